@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // ErrInvalidRegion represents the error
 // returned when the region in user config is invalid.
 type ErrInvalidRegion struct {
@@ -29,3 +31,83 @@ type ErrInvalidSecretAccessKey struct {
 func (ErrInvalidSecretAccessKey) Error() string {
 	return "ErrInvalidSecretAccessKey"
 }
+
+// ErrInvalidSSOStartURL represents the error returned
+// when the AWS SSO start URL in user config is invalid.
+type ErrInvalidSSOStartURL struct {
+	StartURL string
+}
+
+func (ErrInvalidSSOStartURL) Error() string {
+	return "ErrInvalidSSOStartURL"
+}
+
+// ErrInvalidSSORegion represents the error returned
+// when the AWS SSO region in user config is invalid.
+type ErrInvalidSSORegion struct {
+	Region string
+}
+
+func (ErrInvalidSSORegion) Error() string {
+	return "ErrInvalidSSORegion"
+}
+
+// ErrInvalidSSOAccountID represents the error returned
+// when the AWS SSO account ID in user config is invalid.
+type ErrInvalidSSOAccountID struct {
+	AccountID string
+}
+
+func (ErrInvalidSSOAccountID) Error() string {
+	return "ErrInvalidSSOAccountID"
+}
+
+// ErrInvalidRoleARN represents the error returned
+// when the ARN of a role to assume in user config is invalid.
+type ErrInvalidRoleARN struct {
+	Profile string
+	RoleARN string
+}
+
+func (ErrInvalidRoleARN) Error() string {
+	return "ErrInvalidRoleARN"
+}
+
+// ErrInvalidAssumeRoleDuration represents the error returned when
+// the session duration of a role to assume in user config is invalid.
+type ErrInvalidAssumeRoleDuration struct {
+	Profile  string
+	Duration time.Duration
+}
+
+func (ErrInvalidAssumeRoleDuration) Error() string {
+	return "ErrInvalidAssumeRoleDuration"
+}
+
+// ErrInvalidConfigStorageBackend represents the error returned
+// when the config storage backend in user config is unknown.
+type ErrInvalidConfigStorageBackend struct {
+	Backend string
+}
+
+func (ErrInvalidConfigStorageBackend) Error() string {
+	return "ErrInvalidConfigStorageBackend"
+}
+
+// ErrInvalidS3Bucket represents the error returned when the
+// config storage backend is S3 and the bucket name is invalid.
+type ErrInvalidS3Bucket struct {
+	S3Bucket string
+}
+
+func (ErrInvalidS3Bucket) Error() string {
+	return "ErrInvalidS3Bucket"
+}
+
+// ErrMissingConfigStorageFileDirPath represents the error returned
+// when the config storage backend is "file" and no directory is set.
+type ErrMissingConfigStorageFileDirPath struct{}
+
+func (ErrMissingConfigStorageFileDirPath) Error() string {
+	return "ErrMissingConfigStorageFileDirPath"
+}
@@ -2,7 +2,9 @@ package config_test
 
 import (
 	"errors"
+	"reflect"
 	"testing"
+	"time"
 
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/recode-sh/aws-cloud-provider/config"
@@ -59,6 +61,135 @@ func TestLoadWithExistingProfiles(t *testing.T) {
 	}
 }
 
+func TestLoadWithSSOProfile(t *testing.T) {
+	profileLoader := config.NewProfileLoader()
+	loadedProfile, err := profileLoader.Load(
+		"sso",
+		"./testdata/user_credentials",
+		"./testdata/user_config",
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if loadedProfile.Credentials.HasKeys() {
+		t.Fatalf("expected no keys, got '%+v'", loadedProfile.Credentials)
+	}
+
+	if loadedProfile.SSOStartURL != "https://sso.awsapps.com/start" ||
+		loadedProfile.SSORegion != "sso_portal_region" ||
+		loadedProfile.SSOAccountID != "123456789012" ||
+		loadedProfile.SSORoleName != "sso_role_name" ||
+		loadedProfile.Region != "sso_region" {
+
+		t.Fatalf("expected SSO settings to be loaded, got '%+v'", loadedProfile)
+	}
+}
+
+func TestResolveRoleChains(t *testing.T) {
+	testCases := []struct {
+		test                string
+		profile             string
+		expectedAssumeRoles []userconfig.AssumeRole
+		expectedError       error
+	}{
+		{
+			test:    "with role",
+			profile: "sandbox",
+			expectedAssumeRoles: []userconfig.AssumeRole{
+				{
+					Profile:         "sandbox",
+					RoleARN:         "arn:aws:iam::123456789012:role/sandbox",
+					ExternalID:      "sandbox_external_id",
+					RoleSessionName: "recode",
+					Duration:        time.Hour,
+				},
+			},
+		},
+
+		{
+			test:    "with role chain",
+			profile: "sandbox_admin",
+			expectedAssumeRoles: []userconfig.AssumeRole{
+				{
+					Profile:         "sandbox",
+					RoleARN:         "arn:aws:iam::123456789012:role/sandbox",
+					ExternalID:      "sandbox_external_id",
+					RoleSessionName: "recode",
+					Duration:        time.Hour,
+				},
+				{
+					Profile: "sandbox_admin",
+					RoleARN: "arn:aws:iam::123456789012:role/sandbox_admin",
+				},
+			},
+		},
+
+		{
+			test:          "with source profile cycle",
+			profile:       "cycle_a",
+			expectedError: userconfig.ErrSourceProfileCycle{},
+		},
+
+		{
+			test:          "with missing source profile",
+			profile:       "missing_source",
+			expectedError: userconfig.ErrSourceProfileNotFound{},
+		},
+
+		{
+			test:          "with source profile without credentials",
+			profile:       "empty_source",
+			expectedError: userconfig.ErrMissingCredentialsInSourceProfile{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			resolver := userconfig.NewFilesResolver(
+				config.NewProfileLoader(),
+				userconfig.FilesResolverOpts{
+					Profile:             tc.profile,
+					CredentialsFilePath: "./testdata/user_credentials",
+					ConfigFilePath:      "./testdata/user_config",
+				},
+			)
+
+			resolvedConfig, err := resolver.Resolve()
+
+			if tc.expectedError == nil && err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if tc.expectedError != nil &&
+				reflect.TypeOf(err) != reflect.TypeOf(tc.expectedError) {
+
+				t.Fatalf("expected error to equal '%+v', got '%+v'", tc.expectedError, err)
+			}
+
+			if tc.expectedError != nil {
+				return
+			}
+
+			if resolvedConfig.Credentials.AccessKeyID != "production_access_key_id" {
+				t.Fatalf(
+					"expected source credentials to be the production ones, got '%+v'",
+					resolvedConfig.Credentials,
+				)
+			}
+
+			if !reflect.DeepEqual(resolvedConfig.Credentials.AssumeRoles, tc.expectedAssumeRoles) {
+				t.Fatalf(
+					"expected roles to equal '%+v', got '%+v'",
+					tc.expectedAssumeRoles,
+					resolvedConfig.Credentials.AssumeRoles,
+				)
+			}
+		})
+	}
+}
+
 func TestLoadWithInvalidProfile(t *testing.T) {
 	profileLoader := config.NewProfileLoader()
 	_, err := profileLoader.Load(
@@ -84,11 +215,9 @@ func TestLoadWithInvalidConfigFile(t *testing.T) {
 		"./testdata/user_credentials",
 	)
 
-	if !errors.As(err, &awsconfig.SharedConfigLoadError{}) {
-		t.Fatalf(
-			"expected error to equal '%+v', got '%+v'",
-			awsconfig.SharedConfigProfileNotExistError{},
-			err,
-		)
+	// The SDK ignores the lines that it doesn't recognize
+	// so the invalid file sets partial credentials
+	if err == nil || errors.As(err, &awsconfig.SharedConfigProfileNotExistError{}) {
+		t.Fatalf("expected invalid config file error, got '%+v'", err)
 	}
 }
@@ -2,13 +2,30 @@ package config
 
 import (
 	"context"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/processcreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/recode-sh/aws-cloud-provider/userconfig"
 )
 
+const (
+	// CredentialProcessTimeout represents the duration
+	// after which a credential process is killed.
+	CredentialProcessTimeout = time.Minute
+
+	// CredentialProcessExpiryWindow represents the duration before
+	// expiration at which the credentials returned by a credential
+	// process are refreshed (so that they don't expire during a request).
+	CredentialProcessExpiryWindow = 5 * time.Minute
+)
+
 type UserConfigLoader struct{}
 
 func NewUserConfigLoader() UserConfigLoader {
@@ -16,15 +33,112 @@ func NewUserConfigLoader() UserConfigLoader {
 }
 
 func (UserConfigLoader) Load(userConfig *userconfig.Config) (aws.Config, error) {
-	return config.LoadDefaultConfig(
+	awsConfig, err := config.LoadDefaultConfig(
 		context.TODO(),
-		config.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(
-				userConfig.Credentials.AccessKeyID,
-				userConfig.Credentials.SecretAccessKey,
-				userConfig.Credentials.SessionToken,
+		// Replaced below. Prevents the SDK
+		// from resolving its default credentials chain.
+		config.WithCredentialsProvider(aws.AnonymousCredentials{}),
+		config.WithRegion(userConfig.Region),
+	)
+
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	awsConfig.Credentials = newCredentialsProvider(
+		awsConfig,
+		userConfig.Credentials,
+	)
+
+	return awsConfig, nil
+}
+
+// newCredentialsProvider returns a cached credentials provider.
+// The roles are assumed in order, each one with the credentials of
+// the previous one. Their credentials are refreshed when they expire.
+//
+// AWS SSO credentials are refreshed when they expire using the SSO token
+// cached by the AWS CLI (until this token expires too and "aws sso login"
+// needs to be run again).
+//
+// The credential process is run again each time its credentials
+// expire (eg: during long operations like snapshot creation).
+//
+// Static keys (with an optional session token) never
+// expire in the cache given that they cannot be refreshed.
+func newCredentialsProvider(
+	awsConfig aws.Config,
+	creds userconfig.Credentials,
+) aws.CredentialsProvider {
+
+	credsProvider := newSourceCredentialsProvider(awsConfig, creds)
+
+	for _, assumeRole := range creds.AssumeRoles {
+		stsConfig := awsConfig.Copy()
+		stsConfig.Credentials = credsProvider
+
+		credsProvider = aws.NewCredentialsCache(
+			stscreds.NewAssumeRoleProvider(
+				sts.NewFromConfig(stsConfig),
+				assumeRole.RoleARN,
+				func(o *stscreds.AssumeRoleOptions) {
+					o.RoleSessionName = assumeRole.RoleSessionName
+
+					if len(assumeRole.ExternalID) > 0 {
+						o.ExternalID = aws.String(assumeRole.ExternalID)
+					}
+
+					if assumeRole.Duration > 0 {
+						o.Duration = assumeRole.Duration
+					}
+				},
 			),
+		)
+	}
+
+	return credsProvider
+}
+
+func newSourceCredentialsProvider(
+	awsConfig aws.Config,
+	creds userconfig.Credentials,
+) aws.CredentialsProvider {
+
+	if creds.SSO.IsSet() {
+		// The SSO API needs to be called
+		// in the region of the user portal
+		ssoConfig := awsConfig.Copy()
+		ssoConfig.Region = creds.SSO.Region
+
+		return aws.NewCredentialsCache(
+			ssocreds.New(
+				sso.NewFromConfig(ssoConfig),
+				creds.SSO.AccountID,
+				creds.SSO.RoleName,
+				creds.SSO.StartURL,
+			),
+		)
+	}
+
+	if len(creds.CredentialProcess) > 0 {
+		return aws.NewCredentialsCache(
+			processcreds.NewProvider(
+				creds.CredentialProcess,
+				func(o *processcreds.Options) {
+					o.Timeout = CredentialProcessTimeout
+				},
+			),
+			func(o *aws.CredentialsCacheOptions) {
+				o.ExpiryWindow = CredentialProcessExpiryWindow
+			},
+		)
+	}
+
+	return aws.NewCredentialsCache(
+		credentials.NewStaticCredentialsProvider(
+			creds.AccessKeyID,
+			creds.SecretAccessKey,
+			creds.SessionToken,
 		),
-		config.WithRegion(userConfig.Region),
 	)
 }
@@ -2,8 +2,13 @@ package config_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"runtime"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
 	"github.com/recode-sh/aws-cloud-provider/config"
 	"github.com/recode-sh/aws-cloud-provider/userconfig"
 )
@@ -47,4 +52,137 @@ func TestLoader(t *testing.T) {
 			credsInConfig.SecretAccessKey,
 		)
 	}
+
+	if credsInConfig.SessionToken != passedUserConfig.Credentials.SessionToken {
+		t.Errorf(
+			"expected session token to equal '%s', got '%s'",
+			passedUserConfig.Credentials.SessionToken,
+			credsInConfig.SessionToken,
+		)
+	}
+}
+
+func TestLoaderWithSessionToken(t *testing.T) {
+	configLoader := config.NewUserConfigLoader()
+
+	passedUserConfig := userconfig.NewConfig("a", "b", "c")
+	passedUserConfig.Credentials.SessionToken = "d"
+
+	loadedConfig, err := configLoader.Load(passedUserConfig)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	credsInConfig, err := loadedConfig.Credentials.Retrieve(context.TODO())
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if credsInConfig.SessionToken != passedUserConfig.Credentials.SessionToken {
+		t.Errorf(
+			"expected session token to equal '%s', got '%s'",
+			passedUserConfig.Credentials.SessionToken,
+			credsInConfig.SessionToken,
+		)
+	}
+}
+
+func TestLoaderWithSSOCredentials(t *testing.T) {
+	// No SSO token is cached in this directory
+	t.Setenv("HOME", t.TempDir())
+
+	configLoader := config.NewUserConfigLoader()
+
+	passedUserConfig := userconfig.NewConfig("", "", "c")
+	passedUserConfig.Credentials.SSO = userconfig.SSOCredentials{
+		StartURL:  "https://sso.awsapps.com/start",
+		Region:    "us-east-1",
+		AccountID: "123456789012",
+		RoleName:  "role",
+	}
+
+	loadedConfig, err := configLoader.Load(passedUserConfig)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	_, err = loadedConfig.Credentials.Retrieve(context.TODO())
+
+	var invalidTokenErr *ssocreds.InvalidTokenError
+
+	if !errors.As(err, &invalidTokenErr) {
+		t.Fatalf("expected error to equal '%+v', got '%+v'", &ssocreds.InvalidTokenError{}, err)
+	}
+}
+
+func TestLoaderWithCredentialProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential process uses a POSIX shell")
+	}
+
+	testCases := []struct {
+		test               string
+		expiration         time.Time
+		expectProcessRerun bool
+	}{
+		{
+			test:               "with valid credentials",
+			expiration:         time.Now().Add(time.Hour),
+			expectProcessRerun: false,
+		},
+
+		{
+			test:               "with credentials about to expire",
+			expiration:         time.Now().Add(time.Minute),
+			expectProcessRerun: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			configLoader := config.NewUserConfigLoader()
+
+			// The access key changes each time the process is run
+			passedUserConfig := userconfig.NewConfig("", "", "c")
+			passedUserConfig.Credentials.CredentialProcess = fmt.Sprintf(
+				`printf '{"Version": 1, "AccessKeyId": "%%s", "SecretAccessKey": "b", "SessionToken": "c", "Expiration": "%s"}' "$(date +%%s%%N)"`,
+				tc.expiration.UTC().Format(time.RFC3339),
+			)
+
+			loadedConfig, err := configLoader.Load(passedUserConfig)
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			firstCreds, err := loadedConfig.Credentials.Retrieve(context.TODO())
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if firstCreds.SessionToken != "c" || !firstCreds.CanExpire {
+				t.Fatalf("expected expiring credentials with session token, got '%+v'", firstCreds)
+			}
+
+			secondCreds, err := loadedConfig.Credentials.Retrieve(context.TODO())
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			processRerun := firstCreds.AccessKeyID != secondCreds.AccessKeyID
+
+			if processRerun != tc.expectProcessRerun {
+				t.Fatalf(
+					"expected process rerun to equal '%t', got '%t'",
+					tc.expectProcessRerun,
+					processRerun,
+				)
+			}
+		})
+	}
 }
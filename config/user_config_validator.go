@@ -1,7 +1,9 @@
 package config
 
 import (
+	"net/url"
 	"regexp"
+	"time"
 
 	"github.com/recode-sh/aws-cloud-provider/userconfig"
 
@@ -11,6 +13,16 @@ import (
 const (
 	AWSAccessKeyIDPattern     = "^[A-Z0-9]{20}$"
 	AWSSecretAccessKeyPattern = "^[A-Za-z0-9/+=]{40}$"
+	AWSS3BucketPattern        = "^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$"
+	AWSAccountIDPattern       = "^[0-9]{12}$"
+	AWSRoleARNPattern         = "^arn:aws[a-z-]*:iam::[0-9]{12}:role/[A-Za-z0-9_+=,.@/-]+$"
+)
+
+const (
+	// The role session duration must be between 15 minutes and 12 hours.
+	// The maximum could be lower depending on the role settings.
+	AWSAssumeRoleMinDuration = 15 * time.Minute
+	AWSAssumeRoleMaxDuration = 12 * time.Hour
 )
 
 type UserConfigValidator struct{}
@@ -27,14 +39,31 @@ func (u UserConfigValidator) Validate(userConfig *userconfig.Config) error {
 	}
 
 	creds := userConfig.Credentials
-	accessKeyID := creds.AccessKeyID
-	secretAccessKey := creds.SecretAccessKey
 
-	if err := u.validateAccessKeyID(accessKeyID); err != nil {
-		return err
+	if creds.SSO.IsSet() {
+		if err := u.validateSSOCredentials(creds.SSO); err != nil {
+			return err
+		}
+	} else if len(creds.CredentialProcess) == 0 {
+		accessKeyID := creds.AccessKeyID
+		secretAccessKey := creds.SecretAccessKey
+
+		if err := u.validateAccessKeyID(accessKeyID); err != nil {
+			return err
+		}
+
+		if err := u.validateSecretAccessKey(secretAccessKey); err != nil {
+			return err
+		}
+	}
+
+	for _, assumeRole := range creds.AssumeRoles {
+		if err := u.validateAssumeRole(assumeRole); err != nil {
+			return err
+		}
 	}
 
-	if err := u.validateSecretAccessKey(secretAccessKey); err != nil {
+	if err := u.validateConfigStorage(userConfig.ConfigStorage); err != nil {
 		return err
 	}
 
@@ -84,3 +113,100 @@ func (UserConfigValidator) validateSecretAccessKey(secretAccessKey string) error
 
 	return nil
 }
+
+func (UserConfigValidator) validateSSOCredentials(
+	SSOCreds userconfig.SSOCredentials,
+) error {
+
+	startURL, err := url.Parse(SSOCreds.StartURL)
+
+	if err != nil || startURL.Scheme != "https" || len(startURL.Host) == 0 {
+		return ErrInvalidSSOStartURL{
+			StartURL: SSOCreds.StartURL,
+		}
+	}
+
+	if _, err := awsRegions.LookupByCode(SSOCreds.Region); err != nil {
+		return ErrInvalidSSORegion{
+			Region: SSOCreds.Region,
+		}
+	}
+
+	match, err := regexp.MatchString(AWSAccountIDPattern, SSOCreds.AccountID)
+
+	if err != nil {
+		return err
+	}
+
+	if !match {
+		return ErrInvalidSSOAccountID{
+			AccountID: SSOCreds.AccountID,
+		}
+	}
+
+	return nil
+}
+
+func (UserConfigValidator) validateAssumeRole(
+	assumeRole userconfig.AssumeRole,
+) error {
+
+	match, err := regexp.MatchString(AWSRoleARNPattern, assumeRole.RoleARN)
+
+	if err != nil {
+		return err
+	}
+
+	if !match {
+		return ErrInvalidRoleARN{
+			Profile: assumeRole.Profile,
+			RoleARN: assumeRole.RoleARN,
+		}
+	}
+
+	if assumeRole.Duration != 0 &&
+		(assumeRole.Duration < AWSAssumeRoleMinDuration ||
+			assumeRole.Duration > AWSAssumeRoleMaxDuration) {
+
+		return ErrInvalidAssumeRoleDuration{
+			Profile:  assumeRole.Profile,
+			Duration: assumeRole.Duration,
+		}
+	}
+
+	return nil
+}
+
+func (UserConfigValidator) validateConfigStorage(
+	configStorage userconfig.ConfigStorage,
+) error {
+
+	switch configStorage.Backend {
+	case "", userconfig.ConfigStorageBackendDynamoDB:
+		return nil
+	case userconfig.ConfigStorageBackendS3:
+		match, err := regexp.MatchString(AWSS3BucketPattern, configStorage.S3Bucket)
+
+		if err != nil {
+			return err
+		}
+
+		if !match {
+			return ErrInvalidS3Bucket{
+				S3Bucket: configStorage.S3Bucket,
+			}
+		}
+
+		return nil
+	case userconfig.ConfigStorageBackendFile:
+		if len(configStorage.FileDirPath) == 0 {
+			return ErrMissingConfigStorageFileDirPath{}
+		}
+
+		return nil
+	}
+
+	return ErrInvalidConfigStorageBackend{
+		Backend: configStorage.Backend,
+	}
+}
@@ -0,0 +1,45 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+)
+
+// CallerPublicIP is a fake client that returns the public IP
+// address of the caller (see infrastructure.CallerPublicIPClient).
+// The address could be changed with SetIPAddress to simulate
+// a caller that moved to another network.
+type CallerPublicIP struct {
+	faults
+
+	mu        sync.Mutex
+	ipAddress string
+}
+
+// NewCallerPublicIP constructs a fake caller
+// public IP client returning the passed address.
+func NewCallerPublicIP(IPAddress string) *CallerPublicIP {
+	return &CallerPublicIP{
+		ipAddress: IPAddress,
+	}
+}
+
+// SetIPAddress changes the address returned
+// by LookupCallerPublicIPAddress.
+func (c *CallerPublicIP) SetIPAddress(IPAddress string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ipAddress = IPAddress
+}
+
+func (c *CallerPublicIP) LookupCallerPublicIPAddress(ctx context.Context) (string, error) {
+	if err := c.call(ctx, "LookupCallerPublicIPAddress"); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ipAddress, nil
+}
@@ -0,0 +1,800 @@
+package fakes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// DynamoDB is an in-memory implementation of the DynamoDB API
+// (see infrastructure.DynamoDBAPI) used to test the
+// infrastructure queues offline.
+//
+// Tables are "CREATING" when created and "ACTIVE"
+// once observed via a DescribeTable call.
+type DynamoDB struct {
+	faults
+
+	mu sync.Mutex
+
+	// Transitions applied on next observation
+	pendingTransitions []func()
+
+	tables map[string]*fakeTable
+
+	// The maximum number of keys processed by each
+	// BatchGetItem call (0 means all the keys)
+	maxBatchGetItemKeysProcessed int
+}
+
+type fakeTable struct {
+	description types.TableDescription
+	hashKey     string
+	items       map[string]map[string]types.AttributeValue
+}
+
+var _ infrastructure.DynamoDBAPI = (*DynamoDB)(nil)
+
+// NewDynamoDB constructs a fake
+// DynamoDB API without tables.
+func NewDynamoDB() *DynamoDB {
+	return &DynamoDB{
+		tables: map[string]*fakeTable{},
+	}
+}
+
+// TableNames returns the names of the existing tables.
+func (d *DynamoDB) TableNames() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle()
+
+	return sortedKeys(d.tables)
+}
+
+// SetMaxBatchGetItemKeysProcessed limits the number of keys processed
+// by each BatchGetItem call. Like in AWS when the response size limit is
+// reached, the remaining keys are returned in UnprocessedKeys.
+func (d *DynamoDB) SetMaxBatchGetItemKeysProcessed(max int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.maxBatchGetItemKeysProcessed = max
+}
+
+// Items returns a copy of the items
+// stored in the passed table.
+func (d *DynamoDB) Items(tableName string) []map[string]types.AttributeValue {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle()
+
+	table, ok := d.tables[tableName]
+
+	if !ok {
+		return nil
+	}
+
+	return table.sortedItems()
+}
+
+func (d *DynamoDB) CreateTable(
+	ctx context.Context,
+	params *dynamodb.CreateTableInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.CreateTableOutput, error) {
+
+	if err := d.call(ctx, "CreateTable"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle()
+
+	tableName := aws.ToString(params.TableName)
+
+	if _, ok := d.tables[tableName]; ok {
+		return nil, &types.ResourceInUseException{
+			Message: aws.String(fmt.Sprintf("Table already exists: %s", tableName)),
+		}
+	}
+
+	hashKey := ""
+
+	for _, keySchemaElement := range params.KeySchema {
+		if keySchemaElement.KeyType == types.KeyTypeHash {
+			hashKey = aws.ToString(keySchemaElement.AttributeName)
+		}
+	}
+
+	if len(hashKey) == 0 {
+		return nil, validationError("No Hash Key specified in schema.")
+	}
+
+	table := &fakeTable{
+		description: types.TableDescription{
+			TableName:            aws.String(tableName),
+			TableArn:             aws.String("arn:aws:dynamodb:fake:000000000000:table/" + tableName),
+			TableStatus:          types.TableStatusCreating,
+			AttributeDefinitions: append([]types.AttributeDefinition{}, params.AttributeDefinitions...),
+			KeySchema:            append([]types.KeySchemaElement{}, params.KeySchema...),
+			BillingModeSummary: &types.BillingModeSummary{
+				BillingMode: params.BillingMode,
+			},
+			CreationDateTime: aws.Time(time.Now()),
+		},
+		hashKey: hashKey,
+		items:   map[string]map[string]types.AttributeValue{},
+	}
+
+	d.tables[tableName] = table
+
+	d.transitionOnNextObservation(func() {
+		if table.description.TableStatus == types.TableStatusCreating {
+			table.description.TableStatus = types.TableStatusActive
+		}
+	})
+
+	description := table.description
+
+	return &dynamodb.CreateTableOutput{
+		TableDescription: &description,
+	}, nil
+}
+
+func (d *DynamoDB) DeleteTable(
+	ctx context.Context,
+	params *dynamodb.DeleteTableInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.DeleteTableOutput, error) {
+
+	if err := d.call(ctx, "DeleteTable"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle()
+
+	tableName := aws.ToString(params.TableName)
+	table, err := d.lookupTable(tableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if table.description.TableStatus != types.TableStatusActive {
+		return nil, &types.ResourceInUseException{
+			Message: aws.String(fmt.Sprintf(
+				"Attempt to change a resource which is still in use: Table is being %s: %s",
+				table.description.TableStatus,
+				tableName,
+			)),
+		}
+	}
+
+	table.description.TableStatus = types.TableStatusDeleting
+
+	d.transitionOnNextObservation(func() {
+		delete(d.tables, tableName)
+	})
+
+	description := table.description
+
+	return &dynamodb.DeleteTableOutput{
+		TableDescription: &description,
+	}, nil
+}
+
+func (d *DynamoDB) DescribeTable(
+	ctx context.Context,
+	params *dynamodb.DescribeTableInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.DescribeTableOutput, error) {
+
+	if err := d.call(ctx, "DescribeTable"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle()
+
+	table, err := d.lookupTable(aws.ToString(params.TableName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	description := table.description
+	description.ItemCount = aws.Int64(int64(len(table.items)))
+
+	return &dynamodb.DescribeTableOutput{
+		Table: &description,
+	}, nil
+}
+
+func (d *DynamoDB) PutItem(
+	ctx context.Context,
+	params *dynamodb.PutItemInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.PutItemOutput, error) {
+
+	if err := d.call(ctx, "PutItem"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle()
+
+	table, err := d.lookupActiveTable(aws.ToString(params.TableName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := table.itemKey(params.Item)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkItemCondition(
+		table.items[key],
+		params.ConditionExpression,
+		params.ExpressionAttributeNames,
+		params.ExpressionAttributeValues,
+	); err != nil {
+		return nil, err
+	}
+
+	item := map[string]types.AttributeValue{}
+
+	for attributeName, attributeValue := range params.Item {
+		item[attributeName] = attributeValue
+	}
+
+	table.items[key] = item
+
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (d *DynamoDB) Scan(
+	ctx context.Context,
+	params *dynamodb.ScanInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.ScanOutput, error) {
+
+	if err := d.call(ctx, "Scan"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle()
+
+	table, err := d.lookupActiveTable(aws.ToString(params.TableName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	scannedItems := table.sortedItems()
+	attributes := newExpressionAttributes(
+		params.ExpressionAttributeNames,
+		params.ExpressionAttributeValues,
+	)
+
+	items := []map[string]types.AttributeValue{}
+
+	for _, item := range scannedItems {
+		match := true
+
+		if params.FilterExpression != nil {
+			match, err = evaluateCondition(
+				aws.ToString(params.FilterExpression),
+				attributes,
+				item,
+			)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if match {
+			items = append(items, item)
+		}
+	}
+
+	// Like in AWS, the filter expression
+	// is validated even if the table is empty
+	if params.FilterExpression != nil && len(scannedItems) == 0 {
+		_, err := evaluateCondition(
+			aws.ToString(params.FilterExpression),
+			attributes,
+			map[string]types.AttributeValue{},
+		)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := attributes.checkUnused(); err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.ScanOutput{
+		Items:        items,
+		Count:        int32(len(items)),
+		ScannedCount: int32(len(scannedItems)),
+	}, nil
+}
+
+func (d *DynamoDB) GetItem(
+	ctx context.Context,
+	params *dynamodb.GetItemInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.GetItemOutput, error) {
+
+	if err := d.call(ctx, "GetItem"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle()
+
+	table, err := d.lookupActiveTable(aws.ToString(params.TableName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := table.itemKey(params.Key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	existingItem, ok := table.items[key]
+
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+
+	item := map[string]types.AttributeValue{}
+
+	for attributeName, attributeValue := range existingItem {
+		item[attributeName] = attributeValue
+	}
+
+	return &dynamodb.GetItemOutput{
+		Item: item,
+	}, nil
+}
+
+// BatchGetItem returns the items matching the passed keys. Like in AWS,
+// at most 100 keys could be passed, duplicate keys are rejected and
+// the missing items are not returned.
+func (d *DynamoDB) BatchGetItem(
+	ctx context.Context,
+	params *dynamodb.BatchGetItemInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.BatchGetItemOutput, error) {
+
+	if err := d.call(ctx, "BatchGetItem"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle()
+
+	keysCount := 0
+
+	for _, keysAndAttributes := range params.RequestItems {
+		keysCount += len(keysAndAttributes.Keys)
+	}
+
+	if keysCount == 0 || keysCount > 100 {
+		return nil, validationError(
+			"Too many items requested for the BatchGetItem call",
+		)
+	}
+
+	responses := map[string][]map[string]types.AttributeValue{}
+	unprocessedKeys := map[string]types.KeysAndAttributes{}
+	keysProcessed := 0
+
+	for _, tableName := range sortedKeys(params.RequestItems) {
+		keysAndAttributes := params.RequestItems[tableName]
+		table, err := d.lookupActiveTable(tableName)
+
+		if err != nil {
+			return nil, err
+		}
+
+		seenKeys := map[string]bool{}
+
+		for _, itemKey := range keysAndAttributes.Keys {
+			key, err := table.itemKey(itemKey)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if seenKeys[key] {
+				return nil, validationError("Provided list of item keys contains duplicates")
+			}
+
+			seenKeys[key] = true
+
+			if d.maxBatchGetItemKeysProcessed > 0 &&
+				keysProcessed >= d.maxBatchGetItemKeysProcessed {
+
+				unprocessed := unprocessedKeys[tableName]
+				unprocessed.Keys = append(unprocessed.Keys, itemKey)
+				unprocessed.ConsistentRead = keysAndAttributes.ConsistentRead
+				unprocessedKeys[tableName] = unprocessed
+
+				continue
+			}
+
+			keysProcessed++
+			existingItem, ok := table.items[key]
+
+			if !ok {
+				continue
+			}
+
+			item := map[string]types.AttributeValue{}
+
+			for attributeName, attributeValue := range existingItem {
+				item[attributeName] = attributeValue
+			}
+
+			responses[tableName] = append(responses[tableName], item)
+		}
+	}
+
+	return &dynamodb.BatchGetItemOutput{
+		Responses:       responses,
+		UnprocessedKeys: unprocessedKeys,
+	}, nil
+}
+
+func (d *DynamoDB) DeleteItem(
+	ctx context.Context,
+	params *dynamodb.DeleteItemInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.DeleteItemOutput, error) {
+
+	if err := d.call(ctx, "DeleteItem"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle()
+
+	table, err := d.lookupActiveTable(aws.ToString(params.TableName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := table.itemKey(params.Key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkItemCondition(
+		table.items[key],
+		params.ConditionExpression,
+		params.ExpressionAttributeNames,
+		params.ExpressionAttributeValues,
+	); err != nil {
+		return nil, err
+	}
+
+	delete(table.items, key)
+
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// TransactWriteItems applies the passed Put, Delete and ConditionCheck
+// actions atomically. Like in AWS, the transaction is cancelled if
+// any condition fails and the reasons are returned in order.
+func (d *DynamoDB) TransactWriteItems(
+	ctx context.Context,
+	params *dynamodb.TransactWriteItemsInput,
+	optFns ...func(*dynamodb.Options),
+) (*dynamodb.TransactWriteItemsOutput, error) {
+
+	if err := d.call(ctx, "TransactWriteItems"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settle()
+
+	if len(params.TransactItems) == 0 || len(params.TransactItems) > 25 {
+		return nil, validationError(
+			"Member must have length less than or equal to 25 and greater than or equal to 1",
+		)
+	}
+
+	type transactAction struct {
+		table *fakeTable
+		key   string
+		// nil for deletes and condition checks
+		item   map[string]types.AttributeValue
+		delete bool
+	}
+
+	actions := []transactAction{}
+	seenKeys := map[string]bool{}
+	cancellationReasons := []types.CancellationReason{}
+	cancelled := false
+
+	for _, transactItem := range params.TransactItems {
+		var (
+			tableName           *string
+			keyOrItem           map[string]types.AttributeValue
+			conditionExpression *string
+			names               map[string]string
+			values              map[string]types.AttributeValue
+			action              transactAction
+		)
+
+		switch {
+		case transactItem.Put != nil:
+			tableName = transactItem.Put.TableName
+			keyOrItem = transactItem.Put.Item
+			conditionExpression = transactItem.Put.ConditionExpression
+			names = transactItem.Put.ExpressionAttributeNames
+			values = transactItem.Put.ExpressionAttributeValues
+			action.item = keyOrItem
+		case transactItem.Delete != nil:
+			tableName = transactItem.Delete.TableName
+			keyOrItem = transactItem.Delete.Key
+			conditionExpression = transactItem.Delete.ConditionExpression
+			names = transactItem.Delete.ExpressionAttributeNames
+			values = transactItem.Delete.ExpressionAttributeValues
+			action.delete = true
+		case transactItem.ConditionCheck != nil:
+			tableName = transactItem.ConditionCheck.TableName
+			keyOrItem = transactItem.ConditionCheck.Key
+			conditionExpression = transactItem.ConditionCheck.ConditionExpression
+			names = transactItem.ConditionCheck.ExpressionAttributeNames
+			values = transactItem.ConditionCheck.ExpressionAttributeValues
+		default:
+			return nil, validationError("Only Put, Delete and ConditionCheck are supported by the fake")
+		}
+
+		table, err := d.lookupActiveTable(aws.ToString(tableName))
+
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := table.itemKey(keyOrItem)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if seenKeys[aws.ToString(tableName)+"/"+key] {
+			return nil, validationError(
+				"Transaction request cannot include multiple operations on one item",
+			)
+		}
+
+		seenKeys[aws.ToString(tableName)+"/"+key] = true
+
+		action.table = table
+		action.key = key
+		actions = append(actions, action)
+
+		err = checkItemCondition(
+			table.items[key],
+			conditionExpression,
+			names,
+			values,
+		)
+
+		var conditionalCheckFailedErr *types.ConditionalCheckFailedException
+
+		if err != nil && !errors.As(err, &conditionalCheckFailedErr) {
+			return nil, err
+		}
+
+		if err != nil {
+			cancelled = true
+			cancellationReasons = append(cancellationReasons, types.CancellationReason{
+				Code:    aws.String("ConditionalCheckFailed"),
+				Message: aws.String("The conditional request failed"),
+			})
+			continue
+		}
+
+		cancellationReasons = append(cancellationReasons, types.CancellationReason{
+			Code: aws.String("None"),
+		})
+	}
+
+	if cancelled {
+		return nil, &types.TransactionCanceledException{
+			Message:             aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons"),
+			CancellationReasons: cancellationReasons,
+		}
+	}
+
+	for _, action := range actions {
+		if action.delete {
+			delete(action.table.items, action.key)
+			continue
+		}
+
+		if action.item == nil { // Condition check
+			continue
+		}
+
+		item := map[string]types.AttributeValue{}
+
+		for attributeName, attributeValue := range action.item {
+			item[attributeName] = attributeValue
+		}
+
+		action.table.items[action.key] = item
+	}
+
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+// Must be called with the lock held.
+func (d *DynamoDB) lookupTable(tableName string) (*fakeTable, error) {
+	table, ok := d.tables[tableName]
+
+	if !ok {
+		return nil, &types.ResourceNotFoundException{
+			Message: aws.String(fmt.Sprintf("Requested resource not found: Table: %s not found", tableName)),
+		}
+	}
+
+	return table, nil
+}
+
+// Like in AWS, items could only be read or
+// written once the table is "ACTIVE".
+// Must be called with the lock held.
+func (d *DynamoDB) lookupActiveTable(tableName string) (*fakeTable, error) {
+	table, err := d.lookupTable(tableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if table.description.TableStatus == types.TableStatusCreating {
+		return nil, &types.ResourceNotFoundException{
+			Message: aws.String("Requested resource not found"),
+		}
+	}
+
+	return table, nil
+}
+
+// settle applies the pending state transitions.
+// Must be called with the lock held.
+func (d *DynamoDB) settle() {
+	transitions := d.pendingTransitions
+	d.pendingTransitions = nil
+
+	for _, transition := range transitions {
+		transition()
+	}
+}
+
+// Must be called with the lock held.
+func (d *DynamoDB) transitionOnNextObservation(transition func()) {
+	d.pendingTransitions = append(d.pendingTransitions, transition)
+}
+
+func (t *fakeTable) itemKey(item map[string]types.AttributeValue) (string, error) {
+	switch keyValue := item[t.hashKey].(type) {
+	case *types.AttributeValueMemberS:
+		return "S:" + keyValue.Value, nil
+	case *types.AttributeValueMemberN:
+		return "N:" + keyValue.Value, nil
+	}
+
+	return "", validationError(
+		"One of the required keys was not given a value: " + t.hashKey,
+	)
+}
+
+func (t *fakeTable) sortedItems() []map[string]types.AttributeValue {
+	items := []map[string]types.AttributeValue{}
+
+	for _, key := range sortedKeys(t.items) {
+		item := map[string]types.AttributeValue{}
+
+		for attributeName, attributeValue := range t.items[key] {
+			item[attributeName] = attributeValue
+		}
+
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// checkItemCondition returns a ConditionalCheckFailedException
+// if the condition is not met by the existing item (nil if none).
+func checkItemCondition(
+	existingItem map[string]types.AttributeValue,
+	conditionExpression *string,
+	names map[string]string,
+	values map[string]types.AttributeValue,
+) error {
+
+	attributes := newExpressionAttributes(names, values)
+	conditionMet := true
+
+	if conditionExpression != nil {
+		if existingItem == nil {
+			existingItem = map[string]types.AttributeValue{}
+		}
+
+		var err error
+		conditionMet, err = evaluateCondition(
+			aws.ToString(conditionExpression),
+			attributes,
+			existingItem,
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := attributes.checkUnused(); err != nil {
+		return err
+	}
+
+	if !conditionMet {
+		return &types.ConditionalCheckFailedException{
+			Message: aws.String("The conditional request failed"),
+		}
+	}
+
+	return nil
+}
+
+func validationError(message string) error {
+	return apiError("ValidationException", "%s", message)
+}
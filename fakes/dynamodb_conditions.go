@@ -0,0 +1,507 @@
+package fakes
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// expressionAttributes resolves the placeholders
+// (eg: "#name", ":value") used in DynamoDB expressions.
+//
+// Like in AWS, placeholders that are passed
+// but not used in any expression are rejected.
+type expressionAttributes struct {
+	names  map[string]string
+	values map[string]types.AttributeValue
+
+	usedNames  map[string]bool
+	usedValues map[string]bool
+}
+
+func newExpressionAttributes(
+	names map[string]string,
+	values map[string]types.AttributeValue,
+) *expressionAttributes {
+
+	return &expressionAttributes{
+		names:      names,
+		values:     values,
+		usedNames:  map[string]bool{},
+		usedValues: map[string]bool{},
+	}
+}
+
+func (e *expressionAttributes) resolveName(name string) (string, error) {
+	if !strings.HasPrefix(name, "#") {
+		return name, nil
+	}
+
+	resolvedName, ok := e.names[name]
+
+	if !ok {
+		return "", validationError(
+			"Invalid ConditionExpression: An expression attribute name used in the document path is not defined; attribute name: " + name,
+		)
+	}
+
+	e.usedNames[name] = true
+
+	return resolvedName, nil
+}
+
+func (e *expressionAttributes) resolveValue(value string) (types.AttributeValue, error) {
+	resolvedValue, ok := e.values[value]
+
+	if !ok {
+		return nil, validationError(
+			"Invalid ConditionExpression: An expression attribute value used in expression is not defined; attribute value: " + value,
+		)
+	}
+
+	e.usedValues[value] = true
+
+	return resolvedValue, nil
+}
+
+func (e *expressionAttributes) checkUnused() error {
+	unusedNames := []string{}
+
+	for name := range e.names {
+		if !e.usedNames[name] {
+			unusedNames = append(unusedNames, name)
+		}
+	}
+
+	if len(unusedNames) > 0 {
+		sort.Strings(unusedNames)
+
+		return validationError(
+			"Value provided in ExpressionAttributeNames unused in expressions: keys: {" +
+				strings.Join(unusedNames, ", ") + "}",
+		)
+	}
+
+	unusedValues := []string{}
+
+	for value := range e.values {
+		if !e.usedValues[value] {
+			unusedValues = append(unusedValues, value)
+		}
+	}
+
+	if len(unusedValues) > 0 {
+		sort.Strings(unusedValues)
+
+		return validationError(
+			"Value provided in ExpressionAttributeValues unused in expressions: keys: {" +
+				strings.Join(unusedValues, ", ") + "}",
+		)
+	}
+
+	return nil
+}
+
+// evaluateCondition evaluates a condition expression against
+// the passed item (empty if the item doesn't exist).
+//
+// Supported grammar (a subset of the DynamoDB one):
+//
+//	condition  := or
+//	or         := and ("OR" and)*
+//	and        := not ("AND" not)*
+//	not        := "NOT" not | primary
+//	primary    := "(" condition ")" | function | operand comparator operand
+//	function   := ("attribute_exists" | "attribute_not_exists") "(" path ")"
+//	comparator := "=" | "<>" | "<" | "<=" | ">" | ">="
+func evaluateCondition(
+	expression string,
+	attributes *expressionAttributes,
+	item map[string]types.AttributeValue,
+) (bool, error) {
+
+	tokens, err := tokenizeExpression(expression)
+
+	if err != nil {
+		return false, err
+	}
+
+	parser := &conditionParser{
+		tokens:     tokens,
+		attributes: attributes,
+		item:       item,
+	}
+
+	result, err := parser.parseOr()
+
+	if err != nil {
+		return false, err
+	}
+
+	if parser.position != len(parser.tokens) {
+		return false, invalidConditionError(
+			"Syntax error; token: \"%s\"",
+			parser.tokens[parser.position],
+		)
+	}
+
+	return result, nil
+}
+
+type conditionParser struct {
+	tokens     []string
+	position   int
+	attributes *expressionAttributes
+	item       map[string]types.AttributeValue
+}
+
+func (p *conditionParser) peek() string {
+	if p.position >= len(p.tokens) {
+		return ""
+	}
+
+	return p.tokens[p.position]
+}
+
+func (p *conditionParser) next() string {
+	token := p.peek()
+	p.position++
+
+	return token
+}
+
+func (p *conditionParser) expect(expectedToken string) error {
+	if token := p.next(); token != expectedToken {
+		return invalidConditionError(
+			"Syntax error; expected \"%s\", got \"%s\"",
+			expectedToken,
+			token,
+		)
+	}
+
+	return nil
+}
+
+func (p *conditionParser) parseOr() (bool, error) {
+	result, err := p.parseAnd()
+
+	if err != nil {
+		return false, err
+	}
+
+	for strings.EqualFold(p.peek(), "OR") {
+		p.next()
+
+		// Both sides are parsed to resolve
+		// all the placeholders
+		otherResult, err := p.parseAnd()
+
+		if err != nil {
+			return false, err
+		}
+
+		result = result || otherResult
+	}
+
+	return result, nil
+}
+
+func (p *conditionParser) parseAnd() (bool, error) {
+	result, err := p.parseNot()
+
+	if err != nil {
+		return false, err
+	}
+
+	for strings.EqualFold(p.peek(), "AND") {
+		p.next()
+
+		otherResult, err := p.parseNot()
+
+		if err != nil {
+			return false, err
+		}
+
+		result = result && otherResult
+	}
+
+	return result, nil
+}
+
+func (p *conditionParser) parseNot() (bool, error) {
+	if strings.EqualFold(p.peek(), "NOT") {
+		p.next()
+
+		result, err := p.parseNot()
+		return !result, err
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() (bool, error) {
+	token := p.peek()
+
+	if token == "(" {
+		p.next()
+
+		result, err := p.parseOr()
+
+		if err != nil {
+			return false, err
+		}
+
+		return result, p.expect(")")
+	}
+
+	if token == "attribute_exists" || token == "attribute_not_exists" {
+		p.next()
+
+		if err := p.expect("("); err != nil {
+			return false, err
+		}
+
+		attributeName, err := p.attributes.resolveName(p.next())
+
+		if err != nil {
+			return false, err
+		}
+
+		if err := p.expect(")"); err != nil {
+			return false, err
+		}
+
+		_, exists := p.item[attributeName]
+
+		return exists == (token == "attribute_exists"), nil
+	}
+
+	if token == "begins_with" {
+		p.next()
+
+		if err := p.expect("("); err != nil {
+			return false, err
+		}
+
+		operand, err := p.parseOperand()
+
+		if err != nil {
+			return false, err
+		}
+
+		if err := p.expect(","); err != nil {
+			return false, err
+		}
+
+		prefix, err := p.parseOperand()
+
+		if err != nil {
+			return false, err
+		}
+
+		if err := p.expect(")"); err != nil {
+			return false, err
+		}
+
+		stringOperand, ok := operand.(*types.AttributeValueMemberS)
+		stringPrefix, prefixOk := prefix.(*types.AttributeValueMemberS)
+
+		if !prefixOk {
+			return false, invalidConditionError("Incorrect operand type for operator or function; operator or function: begins_with")
+		}
+
+		return ok && strings.HasPrefix(stringOperand.Value, stringPrefix.Value), nil
+	}
+
+	leftOperand, err := p.parseOperand()
+
+	if err != nil {
+		return false, err
+	}
+
+	comparator := p.next()
+
+	if !containsString([]string{"=", "<>", "<", "<=", ">", ">="}, comparator) {
+		return false, invalidConditionError(
+			"Syntax error; unexpected comparator \"%s\"",
+			comparator,
+		)
+	}
+
+	rightOperand, err := p.parseOperand()
+
+	if err != nil {
+		return false, err
+	}
+
+	return compareAttributeValues(leftOperand, comparator, rightOperand)
+}
+
+// parseOperand returns nil if the operand
+// is an attribute that doesn't exist.
+func (p *conditionParser) parseOperand() (types.AttributeValue, error) {
+	token := p.next()
+
+	if len(token) == 0 || token == "(" || token == ")" {
+		return nil, invalidConditionError(
+			"Syntax error; unexpected token \"%s\"",
+			token,
+		)
+	}
+
+	if strings.HasPrefix(token, ":") {
+		return p.attributes.resolveValue(token)
+	}
+
+	attributeName, err := p.attributes.resolveName(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p.item[attributeName], nil
+}
+
+func compareAttributeValues(
+	left types.AttributeValue,
+	comparator string,
+	right types.AttributeValue,
+) (bool, error) {
+
+	// Like in AWS, comparisons with
+	// missing attributes are false
+	if left == nil || right == nil {
+		return false, nil
+	}
+
+	var comparison int
+
+	switch leftValue := left.(type) {
+	case *types.AttributeValueMemberS:
+		rightValue, ok := right.(*types.AttributeValueMemberS)
+
+		if !ok {
+			return false, nil
+		}
+
+		comparison = strings.Compare(leftValue.Value, rightValue.Value)
+	case *types.AttributeValueMemberN:
+		rightValue, ok := right.(*types.AttributeValueMemberN)
+
+		if !ok {
+			return false, nil
+		}
+
+		leftNumber, err := strconv.ParseFloat(leftValue.Value, 64)
+
+		if err != nil {
+			return false, err
+		}
+
+		rightNumber, err := strconv.ParseFloat(rightValue.Value, 64)
+
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case leftNumber < rightNumber:
+			comparison = -1
+		case leftNumber > rightNumber:
+			comparison = 1
+		}
+	case *types.AttributeValueMemberBOOL:
+		rightValue, ok := right.(*types.AttributeValueMemberBOOL)
+
+		if !ok {
+			return false, nil
+		}
+
+		if comparator != "=" && comparator != "<>" {
+			return false, invalidConditionError(
+				"Incorrect operand type for operator or function; operator: %s, operand type: BOOL",
+				comparator,
+			)
+		}
+
+		if leftValue.Value != rightValue.Value {
+			comparison = 1
+		}
+	default:
+		return false, invalidConditionError(
+			"Unsupported operand type %T",
+			left,
+		)
+	}
+
+	switch comparator {
+	case "=":
+		return comparison == 0, nil
+	case "<>":
+		return comparison != 0, nil
+	case "<":
+		return comparison < 0, nil
+	case "<=":
+		return comparison <= 0, nil
+	case ">":
+		return comparison > 0, nil
+	}
+
+	return comparison >= 0, nil
+}
+
+func tokenizeExpression(expression string) ([]string, error) {
+	tokens := []string{}
+	runes := []rune(expression)
+
+	isIdentifierRune := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) ||
+			r == '_' || r == '#' || r == ':' || r == '.' || r == '-'
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == ',' || r == '=':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '<' || r == '>':
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '<' && runes[i+1] == '>')) {
+				tokens = append(tokens, string(runes[i:i+2]))
+				i += 2
+				continue
+			}
+
+			tokens = append(tokens, string(r))
+			i++
+		case isIdentifierRune(r):
+			start := i
+
+			for i < len(runes) && isIdentifierRune(runes[i]) {
+				i++
+			}
+
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			return nil, invalidConditionError(
+				"Syntax error; unexpected character \"%c\"",
+				r,
+			)
+		}
+	}
+
+	return tokens, nil
+}
+
+func invalidConditionError(format string, args ...interface{}) error {
+	return validationError(
+		"Invalid ConditionExpression: " + fmt.Sprintf(format, args...),
+	)
+}
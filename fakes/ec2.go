@@ -0,0 +1,587 @@
+package fakes
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// EC2InstanceTypeCatalogEntry represents
+// an instance type known by the fake EC2 API.
+type EC2InstanceTypeCatalogEntry struct {
+	Type         string
+	Archs        []types.ArchitectureType
+	UsageClasses []types.UsageClassType
+	RootDevices  []types.RootDeviceType
+
+	// AvailabilityZones lists the suffixes of the availability
+	// zones (eg: "a") where the instance type is offered.
+	// Offered in all the availability zones if empty.
+	AvailabilityZones []string
+}
+
+// EC2 is an in-memory implementation of the EC2 API
+// (see infrastructure.EC2API) used to test the
+// infrastructure queues offline.
+//
+// Resources follow the same state transitions as in AWS
+// (eg: an instance is "pending" when created and "running"
+// once observed via a Describe* call) and
+// return the same error codes.
+type EC2 struct {
+	faults
+
+	mu sync.Mutex
+
+	region            string
+	availabilityZones []string
+
+	lastID          int
+	lastPublicIP    int
+	lastIPv6Block   int
+	lastIPv6Address int
+
+	// Transitions applied on next observation
+	pendingTransitions []func()
+
+	vpcs              map[string]*fakeVPC
+	subnets           map[string]*types.Subnet
+	internetGateways  map[string]*types.InternetGateway
+	routeTables       map[string]*types.RouteTable
+	securityGroups    map[string]*types.SecurityGroup
+	keyPairs          map[string]*fakeKeyPair
+	networkInterfaces map[string]*types.NetworkInterface
+	instances         map[string]*fakeInstance
+	volumes           map[string]*fakeVolume
+	snapshots         map[string]*types.Snapshot
+	vpcEndpoints      map[string]*types.VpcEndpoint
+	addresses         map[string]*fakeAddress
+
+	spotInstanceRequests    map[string]*types.SpotInstanceRequest
+	spotCapacityUnavailable bool
+
+	instanceTypes map[string]EC2InstanceTypeCatalogEntry
+	images        []types.Image
+}
+
+type fakeVPC struct {
+	vpc                types.Vpc
+	enableDNSSupport   bool
+	enableDNSHostnames bool
+}
+
+type fakeKeyPair struct {
+	keyPair    types.KeyPairInfo
+	PEMContent string
+}
+
+type fakeInstance struct {
+	instance           types.Instance
+	networkInterfaceID string
+}
+
+type fakeVolume struct {
+	volume              types.Volume
+	deleteOnTermination bool
+}
+
+var _ infrastructure.EC2API = (*EC2)(nil)
+
+// NewEC2 constructs an empty fake EC2 API
+// for the passed region.
+//
+// The region has three availability zones (a, b and c)
+// and the instance types and Ubuntu AMIs
+// returned by DefaultEC2InstanceTypes and DefaultEC2Images.
+func NewEC2(region string) *EC2 {
+	e := &EC2{
+		region: region,
+		availabilityZones: []string{
+			region + "a",
+			region + "b",
+			region + "c",
+		},
+
+		vpcs:              map[string]*fakeVPC{},
+		subnets:           map[string]*types.Subnet{},
+		internetGateways:  map[string]*types.InternetGateway{},
+		routeTables:       map[string]*types.RouteTable{},
+		securityGroups:    map[string]*types.SecurityGroup{},
+		keyPairs:          map[string]*fakeKeyPair{},
+		networkInterfaces: map[string]*types.NetworkInterface{},
+		instances:         map[string]*fakeInstance{},
+		volumes:           map[string]*fakeVolume{},
+		snapshots:         map[string]*types.Snapshot{},
+		vpcEndpoints:      map[string]*types.VpcEndpoint{},
+		addresses:         map[string]*fakeAddress{},
+
+		spotInstanceRequests: map[string]*types.SpotInstanceRequest{},
+
+		instanceTypes: map[string]EC2InstanceTypeCatalogEntry{},
+		images:        DefaultEC2Images(),
+	}
+
+	for _, instanceType := range DefaultEC2InstanceTypes() {
+		e.instanceTypes[instanceType.Type] = instanceType
+	}
+
+	return e
+}
+
+// DefaultEC2InstanceTypes returns the instance types
+// known by the fake EC2 API by default.
+func DefaultEC2InstanceTypes() []EC2InstanceTypeCatalogEntry {
+	onDemandAndSpot := []types.UsageClassType{
+		types.UsageClassTypeOnDemand,
+		types.UsageClassTypeSpot,
+	}
+
+	EBS := []types.RootDeviceType{
+		types.RootDeviceTypeEbs,
+	}
+
+	return []EC2InstanceTypeCatalogEntry{
+		{
+			Type:         "t2.medium",
+			Archs:        []types.ArchitectureType{types.ArchitectureTypeI386, types.ArchitectureTypeX8664},
+			UsageClasses: onDemandAndSpot,
+			RootDevices:  EBS,
+		},
+
+		{
+			Type:              "m6g.large",
+			Archs:             []types.ArchitectureType{types.ArchitectureTypeArm64},
+			UsageClasses:      onDemandAndSpot,
+			RootDevices:       EBS,
+			AvailabilityZones: []string{"b", "c"},
+		},
+
+		// High memory instances are not offered as spot
+		{
+			Type:         "u-6tb1.56xlarge",
+			Archs:        []types.ArchitectureType{types.ArchitectureTypeX8664},
+			UsageClasses: []types.UsageClassType{types.UsageClassTypeOnDemand},
+			RootDevices:  EBS,
+		},
+
+		{
+			Type:         "mac1.metal",
+			Archs:        []types.ArchitectureType{types.ArchitectureTypeX8664Mac},
+			UsageClasses: []types.UsageClassType{types.UsageClassTypeOnDemand},
+			RootDevices:  EBS,
+		},
+	}
+}
+
+// DefaultEC2Images returns the AMIs
+// known by the fake EC2 API by default.
+func DefaultEC2Images() []types.Image {
+	images := []types.Image{}
+
+	for _, arch := range []types.ArchitectureValues{
+		types.ArchitectureValuesX8664,
+		types.ArchitectureValuesArm64,
+	} {
+
+		namedArch := "amd64"
+
+		if arch == types.ArchitectureValuesArm64 {
+			namedArch = "arm64"
+		}
+
+		for i, creationDate := range []string{
+			"2022-04-20T10:00:00.000Z",
+			"2022-06-01T10:00:00.000Z",
+		} {
+
+			images = append(images, types.Image{
+				ImageId:            aws.String(fmt.Sprintf("ami-%017x", len(images)+1)),
+				Name:               aws.String(fmt.Sprintf("ubuntu/images/hvm-ssd/ubuntu-jammy-22.04-%s-server-2022060%d", namedArch, i)),
+				Architecture:       arch,
+				CreationDate:       aws.String(creationDate),
+				OwnerId:            aws.String("099720109477"),
+				RootDeviceName:     aws.String("/dev/sda1"),
+				RootDeviceType:     types.DeviceTypeEbs,
+				VirtualizationType: types.VirtualizationTypeHvm,
+				State:              types.ImageStateAvailable,
+			})
+		}
+	}
+
+	return images
+}
+
+// Region returns the region of the fake EC2 API.
+func (e *EC2) Region() string {
+	return e.region
+}
+
+// AvailabilityZones returns the availability
+// zones of the fake EC2 API.
+func (e *EC2) AvailabilityZones() []string {
+	return append([]string{}, e.availabilityZones...)
+}
+
+// ResourceCounts returns the number of existing
+// (ie: not removed nor terminated) resources by kind
+// (eg: "vpc", "instance", "volume"...).
+//
+// Used in tests to assert that no resource was leaked.
+func (e *EC2) ResourceCounts() map[string]int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	existingInstances := 0
+
+	for _, instance := range e.instances {
+		if instance.instance.State.Name != types.InstanceStateNameTerminated {
+			existingInstances++
+		}
+	}
+
+	// The cancelled requests are kept like in AWS
+	activeSpotInstanceRequests := 0
+
+	for _, spotInstanceRequest := range e.spotInstanceRequests {
+		if spotInstanceRequest.State != types.SpotInstanceStateCancelled {
+			activeSpotInstanceRequests++
+		}
+	}
+
+	return map[string]int{
+		"vpc":               len(e.vpcs),
+		"subnet":            len(e.subnets),
+		"internet-gateway":  len(e.internetGateways),
+		"route-table":       len(e.routeTables),
+		"security-group":    len(e.securityGroups),
+		"key-pair":          len(e.keyPairs),
+		"network-interface": len(e.networkInterfaces),
+		"instance":          existingInstances,
+		"volume":            len(e.volumes),
+		"snapshot":          len(e.snapshots),
+		"vpc-endpoint":      len(e.vpcEndpoints),
+		"elastic-ip":        len(e.addresses),
+
+		"spot-instance-request": activeSpotInstanceRequests,
+	}
+}
+
+// settle applies the pending state transitions.
+// Must be called with the lock held.
+func (e *EC2) settle() {
+	transitions := e.pendingTransitions
+	e.pendingTransitions = nil
+
+	for _, transition := range transitions {
+		transition()
+	}
+}
+
+// transitionOnNextObservation registers a state transition
+// that will be applied on the next Describe* call.
+// Must be called with the lock held.
+func (e *EC2) transitionOnNextObservation(transition func()) {
+	e.pendingTransitions = append(e.pendingTransitions, transition)
+}
+
+// Must be called with the lock held.
+func (e *EC2) newID(prefix string) string {
+	e.lastID++
+	return fmt.Sprintf("%s-%017x", prefix, e.lastID)
+}
+
+// Must be called with the lock held.
+func (e *EC2) newPublicIP() (string, string) {
+	e.lastPublicIP++
+
+	// TEST-NET-3 addresses
+	IP := fmt.Sprintf("203.0.113.%d", 1+(e.lastPublicIP-1)%254)
+	hostname := fmt.Sprintf(
+		"ec2-%s.%s.compute.amazonaws.com",
+		strings.ReplaceAll(IP, ".", "-"),
+		e.region,
+	)
+
+	return IP, hostname
+}
+
+// newIPv6CIDRBlock returns the /56 block
+// provided by Amazon to a new VPC.
+// Must be called with the lock held.
+func (e *EC2) newIPv6CIDRBlock() string {
+	e.lastIPv6Block++
+
+	// IPv6 documentation prefix
+	return fmt.Sprintf("2001:db8:0:%x00::/56", 1+(e.lastIPv6Block-1)%255)
+}
+
+// newIPv6Address returns an address of the
+// passed subnet block ("" if invalid).
+// Must be called with the lock held.
+func (e *EC2) newIPv6Address(subnetIPv6CIDRBlock string) string {
+	_, subnetNet, err := net.ParseCIDR(subnetIPv6CIDRBlock)
+
+	if err != nil {
+		return ""
+	}
+
+	e.lastIPv6Address++
+
+	IP := append(net.IP{}, subnetNet.IP...)
+	IP[14] = byte(e.lastIPv6Address >> 8)
+	IP[15] = byte(e.lastIPv6Address)
+
+	return IP.String()
+}
+
+func (e *EC2) isKnownAvailabilityZone(availabilityZone string) bool {
+	for _, az := range e.availabilityZones {
+		if az == availabilityZone {
+			return true
+		}
+	}
+
+	return false
+}
+
+func tagsFromSpecifications(
+	specs []types.TagSpecification,
+	resourceType types.ResourceType,
+) []types.Tag {
+
+	tags := []types.Tag{}
+
+	for _, spec := range specs {
+		if spec.ResourceType != resourceType {
+			continue
+		}
+
+		tags = append(tags, spec.Tags...)
+	}
+
+	return tags
+}
+
+// filterValuesFunc returns the values of a resource
+// for the passed filter name.
+// The boolean is false if the filter is unknown.
+type filterValuesFunc func(filterName string) ([]string, bool)
+
+func tagFilterValues(tags []types.Tag, filterName string) ([]string, bool) {
+	if filterName == "tag-key" {
+		keys := []string{}
+
+		for _, tag := range tags {
+			keys = append(keys, aws.ToString(tag.Key))
+		}
+
+		return keys, true
+	}
+
+	if !strings.HasPrefix(filterName, "tag:") {
+		return nil, false
+	}
+
+	key := strings.TrimPrefix(filterName, "tag:")
+
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key {
+			return []string{aws.ToString(tag.Value)}, true
+		}
+	}
+
+	return []string{}, true
+}
+
+func matchFilters(filters []types.Filter, values filterValuesFunc) (bool, error) {
+	for _, filter := range filters {
+		filterName := aws.ToString(filter.Name)
+		resourceValues, known := values(filterName)
+
+		if !known {
+			return false, apiError(
+				"InvalidParameterValue",
+				"The filter '%s' is invalid",
+				filterName,
+			)
+		}
+
+		if !matchAnyValue(filter.Values, resourceValues) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func matchAnyValue(patterns []string, values []string) bool {
+	for _, pattern := range patterns {
+		patternRegexp := regexp.MustCompile(
+			"^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern)) + "$",
+		)
+
+		for _, value := range values {
+			if patternRegexp.MatchString(value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+/* The fake EC2 API returns copies of its resources
+so that callers could not update its state */
+
+func copyTags(tags []types.Tag) []types.Tag {
+	return append([]types.Tag{}, tags...)
+}
+
+func copyVPC(VPC types.Vpc) *types.Vpc {
+	IPv6CIDRBlockAssociations := []types.VpcIpv6CidrBlockAssociation{}
+
+	for _, association := range VPC.Ipv6CidrBlockAssociationSet {
+		if association.Ipv6CidrBlockState != nil {
+			state := *association.Ipv6CidrBlockState
+			association.Ipv6CidrBlockState = &state
+		}
+
+		IPv6CIDRBlockAssociations = append(IPv6CIDRBlockAssociations, association)
+	}
+
+	VPC.Ipv6CidrBlockAssociationSet = IPv6CIDRBlockAssociations
+	VPC.Tags = copyTags(VPC.Tags)
+	return &VPC
+}
+
+func copySubnet(subnet types.Subnet) *types.Subnet {
+	subnet.Ipv6CidrBlockAssociationSet = append(
+		[]types.SubnetIpv6CidrBlockAssociation{},
+		subnet.Ipv6CidrBlockAssociationSet...,
+	)
+	subnet.Tags = copyTags(subnet.Tags)
+	return &subnet
+}
+
+func copyInternetGateway(internetGateway types.InternetGateway) *types.InternetGateway {
+	internetGateway.Attachments = append(
+		[]types.InternetGatewayAttachment{},
+		internetGateway.Attachments...,
+	)
+	internetGateway.Tags = copyTags(internetGateway.Tags)
+	return &internetGateway
+}
+
+func copyRouteTable(routeTable types.RouteTable) *types.RouteTable {
+	routeTable.Routes = append([]types.Route{}, routeTable.Routes...)
+	routeTable.Associations = append(
+		[]types.RouteTableAssociation{},
+		routeTable.Associations...,
+	)
+	routeTable.Tags = copyTags(routeTable.Tags)
+	return &routeTable
+}
+
+func copySecurityGroup(securityGroup types.SecurityGroup) *types.SecurityGroup {
+	securityGroup.IpPermissions = append(
+		[]types.IpPermission{},
+		securityGroup.IpPermissions...,
+	)
+	securityGroup.Tags = copyTags(securityGroup.Tags)
+	return &securityGroup
+}
+
+func copyNetworkInterface(networkInterface types.NetworkInterface) *types.NetworkInterface {
+	networkInterface.Groups = append(
+		[]types.GroupIdentifier{},
+		networkInterface.Groups...,
+	)
+
+	networkInterface.Ipv6Addresses = append(
+		[]types.NetworkInterfaceIpv6Address{},
+		networkInterface.Ipv6Addresses...,
+	)
+
+	if networkInterface.Attachment != nil {
+		attachment := *networkInterface.Attachment
+		networkInterface.Attachment = &attachment
+	}
+
+	if networkInterface.Association != nil {
+		association := *networkInterface.Association
+		networkInterface.Association = &association
+	}
+
+	networkInterface.TagSet = copyTags(networkInterface.TagSet)
+	return &networkInterface
+}
+
+func copyInstance(instance types.Instance) *types.Instance {
+	blockDeviceMappings := []types.InstanceBlockDeviceMapping{}
+
+	for _, blockDeviceMapping := range instance.BlockDeviceMappings {
+		if blockDeviceMapping.Ebs != nil {
+			EBS := *blockDeviceMapping.Ebs
+			blockDeviceMapping.Ebs = &EBS
+		}
+
+		blockDeviceMappings = append(blockDeviceMappings, blockDeviceMapping)
+	}
+
+	instance.BlockDeviceMappings = blockDeviceMappings
+
+	if instance.State != nil {
+		state := *instance.State
+		instance.State = &state
+	}
+
+	if instance.IamInstanceProfile != nil {
+		instanceProfile := *instance.IamInstanceProfile
+		instance.IamInstanceProfile = &instanceProfile
+	}
+
+	instance.Tags = copyTags(instance.Tags)
+	return &instance
+}
+
+func copyVolume(volume types.Volume) *types.Volume {
+	volume.Attachments = append([]types.VolumeAttachment{}, volume.Attachments...)
+	volume.Tags = copyTags(volume.Tags)
+	return &volume
+}
+
+func copySnapshot(snapshot types.Snapshot) *types.Snapshot {
+	snapshot.Tags = copyTags(snapshot.Tags)
+	return &snapshot
+}
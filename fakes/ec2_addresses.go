@@ -0,0 +1,294 @@
+package fakes
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type fakeAddress struct {
+	address        types.Address
+	publicHostname string
+}
+
+func (e *EC2) AllocateAddress(
+	ctx context.Context,
+	params *ec2.AllocateAddressInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.AllocateAddressOutput, error) {
+
+	if err := e.call(ctx, "AllocateAddress"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if params.Domain != types.DomainTypeVpc {
+		return nil, apiError(
+			"InvalidParameterValue",
+			"only the %s domain is supported",
+			types.DomainTypeVpc,
+		)
+	}
+
+	publicIPAddress, publicHostname := e.newPublicIP()
+
+	address := &fakeAddress{
+		address: types.Address{
+			AllocationId: aws.String(e.newID("eipalloc")),
+			Domain:       types.DomainTypeVpc,
+			PublicIp:     aws.String(publicIPAddress),
+			Tags:         tagsFromSpecifications(params.TagSpecifications, types.ResourceTypeElasticIp),
+		},
+		publicHostname: publicHostname,
+	}
+
+	e.addresses[*address.address.AllocationId] = address
+
+	return &ec2.AllocateAddressOutput{
+		AllocationId: address.address.AllocationId,
+		Domain:       address.address.Domain,
+		PublicIp:     address.address.PublicIp,
+	}, nil
+}
+
+func (e *EC2) AssociateAddress(
+	ctx context.Context,
+	params *ec2.AssociateAddressInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.AssociateAddressOutput, error) {
+
+	if err := e.call(ctx, "AssociateAddress"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	address, err := e.lookupAddress(aws.ToString(params.AllocationId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the association with a network interface is supported
+	networkInterface, err := e.lookupNetworkInterface(aws.ToString(params.NetworkInterfaceId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.hasInternetGatewayAttached(aws.ToString(networkInterface.VpcId)) {
+		return nil, apiError(
+			"Gateway.NotAttached",
+			"Network %s is not attached to any internet gateway",
+			aws.ToString(networkInterface.VpcId),
+		)
+	}
+
+	isAssociated := address.address.AssociationId != nil || networkInterface.Association != nil
+
+	if isAssociated && !aws.ToBool(params.AllowReassociation) {
+		return nil, apiError(
+			"Resource.AlreadyAssociated",
+			"resource %s is already associated",
+			aws.ToString(address.address.AllocationId),
+		)
+	}
+
+	if address.address.AssociationId != nil {
+		e.disassociateAddress(address)
+	}
+
+	if networkInterface.Association != nil {
+		if previousAddress, ok := e.addresses[aws.ToString(networkInterface.Association.AllocationId)]; ok {
+			e.disassociateAddress(previousAddress)
+		}
+	}
+
+	associationID := aws.String(e.newID("eipassoc"))
+
+	address.address.AssociationId = associationID
+	address.address.NetworkInterfaceId = networkInterface.NetworkInterfaceId
+
+	networkInterface.Association = &types.NetworkInterfaceAssociation{
+		AllocationId:  address.address.AllocationId,
+		AssociationId: associationID,
+		PublicDnsName: aws.String(address.publicHostname),
+		PublicIp:      address.address.PublicIp,
+	}
+
+	if instance, ok := e.instanceOnNetworkInterface(aws.ToString(networkInterface.NetworkInterfaceId)); ok {
+		address.address.InstanceId = instance.instance.InstanceId
+
+		if instance.instance.State.Name == types.InstanceStateNameRunning {
+			instance.instance.PublicIpAddress = address.address.PublicIp
+			instance.instance.PublicDnsName = aws.String(address.publicHostname)
+		}
+	}
+
+	return &ec2.AssociateAddressOutput{
+		AssociationId: associationID,
+	}, nil
+}
+
+func (e *EC2) DisassociateAddress(
+	ctx context.Context,
+	params *ec2.DisassociateAddressInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DisassociateAddressOutput, error) {
+
+	if err := e.call(ctx, "DisassociateAddress"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	associationID := aws.ToString(params.AssociationId)
+
+	for _, address := range e.addresses {
+		if aws.ToString(address.address.AssociationId) == associationID {
+			e.disassociateAddress(address)
+			return &ec2.DisassociateAddressOutput{}, nil
+		}
+	}
+
+	return nil, apiError(
+		"InvalidAssociationID.NotFound",
+		"The association ID '%s' does not exist",
+		associationID,
+	)
+}
+
+func (e *EC2) ReleaseAddress(
+	ctx context.Context,
+	params *ec2.ReleaseAddressInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.ReleaseAddressOutput, error) {
+
+	if err := e.call(ctx, "ReleaseAddress"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	address, err := e.lookupAddress(aws.ToString(params.AllocationId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if address.address.AssociationId != nil {
+		return nil, apiError(
+			"InvalidIPAddress.InUse",
+			"Address %s is in use.",
+			aws.ToString(address.address.PublicIp),
+		)
+	}
+
+	delete(e.addresses, aws.ToString(address.address.AllocationId))
+
+	return &ec2.ReleaseAddressOutput{}, nil
+}
+
+// ElasticIPAssociatedWith returns the public IP address of the
+// Elastic IP associated with the passed network interface.
+func (e *EC2) ElasticIPAssociatedWith(networkInterfaceID string) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, address := range e.addresses {
+		if aws.ToString(address.address.NetworkInterfaceId) == networkInterfaceID {
+			return aws.ToString(address.address.PublicIp), true
+		}
+	}
+
+	return "", false
+}
+
+// disassociateAddress removes the association of the address
+// (the instance loses its public IP address like in a subnet
+// that doesn't map public IPs on launch).
+// Must be called with the lock held.
+func (e *EC2) disassociateAddress(address *fakeAddress) {
+	networkInterfaceID := aws.ToString(address.address.NetworkInterfaceId)
+
+	if networkInterface, ok := e.networkInterfaces[networkInterfaceID]; ok {
+		networkInterface.Association = nil
+	}
+
+	if instance, ok := e.instanceOnNetworkInterface(networkInterfaceID); ok &&
+		aws.ToString(instance.instance.PublicIpAddress) == aws.ToString(address.address.PublicIp) {
+
+		instance.instance.PublicIpAddress = nil
+		instance.instance.PublicDnsName = aws.String("")
+	}
+
+	address.address.AssociationId = nil
+	address.address.NetworkInterfaceId = nil
+	address.address.InstanceId = nil
+}
+
+// elasticIPOnNetworkInterface returns the Elastic IP
+// associated with the passed network interface.
+// Must be called with the lock held.
+func (e *EC2) elasticIPOnNetworkInterface(networkInterfaceID string) (*fakeAddress, bool) {
+	networkInterface, ok := e.networkInterfaces[networkInterfaceID]
+
+	if !ok || networkInterface.Association == nil {
+		return nil, false
+	}
+
+	address, ok := e.addresses[aws.ToString(networkInterface.Association.AllocationId)]
+	return address, ok
+}
+
+// instanceOnNetworkInterface returns the (not terminated)
+// instance launched with the passed network interface.
+// Must be called with the lock held.
+func (e *EC2) instanceOnNetworkInterface(networkInterfaceID string) (*fakeInstance, bool) {
+	for _, instance := range e.instances {
+		if instance.networkInterfaceID == networkInterfaceID &&
+			instance.instance.State.Name != types.InstanceStateNameTerminated {
+
+			return instance, true
+		}
+	}
+
+	return nil, false
+}
+
+// Must be called with the lock held.
+func (e *EC2) hasInternetGatewayAttached(VPCID string) bool {
+	for _, internetGateway := range e.internetGateways {
+		for _, attachment := range internetGateway.Attachments {
+			if aws.ToString(attachment.VpcId) == VPCID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Must be called with the lock held.
+func (e *EC2) lookupAddress(allocationID string) (*fakeAddress, error) {
+	address, ok := e.addresses[allocationID]
+
+	if !ok {
+		return nil, apiError(
+			"InvalidAllocationID.NotFound",
+			"The allocation ID '%s' does not exist",
+			allocationID,
+		)
+	}
+
+	return address, nil
+}
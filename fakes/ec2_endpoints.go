@@ -0,0 +1,460 @@
+package fakes
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// The states of the VPC endpoints
+// (returned in lower case by the API).
+const (
+	vpcEndpointStatePending   = types.State("pending")
+	vpcEndpointStateAvailable = types.State("available")
+	vpcEndpointStateDeleting  = types.State("deleting")
+)
+
+// The services that could be reached via
+// interface endpoints in the fake EC2 API.
+var interfaceVPCEndpointServices = []string{
+	"ec2messages",
+	"ssm",
+	"ssmmessages",
+}
+
+// The services that could be reached via
+// gateway endpoints in the fake EC2 API.
+var gatewayVPCEndpointServices = []string{
+	"dynamodb",
+	"s3",
+}
+
+func (e *EC2) CreateVpcEndpoint(
+	ctx context.Context,
+	params *ec2.CreateVpcEndpointInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.CreateVpcEndpointOutput, error) {
+
+	if err := e.call(ctx, "CreateVpcEndpoint"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	VPC, err := e.lookupVPC(aws.ToString(params.VpcId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch params.VpcEndpointType {
+	case types.VpcEndpointTypeInterface:
+		return e.createInterfaceVPCEndpoint(VPC, params)
+	case types.VpcEndpointTypeGateway:
+		return e.createGatewayVPCEndpoint(VPC, params)
+	}
+
+	return nil, apiError(
+		"InvalidParameter",
+		"The fake EC2 API only supports interface and gateway endpoints",
+	)
+}
+
+// Must be called with the lock held.
+func (e *EC2) createInterfaceVPCEndpoint(
+	VPC *fakeVPC,
+	params *ec2.CreateVpcEndpointInput,
+) (*ec2.CreateVpcEndpointOutput, error) {
+
+	serviceName := aws.ToString(params.ServiceName)
+
+	if !e.isKnownVPCEndpointService(serviceName, interfaceVPCEndpointServices) {
+		return nil, apiError(
+			"InvalidServiceName",
+			"The Vpc Endpoint Service '%s' does not exist",
+			serviceName,
+		)
+	}
+
+	if aws.ToBool(params.PrivateDnsEnabled) &&
+		(!VPC.enableDNSSupport || !VPC.enableDNSHostnames) {
+
+		return nil, apiError(
+			"InvalidParameter",
+			"Private DNS can't be enabled because the VPC %s does not have enableDnsSupport and enableDnsHostnames enabled.",
+			aws.ToString(VPC.vpc.VpcId),
+		)
+	}
+
+	subnetAvailabilityZones := map[string]bool{}
+
+	for _, subnetID := range params.SubnetIds {
+		subnet, err := e.lookupSubnet(subnetID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if aws.ToString(subnet.VpcId) != aws.ToString(VPC.vpc.VpcId) {
+			return nil, apiError(
+				"InvalidParameter",
+				"The subnet %s does not belong to the VPC %s",
+				subnetID,
+				aws.ToString(VPC.vpc.VpcId),
+			)
+		}
+
+		if subnetAvailabilityZones[aws.ToString(subnet.AvailabilityZone)] {
+			return nil, apiError(
+				"DuplicateSubnetsInSameZone",
+				"Found another VPC endpoint subnet in the availability zone of %s",
+				subnetID,
+			)
+		}
+
+		subnetAvailabilityZones[aws.ToString(subnet.AvailabilityZone)] = true
+	}
+
+	groups := []types.SecurityGroupIdentifier{}
+
+	for _, securityGroupID := range params.SecurityGroupIds {
+		securityGroup, err := e.lookupSecurityGroup(securityGroupID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, types.SecurityGroupIdentifier{
+			GroupId:   securityGroup.GroupId,
+			GroupName: securityGroup.GroupName,
+		})
+	}
+
+	VPCEndpoint := &types.VpcEndpoint{
+		VpcEndpointId:     aws.String(e.newID("vpce")),
+		VpcEndpointType:   params.VpcEndpointType,
+		VpcId:             VPC.vpc.VpcId,
+		ServiceName:       aws.String(serviceName),
+		State:             vpcEndpointStatePending,
+		SubnetIds:         append([]string{}, params.SubnetIds...),
+		Groups:            groups,
+		PrivateDnsEnabled: aws.Bool(aws.ToBool(params.PrivateDnsEnabled)),
+		Tags:              tagsFromSpecifications(params.TagSpecifications, types.ResourceTypeVpcEndpoint),
+	}
+
+	e.vpcEndpoints[*VPCEndpoint.VpcEndpointId] = VPCEndpoint
+
+	e.transitionOnNextObservation(func() {
+		VPCEndpoint.State = vpcEndpointStateAvailable
+	})
+
+	return &ec2.CreateVpcEndpointOutput{
+		VpcEndpoint: copyVPCEndpoint(*VPCEndpoint),
+	}, nil
+}
+
+// createGatewayVPCEndpoint adds a route to the prefix list of the
+// service in the route tables like in AWS (removed with the endpoint).
+// Must be called with the lock held.
+func (e *EC2) createGatewayVPCEndpoint(
+	VPC *fakeVPC,
+	params *ec2.CreateVpcEndpointInput,
+) (*ec2.CreateVpcEndpointOutput, error) {
+
+	serviceName := aws.ToString(params.ServiceName)
+
+	if !e.isKnownVPCEndpointService(serviceName, gatewayVPCEndpointServices) {
+		return nil, apiError(
+			"InvalidServiceName",
+			"The Vpc Endpoint Service '%s' does not exist",
+			serviceName,
+		)
+	}
+
+	if len(params.SubnetIds) > 0 || len(params.SecurityGroupIds) > 0 ||
+		aws.ToBool(params.PrivateDnsEnabled) {
+
+		return nil, apiError(
+			"InvalidParameter",
+			"Subnets, security groups and private DNS are not supported by gateway endpoints",
+		)
+	}
+
+	routeTables := []*types.RouteTable{}
+
+	for _, routeTableID := range params.RouteTableIds {
+		routeTable, err := e.lookupRouteTable(routeTableID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if aws.ToString(routeTable.VpcId) != aws.ToString(VPC.vpc.VpcId) {
+			return nil, apiError(
+				"InvalidParameter",
+				"The route table %s does not belong to the VPC %s",
+				routeTableID,
+				aws.ToString(VPC.vpc.VpcId),
+			)
+		}
+
+		routeTables = append(routeTables, routeTable)
+	}
+
+	VPCEndpoint := &types.VpcEndpoint{
+		VpcEndpointId:   aws.String(e.newID("vpce")),
+		VpcEndpointType: params.VpcEndpointType,
+		VpcId:           VPC.vpc.VpcId,
+		ServiceName:     aws.String(serviceName),
+		State:           vpcEndpointStatePending,
+		RouteTableIds:   append([]string{}, params.RouteTableIds...),
+		Tags:            tagsFromSpecifications(params.TagSpecifications, types.ResourceTypeVpcEndpoint),
+	}
+
+	prefixListID := aws.String(e.newID("pl"))
+
+	for _, routeTable := range routeTables {
+		routeTable.Routes = append(routeTable.Routes, types.Route{
+			DestinationPrefixListId: prefixListID,
+			GatewayId:               VPCEndpoint.VpcEndpointId,
+			Origin:                  types.RouteOriginCreateRoute,
+			State:                   types.RouteStateActive,
+		})
+	}
+
+	e.vpcEndpoints[*VPCEndpoint.VpcEndpointId] = VPCEndpoint
+
+	e.transitionOnNextObservation(func() {
+		VPCEndpoint.State = vpcEndpointStateAvailable
+	})
+
+	return &ec2.CreateVpcEndpointOutput{
+		VpcEndpoint: copyVPCEndpoint(*VPCEndpoint),
+	}, nil
+}
+
+func (e *EC2) DeleteVpcEndpoints(
+	ctx context.Context,
+	params *ec2.DeleteVpcEndpointsInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DeleteVpcEndpointsOutput, error) {
+
+	if err := e.call(ctx, "DeleteVpcEndpoints"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	output := &ec2.DeleteVpcEndpointsOutput{}
+
+	for _, VPCEndpointID := range params.VpcEndpointIds {
+		VPCEndpoint, ok := e.vpcEndpoints[VPCEndpointID]
+
+		if !ok {
+			output.Unsuccessful = append(output.Unsuccessful, types.UnsuccessfulItem{
+				ResourceId: aws.String(VPCEndpointID),
+				Error: &types.UnsuccessfulItemError{
+					Code:    aws.String("InvalidVpcEndpointId.NotFound"),
+					Message: aws.String("The Vpc Endpoint Id '" + VPCEndpointID + "' does not exist"),
+				},
+			})
+
+			continue
+		}
+
+		VPCEndpoint.State = vpcEndpointStateDeleting
+
+		e.transitionOnNextObservation(func() {
+			e.removeVPCEndpointRoutes(VPCEndpointID)
+			delete(e.vpcEndpoints, VPCEndpointID)
+		})
+	}
+
+	return output, nil
+}
+
+func (e *EC2) DescribeVpcEndpoints(
+	ctx context.Context,
+	params *ec2.DescribeVpcEndpointsInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DescribeVpcEndpointsOutput, error) {
+
+	if err := e.call(ctx, "DescribeVpcEndpoints"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	VPCEndpointIDs := params.VpcEndpointIds
+
+	if len(VPCEndpointIDs) == 0 {
+		VPCEndpointIDs = sortedKeys(e.vpcEndpoints)
+	}
+
+	output := &ec2.DescribeVpcEndpointsOutput{}
+
+	for _, VPCEndpointID := range VPCEndpointIDs {
+		VPCEndpoint, ok := e.vpcEndpoints[VPCEndpointID]
+
+		if !ok {
+			return nil, apiError(
+				"InvalidVpcEndpointId.NotFound",
+				"The Vpc Endpoint Id '%s' does not exist",
+				VPCEndpointID,
+			)
+		}
+
+		match, err := matchFilters(params.Filters, func(filterName string) ([]string, bool) {
+			switch filterName {
+			case "vpc-id":
+				return []string{aws.ToString(VPCEndpoint.VpcId)}, true
+			case "service-name":
+				return []string{aws.ToString(VPCEndpoint.ServiceName)}, true
+			case "vpc-endpoint-id":
+				return []string{aws.ToString(VPCEndpoint.VpcEndpointId)}, true
+			case "vpc-endpoint-state":
+				return []string{string(VPCEndpoint.State)}, true
+			case "vpc-endpoint-type":
+				return []string{strings.ToLower(string(VPCEndpoint.VpcEndpointType))}, true
+			}
+
+			return tagFilterValues(VPCEndpoint.Tags, filterName)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if match {
+			output.VpcEndpoints = append(output.VpcEndpoints, *copyVPCEndpoint(*VPCEndpoint))
+		}
+	}
+
+	return output, nil
+}
+
+// HasAvailableVPCEndpoint reports whether the passed service
+// (eg: "ssm") could be reached via an available
+// endpoint of the passed VPC.
+func (e *EC2) HasAvailableVPCEndpoint(VPCID string, service string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	serviceName := "com.amazonaws." + e.region + "." + service
+
+	for _, VPCEndpoint := range e.vpcEndpoints {
+		if aws.ToString(VPCEndpoint.VpcId) == VPCID &&
+			aws.ToString(VPCEndpoint.ServiceName) == serviceName &&
+			VPCEndpoint.State == vpcEndpointStateAvailable {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasGatewayVPCEndpointRoute reports whether the passed route
+// table has a route to the passed service (eg: "s3") via
+// an available gateway endpoint.
+func (e *EC2) HasGatewayVPCEndpointRoute(routeTableID string, service string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	serviceName := "com.amazonaws." + e.region + "." + service
+
+	routeTable, ok := e.routeTables[routeTableID]
+
+	if !ok {
+		return false
+	}
+
+	for _, route := range routeTable.Routes {
+		VPCEndpoint, ok := e.vpcEndpoints[aws.ToString(route.GatewayId)]
+
+		if ok && aws.ToString(VPCEndpoint.ServiceName) == serviceName &&
+			VPCEndpoint.State == vpcEndpointStateAvailable {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeVPCEndpointRoutes removes the routes to the passed
+// gateway endpoint from the route tables.
+// Must be called with the lock held.
+func (e *EC2) removeVPCEndpointRoutes(VPCEndpointID string) {
+	for _, routeTable := range e.routeTables {
+		routes := []types.Route{}
+
+		for _, route := range routeTable.Routes {
+			if aws.ToString(route.GatewayId) != VPCEndpointID {
+				routes = append(routes, route)
+			}
+		}
+
+		routeTable.Routes = routes
+	}
+}
+
+// hasVPCEndpointDependency reports whether a VPC endpoint depends on
+// the passed resource (VPC, subnet, security group or route table).
+// Must be called with the lock held.
+func (e *EC2) hasVPCEndpointDependency(resourceID string) bool {
+	for _, VPCEndpoint := range e.vpcEndpoints {
+		if aws.ToString(VPCEndpoint.VpcId) == resourceID {
+			return true
+		}
+
+		for _, routeTableID := range VPCEndpoint.RouteTableIds {
+			if routeTableID == resourceID {
+				return true
+			}
+		}
+
+		for _, subnetID := range VPCEndpoint.SubnetIds {
+			if subnetID == resourceID {
+				return true
+			}
+		}
+
+		for _, group := range VPCEndpoint.Groups {
+			if aws.ToString(group.GroupId) == resourceID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (e *EC2) isKnownVPCEndpointService(serviceName string, services []string) bool {
+	for _, service := range services {
+		if serviceName == "com.amazonaws."+e.region+"."+service {
+			return true
+		}
+	}
+
+	return false
+}
+
+func copyVPCEndpoint(VPCEndpoint types.VpcEndpoint) *types.VpcEndpoint {
+	VPCEndpoint.SubnetIds = append([]string{}, VPCEndpoint.SubnetIds...)
+	VPCEndpoint.RouteTableIds = append([]string{}, VPCEndpoint.RouteTableIds...)
+	VPCEndpoint.Groups = append(
+		[]types.SecurityGroupIdentifier{},
+		VPCEndpoint.Groups...,
+	)
+	VPCEndpoint.Tags = copyTags(VPCEndpoint.Tags)
+	return &VPCEndpoint
+}
@@ -0,0 +1,989 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const defaultRootVolumeSizeGb = 8
+
+func (e *EC2) RunInstances(
+	ctx context.Context,
+	params *ec2.RunInstancesInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.RunInstancesOutput, error) {
+
+	if err := e.call(ctx, "RunInstances"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	if aws.ToInt32(params.MinCount) != 1 || aws.ToInt32(params.MaxCount) != 1 {
+		return nil, apiError(
+			"InvalidParameterValue",
+			"The fake EC2 API only supports launching one instance at a time",
+		)
+	}
+
+	image, err := e.lookupImage(aws.ToString(params.ImageId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	instanceType := string(params.InstanceType)
+
+	catalogEntry, ok := e.instanceTypes[instanceType]
+
+	if !ok {
+		return nil, apiError(
+			"InvalidParameterValue",
+			"Invalid value '%s' for InstanceType.",
+			instanceType,
+		)
+	}
+
+	if params.KeyName != nil {
+		if _, found := e.lookupKeyPairByName(aws.ToString(params.KeyName)); !found {
+			return nil, apiError(
+				"InvalidKeyPair.NotFound",
+				"The key pair '%s' does not exist",
+				aws.ToString(params.KeyName),
+			)
+		}
+	}
+
+	if len(params.NetworkInterfaces) != 1 {
+		return nil, apiError(
+			"InvalidParameterValue",
+			"The fake EC2 API only supports launching instances with one network interface",
+		)
+	}
+
+	networkInterface, err := e.lookupNetworkInterface(
+		aws.ToString(params.NetworkInterfaces[0].NetworkInterfaceId),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if networkInterface.Attachment != nil {
+		return nil, apiError(
+			"InvalidNetworkInterface.InUse",
+			"Interface: [%s] in use.",
+			aws.ToString(networkInterface.NetworkInterfaceId),
+		)
+	}
+
+	subnet, err := e.lookupSubnet(aws.ToString(networkInterface.SubnetId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.isInstanceTypeOffered(catalogEntry, aws.ToString(subnet.AvailabilityZone)) {
+		return nil, apiError(
+			"Unsupported",
+			"Your requested instance type (%s) is not supported in your requested Availability Zone (%s).",
+			instanceType,
+			aws.ToString(subnet.AvailabilityZone),
+		)
+	}
+
+	instanceID := e.newID("i")
+	rootDeviceName := aws.ToString(image.RootDeviceName)
+	rootVolumeSize := int32(defaultRootVolumeSizeGb)
+
+	for _, blockDevice := range params.BlockDeviceMappings {
+		if aws.ToString(blockDevice.DeviceName) == rootDeviceName &&
+			blockDevice.Ebs != nil && blockDevice.Ebs.VolumeSize != nil {
+
+			rootVolumeSize = *blockDevice.Ebs.VolumeSize
+		}
+	}
+
+	rootVolume := &fakeVolume{
+		volume: types.Volume{
+			VolumeId:         aws.String(e.newID("vol")),
+			AvailabilityZone: subnet.AvailabilityZone,
+			Size:             aws.Int32(rootVolumeSize),
+			State:            types.VolumeStateInUse,
+			VolumeType:       types.VolumeTypeGp2,
+			Attachments: []types.VolumeAttachment{{
+				InstanceId:          aws.String(instanceID),
+				Device:              aws.String(rootDeviceName),
+				State:               types.VolumeAttachmentStateAttached,
+				DeleteOnTermination: aws.Bool(true),
+			}},
+			Tags: []types.Tag{},
+		},
+		deleteOnTermination: true,
+	}
+
+	rootVolume.volume.Attachments[0].VolumeId = rootVolume.volume.VolumeId
+	e.volumes[*rootVolume.volume.VolumeId] = rootVolume
+
+	instance := &fakeInstance{
+		instance: types.Instance{
+			InstanceId:       aws.String(instanceID),
+			InstanceType:     params.InstanceType,
+			ImageId:          image.ImageId,
+			Architecture:     image.Architecture,
+			KeyName:          params.KeyName,
+			SubnetId:         subnet.SubnetId,
+			VpcId:            subnet.VpcId,
+			PrivateIpAddress: aws.String(fmt.Sprintf("10.0.0.%d", 4+len(e.instances)%250)),
+			Placement: &types.Placement{
+				AvailabilityZone: subnet.AvailabilityZone,
+			},
+			RootDeviceName: aws.String(rootDeviceName),
+			RootDeviceType: types.DeviceTypeEbs,
+			LaunchTime:     aws.Time(time.Now()),
+			State:          instanceState(types.InstanceStateNamePending),
+			BlockDeviceMappings: []types.InstanceBlockDeviceMapping{{
+				DeviceName: aws.String(rootDeviceName),
+				Ebs: &types.EbsInstanceBlockDevice{
+					VolumeId:            rootVolume.volume.VolumeId,
+					Status:              types.AttachmentStatusAttached,
+					DeleteOnTermination: aws.Bool(true),
+				},
+			}},
+			Tags: tagsFromSpecifications(params.TagSpecifications, types.ResourceTypeInstance),
+		},
+		networkInterfaceID: aws.ToString(networkInterface.NetworkInterfaceId),
+	}
+
+	if len(networkInterface.Ipv6Addresses) > 0 {
+		instance.instance.Ipv6Address = networkInterface.Ipv6Addresses[0].Ipv6Address
+	}
+
+	if params.InstanceMarketOptions != nil {
+		if err := e.requestSpotInstance(params.InstanceMarketOptions, instance); err != nil {
+			// Nothing is launched
+			delete(e.volumes, *rootVolume.volume.VolumeId)
+			return nil, err
+		}
+	}
+
+	if params.IamInstanceProfile != nil {
+		instance.instance.IamInstanceProfile = &types.IamInstanceProfile{
+			Arn: aws.String(
+				"arn:aws:iam::123456789012:instance-profile/" +
+					aws.ToString(params.IamInstanceProfile.Name),
+			),
+		}
+	}
+
+	e.instances[instanceID] = instance
+
+	networkInterface.Status = types.NetworkInterfaceStatusInUse
+	networkInterface.Attachment = &types.NetworkInterfaceAttachment{
+		AttachmentId:        aws.String(e.newID("eni-attach")),
+		InstanceId:          aws.String(instanceID),
+		DeviceIndex:         aws.Int32(0),
+		Status:              types.AttachmentStatusAttached,
+		DeleteOnTermination: aws.Bool(false),
+	}
+
+	e.transitionOnNextObservation(func() {
+		e.transitionInstanceToRunning(instance)
+	})
+
+	return &ec2.RunInstancesOutput{
+		Instances: []types.Instance{
+			*copyInstance(instance.instance),
+		},
+	}, nil
+}
+
+func (e *EC2) StartInstances(
+	ctx context.Context,
+	params *ec2.StartInstancesInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.StartInstancesOutput, error) {
+
+	if err := e.call(ctx, "StartInstances"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	instances, err := e.lookupInstances(params.InstanceIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, instance := range instances {
+		state := instance.instance.State.Name
+
+		if state != types.InstanceStateNameStopped &&
+			state != types.InstanceStateNameRunning {
+
+			return nil, incorrectInstanceStateError(instance, "start")
+		}
+
+		if state == types.InstanceStateNameStopped &&
+			instance.instance.InstanceLifecycle == types.InstanceLifecycleTypeSpot &&
+			e.spotCapacityUnavailable {
+
+			return nil, insufficientSpotCapacityError()
+		}
+	}
+
+	output := &ec2.StartInstancesOutput{}
+
+	for _, instance := range instances {
+		previousState := instance.instance.State
+
+		if previousState.Name == types.InstanceStateNameStopped {
+			instance.instance.State = instanceState(types.InstanceStateNamePending)
+			instance.instance.StateReason = nil
+
+			// Needs a new variable to be
+			// captured by the transition
+			startedInstance := instance
+
+			e.transitionOnNextObservation(func() {
+				e.transitionInstanceToRunning(startedInstance)
+			})
+		}
+
+		output.StartingInstances = append(output.StartingInstances, types.InstanceStateChange{
+			InstanceId:    instance.instance.InstanceId,
+			PreviousState: previousState,
+			CurrentState:  instanceState(instance.instance.State.Name),
+		})
+	}
+
+	return output, nil
+}
+
+func (e *EC2) StopInstances(
+	ctx context.Context,
+	params *ec2.StopInstancesInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.StopInstancesOutput, error) {
+
+	if err := e.call(ctx, "StopInstances"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	instances, err := e.lookupInstances(params.InstanceIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, instance := range instances {
+		state := instance.instance.State.Name
+
+		if state != types.InstanceStateNameRunning &&
+			state != types.InstanceStateNameStopped {
+
+			return nil, incorrectInstanceStateError(instance, "stop")
+		}
+	}
+
+	output := &ec2.StopInstancesOutput{}
+
+	for _, instance := range instances {
+		previousState := instance.instance.State
+
+		if previousState.Name == types.InstanceStateNameRunning {
+			instance.instance.State = instanceState(types.InstanceStateNameStopping)
+
+			stoppedInstance := instance
+
+			e.transitionOnNextObservation(func() {
+				if stoppedInstance.instance.State.Name != types.InstanceStateNameStopping {
+					return
+				}
+
+				// Like in AWS, the public IP address is released
+				// on stop (unless it is an Elastic IP)
+				if _, ok := e.elasticIPOnNetworkInterface(stoppedInstance.networkInterfaceID); !ok {
+					stoppedInstance.instance.PublicIpAddress = nil
+					stoppedInstance.instance.PublicDnsName = aws.String("")
+				}
+
+				stoppedInstance.instance.State = instanceState(types.InstanceStateNameStopped)
+			})
+		}
+
+		output.StoppingInstances = append(output.StoppingInstances, types.InstanceStateChange{
+			InstanceId:    instance.instance.InstanceId,
+			PreviousState: previousState,
+			CurrentState:  instanceState(instance.instance.State.Name),
+		})
+	}
+
+	return output, nil
+}
+
+func (e *EC2) TerminateInstances(
+	ctx context.Context,
+	params *ec2.TerminateInstancesInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.TerminateInstancesOutput, error) {
+
+	if err := e.call(ctx, "TerminateInstances"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	instances, err := e.lookupInstances(params.InstanceIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	output := &ec2.TerminateInstancesOutput{}
+
+	for _, instance := range instances {
+		previousState := instance.instance.State
+
+		if previousState.Name != types.InstanceStateNameTerminated &&
+			previousState.Name != types.InstanceStateNameShuttingDown {
+
+			instance.instance.State = instanceState(types.InstanceStateNameShuttingDown)
+
+			terminatedInstance := instance
+
+			e.transitionOnNextObservation(func() {
+				e.transitionInstanceToTerminated(terminatedInstance)
+			})
+		}
+
+		output.TerminatingInstances = append(output.TerminatingInstances, types.InstanceStateChange{
+			InstanceId:    instance.instance.InstanceId,
+			PreviousState: previousState,
+			CurrentState:  instanceState(instance.instance.State.Name),
+		})
+	}
+
+	return output, nil
+}
+
+// ModifyInstanceAttribute only supports updating
+// the "DeleteOnTermination" flag of the attached volumes.
+func (e *EC2) ModifyInstanceAttribute(
+	ctx context.Context,
+	params *ec2.ModifyInstanceAttributeInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.ModifyInstanceAttributeOutput, error) {
+
+	if err := e.call(ctx, "ModifyInstanceAttribute"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	instances, err := e.lookupInstances([]string{aws.ToString(params.InstanceId)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	instance := instances[0]
+
+	if len(params.BlockDeviceMappings) == 0 {
+		return nil, apiError(
+			"InvalidParameterCombination",
+			"The fake EC2 API only supports modifying the block device mappings",
+		)
+	}
+
+	for _, mapping := range params.BlockDeviceMappings {
+		device := aws.ToString(mapping.DeviceName)
+		found := false
+
+		for i, blockDevice := range instance.instance.BlockDeviceMappings {
+			if aws.ToString(blockDevice.DeviceName) != device {
+				continue
+			}
+
+			found = true
+
+			if mapping.Ebs == nil || mapping.Ebs.DeleteOnTermination == nil {
+				continue
+			}
+
+			deleteOnTermination := aws.ToBool(mapping.Ebs.DeleteOnTermination)
+
+			EBS := *blockDevice.Ebs
+			EBS.DeleteOnTermination = aws.Bool(deleteOnTermination)
+			instance.instance.BlockDeviceMappings[i].Ebs = &EBS
+
+			if volume, ok := e.volumes[aws.ToString(EBS.VolumeId)]; ok {
+				volume.deleteOnTermination = deleteOnTermination
+
+				for j := range volume.volume.Attachments {
+					volume.volume.Attachments[j].DeleteOnTermination = aws.Bool(deleteOnTermination)
+				}
+			}
+		}
+
+		if !found {
+			return nil, apiError(
+				"InvalidInstanceAttributeValue",
+				"No device is currently mapped at %s",
+				device,
+			)
+		}
+	}
+
+	return &ec2.ModifyInstanceAttributeOutput{}, nil
+}
+
+func (e *EC2) DescribeInstances(
+	ctx context.Context,
+	params *ec2.DescribeInstancesInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DescribeInstancesOutput, error) {
+
+	if err := e.call(ctx, "DescribeInstances"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	instanceIDs := params.InstanceIds
+
+	if len(instanceIDs) == 0 {
+		instanceIDs = sortedKeys(e.instances)
+	}
+
+	instances, err := e.lookupInstances(instanceIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	output := &ec2.DescribeInstancesOutput{}
+
+	for _, instance := range instances {
+		match, err := matchFilters(params.Filters, func(filterName string) ([]string, bool) {
+			switch filterName {
+			case "instance-id":
+				return []string{aws.ToString(instance.instance.InstanceId)}, true
+			case "instance-state-name":
+				return []string{string(instance.instance.State.Name)}, true
+			case "instance-type":
+				return []string{string(instance.instance.InstanceType)}, true
+			case "subnet-id":
+				return []string{aws.ToString(instance.instance.SubnetId)}, true
+			case "vpc-id":
+				return []string{aws.ToString(instance.instance.VpcId)}, true
+			}
+
+			return tagFilterValues(instance.instance.Tags, filterName)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !match {
+			continue
+		}
+
+		// One reservation per instance given that
+		// the fake only launches one instance at a time
+		output.Reservations = append(output.Reservations, types.Reservation{
+			ReservationId: aws.String("r-" + aws.ToString(instance.instance.InstanceId)),
+			Instances: []types.Instance{
+				*copyInstance(instance.instance),
+			},
+		})
+	}
+
+	return output, nil
+}
+
+// InstanceByPublicIP returns a copy of the running
+// instance with the passed public IP address.
+func (e *EC2) InstanceByPublicIP(publicIPAddress string) (*types.Instance, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	for _, instance := range e.instances {
+		if aws.ToString(instance.instance.PublicIpAddress) == publicIPAddress &&
+			instance.instance.State.Name == types.InstanceStateNameRunning {
+
+			return copyInstance(instance.instance), true
+		}
+	}
+
+	return nil, false
+}
+
+// InstanceByID returns the instance with the passed ID if it is running.
+func (e *EC2) InstanceByID(instanceID string) (*types.Instance, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	instance, ok := e.instances[instanceID]
+
+	if !ok || instance.instance.State.Name != types.InstanceStateNameRunning {
+		return nil, false
+	}
+
+	return copyInstance(instance.instance), true
+}
+
+// Must be called with the lock held.
+func (e *EC2) lookupInstances(instanceIDs []string) ([]*fakeInstance, error) {
+	instances := []*fakeInstance{}
+
+	for _, instanceID := range instanceIDs {
+		instance, ok := e.instances[instanceID]
+
+		if !ok {
+			return nil, apiError(
+				"InvalidInstanceID.NotFound",
+				"The instance ID '%s' does not exist",
+				instanceID,
+			)
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+// Must be called with the lock held.
+func (e *EC2) lookupKeyPairByName(keyName string) (*fakeKeyPair, bool) {
+	for _, keyPair := range e.keyPairs {
+		if aws.ToString(keyPair.keyPair.KeyName) == keyName {
+			return keyPair, true
+		}
+	}
+
+	return nil, false
+}
+
+// Must be called with the lock held.
+func (e *EC2) transitionInstanceToRunning(instance *fakeInstance) {
+	if instance.instance.State.Name != types.InstanceStateNamePending {
+		return
+	}
+
+	instance.instance.State = instanceState(types.InstanceStateNameRunning)
+	instance.instance.PublicDnsName = aws.String("")
+
+	if address, ok := e.elasticIPOnNetworkInterface(instance.networkInterfaceID); ok {
+		address.address.InstanceId = instance.instance.InstanceId
+
+		instance.instance.PublicIpAddress = address.address.PublicIp
+		instance.instance.PublicDnsName = aws.String(address.publicHostname)
+		return
+	}
+
+	subnet, ok := e.subnets[aws.ToString(instance.instance.SubnetId)]
+
+	if !ok || !aws.ToBool(subnet.MapPublicIpOnLaunch) {
+		return
+	}
+
+	publicIPAddress, publicHostname := e.newPublicIP()
+
+	instance.instance.PublicIpAddress = aws.String(publicIPAddress)
+	instance.instance.PublicDnsName = aws.String(publicHostname)
+}
+
+// Must be called with the lock held.
+func (e *EC2) transitionInstanceToTerminated(instance *fakeInstance) {
+	if instance.instance.State.Name != types.InstanceStateNameShuttingDown {
+		return
+	}
+
+	instance.instance.State = instanceState(types.InstanceStateNameTerminated)
+	instance.instance.PublicIpAddress = nil
+	instance.instance.PublicDnsName = aws.String("")
+
+	// The Elastic IP stays associated with the network interface
+	if address, ok := e.elasticIPOnNetworkInterface(instance.networkInterfaceID); ok {
+		address.address.InstanceId = nil
+	}
+
+	for _, blockDevice := range instance.instance.BlockDeviceMappings {
+		volume, ok := e.volumes[aws.ToString(blockDevice.Ebs.VolumeId)]
+
+		if !ok {
+			continue
+		}
+
+		if volume.deleteOnTermination {
+			delete(e.volumes, aws.ToString(volume.volume.VolumeId))
+			continue
+		}
+
+		volume.volume.Attachments = nil
+		volume.volume.State = types.VolumeStateAvailable
+	}
+
+	instance.instance.BlockDeviceMappings = nil
+
+	// Network interfaces passed at launch
+	// are not deleted on termination
+	if networkInterface, ok := e.networkInterfaces[instance.networkInterfaceID]; ok {
+		networkInterface.Attachment = nil
+		networkInterface.Status = types.NetworkInterfaceStatusAvailable
+	}
+}
+
+func (e *EC2) DescribeAvailabilityZones(
+	ctx context.Context,
+	params *ec2.DescribeAvailabilityZonesInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DescribeAvailabilityZonesOutput, error) {
+
+	if err := e.call(ctx, "DescribeAvailabilityZones"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	output := &ec2.DescribeAvailabilityZonesOutput{}
+
+	for i, availabilityZone := range e.availabilityZones {
+		match, err := matchFilters(params.Filters, func(filterName string) ([]string, bool) {
+			switch filterName {
+			case "zone-name":
+				return []string{availabilityZone}, true
+			case "region-name":
+				return []string{e.region}, true
+			case "state":
+				return []string{string(types.AvailabilityZoneStateAvailable)}, true
+			case "zone-type":
+				return []string{"availability-zone"}, true
+			}
+
+			return nil, false
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !match {
+			continue
+		}
+
+		output.AvailabilityZones = append(output.AvailabilityZones, types.AvailabilityZone{
+			ZoneName:   aws.String(availabilityZone),
+			ZoneId:     aws.String(fmt.Sprintf("%s-az%d", e.region, i+1)),
+			ZoneType:   aws.String("availability-zone"),
+			RegionName: aws.String(e.region),
+			State:      types.AvailabilityZoneStateAvailable,
+		})
+	}
+
+	return output, nil
+}
+
+func (e *EC2) DescribeInstanceTypeOfferings(
+	ctx context.Context,
+	params *ec2.DescribeInstanceTypeOfferingsInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DescribeInstanceTypeOfferingsOutput, error) {
+
+	if err := e.call(ctx, "DescribeInstanceTypeOfferings"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if params.LocationType != types.LocationTypeAvailabilityZone {
+		return nil, apiError(
+			"InvalidParameterValue",
+			"The fake EC2 API only supports the '%s' location type",
+			types.LocationTypeAvailabilityZone,
+		)
+	}
+
+	output := &ec2.DescribeInstanceTypeOfferingsOutput{}
+
+	for _, instanceType := range sortedKeys(e.instanceTypes) {
+		catalogEntry := e.instanceTypes[instanceType]
+
+		for _, availabilityZone := range e.availabilityZones {
+			if !e.isInstanceTypeOffered(catalogEntry, availabilityZone) {
+				continue
+			}
+
+			match, err := matchFilters(params.Filters, func(filterName string) ([]string, bool) {
+				switch filterName {
+				case "instance-type":
+					return []string{catalogEntry.Type}, true
+				case "location":
+					return []string{availabilityZone}, true
+				}
+
+				return nil, false
+			})
+
+			if err != nil {
+				return nil, err
+			}
+
+			if match {
+				output.InstanceTypeOfferings = append(output.InstanceTypeOfferings, types.InstanceTypeOffering{
+					InstanceType: types.InstanceType(catalogEntry.Type),
+					Location:     aws.String(availabilityZone),
+					LocationType: types.LocationTypeAvailabilityZone,
+				})
+			}
+		}
+	}
+
+	return output, nil
+}
+
+// Must be called with the lock held.
+func (e *EC2) isInstanceTypeOffered(
+	catalogEntry EC2InstanceTypeCatalogEntry,
+	availabilityZone string,
+) bool {
+
+	if len(catalogEntry.AvailabilityZones) == 0 {
+		return true
+	}
+
+	for _, suffix := range catalogEntry.AvailabilityZones {
+		if e.region+suffix == availabilityZone {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *EC2) DescribeInstanceTypes(
+	ctx context.Context,
+	params *ec2.DescribeInstanceTypesInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DescribeInstanceTypesOutput, error) {
+
+	if err := e.call(ctx, "DescribeInstanceTypes"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	instanceTypes := []string{}
+
+	for _, instanceType := range params.InstanceTypes {
+		instanceTypes = append(instanceTypes, string(instanceType))
+	}
+
+	if len(instanceTypes) == 0 {
+		instanceTypes = sortedKeys(e.instanceTypes)
+	}
+
+	output := &ec2.DescribeInstanceTypesOutput{}
+
+	for _, instanceType := range instanceTypes {
+		catalogEntry, ok := e.instanceTypes[instanceType]
+
+		if !ok {
+			return nil, apiError(
+				"InvalidInstanceType",
+				"The following supplied instance types do not exist: [%s]",
+				instanceType,
+			)
+		}
+
+		match, err := matchFilters(params.Filters, func(filterName string) ([]string, bool) {
+			values := []string{}
+
+			switch filterName {
+			case "instance-type":
+				return []string{catalogEntry.Type}, true
+			case "processor-info.supported-architecture":
+				for _, arch := range catalogEntry.Archs {
+					values = append(values, string(arch))
+				}
+
+				return values, true
+			case "supported-usage-class":
+				for _, usageClass := range catalogEntry.UsageClasses {
+					values = append(values, string(usageClass))
+				}
+
+				return values, true
+			case "supported-root-device-type":
+				for _, rootDevice := range catalogEntry.RootDevices {
+					values = append(values, string(rootDevice))
+				}
+
+				return values, true
+			}
+
+			return nil, false
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !match {
+			continue
+		}
+
+		output.InstanceTypes = append(output.InstanceTypes, types.InstanceTypeInfo{
+			InstanceType: types.InstanceType(catalogEntry.Type),
+			ProcessorInfo: &types.ProcessorInfo{
+				SupportedArchitectures: append([]types.ArchitectureType{}, catalogEntry.Archs...),
+			},
+			SupportedUsageClasses:    append([]types.UsageClassType{}, catalogEntry.UsageClasses...),
+			SupportedRootDeviceTypes: append([]types.RootDeviceType{}, catalogEntry.RootDevices...),
+		})
+	}
+
+	return output, nil
+}
+
+func (e *EC2) DescribeImages(
+	ctx context.Context,
+	params *ec2.DescribeImagesInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DescribeImagesOutput, error) {
+
+	if err := e.call(ctx, "DescribeImages"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	output := &ec2.DescribeImagesOutput{}
+
+	for _, image := range e.images {
+		if len(params.ImageIds) > 0 &&
+			!containsString(params.ImageIds, aws.ToString(image.ImageId)) {
+
+			continue
+		}
+
+		if len(params.Owners) > 0 &&
+			!containsString(params.Owners, aws.ToString(image.OwnerId)) {
+
+			continue
+		}
+
+		// Needs a new variable to be
+		// captured by the filter func
+		image := image
+
+		match, err := matchFilters(params.Filters, func(filterName string) ([]string, bool) {
+			switch filterName {
+			case "image-id":
+				return []string{aws.ToString(image.ImageId)}, true
+			case "name":
+				return []string{aws.ToString(image.Name)}, true
+			case "architecture":
+				return []string{string(image.Architecture)}, true
+			case "owner-id":
+				return []string{aws.ToString(image.OwnerId)}, true
+			case "root-device-type":
+				return []string{string(image.RootDeviceType)}, true
+			case "virtualization-type":
+				return []string{string(image.VirtualizationType)}, true
+			case "state":
+				return []string{string(image.State)}, true
+			}
+
+			return tagFilterValues(image.Tags, filterName)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if match {
+			output.Images = append(output.Images, image)
+		}
+	}
+
+	return output, nil
+}
+
+// Must be called with the lock held.
+func (e *EC2) lookupImage(imageID string) (*types.Image, error) {
+	for _, image := range e.images {
+		if aws.ToString(image.ImageId) == imageID {
+			image := image
+			return &image, nil
+		}
+	}
+
+	return nil, apiError(
+		"InvalidAMIID.NotFound",
+		"The image id '[%s]' does not exist",
+		imageID,
+	)
+}
+
+func instanceState(name types.InstanceStateName) *types.InstanceState {
+	codes := map[types.InstanceStateName]int32{
+		types.InstanceStateNamePending:      0,
+		types.InstanceStateNameRunning:      16,
+		types.InstanceStateNameShuttingDown: 32,
+		types.InstanceStateNameTerminated:   48,
+		types.InstanceStateNameStopping:     64,
+		types.InstanceStateNameStopped:      80,
+	}
+
+	return &types.InstanceState{
+		Code: aws.Int32(codes[name]),
+		Name: name,
+	}
+}
+
+func incorrectInstanceStateError(instance *fakeInstance, operation string) error {
+	return apiError(
+		"IncorrectInstanceState",
+		"The instance '%s' is in the '%s' state which is invalid for operation '%s'.",
+		aws.ToString(instance.instance.InstanceId),
+		instance.instance.State.Name,
+		operation,
+	)
+}
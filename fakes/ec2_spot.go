@@ -0,0 +1,208 @@
+package fakes
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// The spot price of all the instance
+// types in the fake EC2 API (USD per hour).
+const spotPrice = "0.0100"
+
+// SetSpotCapacityAvailable sets whether the spot instances could be
+// launched or started (true by default). Without capacity, RunInstances
+// and StartInstances fail with "InsufficientInstanceCapacity"
+// for the spot instances like in AWS.
+func (e *EC2) SetSpotCapacityAvailable(available bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spotCapacityUnavailable = !available
+}
+
+// InterruptSpotInstance interrupts the passed spot instance like
+// AWS does when it reclaims the capacity: the instance is stopping
+// then stopped (observed twice so that the waiters see the
+// stopping state) with a "Server.SpotInstanceShutdown" reason.
+func (e *EC2) InterruptSpotInstance(instanceID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	instances, err := e.lookupInstances([]string{instanceID})
+
+	if err != nil {
+		return err
+	}
+
+	instance := instances[0]
+
+	if instance.instance.InstanceLifecycle != types.InstanceLifecycleTypeSpot {
+		return apiError(
+			"InvalidParameterValue",
+			"The instance '%s' is not a spot instance",
+			instanceID,
+		)
+	}
+
+	instance.instance.State = instanceState(types.InstanceStateNameStopping)
+	instance.instance.StateReason = &types.StateReason{
+		Code:    aws.String("Server.SpotInstanceShutdown"),
+		Message: aws.String("Server.SpotInstanceShutdown: Spot Instance shutdown due to price or capacity"),
+	}
+
+	e.transitionOnNextObservation(func() {
+		e.transitionOnNextObservation(func() {
+			if instance.instance.State.Name != types.InstanceStateNameStopping {
+				return
+			}
+
+			if _, ok := e.elasticIPOnNetworkInterface(instance.networkInterfaceID); !ok {
+				instance.instance.PublicIpAddress = nil
+				instance.instance.PublicDnsName = aws.String("")
+			}
+
+			instance.instance.State = instanceState(types.InstanceStateNameStopped)
+		})
+	})
+
+	return nil
+}
+
+func (e *EC2) CancelSpotInstanceRequests(
+	ctx context.Context,
+	params *ec2.CancelSpotInstanceRequestsInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.CancelSpotInstanceRequestsOutput, error) {
+
+	if err := e.call(ctx, "CancelSpotInstanceRequests"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	output := &ec2.CancelSpotInstanceRequestsOutput{}
+
+	for _, spotInstanceRequestID := range params.SpotInstanceRequestIds {
+		spotInstanceRequest, ok := e.spotInstanceRequests[spotInstanceRequestID]
+
+		if !ok {
+			return nil, apiError(
+				"InvalidSpotInstanceRequestID.NotFound",
+				"The spot instance request ID '%s' does not exist",
+				spotInstanceRequestID,
+			)
+		}
+
+		spotInstanceRequest.State = types.SpotInstanceStateCancelled
+
+		output.CancelledSpotInstanceRequests = append(
+			output.CancelledSpotInstanceRequests,
+			types.CancelledSpotInstanceRequest{
+				SpotInstanceRequestId: spotInstanceRequest.SpotInstanceRequestId,
+				State:                 types.CancelSpotInstanceRequestStateCancelled,
+			},
+		)
+	}
+
+	return output, nil
+}
+
+// requestSpotInstance validates the spot options of the passed
+// launch and records the spot request of the instance.
+// Must be called with the lock held.
+func (e *EC2) requestSpotInstance(
+	marketOptions *types.InstanceMarketOptionsRequest,
+	instance *fakeInstance,
+) error {
+
+	if marketOptions.MarketType != types.MarketTypeSpot {
+		return apiError(
+			"InvalidParameterValue",
+			"The fake EC2 API only supports the '%s' market type",
+			types.MarketTypeSpot,
+		)
+	}
+
+	spotOptions := marketOptions.SpotOptions
+
+	if spotOptions == nil {
+		spotOptions = &types.SpotMarketOptions{}
+	}
+
+	spotInstanceType := spotOptions.SpotInstanceType
+
+	if len(spotInstanceType) == 0 {
+		spotInstanceType = types.SpotInstanceTypeOneTime
+	}
+
+	interruptionBehavior := spotOptions.InstanceInterruptionBehavior
+
+	if len(interruptionBehavior) == 0 {
+		interruptionBehavior = types.InstanceInterruptionBehaviorTerminate
+	}
+
+	if interruptionBehavior != types.InstanceInterruptionBehaviorTerminate &&
+		spotInstanceType != types.SpotInstanceTypePersistent {
+
+		return apiError(
+			"InvalidParameterCombination",
+			"The '%s' interruption behavior is only supported by persistent requests",
+			interruptionBehavior,
+		)
+	}
+
+	if spotOptions.MaxPrice != nil {
+		maxPrice, err := strconv.ParseFloat(aws.ToString(spotOptions.MaxPrice), 64)
+
+		if err != nil {
+			return apiError(
+				"InvalidParameterValue",
+				"Invalid value '%s' for spotPrice",
+				aws.ToString(spotOptions.MaxPrice),
+			)
+		}
+
+		minPrice, _ := strconv.ParseFloat(spotPrice, 64)
+
+		if maxPrice < minPrice {
+			return apiError(
+				"SpotMaxPriceTooLow",
+				"Your Spot request price of %s is lower than the minimum required Spot request fulfillment price of %s.",
+				aws.ToString(spotOptions.MaxPrice),
+				spotPrice,
+			)
+		}
+	}
+
+	if e.spotCapacityUnavailable {
+		return insufficientSpotCapacityError()
+	}
+
+	spotInstanceRequest := &types.SpotInstanceRequest{
+		SpotInstanceRequestId:        aws.String(e.newID("sir")),
+		Type:                         spotInstanceType,
+		InstanceInterruptionBehavior: interruptionBehavior,
+		SpotPrice:                    spotOptions.MaxPrice,
+		State:                        types.SpotInstanceStateActive,
+		InstanceId:                   instance.instance.InstanceId,
+	}
+
+	e.spotInstanceRequests[*spotInstanceRequest.SpotInstanceRequestId] = spotInstanceRequest
+
+	instance.instance.InstanceLifecycle = types.InstanceLifecycleTypeSpot
+	instance.instance.SpotInstanceRequestId = spotInstanceRequest.SpotInstanceRequestId
+
+	return nil
+}
+
+func insufficientSpotCapacityError() error {
+	return apiError(
+		"InsufficientInstanceCapacity",
+		"There is no Spot capacity available that matches your request.",
+	)
+}
@@ -0,0 +1,573 @@
+package fakes
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func (e *EC2) CreateVolume(
+	ctx context.Context,
+	params *ec2.CreateVolumeInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.CreateVolumeOutput, error) {
+
+	if err := e.call(ctx, "CreateVolume"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	availabilityZone := aws.ToString(params.AvailabilityZone)
+
+	if !e.isKnownAvailabilityZone(availabilityZone) {
+		return nil, apiError(
+			"InvalidParameterValue",
+			"Value (%s) for parameter availabilityZone is invalid.",
+			availabilityZone,
+		)
+	}
+
+	size := aws.ToInt32(params.Size)
+
+	if params.SnapshotId != nil {
+		snapshot, err := e.lookupSnapshot(aws.ToString(params.SnapshotId))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if snapshot.State != types.SnapshotStateCompleted {
+			return nil, apiError(
+				"IncorrectState",
+				"Snapshot '%s' is not 'completed'.",
+				aws.ToString(snapshot.SnapshotId),
+			)
+		}
+
+		if size == 0 {
+			size = aws.ToInt32(snapshot.VolumeSize)
+		}
+	}
+
+	if size == 0 {
+		return nil, apiError(
+			"MissingParameter",
+			"The request must contain the parameter size or snapshotId",
+		)
+	}
+
+	volume := &fakeVolume{
+		volume: types.Volume{
+			VolumeId:         aws.String(e.newID("vol")),
+			AvailabilityZone: aws.String(availabilityZone),
+			SnapshotId:       params.SnapshotId,
+			Size:             aws.Int32(size),
+			VolumeType:       params.VolumeType,
+			State:            types.VolumeStateCreating,
+			CreateTime:       aws.Time(time.Now()),
+			Tags:             tagsFromSpecifications(params.TagSpecifications, types.ResourceTypeVolume),
+		},
+	}
+
+	e.volumes[*volume.volume.VolumeId] = volume
+
+	e.transitionOnNextObservation(func() {
+		if volume.volume.State == types.VolumeStateCreating {
+			volume.volume.State = types.VolumeStateAvailable
+		}
+	})
+
+	return &ec2.CreateVolumeOutput{
+		VolumeId:         volume.volume.VolumeId,
+		AvailabilityZone: volume.volume.AvailabilityZone,
+		SnapshotId:       volume.volume.SnapshotId,
+		Size:             volume.volume.Size,
+		VolumeType:       volume.volume.VolumeType,
+		State:            volume.volume.State,
+		Tags:             copyTags(volume.volume.Tags),
+	}, nil
+}
+
+func (e *EC2) AttachVolume(
+	ctx context.Context,
+	params *ec2.AttachVolumeInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.AttachVolumeOutput, error) {
+
+	if err := e.call(ctx, "AttachVolume"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	volume, err := e.lookupVolume(aws.ToString(params.VolumeId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := e.lookupInstances([]string{aws.ToString(params.InstanceId)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	instance := instances[0]
+	device := aws.ToString(params.Device)
+
+	if volume.volume.State != types.VolumeStateAvailable {
+		return nil, apiError(
+			"VolumeInUse",
+			"%s is already attached to an instance",
+			aws.ToString(volume.volume.VolumeId),
+		)
+	}
+
+	if aws.ToString(volume.volume.AvailabilityZone) !=
+		aws.ToString(instance.instance.Placement.AvailabilityZone) {
+
+		return nil, apiError(
+			"InvalidVolume.ZoneMismatch",
+			"The volume '%s' is not in the same availability zone as instance '%s'",
+			aws.ToString(volume.volume.VolumeId),
+			aws.ToString(instance.instance.InstanceId),
+		)
+	}
+
+	instanceStateName := instance.instance.State.Name
+
+	if instanceStateName == types.InstanceStateNameTerminated ||
+		instanceStateName == types.InstanceStateNameShuttingDown {
+
+		return nil, incorrectInstanceStateError(instance, "attach")
+	}
+
+	// Like in AWS, the root device could only
+	// be replaced when the instance is stopped
+	if device == aws.ToString(instance.instance.RootDeviceName) &&
+		instanceStateName != types.InstanceStateNameStopped {
+
+		return nil, incorrectInstanceStateError(instance, "attach")
+	}
+
+	for _, blockDevice := range instance.instance.BlockDeviceMappings {
+		if aws.ToString(blockDevice.DeviceName) == device {
+			return nil, apiError(
+				"InvalidParameterValue",
+				"Attachment point %s is already in use",
+				device,
+			)
+		}
+	}
+
+	attachTime := aws.Time(time.Now())
+
+	volume.volume.State = types.VolumeStateInUse
+	volume.volume.Attachments = []types.VolumeAttachment{{
+		VolumeId:            volume.volume.VolumeId,
+		InstanceId:          instance.instance.InstanceId,
+		Device:              aws.String(device),
+		State:               types.VolumeAttachmentStateAttaching,
+		AttachTime:          attachTime,
+		DeleteOnTermination: aws.Bool(false),
+	}}
+	volume.deleteOnTermination = false
+
+	instance.instance.BlockDeviceMappings = append(
+		instance.instance.BlockDeviceMappings,
+		types.InstanceBlockDeviceMapping{
+			DeviceName: aws.String(device),
+			Ebs: &types.EbsInstanceBlockDevice{
+				VolumeId:            volume.volume.VolumeId,
+				Status:              types.AttachmentStatusAttaching,
+				AttachTime:          attachTime,
+				DeleteOnTermination: aws.Bool(false),
+			},
+		},
+	)
+
+	e.transitionOnNextObservation(func() {
+		for i, attachment := range volume.volume.Attachments {
+			if attachment.State == types.VolumeAttachmentStateAttaching {
+				volume.volume.Attachments[i].State = types.VolumeAttachmentStateAttached
+			}
+		}
+
+		for i, blockDevice := range instance.instance.BlockDeviceMappings {
+			if blockDevice.Ebs.Status == types.AttachmentStatusAttaching {
+				EBS := *blockDevice.Ebs
+				EBS.Status = types.AttachmentStatusAttached
+				instance.instance.BlockDeviceMappings[i].Ebs = &EBS
+			}
+		}
+	})
+
+	return &ec2.AttachVolumeOutput{
+		VolumeId:   volume.volume.VolumeId,
+		InstanceId: instance.instance.InstanceId,
+		Device:     aws.String(device),
+		State:      types.VolumeAttachmentStateAttaching,
+		AttachTime: attachTime,
+	}, nil
+}
+
+func (e *EC2) DetachVolume(
+	ctx context.Context,
+	params *ec2.DetachVolumeInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DetachVolumeOutput, error) {
+
+	if err := e.call(ctx, "DetachVolume"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	volume, err := e.lookupVolume(aws.ToString(params.VolumeId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if volume.volume.State != types.VolumeStateInUse ||
+		len(volume.volume.Attachments) == 0 {
+
+		return nil, apiError(
+			"IncorrectState",
+			"Volume '%s' is in the '%s' state.",
+			aws.ToString(volume.volume.VolumeId),
+			volume.volume.State,
+		)
+	}
+
+	attachment := volume.volume.Attachments[0]
+
+	if params.InstanceId != nil &&
+		aws.ToString(params.InstanceId) != aws.ToString(attachment.InstanceId) {
+
+		return nil, apiError(
+			"InvalidAttachment.NotFound",
+			"Volume '%s' is not attached to instance '%s'",
+			aws.ToString(volume.volume.VolumeId),
+			aws.ToString(params.InstanceId),
+		)
+	}
+
+	instance, ok := e.instances[aws.ToString(attachment.InstanceId)]
+
+	if ok {
+		// Like in AWS, the root device could only
+		// be detached when the instance is stopped
+		if aws.ToString(attachment.Device) == aws.ToString(instance.instance.RootDeviceName) &&
+			instance.instance.State.Name != types.InstanceStateNameStopped {
+
+			return nil, incorrectInstanceStateError(instance, "detach")
+		}
+
+		blockDeviceMappings := []types.InstanceBlockDeviceMapping{}
+
+		for _, blockDevice := range instance.instance.BlockDeviceMappings {
+			if aws.ToString(blockDevice.Ebs.VolumeId) != aws.ToString(volume.volume.VolumeId) {
+				blockDeviceMappings = append(blockDeviceMappings, blockDevice)
+			}
+		}
+
+		instance.instance.BlockDeviceMappings = blockDeviceMappings
+	}
+
+	volume.volume.Attachments[0].State = types.VolumeAttachmentStateDetaching
+
+	e.transitionOnNextObservation(func() {
+		if volume.volume.State != types.VolumeStateInUse {
+			return
+		}
+
+		volume.volume.Attachments = nil
+		volume.volume.State = types.VolumeStateAvailable
+		volume.deleteOnTermination = false
+	})
+
+	return &ec2.DetachVolumeOutput{
+		VolumeId:   volume.volume.VolumeId,
+		InstanceId: attachment.InstanceId,
+		Device:     attachment.Device,
+		State:      types.VolumeAttachmentStateDetaching,
+	}, nil
+}
+
+func (e *EC2) DeleteVolume(
+	ctx context.Context,
+	params *ec2.DeleteVolumeInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DeleteVolumeOutput, error) {
+
+	if err := e.call(ctx, "DeleteVolume"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	volume, err := e.lookupVolume(aws.ToString(params.VolumeId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if volume.volume.State == types.VolumeStateInUse {
+		return nil, apiError(
+			"VolumeInUse",
+			"Volume %s is currently attached to %s",
+			aws.ToString(volume.volume.VolumeId),
+			aws.ToString(volume.volume.Attachments[0].InstanceId),
+		)
+	}
+
+	volume.volume.State = types.VolumeStateDeleting
+
+	e.transitionOnNextObservation(func() {
+		delete(e.volumes, aws.ToString(volume.volume.VolumeId))
+	})
+
+	return &ec2.DeleteVolumeOutput{}, nil
+}
+
+func (e *EC2) DescribeVolumes(
+	ctx context.Context,
+	params *ec2.DescribeVolumesInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DescribeVolumesOutput, error) {
+
+	if err := e.call(ctx, "DescribeVolumes"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	volumeIDs := params.VolumeIds
+
+	if len(volumeIDs) == 0 {
+		volumeIDs = sortedKeys(e.volumes)
+	}
+
+	output := &ec2.DescribeVolumesOutput{}
+
+	for _, volumeID := range volumeIDs {
+		volume, err := e.lookupVolume(volumeID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		match, err := matchFilters(params.Filters, func(filterName string) ([]string, bool) {
+			switch filterName {
+			case "volume-id":
+				return []string{aws.ToString(volume.volume.VolumeId)}, true
+			case "status":
+				return []string{string(volume.volume.State)}, true
+			case "availability-zone":
+				return []string{aws.ToString(volume.volume.AvailabilityZone)}, true
+			case "snapshot-id":
+				return []string{aws.ToString(volume.volume.SnapshotId)}, true
+			case "attachment.instance-id":
+				instanceIDs := []string{}
+
+				for _, attachment := range volume.volume.Attachments {
+					instanceIDs = append(instanceIDs, aws.ToString(attachment.InstanceId))
+				}
+
+				return instanceIDs, true
+			}
+
+			return tagFilterValues(volume.volume.Tags, filterName)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if match {
+			output.Volumes = append(output.Volumes, *copyVolume(volume.volume))
+		}
+	}
+
+	return output, nil
+}
+
+// Must be called with the lock held.
+func (e *EC2) lookupVolume(volumeID string) (*fakeVolume, error) {
+	volume, ok := e.volumes[volumeID]
+
+	if !ok {
+		return nil, apiError(
+			"InvalidVolume.NotFound",
+			"The volume '%s' does not exist.",
+			volumeID,
+		)
+	}
+
+	return volume, nil
+}
+
+func (e *EC2) CreateSnapshot(
+	ctx context.Context,
+	params *ec2.CreateSnapshotInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.CreateSnapshotOutput, error) {
+
+	if err := e.call(ctx, "CreateSnapshot"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	volume, err := e.lookupVolume(aws.ToString(params.VolumeId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &types.Snapshot{
+		SnapshotId:  aws.String(e.newID("snap")),
+		VolumeId:    volume.volume.VolumeId,
+		VolumeSize:  volume.volume.Size,
+		Description: params.Description,
+		State:       types.SnapshotStatePending,
+		Progress:    aws.String("0%"),
+		StartTime:   aws.Time(time.Now()),
+		Tags:        tagsFromSpecifications(params.TagSpecifications, types.ResourceTypeSnapshot),
+	}
+
+	e.snapshots[*snapshot.SnapshotId] = snapshot
+
+	e.transitionOnNextObservation(func() {
+		if snapshot.State == types.SnapshotStatePending {
+			snapshot.State = types.SnapshotStateCompleted
+			snapshot.Progress = aws.String("100%")
+		}
+	})
+
+	return &ec2.CreateSnapshotOutput{
+		SnapshotId: snapshot.SnapshotId,
+		VolumeId:   snapshot.VolumeId,
+		VolumeSize: snapshot.VolumeSize,
+		State:      snapshot.State,
+		StartTime:  snapshot.StartTime,
+		Tags:       copyTags(snapshot.Tags),
+	}, nil
+}
+
+func (e *EC2) DeleteSnapshot(
+	ctx context.Context,
+	params *ec2.DeleteSnapshotInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DeleteSnapshotOutput, error) {
+
+	if err := e.call(ctx, "DeleteSnapshot"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	snapshotID := aws.ToString(params.SnapshotId)
+
+	if _, err := e.lookupSnapshot(snapshotID); err != nil {
+		return nil, err
+	}
+
+	delete(e.snapshots, snapshotID)
+
+	return &ec2.DeleteSnapshotOutput{}, nil
+}
+
+func (e *EC2) DescribeSnapshots(
+	ctx context.Context,
+	params *ec2.DescribeSnapshotsInput,
+	optFns ...func(*ec2.Options),
+) (*ec2.DescribeSnapshotsOutput, error) {
+
+	if err := e.call(ctx, "DescribeSnapshots"); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settle()
+
+	snapshotIDs := params.SnapshotIds
+
+	if len(snapshotIDs) == 0 {
+		snapshotIDs = sortedKeys(e.snapshots)
+	}
+
+	output := &ec2.DescribeSnapshotsOutput{}
+
+	for _, snapshotID := range snapshotIDs {
+		snapshot, err := e.lookupSnapshot(snapshotID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		match, err := matchFilters(params.Filters, func(filterName string) ([]string, bool) {
+			switch filterName {
+			case "snapshot-id":
+				return []string{aws.ToString(snapshot.SnapshotId)}, true
+			case "volume-id":
+				return []string{aws.ToString(snapshot.VolumeId)}, true
+			case "status":
+				return []string{string(snapshot.State)}, true
+			}
+
+			return tagFilterValues(snapshot.Tags, filterName)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if match {
+			output.Snapshots = append(output.Snapshots, *copySnapshot(*snapshot))
+		}
+	}
+
+	return output, nil
+}
+
+// Must be called with the lock held.
+func (e *EC2) lookupSnapshot(snapshotID string) (*types.Snapshot, error) {
+	snapshot, ok := e.snapshots[snapshotID]
+
+	if !ok {
+		return nil, apiError(
+			"InvalidSnapshot.NotFound",
+			"The snapshot '%s' does not exist.",
+			snapshotID,
+		)
+	}
+
+	return snapshot, nil
+}
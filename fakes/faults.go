@@ -0,0 +1,112 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/smithy-go"
+)
+
+// faults holds the errors and hooks injected
+// by tests in the fake clients.
+//
+// It also records the number of calls
+// made to each operation.
+type faults struct {
+	mu     sync.Mutex
+	errors map[string][]error
+	hooks  map[string][]func()
+	calls  map[string]int
+}
+
+// FailNext makes the next call to the passed
+// operation (eg: "RunInstances") return err.
+//
+// Multiple calls queue multiple errors
+// that will be returned in order.
+func (f *faults) FailNext(operation string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.errors == nil {
+		f.errors = map[string][]error{}
+	}
+
+	f.errors[operation] = append(f.errors[operation], err)
+}
+
+// BeforeCall registers a hook that will be run
+// before each call to the passed operation.
+//
+// Hooks could be used to cancel a context
+// in the middle of an operation.
+func (f *faults) BeforeCall(operation string, hook func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.hooks == nil {
+		f.hooks = map[string][]func(){}
+	}
+
+	f.hooks[operation] = append(f.hooks[operation], hook)
+}
+
+// Calls returns the number of calls
+// made to the passed operation.
+func (f *faults) Calls(operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[operation]
+}
+
+// Operations returns the name of the
+// operations called at least once (sorted).
+func (f *faults) Operations() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return sortedKeys(f.calls)
+}
+
+func (f *faults) call(ctx context.Context, operation string) error {
+	f.mu.Lock()
+
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+
+	f.calls[operation]++
+	hooks := append([]func(){}, f.hooks[operation]...)
+
+	f.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.errors[operation]) == 0 {
+		return nil
+	}
+
+	err := f.errors[operation][0]
+	f.errors[operation] = f.errors[operation][1:]
+
+	return err
+}
+
+func apiError(code string, format string, args ...interface{}) error {
+	return &smithy.GenericAPIError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+		Fault:   smithy.FaultClient,
+	}
+}
@@ -0,0 +1,95 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// IAM is an in-memory implementation of the IAM API
+// (see infrastructure.IAMAPI).
+//
+// The policies of the "recode" user returned by the
+// fake STS allow all actions except the ones denied
+// with DenyActions. Other principals don't exist.
+type IAM struct {
+	faults
+
+	mu sync.Mutex
+
+	principalARN  string
+	deniedActions map[string]bool
+
+	roles            map[string]*fakeRole
+	instanceProfiles map[string]*types.InstanceProfile
+}
+
+var _ infrastructure.IAMAPI = (*IAM)(nil)
+
+// NewIAM constructs a fake IAM API.
+func NewIAM() *IAM {
+	return &IAM{
+		principalARN:  "arn:aws:iam::123456789012:user/recode",
+		deniedActions: map[string]bool{},
+
+		roles:            map[string]*fakeRole{},
+		instanceProfiles: map[string]*types.InstanceProfile{},
+	}
+}
+
+// DenyActions makes the simulation of the
+// passed actions (eg: "ec2:RunInstances") fail.
+func (i *IAM) DenyActions(actions ...string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, action := range actions {
+		i.deniedActions[action] = true
+	}
+}
+
+func (i *IAM) SimulatePrincipalPolicy(
+	ctx context.Context,
+	params *iam.SimulatePrincipalPolicyInput,
+	optFns ...func(*iam.Options),
+) (*iam.SimulatePrincipalPolicyOutput, error) {
+
+	if err := i.call(ctx, "SimulatePrincipalPolicy"); err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if aws.ToString(params.PolicySourceArn) != i.principalARN {
+		return nil, apiError(
+			"NoSuchEntity",
+			"The user with name %s cannot be found.",
+			aws.ToString(params.PolicySourceArn),
+		)
+	}
+
+	results := []types.EvaluationResult{}
+
+	for _, action := range params.ActionNames {
+		decision := types.PolicyEvaluationDecisionTypeAllowed
+
+		if i.deniedActions[action] {
+			decision = types.PolicyEvaluationDecisionTypeImplicitDeny
+		}
+
+		results = append(results, types.EvaluationResult{
+			EvalActionName:   aws.String(action),
+			EvalDecision:     decision,
+			EvalResourceName: aws.String("*"),
+		})
+	}
+
+	return &iam.SimulatePrincipalPolicyOutput{
+		EvaluationResults: results,
+	}, nil
+}
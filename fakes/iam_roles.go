@@ -0,0 +1,420 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+type fakeRole struct {
+	role             types.Role
+	attachedPolicies map[string]bool
+}
+
+func (i *IAM) CreateRole(
+	ctx context.Context,
+	params *iam.CreateRoleInput,
+	optFns ...func(*iam.Options),
+) (*iam.CreateRoleOutput, error) {
+
+	if err := i.call(ctx, "CreateRole"); err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	roleName := aws.ToString(params.RoleName)
+
+	if len(roleName) == 0 || len(roleName) > 64 {
+		return nil, apiError(
+			"ValidationError",
+			"1 validation error detected: Value '%s' at 'roleName' failed to satisfy constraint",
+			roleName,
+		)
+	}
+
+	if _, ok := i.roles[roleName]; ok {
+		return nil, apiError(
+			"EntityAlreadyExists",
+			"Role with name %s already exists.",
+			roleName,
+		)
+	}
+
+	role := &fakeRole{
+		role: types.Role{
+			RoleName:                 aws.String(roleName),
+			RoleId:                   aws.String(newIAMID("AROA", len(i.roles))),
+			Arn:                      aws.String("arn:aws:iam::123456789012:role/" + roleName),
+			Path:                     aws.String("/"),
+			AssumeRolePolicyDocument: params.AssumeRolePolicyDocument,
+			Description:              params.Description,
+			CreateDate:               aws.Time(time.Now()),
+		},
+		attachedPolicies: map[string]bool{},
+	}
+
+	i.roles[roleName] = role
+
+	createdRole := role.role
+
+	return &iam.CreateRoleOutput{
+		Role: &createdRole,
+	}, nil
+}
+
+func (i *IAM) AttachRolePolicy(
+	ctx context.Context,
+	params *iam.AttachRolePolicyInput,
+	optFns ...func(*iam.Options),
+) (*iam.AttachRolePolicyOutput, error) {
+
+	if err := i.call(ctx, "AttachRolePolicy"); err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	role, err := i.lookupRole(aws.ToString(params.RoleName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	role.attachedPolicies[aws.ToString(params.PolicyArn)] = true
+
+	return &iam.AttachRolePolicyOutput{}, nil
+}
+
+func (i *IAM) DetachRolePolicy(
+	ctx context.Context,
+	params *iam.DetachRolePolicyInput,
+	optFns ...func(*iam.Options),
+) (*iam.DetachRolePolicyOutput, error) {
+
+	if err := i.call(ctx, "DetachRolePolicy"); err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	role, err := i.lookupRole(aws.ToString(params.RoleName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	policyARN := aws.ToString(params.PolicyArn)
+
+	if !role.attachedPolicies[policyARN] {
+		return nil, apiError(
+			"NoSuchEntity",
+			"Policy %s was not found.",
+			policyARN,
+		)
+	}
+
+	delete(role.attachedPolicies, policyARN)
+
+	return &iam.DetachRolePolicyOutput{}, nil
+}
+
+func (i *IAM) DeleteRole(
+	ctx context.Context,
+	params *iam.DeleteRoleInput,
+	optFns ...func(*iam.Options),
+) (*iam.DeleteRoleOutput, error) {
+
+	if err := i.call(ctx, "DeleteRole"); err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	roleName := aws.ToString(params.RoleName)
+
+	role, err := i.lookupRole(roleName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hasDependencies := len(role.attachedPolicies) > 0
+
+	for _, instanceProfile := range i.instanceProfiles {
+		for _, instanceProfileRole := range instanceProfile.Roles {
+			hasDependencies = hasDependencies ||
+				aws.ToString(instanceProfileRole.RoleName) == roleName
+		}
+	}
+
+	if hasDependencies {
+		return nil, apiError(
+			"DeleteConflict",
+			"Cannot delete entity, must remove roles from instance profile and detach policies first.",
+		)
+	}
+
+	delete(i.roles, roleName)
+
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+func (i *IAM) CreateInstanceProfile(
+	ctx context.Context,
+	params *iam.CreateInstanceProfileInput,
+	optFns ...func(*iam.Options),
+) (*iam.CreateInstanceProfileOutput, error) {
+
+	if err := i.call(ctx, "CreateInstanceProfile"); err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	instanceProfileName := aws.ToString(params.InstanceProfileName)
+
+	if _, ok := i.instanceProfiles[instanceProfileName]; ok {
+		return nil, apiError(
+			"EntityAlreadyExists",
+			"Instance Profile %s already exists.",
+			instanceProfileName,
+		)
+	}
+
+	instanceProfile := &types.InstanceProfile{
+		InstanceProfileName: aws.String(instanceProfileName),
+		InstanceProfileId:   aws.String(newIAMID("AIPA", len(i.instanceProfiles))),
+		Arn: aws.String(
+			"arn:aws:iam::123456789012:instance-profile/" + instanceProfileName,
+		),
+		Path:       aws.String("/"),
+		CreateDate: aws.Time(time.Now()),
+		Roles:      []types.Role{},
+	}
+
+	i.instanceProfiles[instanceProfileName] = instanceProfile
+
+	return &iam.CreateInstanceProfileOutput{
+		InstanceProfile: copyInstanceProfile(*instanceProfile),
+	}, nil
+}
+
+func (i *IAM) AddRoleToInstanceProfile(
+	ctx context.Context,
+	params *iam.AddRoleToInstanceProfileInput,
+	optFns ...func(*iam.Options),
+) (*iam.AddRoleToInstanceProfileOutput, error) {
+
+	if err := i.call(ctx, "AddRoleToInstanceProfile"); err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	instanceProfile, err := i.lookupInstanceProfile(aws.ToString(params.InstanceProfileName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := i.lookupRole(aws.ToString(params.RoleName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// An instance profile could only contain one role
+	if len(instanceProfile.Roles) > 0 {
+		return nil, apiError(
+			"LimitExceeded",
+			"Cannot exceed quota for InstanceSessionsPerInstanceProfile: 1",
+		)
+	}
+
+	instanceProfile.Roles = append(instanceProfile.Roles, role.role)
+
+	return &iam.AddRoleToInstanceProfileOutput{}, nil
+}
+
+func (i *IAM) RemoveRoleFromInstanceProfile(
+	ctx context.Context,
+	params *iam.RemoveRoleFromInstanceProfileInput,
+	optFns ...func(*iam.Options),
+) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+
+	if err := i.call(ctx, "RemoveRoleFromInstanceProfile"); err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	instanceProfile, err := i.lookupInstanceProfile(aws.ToString(params.InstanceProfileName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []types.Role{}
+
+	for _, role := range instanceProfile.Roles {
+		if aws.ToString(role.RoleName) != aws.ToString(params.RoleName) {
+			roles = append(roles, role)
+		}
+	}
+
+	if len(roles) == len(instanceProfile.Roles) {
+		return nil, apiError(
+			"NoSuchEntity",
+			"The role with name %s cannot be found.",
+			aws.ToString(params.RoleName),
+		)
+	}
+
+	instanceProfile.Roles = roles
+
+	return &iam.RemoveRoleFromInstanceProfileOutput{}, nil
+}
+
+func (i *IAM) DeleteInstanceProfile(
+	ctx context.Context,
+	params *iam.DeleteInstanceProfileInput,
+	optFns ...func(*iam.Options),
+) (*iam.DeleteInstanceProfileOutput, error) {
+
+	if err := i.call(ctx, "DeleteInstanceProfile"); err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	instanceProfileName := aws.ToString(params.InstanceProfileName)
+
+	instanceProfile, err := i.lookupInstanceProfile(instanceProfileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(instanceProfile.Roles) > 0 {
+		return nil, apiError(
+			"DeleteConflict",
+			"Cannot delete entity, must remove roles from instance profile first.",
+		)
+	}
+
+	delete(i.instanceProfiles, instanceProfileName)
+
+	return &iam.DeleteInstanceProfileOutput{}, nil
+}
+
+func (i *IAM) GetInstanceProfile(
+	ctx context.Context,
+	params *iam.GetInstanceProfileInput,
+	optFns ...func(*iam.Options),
+) (*iam.GetInstanceProfileOutput, error) {
+
+	if err := i.call(ctx, "GetInstanceProfile"); err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	instanceProfile, err := i.lookupInstanceProfile(aws.ToString(params.InstanceProfileName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &iam.GetInstanceProfileOutput{
+		InstanceProfile: copyInstanceProfile(*instanceProfile),
+	}, nil
+}
+
+// InstanceProfileHasPolicy reports whether the role of the passed
+// instance profile has the passed managed policy attached.
+func (i *IAM) InstanceProfileHasPolicy(instanceProfileName, policyARN string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	instanceProfile, ok := i.instanceProfiles[instanceProfileName]
+
+	if !ok {
+		return false
+	}
+
+	for _, instanceProfileRole := range instanceProfile.Roles {
+		role, ok := i.roles[aws.ToString(instanceProfileRole.RoleName)]
+
+		if ok && role.attachedPolicies[policyARN] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResourceCounts returns the number of
+// roles and instance profiles by type.
+func (i *IAM) ResourceCounts() map[string]int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return map[string]int{
+		"role":             len(i.roles),
+		"instance-profile": len(i.instanceProfiles),
+	}
+}
+
+// Must be called with the lock held.
+func (i *IAM) lookupRole(roleName string) (*fakeRole, error) {
+	role, ok := i.roles[roleName]
+
+	if !ok {
+		return nil, apiError(
+			"NoSuchEntity",
+			"The role with name %s cannot be found.",
+			roleName,
+		)
+	}
+
+	return role, nil
+}
+
+// Must be called with the lock held.
+func (i *IAM) lookupInstanceProfile(instanceProfileName string) (*types.InstanceProfile, error) {
+	instanceProfile, ok := i.instanceProfiles[instanceProfileName]
+
+	if !ok {
+		return nil, apiError(
+			"NoSuchEntity",
+			"Instance Profile %s cannot be found.",
+			instanceProfileName,
+		)
+	}
+
+	return instanceProfile, nil
+}
+
+func copyInstanceProfile(instanceProfile types.InstanceProfile) *types.InstanceProfile {
+	instanceProfile.Roles = append([]types.Role{}, instanceProfile.Roles...)
+	return &instanceProfile
+}
+
+func newIAMID(prefix string, index int) string {
+	return prefix + strings.ToUpper(fmt.Sprintf("%017x", index+1))
+}
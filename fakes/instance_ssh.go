@@ -0,0 +1,84 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// InstanceSSH is a fake SSH client that reaches
+// the instances of a fake EC2 API.
+//
+// An instance is considered reachable
+// once it is running with a public IP address.
+type InstanceSSH struct {
+	faults
+
+	ec2 *EC2
+}
+
+// NewInstanceSSH constructs a fake SSH client
+// for the instances of the passed fake EC2 API.
+func NewInstanceSSH(ec2 *EC2) *InstanceSSH {
+	return &InstanceSSH{
+		ec2: ec2,
+	}
+}
+
+func (i *InstanceSSH) LookupInitInstanceScriptResults(
+	ctx context.Context,
+	instancePublicIPAddress string,
+	instanceSSHPort string,
+	instanceLoginUser string,
+	sshPrivateKeyContent string,
+) (*infrastructure.InitInstanceScriptResults, error) {
+
+	if err := i.call(ctx, "LookupInitInstanceScriptResults"); err != nil {
+		return nil, err
+	}
+
+	instance, found := i.ec2.InstanceByPublicIP(instancePublicIPAddress)
+
+	if !found {
+		return nil, fmt.Errorf(
+			"no running instance found with public IP address \"%s\"",
+			instancePublicIPAddress,
+		)
+	}
+
+	PEMContent, found := i.ec2.KeyPairPEMContent(aws.ToString(instance.KeyName))
+
+	if !found || PEMContent != sshPrivateKeyContent {
+		return nil, fmt.Errorf(
+			"ssh: unable to authenticate as \"%s\" on \"%s\"",
+			instanceLoginUser,
+			instancePublicIPAddress,
+		)
+	}
+
+	return &infrastructure.InitInstanceScriptResults{
+		ExitCode: "0",
+	}, nil
+}
+
+func (i *InstanceSSH) WaitForSSHAvailableInInstance(
+	ctx context.Context,
+	instancePublicIPAddress string,
+	instanceSSHPort string,
+) error {
+
+	if err := i.call(ctx, "WaitForSSHAvailableInInstance"); err != nil {
+		return err
+	}
+
+	if _, found := i.ec2.InstanceByPublicIP(instancePublicIPAddress); !found {
+		return fmt.Errorf(
+			"no running instance found with public IP address \"%s\"",
+			instancePublicIPAddress,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// The services that the SSM agent of
+// the instances must reach to open sessions.
+var ssmAgentServices = []string{
+	"ec2messages",
+	"ssm",
+	"ssmmessages",
+}
+
+// InstanceSSM is a fake SSM Session Manager client that
+// reaches the instances of a fake EC2 API by their ID.
+//
+// An instance is considered reachable once it is running
+// with an instance profile that has the SSM managed policy
+// attached (in the fake IAM API) and once its VPC has
+// available endpoints for all the SSM services.
+type InstanceSSM struct {
+	faults
+
+	ec2 *EC2
+	iam *IAM
+}
+
+// NewInstanceSSM constructs a fake SSM Session Manager
+// client for the instances of the passed fake EC2 API.
+func NewInstanceSSM(ec2 *EC2, iam *IAM) *InstanceSSM {
+	return &InstanceSSM{
+		ec2: ec2,
+		iam: iam,
+	}
+}
+
+func (i *InstanceSSM) LookupInitInstanceScriptResults(
+	ctx context.Context,
+	instanceID string,
+	instanceSSHPort string,
+	instanceLoginUser string,
+	sshPrivateKeyContent string,
+) (*infrastructure.InitInstanceScriptResults, error) {
+
+	if err := i.call(ctx, "LookupInitInstanceScriptResults"); err != nil {
+		return nil, err
+	}
+
+	instance, err := i.lookupConnectedInstance(instanceID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	PEMContent, found := i.ec2.KeyPairPEMContent(aws.ToString(instance.KeyName))
+
+	if !found || PEMContent != sshPrivateKeyContent {
+		return nil, fmt.Errorf(
+			"ssh: unable to authenticate as \"%s\" on \"%s\"",
+			instanceLoginUser,
+			instanceID,
+		)
+	}
+
+	return &infrastructure.InitInstanceScriptResults{
+		ExitCode: "0",
+	}, nil
+}
+
+func (i *InstanceSSM) WaitForSSHAvailableInInstance(
+	ctx context.Context,
+	instanceID string,
+	instanceSSHPort string,
+) error {
+
+	if err := i.call(ctx, "WaitForSSHAvailableInInstance"); err != nil {
+		return err
+	}
+
+	_, err := i.lookupConnectedInstance(instanceID)
+	return err
+}
+
+func (i *InstanceSSM) lookupConnectedInstance(instanceID string) (*types.Instance, error) {
+	instance, found := i.ec2.InstanceByID(instanceID)
+
+	if !found {
+		return nil, fmt.Errorf(
+			"no running instance found with ID \"%s\"",
+			instanceID,
+		)
+	}
+
+	if instance.IamInstanceProfile == nil {
+		return nil, infrastructure.ErrInstanceNotConnectedToSSM
+	}
+
+	instanceProfileARN := aws.ToString(instance.IamInstanceProfile.Arn)
+	instanceProfileName := instanceProfileARN[strings.LastIndex(instanceProfileARN, "/")+1:]
+
+	hasSSMPolicy := i.iam.InstanceProfileHasPolicy(
+		instanceProfileName,
+		"arn:aws:iam::aws:policy/"+infrastructure.SSMManagedInstancePolicyName,
+	)
+
+	if !hasSSMPolicy {
+		return nil, infrastructure.ErrInstanceNotConnectedToSSM
+	}
+
+	for _, service := range ssmAgentServices {
+		if !i.ec2.HasAvailableVPCEndpoint(aws.ToString(instance.VpcId), service) {
+			return nil, infrastructure.ErrInstanceNotConnectedToSSM
+		}
+	}
+
+	return instance, nil
+}
@@ -0,0 +1,232 @@
+package fakes
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// KMS is an in-memory implementation of the KMS API
+// (see infrastructure.KMSAPI).
+//
+// Like in AWS, ciphertext blobs embed the ID of the
+// key used to encrypt them and could only be decrypted
+// while this key exists.
+type KMS struct {
+	faults
+
+	mu sync.Mutex
+
+	// Master keys indexed by key ID
+	keys      map[string][]byte
+	aliases   map[string]string
+	lastKeyID int
+	region    string
+	account   string
+}
+
+var _ infrastructure.KMSAPI = (*KMS)(nil)
+
+// NewKMS constructs a fake KMS API without keys.
+func NewKMS(region string) *KMS {
+	return &KMS{
+		keys:    map[string][]byte{},
+		aliases: map[string]string{},
+		region:  region,
+		account: "123456789012",
+	}
+}
+
+// CreateKey creates a symmetric key and returns its ARN.
+// The passed alias (eg: "alias/recode") could be empty.
+func (k *KMS) CreateKey(alias string) string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.lastKeyID++
+
+	keyID := fmt.Sprintf(
+		"arn:aws:kms:%s:%s:key/00000000-0000-0000-0000-%012x",
+		k.region,
+		k.account,
+		k.lastKeyID,
+	)
+
+	k.keys[keyID] = randomBytes(32)
+
+	if len(alias) > 0 {
+		k.aliases[alias] = keyID
+	}
+
+	return keyID
+}
+
+// ScheduleKeyDeletion removes the passed key
+// immediately (no pending window).
+func (k *KMS) ScheduleKeyDeletion(keyID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.keys, keyID)
+}
+
+func (k *KMS) GenerateDataKey(
+	ctx context.Context,
+	params *kms.GenerateDataKeyInput,
+	optFns ...func(*kms.Options),
+) (*kms.GenerateDataKeyOutput, error) {
+
+	if err := k.call(ctx, "GenerateDataKey"); err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keyID, masterKey, err := k.lookupKey(aws.ToString(params.KeyId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if params.KeySpec != types.DataKeySpecAes256 {
+		return nil, &types.InvalidKeyUsageException{
+			Message: aws.String("Only AES_256 data keys are supported by the fake"),
+		}
+	}
+
+	plaintext := randomBytes(32)
+	ciphertextBlob, err := sealWithKey(masterKey, plaintext)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          aws.String(keyID),
+		Plaintext:      plaintext,
+		CiphertextBlob: append([]byte(keyID+"\n"), ciphertextBlob...),
+	}, nil
+}
+
+func (k *KMS) Decrypt(
+	ctx context.Context,
+	params *kms.DecryptInput,
+	optFns ...func(*kms.Options),
+) (*kms.DecryptOutput, error) {
+
+	if err := k.call(ctx, "Decrypt"); err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	separatorIndex := bytes.IndexByte(params.CiphertextBlob, '\n')
+
+	if separatorIndex == -1 {
+		return nil, &types.InvalidCiphertextException{
+			Message: aws.String("The ciphertext is invalid"),
+		}
+	}
+
+	keyID, masterKey, err := k.lookupKey(string(params.CiphertextBlob[:separatorIndex]))
+
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := openWithKey(masterKey, params.CiphertextBlob[separatorIndex+1:])
+
+	if err != nil {
+		return nil, &types.InvalidCiphertextException{
+			Message: aws.String("The ciphertext is invalid"),
+		}
+	}
+
+	return &kms.DecryptOutput{
+		KeyId:     aws.String(keyID),
+		Plaintext: plaintext,
+	}, nil
+}
+
+func (k *KMS) lookupKey(keyIDOrAlias string) (string, []byte, error) {
+	keyID := keyIDOrAlias
+
+	if strings.HasPrefix(keyIDOrAlias, "alias/") {
+		keyID = k.aliases[keyIDOrAlias]
+	}
+
+	masterKey, ok := k.keys[keyID]
+
+	if !ok {
+		return "", nil, &types.NotFoundException{
+			Message: aws.String(fmt.Sprintf("Key '%s' does not exist", keyIDOrAlias)),
+		}
+	}
+
+	return keyID, masterKey, nil
+}
+
+func randomBytes(length int) []byte {
+	randomBytes := make([]byte, length)
+
+	if _, err := rand.Read(randomBytes); err != nil {
+		panic(err)
+	}
+
+	return randomBytes
+}
+
+func sealWithKey(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := randomBytes(gcm.NonceSize())
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openWithKey(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	return gcm.Open(
+		nil,
+		ciphertext[:gcm.NonceSize()],
+		ciphertext[gcm.NonceSize():],
+		nil,
+	)
+}
@@ -0,0 +1,273 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// Route53 is an in-memory implementation of the Route 53 API
+// (see infrastructure.Route53API).
+//
+// The hosted zones are created with CreateHostedZone. The
+// change batches are applied atomically and return the same
+// error codes as in AWS (eg: deleting a record whose values
+// don't match fails with "InvalidChangeBatch").
+type Route53 struct {
+	faults
+
+	mu sync.Mutex
+
+	lastID      int
+	hostedZones map[string]*fakeHostedZone
+}
+
+type fakeHostedZone struct {
+	hostedZone types.HostedZone
+
+	// Indexed by name (with the trailing dot) then type
+	records map[string]types.ResourceRecordSet
+}
+
+var _ infrastructure.Route53API = (*Route53)(nil)
+
+// NewRoute53 constructs a fake Route 53 API without hosted zones.
+func NewRoute53() *Route53 {
+	return &Route53{
+		hostedZones: map[string]*fakeHostedZone{},
+	}
+}
+
+// CreateHostedZone creates a public hosted
+// zone for the passed domain and returns its ID.
+func (r *Route53) CreateHostedZone(domainName string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	hostedZoneID := fmt.Sprintf("Z%010d", r.lastID)
+
+	r.hostedZones[hostedZoneID] = &fakeHostedZone{
+		hostedZone: types.HostedZone{
+			Id:              aws.String("/hostedzone/" + hostedZoneID),
+			Name:            aws.String(fullyQualifiedDomainName(domainName)),
+			CallerReference: aws.String(hostedZoneID),
+		},
+		records: map[string]types.ResourceRecordSet{},
+	}
+
+	return hostedZoneID
+}
+
+// RecordValues returns the values of the record matching
+// the passed name and type in the hosted zone.
+func (r *Route53) RecordValues(
+	hostedZoneID string,
+	name string,
+	recordType types.RRType,
+) ([]string, bool) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hostedZone, ok := r.hostedZones[hostedZoneID]
+
+	if !ok {
+		return nil, false
+	}
+
+	record, ok := hostedZone.records[recordKey(name, recordType)]
+
+	if !ok {
+		return nil, false
+	}
+
+	values := []string{}
+
+	for _, resourceRecord := range record.ResourceRecords {
+		values = append(values, aws.ToString(resourceRecord.Value))
+	}
+
+	return values, true
+}
+
+// RecordCount returns the number of records
+// created with ChangeResourceRecordSets.
+func (r *Route53) RecordCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+
+	for _, hostedZone := range r.hostedZones {
+		count += len(hostedZone.records)
+	}
+
+	return count
+}
+
+func (r *Route53) GetHostedZone(
+	ctx context.Context,
+	params *route53.GetHostedZoneInput,
+	optFns ...func(*route53.Options),
+) (*route53.GetHostedZoneOutput, error) {
+
+	if err := r.call(ctx, "GetHostedZone"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hostedZone, err := r.lookupHostedZone(aws.ToString(params.Id))
+
+	if err != nil {
+		return nil, err
+	}
+
+	copiedHostedZone := hostedZone.hostedZone
+
+	return &route53.GetHostedZoneOutput{
+		HostedZone: &copiedHostedZone,
+	}, nil
+}
+
+func (r *Route53) ChangeResourceRecordSets(
+	ctx context.Context,
+	params *route53.ChangeResourceRecordSetsInput,
+	optFns ...func(*route53.Options),
+) (*route53.ChangeResourceRecordSetsOutput, error) {
+
+	if err := r.call(ctx, "ChangeResourceRecordSets"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hostedZone, err := r.lookupHostedZone(aws.ToString(params.HostedZoneId))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if params.ChangeBatch == nil || len(params.ChangeBatch.Changes) == 0 {
+		return nil, apiError("InvalidChangeBatch", "the change batch is empty")
+	}
+
+	// Applied on a copy so that
+	// the batch is atomic
+	records := map[string]types.ResourceRecordSet{}
+
+	for key, record := range hostedZone.records {
+		records[key] = record
+	}
+
+	zoneName := aws.ToString(hostedZone.hostedZone.Name)
+
+	for _, change := range params.ChangeBatch.Changes {
+		record := *change.ResourceRecordSet
+		name := fullyQualifiedDomainName(aws.ToString(record.Name))
+
+		if name != zoneName && !strings.HasSuffix(name, "."+zoneName) {
+			return nil, apiError(
+				"InvalidChangeBatch",
+				"RRSet with DNS name %s is not permitted in zone %s",
+				name,
+				zoneName,
+			)
+		}
+
+		record.Name = aws.String(name)
+		record.ResourceRecords = append([]types.ResourceRecord{}, record.ResourceRecords...)
+
+		key := recordKey(name, record.Type)
+		existingRecord, exists := records[key]
+
+		switch change.Action {
+		case types.ChangeActionCreate:
+			if exists {
+				return nil, apiError(
+					"InvalidChangeBatch",
+					"Tried to create resource record set [name='%s', type='%s'] but it already exists",
+					name,
+					record.Type,
+				)
+			}
+
+			records[key] = record
+		case types.ChangeActionUpsert:
+			records[key] = record
+		case types.ChangeActionDelete:
+			if !exists || !sameResourceRecordSet(existingRecord, record) {
+				return nil, apiError(
+					"InvalidChangeBatch",
+					"Tried to delete resource record set [name='%s', type='%s'] but it was not found",
+					name,
+					record.Type,
+				)
+			}
+
+			delete(records, key)
+		default:
+			return nil, apiError("InvalidInput", "unknown action %s", change.Action)
+		}
+	}
+
+	hostedZone.records = records
+	r.lastID++
+
+	return &route53.ChangeResourceRecordSetsOutput{
+		ChangeInfo: &types.ChangeInfo{
+			Id:     aws.String(fmt.Sprintf("/change/C%010d", r.lastID)),
+			Status: types.ChangeStatusPending,
+		},
+	}, nil
+}
+
+// Must be called with the lock held.
+func (r *Route53) lookupHostedZone(hostedZoneID string) (*fakeHostedZone, error) {
+	hostedZone, ok := r.hostedZones[strings.TrimPrefix(hostedZoneID, "/hostedzone/")]
+
+	if !ok {
+		return nil, apiError(
+			"NoSuchHostedZone",
+			"No hosted zone found with ID: %s",
+			hostedZoneID,
+		)
+	}
+
+	return hostedZone, nil
+}
+
+func fullyQualifiedDomainName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".") + "."
+}
+
+func recordKey(name string, recordType types.RRType) string {
+	return fullyQualifiedDomainName(name) + "/" + string(recordType)
+}
+
+// sameResourceRecordSet returns whether the passed records
+// match (a deleted record must match the existing one).
+func sameResourceRecordSet(a, b types.ResourceRecordSet) bool {
+	if aws.ToInt64(a.TTL) != aws.ToInt64(b.TTL) ||
+		len(a.ResourceRecords) != len(b.ResourceRecords) {
+
+		return false
+	}
+
+	for i := range a.ResourceRecords {
+		if aws.ToString(a.ResourceRecords[i].Value) != aws.ToString(b.ResourceRecords[i].Value) {
+			return false
+		}
+	}
+
+	return true
+}
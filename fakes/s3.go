@@ -0,0 +1,297 @@
+package fakes
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// S3 is an in-memory implementation of the S3 API
+// (see infrastructure.S3API).
+//
+// Like in AWS, the IfMatch and IfNoneMatch conditions
+// of PutObject and DeleteObject requests are honored.
+type S3 struct {
+	faults
+
+	mu sync.Mutex
+
+	// Objects indexed by bucket then by key
+	buckets map[string]map[string]fakeObject
+}
+
+type fakeObject struct {
+	content []byte
+	ETag    string
+}
+
+var _ infrastructure.S3API = (*S3)(nil)
+
+// NewS3 constructs a fake S3 API without buckets.
+func NewS3() *S3 {
+	return &S3{
+		buckets: map[string]map[string]fakeObject{},
+	}
+}
+
+// Keys returns the keys of the objects
+// stored in the passed bucket (sorted).
+func (s *S3) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedKeys(s.buckets[bucket])
+}
+
+func (s *S3) CreateBucket(
+	ctx context.Context,
+	params *s3.CreateBucketInput,
+	optFns ...func(*s3.Options),
+) (*s3.CreateBucketOutput, error) {
+
+	if err := s.call(ctx, "CreateBucket"); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket := aws.ToString(params.Bucket)
+
+	if _, ok := s.buckets[bucket]; ok {
+		return nil, &types.BucketAlreadyOwnedByYou{
+			Message: aws.String("Your previous request to create the named bucket succeeded and you already own it."),
+		}
+	}
+
+	s.buckets[bucket] = map[string]fakeObject{}
+
+	return &s3.CreateBucketOutput{
+		Location: aws.String("/" + bucket),
+	}, nil
+}
+
+func (s *S3) HeadBucket(
+	ctx context.Context,
+	params *s3.HeadBucketInput,
+	optFns ...func(*s3.Options),
+) (*s3.HeadBucketOutput, error) {
+
+	if err := s.call(ctx, "HeadBucket"); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[aws.ToString(params.Bucket)]; !ok {
+		return nil, &types.NotFound{}
+	}
+
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (s *S3) ListObjectsV2(
+	ctx context.Context,
+	params *s3.ListObjectsV2Input,
+	optFns ...func(*s3.Options),
+) (*s3.ListObjectsV2Output, error) {
+
+	if err := s.call(ctx, "ListObjectsV2"); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects, err := s.lookupBucket(aws.ToString(params.Bucket))
+
+	if err != nil {
+		return nil, err
+	}
+
+	contents := []types.Object{}
+
+	for _, key := range sortedKeys(objects) {
+		if !strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			continue
+		}
+
+		contents = append(contents, types.Object{
+			Key:  aws.String(key),
+			ETag: aws.String(objects[key].ETag),
+			Size: aws.Int64(int64(len(objects[key].content))),
+		})
+	}
+
+	return &s3.ListObjectsV2Output{
+		Contents: contents,
+		KeyCount: aws.Int32(int32(len(contents))),
+	}, nil
+}
+
+func (s *S3) GetObject(
+	ctx context.Context,
+	params *s3.GetObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.GetObjectOutput, error) {
+
+	if err := s.call(ctx, "GetObject"); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects, err := s.lookupBucket(aws.ToString(params.Bucket))
+
+	if err != nil {
+		return nil, err
+	}
+
+	object, ok := objects[aws.ToString(params.Key)]
+
+	if !ok {
+		return nil, &types.NoSuchKey{
+			Message: aws.String("The specified key does not exist."),
+		}
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(object.content)),
+		ContentLength: aws.Int64(int64(len(object.content))),
+		ETag:          aws.String(object.ETag),
+	}, nil
+}
+
+func (s *S3) PutObject(
+	ctx context.Context,
+	params *s3.PutObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.PutObjectOutput, error) {
+
+	if err := s.call(ctx, "PutObject"); err != nil {
+		return nil, err
+	}
+
+	content, err := io.ReadAll(params.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects, err := s.lookupBucket(aws.ToString(params.Bucket))
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := aws.ToString(params.Key)
+	object, exists := objects[key]
+
+	if err := checkObjectCondition(
+		object,
+		exists,
+		aws.ToString(params.IfMatch),
+		aws.ToString(params.IfNoneMatch),
+	); err != nil {
+		return nil, err
+	}
+
+	// Like in AWS, the ETag of an object
+	// uploaded in one part is its quoted MD5
+	hash := md5.Sum(content)
+	ETag := `"` + hex.EncodeToString(hash[:]) + `"`
+
+	objects[key] = fakeObject{
+		content: content,
+		ETag:    ETag,
+	}
+
+	return &s3.PutObjectOutput{
+		ETag: aws.String(ETag),
+	}, nil
+}
+
+func (s *S3) DeleteObject(
+	ctx context.Context,
+	params *s3.DeleteObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.DeleteObjectOutput, error) {
+
+	if err := s.call(ctx, "DeleteObject"); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects, err := s.lookupBucket(aws.ToString(params.Bucket))
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := aws.ToString(params.Key)
+	object, exists := objects[key]
+
+	if err := checkObjectCondition(
+		object,
+		exists,
+		aws.ToString(params.IfMatch),
+		"",
+	); err != nil {
+		return nil, err
+	}
+
+	delete(objects, key)
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (s *S3) lookupBucket(bucket string) (map[string]fakeObject, error) {
+	objects, ok := s.buckets[bucket]
+
+	if !ok {
+		return nil, &types.NoSuchBucket{
+			Message: aws.String("The specified bucket does not exist"),
+		}
+	}
+
+	return objects, nil
+}
+
+func checkObjectCondition(
+	object fakeObject,
+	exists bool,
+	ifMatch string,
+	ifNoneMatch string,
+) error {
+
+	if len(ifMatch) > 0 && !exists {
+		return apiError("NoSuchKey", "The specified key does not exist.")
+	}
+
+	if (len(ifMatch) > 0 && ifMatch != object.ETag) ||
+		(ifNoneMatch == "*" && exists) {
+
+		return apiError(
+			"PreconditionFailed",
+			"At least one of the pre-conditions you specified did not hold",
+		)
+	}
+
+	return nil
+}
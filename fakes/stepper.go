@@ -0,0 +1,31 @@
+package fakes
+
+import "sync"
+
+// Stepper is a stepper that records
+// the started steps without displaying them.
+type Stepper struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (s *Stepper) StartTemporaryStep(step string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.steps = append(s.steps, step)
+}
+
+func (s *Stepper) StartTemporaryStepWithoutNewLine(step string) {
+	s.StartTemporaryStep(step)
+}
+
+func (s *Stepper) StopCurrentStep() {}
+
+// Steps returns the started steps.
+func (s *Stepper) Steps() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.steps...)
+}
@@ -0,0 +1,47 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// STS is an in-memory implementation of the STS API
+// (see infrastructure.STSAPI).
+//
+// The caller is an IAM user named "recode".
+// Invalid credentials could be simulated with FailNext.
+type STS struct {
+	faults
+
+	account string
+}
+
+var _ infrastructure.STSAPI = (*STS)(nil)
+
+// NewSTS constructs a fake STS API.
+func NewSTS() *STS {
+	return &STS{
+		account: "123456789012",
+	}
+}
+
+func (s *STS) GetCallerIdentity(
+	ctx context.Context,
+	params *sts.GetCallerIdentityInput,
+	optFns ...func(*sts.Options),
+) (*sts.GetCallerIdentityOutput, error) {
+
+	if err := s.call(ctx, "GetCallerIdentity"); err != nil {
+		return nil, err
+	}
+
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(s.account),
+		Arn:     aws.String(fmt.Sprintf("arn:aws:iam::%s:user/recode", s.account)),
+		UserId:  aws.String("AIDAFAKEUSERID000000"),
+	}, nil
+}
@@ -0,0 +1,48 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// ElasticIP represents a public IP address that stays the
+// same across the restarts of the instance. AssociationID
+// is empty until it is associated with a network interface.
+type ElasticIP struct {
+	AllocationID    string `json:"allocation_id"`
+	PublicIPAddress string `json:"public_ip_address"`
+	AssociationID   string `json:"association_id"`
+}
+
+func AllocateElasticIP(
+	ctx context.Context,
+	ec2Client EC2API,
+	name string,
+) (*ElasticIP, error) {
+
+	allocateAddressResp, err := ec2Client.AllocateAddress(
+		ctx,
+		&ec2.AllocateAddressInput{
+			Domain: types.DomainTypeVpc,
+			TagSpecifications: []types.TagSpecification{{
+				ResourceType: types.ResourceTypeElasticIp,
+				Tags: []types.Tag{{
+					Key:   aws.String("Name"),
+					Value: &name,
+				}},
+			}},
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ElasticIP{
+		AllocationID:    aws.ToString(allocateAddressResp.AllocationId),
+		PublicIPAddress: aws.ToString(allocateAddressResp.PublicIp),
+	}, nil
+}
@@ -0,0 +1,34 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// AssociateElasticIP associates the Elastic IP with the network
+// interface (the instance launched with it gets the address as
+// public IP). The association ID is recorded in the Elastic IP.
+func AssociateElasticIP(
+	ctx context.Context,
+	ec2Client EC2API,
+	elasticIP *ElasticIP,
+	networkInterfaceID string,
+) error {
+
+	associateAddressResp, err := ec2Client.AssociateAddress(
+		ctx,
+		&ec2.AssociateAddressInput{
+			AllocationId:       aws.String(elasticIP.AllocationID),
+			NetworkInterfaceId: aws.String(networkInterfaceID),
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	elasticIP.AssociationID = aws.ToString(associateAddressResp.AssociationId)
+	return nil
+}
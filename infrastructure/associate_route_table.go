@@ -7,13 +7,14 @@ import (
 )
 
 func AssociateRouteTable(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	subnetID string,
 	routeTableID string,
 ) error {
 
 	_, err := ec2Client.AssociateRouteTable(
-		context.TODO(),
+		ctx,
 		&ec2.AssociateRouteTableInput{
 			RouteTableId: &routeTableID,
 			SubnetId:     &subnetID,
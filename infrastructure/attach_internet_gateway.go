@@ -7,13 +7,14 @@ import (
 )
 
 func AttachInternetGatewayToVPC(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	internetGatewayId string,
 	VPCID string,
 ) error {
 
 	_, err := ec2Client.AttachInternetGateway(
-		context.TODO(),
+		ctx,
 		&ec2.AttachInternetGatewayInput{
 			InternetGatewayId: &internetGatewayId,
 			VpcId:             &VPCID,
@@ -0,0 +1,20 @@
+package infrastructure
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	cleanupMaxDuration = 10 * time.Minute
+)
+
+// newCleanupContext returns the context used to roll back
+// a partially created resource.
+//
+// It is detached from the caller's context so that
+// a cancellation (Ctrl-C) doesn't leak the resources
+// created before it.
+func newCleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), cleanupMaxDuration)
+}
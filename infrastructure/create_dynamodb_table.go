@@ -17,11 +17,12 @@ var (
 )
 
 func CreateDynamoDBTableForRecodeConfig(
-	dynamoDBClient *dynamodb.Client,
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
 ) error {
 
 	_, err := dynamoDBClient.CreateTable(
-		context.TODO(),
+		ctx,
 
 		&dynamodb.CreateTableInput{
 			AttributeDefinitions: []types.AttributeDefinition{
@@ -57,7 +58,7 @@ func CreateDynamoDBTableForRecodeConfig(
 	existsWaiter := dynamodb.NewTableExistsWaiter(dynamoDBClient)
 	maxWaitTime := 5 * time.Minute
 
-	return existsWaiter.Wait(context.TODO(), &dynamodb.DescribeTableInput{
+	return existsWaiter.Wait(ctx, &dynamodb.DescribeTableInput{
 		TableName: aws.String(DynamoDBRecodeConfigTableName),
 	}, maxWaitTime)
 }
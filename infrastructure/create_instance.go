@@ -4,12 +4,15 @@ import (
 	"context"
 	_ "embed"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 )
 
 const (
@@ -29,41 +32,103 @@ type InstanceVolume struct {
 }
 
 type Instance struct {
-	ID                string                     `json:"id"`
+	ID string `json:"id"`
+
+	// The persistent request of the spot
+	// instances (empty for the on-demand ones)
+	SpotInstanceRequestID string `json:"spot_instance_request_id"`
+
 	Type              string                     `json:"type"`
 	PublicIPAddress   string                     `json:"public_ip_address"`
 	PublicHostname    string                     `json:"public_hostname"`
+	IPv6Address       string                     `json:"ipv6_address"`
 	Volumes           []InstanceVolume           `json:"volumes"`
 	InitScriptResults *InitInstanceScriptResults `json:"init_script_results"`
 }
 
+// CreateInstance launches an instance that runs the init script
+// on first boot. The instance is a spot one if spot is set
+// (ErrSpotCapacityUnavailable is returned if there is no capacity).
 func CreateInstance(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	name string,
 	AMIID string,
 	rootDeviceName string,
 	instanceType string,
 	networkInterfaceID string,
 	keyName string,
-) (returnedInstance *Instance, returnedError error) {
+	instanceProfileName string,
+	spot *InstanceSpotOpts,
+) (*Instance, error) {
 
 	instanceInitScriptAsB64 := base64.StdEncoding.EncodeToString(
 		[]byte(instanceInitScript),
 	)
 
-	runInstancesResp, err := ec2Client.RunInstances(context.TODO(), &ec2.RunInstancesInput{
-		ImageId:      &AMIID,
-		InstanceType: types.InstanceType(instanceType),
-		MinCount:     aws.Int32(1),
-		MaxCount:     aws.Int32(1),
+	runInstancesInput := newRunInstancesInput(
+		name,
+		AMIID,
+		rootDeviceName,
+		instanceType,
+		networkInterfaceID,
+		keyName,
+		instanceProfileName,
+	)
+
+	runInstancesInput.UserData = &instanceInitScriptAsB64
+
+	if spot != nil {
+		runInstancesInput.InstanceMarketOptions = &types.InstanceMarketOptionsRequest{
+			MarketType: types.MarketTypeSpot,
+			SpotOptions: &types.SpotMarketOptions{
+				SpotInstanceType:             types.SpotInstanceTypePersistent,
+				InstanceInterruptionBehavior: types.InstanceInterruptionBehaviorStop,
+			},
+		}
+
+		if len(spot.MaxPrice) > 0 {
+			runInstancesInput.InstanceMarketOptions.SpotOptions.MaxPrice = aws.String(spot.MaxPrice)
+		}
+	}
+
+	return runInstance(ctx, ec2Client, runInstancesInput)
+}
+
+// newRunInstancesInput returns the input used to launch
+// the instances (without user data, on-demand).
+func newRunInstancesInput(
+	name string,
+	AMIID string,
+	rootDeviceName string,
+	instanceType string,
+	networkInterfaceID string,
+	keyName string,
+	instanceProfileName string,
+) *ec2.RunInstancesInput {
+
+	// No instance profile for the dev envs reached via SSH
+	var instanceProfile *types.IamInstanceProfileSpecification
+
+	if len(instanceProfileName) > 0 {
+		instanceProfile = &types.IamInstanceProfileSpecification{
+			Name: &instanceProfileName,
+		}
+	}
+
+	return &ec2.RunInstancesInput{
+		IamInstanceProfile: instanceProfile,
+		ImageId:            &AMIID,
+		InstanceType:       types.InstanceType(instanceType),
+		MinCount:           aws.Int32(1),
+		MaxCount:           aws.Int32(1),
 		NetworkInterfaces: []types.InstanceNetworkInterfaceSpecification{
 			{
 				DeviceIndex:        aws.Int32(0),
 				NetworkInterfaceId: aws.String(networkInterfaceID),
 			},
 		},
-		KeyName:  &keyName,
-		UserData: &instanceInitScriptAsB64,
+		KeyName: &keyName,
 		BlockDeviceMappings: []types.BlockDeviceMapping{
 			{
 				DeviceName: &rootDeviceName,
@@ -79,33 +144,63 @@ func CreateInstance(
 				Value: &name,
 			}},
 		}},
-	})
+	}
+}
+
+// runInstance launches the instance described by the passed input
+// and waits for it to be running. The instance is terminated (and
+// its spot request cancelled) if the wait fails.
+func runInstance(
+	ctx context.Context,
+	ec2Client EC2API,
+	runInstancesInput *ec2.RunInstancesInput,
+) (returnedInstance *Instance, returnedError error) {
+
+	isSpot := runInstancesInput.InstanceMarketOptions != nil
+
+	runInstancesResp, err := runInstancesWhenProfilePropagated(ctx, ec2Client, runInstancesInput)
 
 	if err != nil {
+		if isSpot {
+			err = spotCapacityError(err)
+		}
+
 		returnedError = err
 		return
 	}
 
 	instanceID := *runInstancesResp.Instances[0].InstanceId
+	spotInstanceRequestID := aws.ToString(runInstancesResp.Instances[0].SpotInstanceRequestId)
 
 	defer func() {
 		if returnedError == nil {
 			return
 		}
 
-		_ = TerminateInstance(ec2Client, instanceID)
+		cleanupCtx, cancelCleanup := newCleanupContext()
+		defer cancelCleanup()
+
+		if len(spotInstanceRequestID) > 0 {
+			_ = CancelSpotInstanceRequest(cleanupCtx, ec2Client, spotInstanceRequestID)
+		}
+
+		_ = TerminateInstance(cleanupCtx, ec2Client, instanceID)
 	}()
 
 	runningWaiter := ec2.NewInstanceRunningWaiter(ec2Client)
 	maxWaitTime := 5 * time.Minute
 
-	err = runningWaiter.Wait(context.TODO(), &ec2.DescribeInstancesInput{
+	err = runningWaiter.Wait(ctx, &ec2.DescribeInstancesInput{
 		InstanceIds: []string{
 			instanceID,
 		},
 	}, maxWaitTime)
 
 	if err != nil {
+		if isSpot {
+			err = spotInterruptionError(ctx, ec2Client, instanceID, err)
+		}
+
 		returnedError = err
 		return
 	}
@@ -113,18 +208,21 @@ func CreateInstance(
 	/* Public IP / DNS are only available
 	when instance is running */
 
-	createdInstance, err := lookupInstance(ec2Client, instanceID)
+	createdInstance, err := lookupInstance(ctx, ec2Client, instanceID)
 
 	if err != nil {
 		returnedError = err
 		return
 	}
 
+	// No public IP in subnets routed to a NAT gateway
 	returnedInstance = &Instance{
-		ID:              *createdInstance.InstanceId,
-		PublicIPAddress: *createdInstance.PublicIpAddress,
-		PublicHostname:  *createdInstance.PublicDnsName,
-		Type:            string(createdInstance.InstanceType),
+		ID:                    *createdInstance.InstanceId,
+		SpotInstanceRequestID: spotInstanceRequestID,
+		PublicIPAddress:       aws.ToString(createdInstance.PublicIpAddress),
+		PublicHostname:        aws.ToString(createdInstance.PublicDnsName),
+		IPv6Address:           instanceIPv6Address(createdInstance),
+		Type:                  string(createdInstance.InstanceType),
 	}
 
 	var volumes []InstanceVolume
@@ -148,3 +246,39 @@ func CreateInstance(
 	returnedInstance.Volumes = volumes
 	return
 }
+
+// runInstancesWhenProfilePropagated retries RunInstances while the
+// instance profile is not yet visible to EC2 (IAM is eventually
+// consistent so a new profile could be rejected for a few seconds).
+func runInstancesWhenProfilePropagated(
+	ctx context.Context,
+	ec2Client EC2API,
+	runInstancesInput *ec2.RunInstancesInput,
+) (*ec2.RunInstancesOutput, error) {
+
+	pollTimeoutChan := time.After(2 * time.Minute)
+	pollSleepDuration := time.Second * 5
+
+	for {
+		runInstancesResp, err := ec2Client.RunInstances(ctx, runInstancesInput)
+
+		var APIErr smithy.APIError
+
+		if runInstancesInput.IamInstanceProfile == nil || !errors.As(err, &APIErr) ||
+			APIErr.ErrorCode() != "InvalidParameterValue" ||
+			!strings.Contains(APIErr.ErrorMessage(), "iamInstanceProfile") {
+
+			return runInstancesResp, err
+		}
+
+		select {
+		case <-pollTimeoutChan:
+			return nil, err
+		default:
+		}
+
+		if err := sleepWithContext(ctx, pollSleepDuration); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// CreateInstanceFromRootVolume launches an on-demand instance that
+// boots on the passed (detached) root volume, eg: the one of a spot
+// instance that could not be started. The instance is launched
+// without user data given that the volume is already initialized,
+// then stopped to replace its root volume. It is returned stopped.
+// Like the other root volumes, the passed one is deleted when the
+// instance is terminated.
+func CreateInstanceFromRootVolume(
+	ctx context.Context,
+	ec2Client EC2API,
+	name string,
+	AMIID string,
+	instanceType string,
+	networkInterfaceID string,
+	keyName string,
+	instanceProfileName string,
+	rootVolume InstanceVolume,
+) (returnedInstance *Instance, returnedError error) {
+
+	instance, err := runInstance(ctx, ec2Client, newRunInstancesInput(
+		name,
+		AMIID,
+		rootVolume.DeviceName,
+		instanceType,
+		networkInterfaceID,
+		keyName,
+		instanceProfileName,
+	))
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	// The passed root volume is kept on termination
+	// until the last step (attached by AttachVolume)
+	defer func() {
+		if returnedError == nil {
+			return
+		}
+
+		cleanupCtx, cancelCleanup := newCleanupContext()
+		defer cancelCleanup()
+
+		_ = TerminateInstance(cleanupCtx, ec2Client, instance.ID)
+	}()
+
+	err = StopInstance(ctx, ec2Client, instance)
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	launchedRootVolume := instance.Volumes[0]
+
+	detachVolumeResp := DetachVolume(
+		ctx,
+		ec2Client,
+		instance.ID,
+		launchedRootVolume.ID,
+		launchedRootVolume.DeviceName,
+	)
+
+	if detachVolumeResp.Err != nil {
+		returnedError = detachVolumeResp.Err
+		return
+	}
+
+	removeVolumeResp := RemoveVolume(ctx, ec2Client, launchedRootVolume.ID)
+
+	if removeVolumeResp.Err != nil {
+		returnedError = removeVolumeResp.Err
+		return
+	}
+
+	attachVolumeResp := AttachVolume(
+		ctx,
+		ec2Client,
+		instance.ID,
+		rootVolume.ID,
+		rootVolume.DeviceName,
+	)
+
+	if attachVolumeResp.Err != nil {
+		returnedError = attachVolumeResp.Err
+		return
+	}
+
+	_, err = ec2Client.ModifyInstanceAttribute(
+		ctx,
+		&ec2.ModifyInstanceAttributeInput{
+			InstanceId: &instance.ID,
+			BlockDeviceMappings: []types.InstanceBlockDeviceMappingSpecification{{
+				DeviceName: aws.String(rootVolume.DeviceName),
+				Ebs: &types.EbsInstanceBlockDeviceSpecification{
+					VolumeId:            aws.String(rootVolume.ID),
+					DeleteOnTermination: aws.Bool(true),
+				},
+			}},
+		},
+	)
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	// The public IP address is released on stop
+	instance.PublicIPAddress = ""
+	instance.PublicHostname = ""
+	instance.Volumes = []InstanceVolume{rootVolume}
+
+	returnedInstance = instance
+	return
+}
@@ -0,0 +1,136 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// The IAM role names are limited to 64 characters
+const instanceProfileRoleNameMaxLength = 64
+
+// The trust policy letting the instances assume the role
+const instanceProfileRoleTrustPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [{
+    "Effect": "Allow",
+    "Principal": {"Service": "ec2.amazonaws.com"},
+    "Action": "sts:AssumeRole"
+  }]
+}`
+
+// InstanceProfile represents an instance profile and its role
+// (with the same name). The IAM names are global to the account
+// so the name must include the region of the instance.
+type InstanceProfile struct {
+	Name      string `json:"name"`
+	ARN       string `json:"arn"`
+	RoleName  string `json:"role_name"`
+	PolicyARN string `json:"policy_arn"`
+}
+
+// CreateInstanceProfile creates an instance profile whose role
+// has the passed managed policy attached (eg: the SSM one).
+func CreateInstanceProfile(
+	ctx context.Context,
+	iamClient IAMAPI,
+	name string,
+	policyARN string,
+) (returnedInstanceProfile *InstanceProfile, returnedError error) {
+
+	name = instanceProfileName(name)
+
+	instanceProfile := &InstanceProfile{
+		Name:      name,
+		RoleName:  name,
+		PolicyARN: policyARN,
+	}
+
+	_, err := iamClient.CreateRole(ctx, &iam.CreateRoleInput{
+		RoleName:                 &name,
+		AssumeRolePolicyDocument: aws.String(instanceProfileRoleTrustPolicy),
+		Description:              aws.String("The role of your development environment"),
+	})
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	defer func() {
+		if returnedError == nil {
+			return
+		}
+
+		cleanupCtx, cancelCleanup := newCleanupContext()
+		defer cancelCleanup()
+
+		_ = RemoveInstanceProfile(cleanupCtx, iamClient, instanceProfile)
+	}()
+
+	_, err = iamClient.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{
+		RoleName:  &name,
+		PolicyArn: &policyARN,
+	})
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	createInstanceProfileResp, err := iamClient.CreateInstanceProfile(
+		ctx,
+		&iam.CreateInstanceProfileInput{
+			InstanceProfileName: &name,
+		},
+	)
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	instanceProfile.ARN = aws.ToString(createInstanceProfileResp.InstanceProfile.Arn)
+
+	_, err = iamClient.AddRoleToInstanceProfile(ctx, &iam.AddRoleToInstanceProfileInput{
+		InstanceProfileName: &name,
+		RoleName:            &name,
+	})
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	existsWaiter := iam.NewInstanceProfileExistsWaiter(iamClient)
+	maxWaitTime := 5 * time.Minute
+
+	err = existsWaiter.Wait(ctx, &iam.GetInstanceProfileInput{
+		InstanceProfileName: &name,
+	}, maxWaitTime)
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	returnedInstanceProfile = instanceProfile
+	return
+}
+
+// instanceProfileName truncates the passed name to the
+// length allowed for roles (with a hash to keep it unique).
+func instanceProfileName(name string) string {
+	if len(name) <= instanceProfileRoleNameMaxLength {
+		return name
+	}
+
+	hash := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(hash[:])[:8]
+
+	return name[:instanceProfileRoleNameMaxLength-len(suffix)] + suffix
+}
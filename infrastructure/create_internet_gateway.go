@@ -15,12 +15,13 @@ type InternetGateway struct {
 }
 
 func CreateInternetGateway(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	name string,
 ) (returnedIG *InternetGateway, returnedError error) {
 
 	createInternetGatewayResp, err := ec2Client.CreateInternetGateway(
-		context.TODO(),
+		ctx,
 		&ec2.CreateInternetGatewayInput{
 			TagSpecifications: []types.TagSpecification{{
 				ResourceType: types.ResourceTypeInternetGateway,
@@ -42,7 +43,11 @@ func CreateInternetGateway(
 			return
 		}
 
+		cleanupCtx, cancelCleanup := newCleanupContext()
+		defer cancelCleanup()
+
 		_ = RemoveInternetGateway(
+			cleanupCtx,
 			ec2Client,
 			*createInternetGatewayResp.InternetGateway.InternetGatewayId,
 		)
@@ -52,7 +57,7 @@ func CreateInternetGateway(
 	maxWaitTime := 5 * time.Minute
 
 	err = existsWaiter.Wait(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeInternetGatewaysInput{
 			InternetGatewayIds: []string{
 				*createInternetGatewayResp.InternetGateway.InternetGatewayId,
@@ -15,12 +15,13 @@ type KeyPair struct {
 }
 
 func CreateKeyPair(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	keyPairName string,
 ) (returnedKeyPair *KeyPair, returnedError error) {
 
 	createKeyPairResp, err := ec2Client.CreateKeyPair(
-		context.TODO(),
+		ctx,
 		&ec2.CreateKeyPairInput{
 			KeyName: &keyPairName,
 			KeyType: types.KeyTypeEd25519,
@@ -37,13 +38,16 @@ func CreateKeyPair(
 			return
 		}
 
-		_ = RemoveKeyPair(ec2Client, *createKeyPairResp.KeyPairId)
+		cleanupCtx, cancelCleanup := newCleanupContext()
+		defer cancelCleanup()
+
+		_ = RemoveKeyPair(cleanupCtx, ec2Client, *createKeyPairResp.KeyPairId)
 	}()
 
 	existsWaiter := ec2.NewKeyPairExistsWaiter(ec2Client)
 	maxWaitTime := 5 * time.Minute
 
-	err = existsWaiter.Wait(context.TODO(), &ec2.DescribeKeyPairsInput{
+	err = existsWaiter.Wait(ctx, &ec2.DescribeKeyPairsInput{
 		KeyPairIds: []string{
 			*createKeyPairResp.KeyPairId,
 		},
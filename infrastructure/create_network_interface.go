@@ -14,7 +14,8 @@ type NetworkInterface struct {
 }
 
 func CreateNetworkInterface(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	name string,
 	description string,
 	subnetID string,
@@ -22,7 +23,7 @@ func CreateNetworkInterface(
 ) (returnedNetworkInterface *NetworkInterface, returnedError error) {
 
 	createNetworkInterfaceResp, err := ec2Client.CreateNetworkInterface(
-		context.TODO(),
+		ctx,
 		&ec2.CreateNetworkInterfaceInput{
 			SubnetId:    &subnetID,
 			Groups:      securityGroupIDs,
@@ -47,7 +48,11 @@ func CreateNetworkInterface(
 			return
 		}
 
+		cleanupCtx, cancelCleanup := newCleanupContext()
+		defer cancelCleanup()
+
 		_ = RemoveNetworkInterface(
+			cleanupCtx,
 			ec2Client,
 			*createNetworkInterfaceResp.NetworkInterface.NetworkInterfaceId,
 		)
@@ -57,7 +62,7 @@ func CreateNetworkInterface(
 	maxWaitTime := 5 * time.Minute
 
 	err = availableWaiter.Wait(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeNetworkInterfacesInput{
 			NetworkInterfaceIds: []string{
 				*createNetworkInterfaceResp.NetworkInterface.NetworkInterfaceId,
@@ -10,12 +10,13 @@ import (
 type Route struct{}
 
 func CreateRoute(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	internetGatewayID string,
 	routeTableID string,
 ) (returnedRoute *Route, returnedError error) {
 
-	_, err := ec2Client.CreateRoute(context.TODO(), &ec2.CreateRouteInput{
+	_, err := ec2Client.CreateRoute(ctx, &ec2.CreateRouteInput{
 		RouteTableId:         &routeTableID,
 		DestinationCidrBlock: aws.String("0.0.0.0/0"),
 		GatewayId:            &internetGatewayID,
@@ -30,3 +31,28 @@ func CreateRoute(
 
 	return
 }
+
+// CreateIPv6Route adds the default IPv6 route ("::/0")
+// to the passed internet gateway in the route table.
+func CreateIPv6Route(
+	ctx context.Context,
+	ec2Client EC2API,
+	internetGatewayID string,
+	routeTableID string,
+) (returnedRoute *Route, returnedError error) {
+
+	_, err := ec2Client.CreateRoute(ctx, &ec2.CreateRouteInput{
+		RouteTableId:             &routeTableID,
+		DestinationIpv6CidrBlock: aws.String("::/0"),
+		GatewayId:                &internetGatewayID,
+	})
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	returnedRoute = &Route{}
+
+	return
+}
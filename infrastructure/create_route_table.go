@@ -9,18 +9,18 @@ import (
 )
 
 type RouteTable struct {
-	ID                   string `json:"id"`
-	IsAssociatedToSubnet bool   `json:"is_associated_to_subnet"`
+	ID string `json:"id"`
 }
 
 func CreateRouteTable(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	name string,
 	VPCID string,
 ) (returnedRouteTable *RouteTable, returnedError error) {
 
 	createRouteTableResp, err := ec2Client.CreateRouteTable(
-		context.TODO(),
+		ctx,
 		&ec2.CreateRouteTableInput{
 			VpcId: &VPCID,
 			TagSpecifications: []types.TagSpecification{{
@@ -39,8 +39,7 @@ func CreateRouteTable(
 	}
 
 	returnedRouteTable = &RouteTable{
-		ID:                   *createRouteTableResp.RouteTable.RouteTableId,
-		IsAssociatedToSubnet: false,
+		ID: *createRouteTableResp.RouteTable.RouteTableId,
 	}
 	return
 }
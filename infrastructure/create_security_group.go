@@ -11,18 +11,23 @@ import (
 
 type SecurityGroup struct {
 	ID string `json:"id"`
+
+	// The ingress rules authorized by Recode. Nil for the
+	// security groups created before they were recorded.
+	IngressRules []SecurityGroupIngressRule `json:"ingress_rules"`
 }
 
 func CreateSecurityGroup(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	name string,
 	description string,
 	VPCID string,
-	ingressPorts []types.IpPermission,
+	ingressRules []SecurityGroupIngressRule,
 ) (returnedSecurityGroup *SecurityGroup, returnedError error) {
 
 	createSecurityGroupResp, err := ec2Client.CreateSecurityGroup(
-		context.TODO(),
+		ctx,
 		&ec2.CreateSecurityGroupInput{
 			GroupName:   &name,
 			Description: &description,
@@ -47,14 +52,17 @@ func CreateSecurityGroup(
 			return
 		}
 
-		_ = RemoveSecurityGroup(ec2Client, *createSecurityGroupResp.GroupId)
+		cleanupCtx, cancelCleanup := newCleanupContext()
+		defer cancelCleanup()
+
+		_ = RemoveSecurityGroup(cleanupCtx, ec2Client, *createSecurityGroupResp.GroupId)
 	}()
 
 	existsWaiter := ec2.NewSecurityGroupExistsWaiter(ec2Client)
 	maxWaitTime := 5 * time.Minute
 
 	err = existsWaiter.Wait(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeSecurityGroupsInput{
 			GroupIds: []string{
 				*createSecurityGroupResp.GroupId,
@@ -68,12 +76,11 @@ func CreateSecurityGroup(
 		return
 	}
 
-	_, err = ec2Client.AuthorizeSecurityGroupIngress(
-		context.TODO(),
-		&ec2.AuthorizeSecurityGroupIngressInput{
-			GroupId:       createSecurityGroupResp.GroupId,
-			IpPermissions: ingressPorts,
-		},
+	err = AuthorizeSecurityGroupIngressRules(
+		ctx,
+		ec2Client,
+		*createSecurityGroupResp.GroupId,
+		ingressRules,
 	)
 
 	if err != nil {
@@ -82,7 +89,8 @@ func CreateSecurityGroup(
 	}
 
 	returnedSecurityGroup = &SecurityGroup{
-		ID: *createSecurityGroupResp.GroupId,
+		ID:           *createSecurityGroupResp.GroupId,
+		IngressRules: append([]SecurityGroupIngressRule{}, ingressRules...),
 	}
 	return
 }
@@ -10,22 +10,41 @@ import (
 )
 
 type Subnet struct {
-	ID               string `json:"id"`
-	AvailabilityZone string `json:"availability_zone"`
+	ID                       string `json:"id"`
+	AvailabilityZone         string `json:"availability_zone"`
+	CIDRBlock                string `json:"cidr_block"`
+	IPv6CIDRBlock            string `json:"ipv6_cidr_block"`
+	IsAssociatedToRouteTable bool   `json:"is_associated_to_route_table"`
+
+	// IsAdopted is set for the existing subnets
+	// used as-is (not created, nor removed)
+	IsAdopted bool `json:"is_adopted"`
 }
 
 func CreateSubnet(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	name string,
 	cidrBlock string,
+	IPv6CIDRBlock string,
 	VPCID string,
+	availabilityZone string,
 ) (returnedSubnet *Subnet, returnedError error) {
 
+	// No IPv6 block for the subnets of IPv4-only VPCs
+	var IPv6CIDRBlockParam *string
+
+	if len(IPv6CIDRBlock) > 0 {
+		IPv6CIDRBlockParam = &IPv6CIDRBlock
+	}
+
 	createSubnetResp, err := ec2Client.CreateSubnet(
-		context.TODO(),
+		ctx,
 		&ec2.CreateSubnetInput{
-			CidrBlock: &cidrBlock,
-			VpcId:     &VPCID,
+			AvailabilityZone: &availabilityZone,
+			CidrBlock:        &cidrBlock,
+			Ipv6CidrBlock:    IPv6CIDRBlockParam,
+			VpcId:            &VPCID,
 			TagSpecifications: []types.TagSpecification{{
 				ResourceType: types.ResourceTypeSubnet,
 				Tags: []types.Tag{{
@@ -46,13 +65,16 @@ func CreateSubnet(
 			return
 		}
 
-		_ = RemoveSubnet(ec2Client, *createSubnetResp.Subnet.SubnetId)
+		cleanupCtx, cancelCleanup := newCleanupContext()
+		defer cancelCleanup()
+
+		_ = RemoveSubnet(cleanupCtx, ec2Client, *createSubnetResp.Subnet.SubnetId)
 	}()
 
 	availableWaiter := ec2.NewSubnetAvailableWaiter(ec2Client)
 	maxWaitTime := 5 * time.Minute
 
-	err = availableWaiter.Wait(context.TODO(), &ec2.DescribeSubnetsInput{
+	err = availableWaiter.Wait(ctx, &ec2.DescribeSubnetsInput{
 		SubnetIds: []string{
 			*createSubnetResp.Subnet.SubnetId,
 		},
@@ -64,7 +86,7 @@ func CreateSubnet(
 	}
 
 	_, err = ec2Client.ModifySubnetAttribute(
-		context.TODO(),
+		ctx,
 		&ec2.ModifySubnetAttributeInput{
 			SubnetId: createSubnetResp.Subnet.SubnetId,
 			MapPublicIpOnLaunch: &types.AttributeBooleanValue{
@@ -78,9 +100,30 @@ func CreateSubnet(
 		return
 	}
 
+	// Only one attribute could be modified at a time
+	if len(IPv6CIDRBlock) > 0 {
+		_, err = ec2Client.ModifySubnetAttribute(
+			ctx,
+			&ec2.ModifySubnetAttributeInput{
+				SubnetId: createSubnetResp.Subnet.SubnetId,
+				AssignIpv6AddressOnCreation: &types.AttributeBooleanValue{
+					Value: aws.Bool(true),
+				},
+			},
+		)
+
+		if err != nil {
+			returnedError = err
+			return
+		}
+	}
+
 	returnedSubnet = &Subnet{
-		AvailabilityZone: *createSubnetResp.Subnet.AvailabilityZone,
-		ID:               *createSubnetResp.Subnet.SubnetId,
+		AvailabilityZone:         *createSubnetResp.Subnet.AvailabilityZone,
+		ID:                       *createSubnetResp.Subnet.SubnetId,
+		CIDRBlock:                cidrBlock,
+		IPv6CIDRBlock:            IPv6CIDRBlock,
+		IsAssociatedToRouteTable: false,
 	}
 	return
 }
@@ -2,6 +2,7 @@ package infrastructure
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -9,20 +10,33 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
+var ErrVPCIPv6CIDRBlockNotAssociated = errors.New("ErrVPCIPv6CIDRBlockNotAssociated")
+
 type VPC struct {
 	ID string `json:"id"`
+
+	// IPv6CIDRBlock is the /56 block provided by Amazon
+	// to the dual-stack VPCs (empty for IPv4-only ones)
+	IPv6CIDRBlock string `json:"ipv6_cidr_block"`
+
+	// IsAdopted is set for the existing VPCs
+	// used as-is (not created, nor removed)
+	IsAdopted bool `json:"is_adopted"`
 }
 
 func CreateVPC(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	VPCName string,
 	CIDRBlock string,
+	withIPv6 bool,
 ) (returnedVPC *VPC, returnedError error) {
 
 	createVPCResp, err := ec2Client.CreateVpc(
-		context.TODO(),
+		ctx,
 		&ec2.CreateVpcInput{
-			CidrBlock: &CIDRBlock,
+			CidrBlock:                   &CIDRBlock,
+			AmazonProvidedIpv6CidrBlock: aws.Bool(withIPv6),
 			TagSpecifications: []types.TagSpecification{{
 				ResourceType: types.ResourceTypeVpc,
 				Tags: []types.Tag{{
@@ -43,13 +57,16 @@ func CreateVPC(
 			return
 		}
 
-		_ = RemoveVPC(ec2Client, *createVPCResp.Vpc.VpcId)
+		cleanupCtx, cancelCleanup := newCleanupContext()
+		defer cancelCleanup()
+
+		_ = RemoveVPC(cleanupCtx, ec2Client, *createVPCResp.Vpc.VpcId)
 	}()
 
 	availableWaiter := ec2.NewVpcAvailableWaiter(ec2Client)
 	maxWaitTime := 5 * time.Minute
 
-	err = availableWaiter.Wait(context.TODO(), &ec2.DescribeVpcsInput{
+	err = availableWaiter.Wait(ctx, &ec2.DescribeVpcsInput{
 		VpcIds: []string{
 			*createVPCResp.Vpc.VpcId,
 		},
@@ -70,7 +87,7 @@ func CreateVPC(
 
 	go func() {
 		_, err := ec2Client.ModifyVpcAttribute(
-			context.TODO(),
+			ctx,
 			&ec2.ModifyVpcAttributeInput{
 				EnableDnsSupport: &types.AttributeBooleanValue{
 					Value: aws.Bool(true),
@@ -84,7 +101,7 @@ func CreateVPC(
 
 	go func() {
 		_, err := ec2Client.ModifyVpcAttribute(
-			context.TODO(),
+			ctx,
 			&ec2.ModifyVpcAttributeInput{
 				EnableDnsHostnames: &types.AttributeBooleanValue{
 					Value: aws.Bool(true),
@@ -112,5 +129,70 @@ func CreateVPC(
 	returnedVPC = &VPC{
 		ID: *createVPCResp.Vpc.VpcId,
 	}
+
+	if !withIPv6 {
+		return
+	}
+
+	IPv6CIDRBlock, err := waitForVPCIPv6CIDRBlock(
+		ctx,
+		ec2Client,
+		returnedVPC.ID,
+		maxWaitTime,
+	)
+
+	if err != nil {
+		returnedVPC = nil
+		returnedError = err
+		return
+	}
+
+	returnedVPC.IPv6CIDRBlock = IPv6CIDRBlock
 	return
 }
+
+// waitForVPCIPv6CIDRBlock waits for the IPv6 block provided by
+// Amazon to be associated with the VPC (no waiter in the SDK).
+// ErrVPCIPv6CIDRBlockNotAssociated is returned if the association fails.
+func waitForVPCIPv6CIDRBlock(
+	ctx context.Context,
+	ec2Client EC2API,
+	VPCID string,
+	maxWaitTime time.Duration,
+) (string, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, maxWaitTime)
+	defer cancel()
+
+	for {
+		describeVPCsResp, err := ec2Client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{
+			VpcIds: []string{VPCID},
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		for _, VPC := range describeVPCsResp.Vpcs {
+			for _, association := range VPC.Ipv6CidrBlockAssociationSet {
+				if association.Ipv6CidrBlockState == nil {
+					continue
+				}
+
+				switch association.Ipv6CidrBlockState.State {
+				case types.VpcCidrBlockStateCodeAssociated:
+					return aws.ToString(association.Ipv6CidrBlock), nil
+				case types.VpcCidrBlockStateCodeFailed,
+					types.VpcCidrBlockStateCodeFailing:
+					return "", ErrVPCIPv6CIDRBlockNotAssociated
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
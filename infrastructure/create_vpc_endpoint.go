@@ -0,0 +1,194 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var ErrVPCEndpointFailed = errors.New("ErrVPCEndpointFailed")
+
+type VPCEndpoint struct {
+	ID          string `json:"id"`
+	ServiceName string `json:"service_name"`
+}
+
+// CreateInterfaceVPCEndpoint creates an interface endpoint for
+// the passed service (eg: "com.amazonaws.eu-west-3.ssm") in the passed
+// subnets (one per availability zone). The private DNS name of the
+// service is enabled so that it resolves to the endpoint in the VPC.
+func CreateInterfaceVPCEndpoint(
+	ctx context.Context,
+	ec2Client EC2API,
+	name string,
+	VPCID string,
+	serviceName string,
+	subnetIDs []string,
+	securityGroupIDs []string,
+) (*VPCEndpoint, error) {
+
+	return createVPCEndpoint(
+		ctx,
+		ec2Client,
+		name,
+		&ec2.CreateVpcEndpointInput{
+			VpcEndpointType:   types.VpcEndpointTypeInterface,
+			VpcId:             &VPCID,
+			ServiceName:       &serviceName,
+			SubnetIds:         subnetIDs,
+			SecurityGroupIds:  securityGroupIDs,
+			PrivateDnsEnabled: aws.Bool(true),
+		},
+	)
+}
+
+// CreateGatewayVPCEndpoint creates a gateway endpoint for the passed
+// service (eg: "com.amazonaws.eu-west-3.s3") attached to the passed
+// route tables. A route to the prefix list of the service is added
+// to the route tables so that the traffic to the service stays
+// in the AWS network instead of going through the internet gateway.
+func CreateGatewayVPCEndpoint(
+	ctx context.Context,
+	ec2Client EC2API,
+	name string,
+	VPCID string,
+	serviceName string,
+	routeTableIDs []string,
+) (*VPCEndpoint, error) {
+
+	return createVPCEndpoint(
+		ctx,
+		ec2Client,
+		name,
+		&ec2.CreateVpcEndpointInput{
+			VpcEndpointType: types.VpcEndpointTypeGateway,
+			VpcId:           &VPCID,
+			ServiceName:     &serviceName,
+			RouteTableIds:   routeTableIDs,
+		},
+	)
+}
+
+// createVPCEndpoint creates the endpoint described by the passed
+// input, tagged with the passed name, and waits for it to be
+// available. The endpoint is removed if the wait fails.
+func createVPCEndpoint(
+	ctx context.Context,
+	ec2Client EC2API,
+	name string,
+	createVPCEndpointInput *ec2.CreateVpcEndpointInput,
+) (returnedVPCEndpoint *VPCEndpoint, returnedError error) {
+
+	createVPCEndpointInput.TagSpecifications = []types.TagSpecification{{
+		ResourceType: types.ResourceTypeVpcEndpoint,
+		Tags: []types.Tag{{
+			Key:   aws.String("Name"),
+			Value: &name,
+		}},
+	}}
+
+	createVPCEndpointResp, err := ec2Client.CreateVpcEndpoint(
+		ctx,
+		createVPCEndpointInput,
+	)
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	VPCEndpointID := *createVPCEndpointResp.VpcEndpoint.VpcEndpointId
+
+	defer func() {
+		if returnedError == nil {
+			return
+		}
+
+		cleanupCtx, cancelCleanup := newCleanupContext()
+		defer cancelCleanup()
+
+		_ = RemoveVPCEndpoint(cleanupCtx, ec2Client, VPCEndpointID)
+	}()
+
+	err = waitForVPCEndpointState(
+		ctx,
+		ec2Client,
+		VPCEndpointID,
+		types.StateAvailable,
+		5*time.Minute,
+	)
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	returnedVPCEndpoint = &VPCEndpoint{
+		ID:          VPCEndpointID,
+		ServiceName: aws.ToString(createVPCEndpointInput.ServiceName),
+	}
+	return
+}
+
+// waitForVPCEndpointState waits for the VPC endpoint to reach the
+// passed state (no waiter in the SDK). A removed endpoint is
+// considered "deleted". ErrVPCEndpointFailed is returned if
+// the endpoint fails.
+func waitForVPCEndpointState(
+	ctx context.Context,
+	ec2Client EC2API,
+	VPCEndpointID string,
+	state types.State,
+	maxWaitTime time.Duration,
+) error {
+
+	ctx, cancel := context.WithTimeout(ctx, maxWaitTime)
+	defer cancel()
+
+	for {
+		describeVPCEndpointsResp, err := ec2Client.DescribeVpcEndpoints(
+			ctx,
+			&ec2.DescribeVpcEndpointsInput{
+				VpcEndpointIds: []string{VPCEndpointID},
+			},
+		)
+
+		if err != nil {
+			err = notFoundError(err, "InvalidVpcEndpointId.NotFound", ErrVPCEndpointNotFound)
+
+			if errors.Is(err, ErrVPCEndpointNotFound) && state == types.StateDeleted {
+				return nil
+			}
+
+			return err
+		}
+
+		if len(describeVPCEndpointsResp.VpcEndpoints) == 0 {
+			if state == types.StateDeleted {
+				return nil
+			}
+
+			return ErrVPCEndpointNotFound
+		}
+
+		// The API returns the states in lower case
+		currentState := describeVPCEndpointsResp.VpcEndpoints[0].State
+
+		if strings.EqualFold(string(currentState), string(state)) {
+			return nil
+		}
+
+		if strings.EqualFold(string(currentState), string(types.StateFailed)) {
+			return ErrVPCEndpointFailed
+		}
+
+		if err := sleepWithContext(ctx, 2*time.Second); err != nil {
+			return err
+		}
+	}
+}
@@ -7,13 +7,14 @@ import (
 )
 
 func DetachInternetGatewayFromVPC(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	internetGatewayId string,
 	VPCID string,
 ) error {
 
 	_, err := ec2Client.DetachInternetGateway(
-		context.TODO(),
+		ctx,
 		&ec2.DetachInternetGatewayInput{
 			InternetGatewayId: &internetGatewayId,
 			VpcId:             &VPCID,
@@ -0,0 +1,250 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// AcquireLeaseInDynamoDBTable creates or renews the lease with the
+// passed ID. It succeeds if the lease doesn't exist, has expired or is
+// already held by ownerID. Otherwise, ErrLeaseAlreadyHeld is returned.
+func AcquireLeaseInDynamoDBTable(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	leaseID string,
+	ownerID string,
+	ownerDescription string,
+	expiresAt time.Time,
+) error {
+
+	err := putLeaseInDynamoDBTable(
+		ctx,
+		dynamoDBClient,
+		LeaseRecord{
+			ID:               leaseID,
+			OwnerID:          ownerID,
+			OwnerDescription: ownerDescription,
+			ExpiresAt:        expiresAt.UnixMilli(),
+		},
+		"attribute_not_exists(#id) OR #ownerID = :ownerID OR #expiresAt < :now",
+		map[string]string{
+			"#id":        "ID",
+			"#ownerID":   "OwnerID",
+			"#expiresAt": "ExpiresAt",
+		},
+		map[string]types.AttributeValue{
+			":ownerID": &types.AttributeValueMemberS{Value: ownerID},
+			":now":     unixMilliAttributeValue(time.Now()),
+		},
+	)
+
+	if errors.Is(err, errLeaseConditionFailed) {
+		return ErrLeaseAlreadyHeld
+	}
+
+	return err
+}
+
+// RenewLeaseInDynamoDBTable extends the lease with the passed ID.
+// Contrary to AcquireLeaseInDynamoDBTable, an expired lease is not
+// reclaimed: ErrLeaseNotHeld is returned if the lease is
+// not held by ownerID anymore (removed or reclaimed by someone else).
+func RenewLeaseInDynamoDBTable(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	leaseID string,
+	ownerID string,
+	ownerDescription string,
+	expiresAt time.Time,
+) error {
+
+	err := putLeaseInDynamoDBTable(
+		ctx,
+		dynamoDBClient,
+		LeaseRecord{
+			ID:               leaseID,
+			OwnerID:          ownerID,
+			OwnerDescription: ownerDescription,
+			ExpiresAt:        expiresAt.UnixMilli(),
+		},
+		"#ownerID = :ownerID",
+		map[string]string{
+			"#ownerID": "OwnerID",
+		},
+		map[string]types.AttributeValue{
+			":ownerID": &types.AttributeValueMemberS{Value: ownerID},
+		},
+	)
+
+	if errors.Is(err, errLeaseConditionFailed) {
+		return ErrLeaseNotHeld
+	}
+
+	return err
+}
+
+// ReleaseLeaseInDynamoDBTable removes the lease with the passed ID
+// if it is still held by ownerID. Releasing a lease that
+// was reclaimed by someone else is a no-op.
+func ReleaseLeaseInDynamoDBTable(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	leaseID string,
+	ownerID string,
+) error {
+
+	_, err := dynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(DynamoDBRecodeConfigTableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: leaseID},
+		},
+		ConditionExpression: aws.String("#ownerID = :ownerID"),
+		ExpressionAttributeNames: map[string]string{
+			"#ownerID": "OwnerID",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ownerID": &types.AttributeValueMemberS{Value: ownerID},
+		},
+	})
+
+	if err != nil {
+		var conditionalCheckFailedErr *types.ConditionalCheckFailedException
+
+		if errors.As(err, &conditionalCheckFailedErr) {
+			return nil
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// LookupLeaseInDynamoDBTable returns the lease with the
+// passed ID or nil if the lease doesn't exist.
+func LookupLeaseInDynamoDBTable(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	leaseID string,
+) (*LeaseRecord, error) {
+
+	getItemResp, err := dynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(DynamoDBRecodeConfigTableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: leaseID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if getItemResp.Item == nil {
+		return nil, nil
+	}
+
+	var lease *LeaseRecord
+	err = attributevalue.UnmarshalMap(getItemResp.Item, &lease)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+// ListLeasesInDynamoDBTable returns the leases whose ID starts with
+// the passed prefix (including the expired ones). The table is
+// scanned given that the leases share it with the config records.
+func ListLeasesInDynamoDBTable(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	leaseIDPrefix string,
+) ([]*LeaseRecord, error) {
+
+	scanInput := &dynamodb.ScanInput{
+		TableName:        aws.String(DynamoDBRecodeConfigTableName),
+		FilterExpression: aws.String("begins_with(#id, :leaseIDPrefix)"),
+		ExpressionAttributeNames: map[string]string{
+			"#id": "ID",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":leaseIDPrefix": &types.AttributeValueMemberS{Value: leaseIDPrefix},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	leases := []*LeaseRecord{}
+	paginator := dynamodb.NewScanPaginator(dynamoDBClient, scanInput)
+
+	for paginator.HasMorePages() {
+		scanResp, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var pageLeases []*LeaseRecord
+		err = attributevalue.UnmarshalListOfMaps(scanResp.Items, &pageLeases)
+
+		if err != nil {
+			return nil, err
+		}
+
+		leases = append(leases, pageLeases...)
+	}
+
+	return leases, nil
+}
+
+var errLeaseConditionFailed = errors.New("errLeaseConditionFailed")
+
+func putLeaseInDynamoDBTable(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	lease LeaseRecord,
+	conditionExpression string,
+	expressionAttributeNames map[string]string,
+	expressionAttributeValues map[string]types.AttributeValue,
+) error {
+
+	marshaledLease, err := attributevalue.MarshalMap(lease)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = dynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(DynamoDBRecodeConfigTableName),
+		Item:                      marshaledLease,
+		ConditionExpression:       aws.String(conditionExpression),
+		ExpressionAttributeNames:  expressionAttributeNames,
+		ExpressionAttributeValues: expressionAttributeValues,
+	})
+
+	if err != nil {
+		var conditionalCheckFailedErr *types.ConditionalCheckFailedException
+
+		if errors.As(err, &conditionalCheckFailedErr) {
+			return errLeaseConditionFailed
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func unixMilliAttributeValue(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberN{
+		Value: strconv.FormatInt(t.UnixMilli(), 10),
+	}
+}
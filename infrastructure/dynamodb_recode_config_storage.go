@@ -0,0 +1,146 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DynamoDBRecodeConfigStorage stores the config and the
+// leases in the Recode config DynamoDB table.
+type DynamoDBRecodeConfigStorage struct {
+	dynamoDBClient DynamoDBAPI
+}
+
+// NewDynamoDBRecodeConfigStorage constructs
+// the DynamoDBRecodeConfigStorage struct.
+func NewDynamoDBRecodeConfigStorage(
+	dynamoDBClient DynamoDBAPI,
+) DynamoDBRecodeConfigStorage {
+
+	return DynamoDBRecodeConfigStorage{
+		dynamoDBClient: dynamoDBClient,
+	}
+}
+
+// Create creates the table if it doesn't exist.
+func (d DynamoDBRecodeConfigStorage) Create(ctx context.Context) error {
+	err := CreateDynamoDBTableForRecodeConfig(ctx, d.dynamoDBClient)
+
+	if err != nil && errors.Is(err, ErrRecodeConfigTableAlreadyExists) {
+		return nil
+	}
+
+	return err
+}
+
+func (d DynamoDBRecodeConfigStorage) Remove(ctx context.Context) error {
+	return RemoveDynamoDBTableForRecodeConfig(ctx, d.dynamoDBClient)
+}
+
+func (d DynamoDBRecodeConfigStorage) LookupConfig(
+	ctx context.Context,
+) (*StoredRecodeConfig, error) {
+
+	return LookupRecodeConfigInDynamoDBTable(ctx, d.dynamoDBClient)
+}
+
+func (d DynamoDBRecodeConfigStorage) LookupConfigHistory(
+	ctx context.Context,
+) ([]StoredRecodeConfigVersion, error) {
+
+	return LookupRecodeConfigHistoryInDynamoDBTable(ctx, d.dynamoDBClient)
+}
+
+func (d DynamoDBRecodeConfigStorage) LookupConfigVersion(
+	ctx context.Context,
+	version int64,
+) (*StoredRecodeConfig, error) {
+
+	return LookupRecodeConfigVersionInDynamoDBTable(ctx, d.dynamoDBClient, version)
+}
+
+func (d DynamoDBRecodeConfigStorage) UpdateConfig(
+	ctx context.Context,
+	config *StoredRecodeConfig,
+	expectedVersion int64,
+	historyOpts RecodeConfigHistoryOpts,
+) error {
+
+	return UpdateRecodeConfigInDynamoDBTable(
+		ctx,
+		d.dynamoDBClient,
+		config,
+		expectedVersion,
+		historyOpts,
+	)
+}
+
+func (d DynamoDBRecodeConfigStorage) RemoveLegacyConfig(
+	ctx context.Context,
+	legacyRecordID string,
+) error {
+
+	return RemoveLegacyRecodeConfigFromDynamoDBTable(ctx, d.dynamoDBClient, legacyRecordID)
+}
+
+func (d DynamoDBRecodeConfigStorage) AcquireLease(
+	ctx context.Context,
+	leaseID string,
+	ownerID string,
+	ownerDescription string,
+	expiresAt time.Time,
+) error {
+
+	return AcquireLeaseInDynamoDBTable(
+		ctx,
+		d.dynamoDBClient,
+		leaseID,
+		ownerID,
+		ownerDescription,
+		expiresAt,
+	)
+}
+
+func (d DynamoDBRecodeConfigStorage) RenewLease(
+	ctx context.Context,
+	leaseID string,
+	ownerID string,
+	ownerDescription string,
+	expiresAt time.Time,
+) error {
+
+	return RenewLeaseInDynamoDBTable(
+		ctx,
+		d.dynamoDBClient,
+		leaseID,
+		ownerID,
+		ownerDescription,
+		expiresAt,
+	)
+}
+
+func (d DynamoDBRecodeConfigStorage) ReleaseLease(
+	ctx context.Context,
+	leaseID string,
+	ownerID string,
+) error {
+
+	return ReleaseLeaseInDynamoDBTable(ctx, d.dynamoDBClient, leaseID, ownerID)
+}
+
+func (d DynamoDBRecodeConfigStorage) LookupLease(
+	ctx context.Context,
+	leaseID string,
+) (*LeaseRecord, error) {
+
+	return LookupLeaseInDynamoDBTable(ctx, d.dynamoDBClient, leaseID)
+}
+
+func (d DynamoDBRecodeConfigStorage) ListLeases(
+	ctx context.Context,
+	leaseIDPrefix string,
+) ([]*LeaseRecord, error) {
+
+	return ListLeasesInDynamoDBTable(ctx, d.dynamoDBClient, leaseIDPrefix)
+}
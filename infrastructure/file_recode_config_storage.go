@@ -0,0 +1,244 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// The lock file serializes the conditional writes
+	// made by the Recode processes sharing the directory.
+	fileRecodeConfigLockName = ".lock"
+
+	// The age after which a lock file is considered
+	// abandoned (eg: crashed process) and removed.
+	fileRecodeConfigStaleLockAge = 30 * time.Second
+
+	fileRecodeConfigLockRetryInterval = 20 * time.Millisecond
+)
+
+// NewFileRecodeConfigStorage constructs an ObjectRecodeConfigStorage
+// that stores the config as JSON files in the passed local directory.
+//
+// Used to test Recode without cloud state. The ETag of
+// a file is the SHA-256 hash of its content.
+func NewFileRecodeConfigStorage(dirPath string) ObjectRecodeConfigStorage {
+	return ObjectRecodeConfigStorage{
+		objectStore: fileRecodeConfigObjectStore{
+			dirPath: dirPath,
+		},
+	}
+}
+
+type fileRecodeConfigObjectStore struct {
+	dirPath string
+}
+
+func (f fileRecodeConfigObjectStore) create(ctx context.Context) error {
+	return os.MkdirAll(f.dirPath, 0700)
+}
+
+func (f fileRecodeConfigObjectStore) remove(ctx context.Context) error {
+	return os.RemoveAll(f.dirPath)
+}
+
+func (f fileRecodeConfigObjectStore) getObject(
+	ctx context.Context,
+	key string,
+) ([]byte, string, error) {
+
+	content, err := os.ReadFile(f.objectPath(key))
+
+	if err != nil {
+
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, "", errRecodeConfigObjectNotFound
+		}
+
+		return nil, "", err
+	}
+
+	return content, fileETag(content), nil
+}
+
+func (f fileRecodeConfigObjectStore) putObject(
+	ctx context.Context,
+	key string,
+	content []byte,
+	condition recodeConfigObjectCondition,
+) error {
+
+	return f.withLock(ctx, func() error {
+		if err := f.checkCondition(key, condition); err != nil {
+			return err
+		}
+
+		objectPath := f.objectPath(key)
+
+		if err := os.MkdirAll(filepath.Dir(objectPath), 0700); err != nil {
+			return err
+		}
+
+		// Readers never see a partially written file
+		tempFile, err := os.CreateTemp(filepath.Dir(objectPath), ".tmp-*")
+
+		if err != nil {
+			return err
+		}
+
+		defer os.Remove(tempFile.Name())
+
+		if _, err := tempFile.Write(content); err != nil {
+			tempFile.Close()
+			return err
+		}
+
+		if err := tempFile.Close(); err != nil {
+			return err
+		}
+
+		return os.Rename(tempFile.Name(), objectPath)
+	})
+}
+
+func (f fileRecodeConfigObjectStore) deleteObject(
+	ctx context.Context,
+	key string,
+	condition recodeConfigObjectCondition,
+) error {
+
+	return f.withLock(ctx, func() error {
+		if err := f.checkCondition(key, condition); err != nil {
+			return err
+		}
+
+		err := os.Remove(f.objectPath(key))
+
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// listObjectKeys only lists the files of the directory of
+// the prefix (the keys used in listings have no subdirectories).
+func (f fileRecodeConfigObjectStore) listObjectKeys(
+	ctx context.Context,
+	keyPrefix string,
+) ([]string, error) {
+
+	keyDir := path.Dir(keyPrefix)
+	entries, err := os.ReadDir(f.objectPath(keyDir))
+
+	if err != nil {
+
+		if errors.Is(err, os.ErrNotExist) {
+			return []string{}, nil
+		}
+
+		return nil, err
+	}
+
+	keys := []string{}
+
+	for _, entry := range entries {
+		key := path.Join(keyDir, entry.Name())
+
+		// Temporary files written by putObject
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") ||
+			!strings.HasPrefix(key, keyPrefix) {
+
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (f fileRecodeConfigObjectStore) checkCondition(
+	key string,
+	condition recodeConfigObjectCondition,
+) error {
+
+	if len(condition.IfMatch) == 0 && !condition.IfNotExists {
+		return nil
+	}
+
+	_, ETag, err := f.getObject(context.Background(), key)
+
+	if err != nil && !errors.Is(err, errRecodeConfigObjectNotFound) {
+		return err
+	}
+
+	objectExists := err == nil
+
+	if condition.IfNotExists && objectExists {
+		return errRecodeConfigObjectConditionFailed
+	}
+
+	if len(condition.IfMatch) > 0 && (!objectExists || ETag != condition.IfMatch) {
+		return errRecodeConfigObjectConditionFailed
+	}
+
+	return nil
+}
+
+// withLock runs fn while holding the lock file of the directory.
+// The directory must exist (see create).
+func (f fileRecodeConfigObjectStore) withLock(
+	ctx context.Context,
+	fn func() error,
+) error {
+
+	lockPath := filepath.Join(f.dirPath, fileRecodeConfigLockName)
+
+	for {
+		lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+
+		if err == nil {
+			lockFile.Close()
+			break
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+
+		if lockInfo, err := os.Stat(lockPath); err == nil &&
+			time.Since(lockInfo.ModTime()) > fileRecodeConfigStaleLockAge {
+
+			os.Remove(lockPath)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(fileRecodeConfigLockRetryInterval):
+		}
+	}
+
+	defer os.Remove(lockPath)
+
+	return fn()
+}
+
+func (f fileRecodeConfigObjectStore) objectPath(key string) string {
+	return filepath.Join(f.dirPath, filepath.FromSlash(key))
+}
+
+func fileETag(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
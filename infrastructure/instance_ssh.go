@@ -2,12 +2,12 @@ package infrastructure
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/recode-sh/recode/entities"
 	"golang.org/x/crypto/ssh"
 )
@@ -22,12 +22,49 @@ type InitInstanceScriptResults struct {
 	SSHHostKeys []entities.DevEnvSSHHostKey `json:"ssh_host_keys"`
 }
 
-func LookupInitInstanceScriptResults(
-	ec2Client *ec2.Client,
+// instanceSSHConnTimeout represents the timeout used
+// when connecting to the SSH server of the instances.
+const instanceSSHConnTimeout = time.Second * 8
+
+// InstanceSSHClient reaches the instances via
+// a direct SSH connection to their public IP address.
+type InstanceSSHClient struct{}
+
+// NewInstanceSSHClient constructs the InstanceSSHClient struct.
+func NewInstanceSSHClient() InstanceSSHClient {
+	return InstanceSSHClient{}
+}
+
+func (InstanceSSHClient) LookupInitInstanceScriptResults(
+	ctx context.Context,
 	instancePublicIPAddress string,
 	instanceSSHPort string,
 	instanceLoginUser string,
 	sshPrivateKeyContent string,
+) (*InitInstanceScriptResults, error) {
+
+	return lookupInitInstanceScriptResults(
+		ctx,
+		func(ctx context.Context, cmd string) (string, error) {
+			return runCMDOnInstanceViaSSH(
+				ctx,
+				net.JoinHostPort(
+					instancePublicIPAddress,
+					instanceSSHPort,
+				),
+				instanceLoginUser,
+				sshPrivateKeyContent,
+				cmd,
+			)
+		},
+	)
+}
+
+// lookupInitInstanceScriptResults polls the results of the init script
+// using the passed function to run commands on the instance via SSH.
+func lookupInitInstanceScriptResults(
+	ctx context.Context,
+	runCMD func(ctx context.Context, cmd string) (string, error),
 ) (returnedInitScriptResults *InitInstanceScriptResults, returnedError error) {
 
 	pollTimeoutChan := time.After(5 * time.Minute)
@@ -35,16 +72,13 @@ func LookupInitInstanceScriptResults(
 
 	for {
 		select {
+		case <-ctx.Done():
+			returnedError = ctx.Err()
+			return
 		case <-pollTimeoutChan:
 			return
 		default:
-			initScriptOutput, err := runCMDOnInstanceViaSSH(
-				instancePublicIPAddress,
-				instanceSSHPort,
-				instanceLoginUser,
-				sshPrivateKeyContent,
-				"cat /tmp/recode_init_results",
-			)
+			initScriptOutput, err := runCMD(ctx, "cat /tmp/recode_init_results")
 
 			// Make sure timeout returns last error
 			returnedError = err
@@ -93,33 +127,63 @@ func LookupInitInstanceScriptResults(
 			return
 		} // <- end of select
 
-		time.Sleep(pollSleepDuration)
+		if err := sleepWithContext(ctx, pollSleepDuration); err != nil {
+			returnedError = err
+			return
+		}
 	} // <- end of for
 }
 
-func WaitForSSHAvailableInInstance(
-	ec2Client *ec2.Client,
+func (InstanceSSHClient) WaitForSSHAvailableInInstance(
+	ctx context.Context,
 	instancePublicIPAddress string,
 	instanceSSHPort string,
+) error {
+
+	return waitForSSHAvailableInInstance(
+		ctx,
+		func(ctx context.Context) error {
+			dialer := net.Dialer{
+				Timeout: instanceSSHConnTimeout,
+			}
+
+			conn, err := dialer.DialContext(
+				ctx,
+				"tcp",
+				net.JoinHostPort(
+					instancePublicIPAddress,
+					instanceSSHPort,
+				),
+			)
+
+			if err != nil {
+				return err
+			}
+
+			return conn.Close()
+		},
+	)
+}
+
+// waitForSSHAvailableInInstance polls the SSH server of the
+// instance using the passed function to connect to it.
+func waitForSSHAvailableInInstance(
+	ctx context.Context,
+	connect func(ctx context.Context) error,
 ) (returnedError error) {
 
 	pollTimeoutChan := time.After(5 * time.Minute)
 	pollSleepDuration := time.Second * 5
-	SSHConnTimeout := time.Second * 8
 
 	for {
 		select {
+		case <-ctx.Done():
+			returnedError = ctx.Err()
+			return
 		case <-pollTimeoutChan:
 			return
 		default:
-			conn, err := net.DialTimeout(
-				"tcp",
-				net.JoinHostPort(
-					instancePublicIPAddress,
-					instanceSSHPort,
-				),
-				SSHConnTimeout,
-			)
+			err := connect(ctx)
 
 			// Make sure timeout returns last error
 			returnedError = err
@@ -128,17 +192,19 @@ func WaitForSSHAvailableInInstance(
 				break // wait pollSleepDuration and retry until timeout
 			}
 
-			conn.Close()
 			return
 		}
 
-		time.Sleep(pollSleepDuration)
+		if err := sleepWithContext(ctx, pollSleepDuration); err != nil {
+			returnedError = err
+			return
+		}
 	}
 }
 
 func runCMDOnInstanceViaSSH(
-	instancePublicIPAddress string,
-	instanceSSHPort string,
+	ctx context.Context,
+	instanceAddr string,
 	loginUser string,
 	privateKeyContent string,
 	cmd string,
@@ -150,30 +216,53 @@ func runCMDOnInstanceViaSSH(
 		return "", err
 	}
 
-	SSHConnTimeout := time.Second * 8
-
 	config := &ssh.ClientConfig{
 		User: loginUser,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         SSHConnTimeout,
+		Timeout:         instanceSSHConnTimeout,
 	}
 
-	client, err := ssh.Dial(
-		"tcp",
-		net.JoinHostPort(
-			instancePublicIPAddress,
-			instanceSSHPort,
-		),
-		config,
-	)
+	dialer := net.Dialer{
+		Timeout: instanceSSHConnTimeout,
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", instanceAddr)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer conn.Close()
+
+	// Closing the connection unblocks the SSH
+	// handshake and the running command on cancellation
+	stopWatchingCtx := make(chan struct{})
+	defer close(stopWatchingCtx)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stopWatchingCtx:
+		}
+	}()
+
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, instanceAddr, config)
 
 	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
 		return "", err
 	}
 
+	client := ssh.NewClient(clientConn, chans, reqs)
+	defer client.Close()
+
 	session, err := client.NewSession()
 
 	if err != nil {
@@ -188,8 +277,24 @@ func runCMDOnInstanceViaSSH(
 	err = session.Run(cmd)
 
 	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
 		return "", err
 	}
 
 	return output.String(), nil
 }
+
+func sleepWithContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
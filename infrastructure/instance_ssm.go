@@ -0,0 +1,370 @@
+package infrastructure
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+var (
+	ErrSessionManagerPluginNotFound = errors.New("ErrSessionManagerPluginNotFound")
+	ErrInstanceNotConnectedToSSM    = errors.New("ErrInstanceNotConnectedToSSM")
+)
+
+const (
+	// SSMManagedInstancePolicyName represents the name of the AWS managed
+	// policy that lets the SSM agent of the instances connect to SSM.
+	SSMManagedInstancePolicyName = "AmazonSSMManagedInstanceCore"
+
+	// The binary used by the AWS CLI to open the sessions
+	sessionManagerPluginName = "session-manager-plugin"
+
+	portForwardingSessionDocumentName = "AWS-StartPortForwardingSession"
+)
+
+// InstanceSSMClient reaches the instances through SSM Session Manager
+// port forwarding sessions so that the instances don't need any
+// public IP address nor ingress rule. The instances are identified
+// by their ID (in place of their public IP address).
+//
+// The sessions are opened with the Session Manager plugin of the
+// AWS CLI that must be installed (ErrSessionManagerPluginNotFound
+// is returned otherwise).
+type InstanceSSMClient struct {
+	ssmClient  SSMAPI
+	ssmOptions ssm.Options
+}
+
+// NewInstanceSSMClient constructs the InstanceSSMClient struct.
+// The options of the SSM client are used to resolve the endpoint
+// passed to the Session Manager plugin (see ssm.Client.Options).
+func NewInstanceSSMClient(ssmClient SSMAPI, ssmOptions ssm.Options) InstanceSSMClient {
+	return InstanceSSMClient{
+		ssmClient:  ssmClient,
+		ssmOptions: ssmOptions,
+	}
+}
+
+// resolveSSMEndpoint returns the URL of the SSM endpoint reached by
+// the SSM client (eg: "https://ssm.cn-north-1.amazonaws.com.cn" in
+// the China regions or the custom endpoint set in the SDK config).
+func (i InstanceSSMClient) resolveSSMEndpoint(ctx context.Context) (string, error) {
+	if i.ssmOptions.EndpointResolverV2 == nil {
+		i.ssmOptions.EndpointResolverV2 = ssm.NewDefaultEndpointResolverV2()
+	}
+
+	endpoint, err := i.ssmOptions.EndpointResolverV2.ResolveEndpoint(
+		ctx,
+		ssm.EndpointParameters{
+			Region:       aws.String(i.ssmOptions.Region),
+			Endpoint:     i.ssmOptions.BaseEndpoint,
+			UseFIPS:      aws.Bool(i.ssmOptions.EndpointOptions.UseFIPSEndpoint == aws.FIPSEndpointStateEnabled),
+			UseDualStack: aws.Bool(i.ssmOptions.EndpointOptions.UseDualStackEndpoint == aws.DualStackEndpointStateEnabled),
+		},
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	return endpoint.URI.String(), nil
+}
+
+func (i InstanceSSMClient) LookupInitInstanceScriptResults(
+	ctx context.Context,
+	instanceID string,
+	instanceSSHPort string,
+	instanceLoginUser string,
+	sshPrivateKeyContent string,
+) (*InitInstanceScriptResults, error) {
+
+	return lookupInitInstanceScriptResults(
+		ctx,
+		func(ctx context.Context, cmd string) (string, error) {
+			session, err := i.startPortForwardingSession(ctx, instanceID, instanceSSHPort)
+
+			if err != nil {
+				return "", err
+			}
+
+			defer session.close()
+
+			return runCMDOnInstanceViaSSH(
+				ctx,
+				session.localAddr,
+				instanceLoginUser,
+				sshPrivateKeyContent,
+				cmd,
+			)
+		},
+	)
+}
+
+func (i InstanceSSMClient) WaitForSSHAvailableInInstance(
+	ctx context.Context,
+	instanceID string,
+	instanceSSHPort string,
+) error {
+
+	return waitForSSHAvailableInInstance(
+		ctx,
+		func(ctx context.Context) error {
+			session, err := i.startPortForwardingSession(ctx, instanceID, instanceSSHPort)
+
+			if err != nil {
+				return err
+			}
+
+			defer session.close()
+
+			dialer := net.Dialer{
+				Timeout: instanceSSHConnTimeout,
+			}
+
+			conn, err := dialer.DialContext(ctx, "tcp", session.localAddr)
+
+			if err != nil {
+				return err
+			}
+
+			defer conn.Close()
+
+			// The local port accepts connections even if the SSH
+			// server doesn't so we wait for its identification string
+			err = conn.SetReadDeadline(time.Now().Add(instanceSSHConnTimeout))
+
+			if err != nil {
+				return err
+			}
+
+			identification, err := bufio.NewReader(conn).ReadString('\n')
+
+			if err != nil {
+				return err
+			}
+
+			if !strings.HasPrefix(identification, "SSH-") {
+				return errors.New("invalid SSH identification string")
+			}
+
+			return nil
+		},
+	)
+}
+
+// portForwardingSession represents an SSM session that forwards
+// a local port to a port of an instance (via the Session Manager plugin).
+type portForwardingSession struct {
+	localAddr string
+
+	sessionID    string
+	pluginCmd    *exec.Cmd
+	ssmClient    SSMAPI
+	cancelPlugin context.CancelFunc
+}
+
+func (i InstanceSSMClient) startPortForwardingSession(
+	ctx context.Context,
+	instanceID string,
+	instancePort string,
+) (returnedSession *portForwardingSession, returnedError error) {
+
+	pluginPath, err := exec.LookPath(sessionManagerPluginName)
+
+	if err != nil {
+		returnedError = ErrSessionManagerPluginNotFound
+		return
+	}
+
+	if err := i.checkInstanceConnectedToSSM(ctx, instanceID); err != nil {
+		returnedError = err
+		return
+	}
+
+	localPort, err := freeLocalPort()
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	SSMEndpoint, err := i.resolveSSMEndpoint(ctx)
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	startSessionInput := &ssm.StartSessionInput{
+		Target:       aws.String(instanceID),
+		DocumentName: aws.String(portForwardingSessionDocumentName),
+		Parameters: map[string][]string{
+			"portNumber":      {instancePort},
+			"localPortNumber": {localPort},
+		},
+	}
+
+	startSessionResp, err := i.ssmClient.StartSession(ctx, startSessionInput)
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	pluginCtx, cancelPlugin := context.WithCancel(context.Background())
+
+	session := &portForwardingSession{
+		localAddr:    net.JoinHostPort("127.0.0.1", localPort),
+		sessionID:    aws.ToString(startSessionResp.SessionId),
+		ssmClient:    i.ssmClient,
+		cancelPlugin: cancelPlugin,
+	}
+
+	defer func() {
+		if returnedError == nil {
+			return
+		}
+
+		session.close()
+	}()
+
+	// Same arguments as the ones passed by the AWS CLI
+	sessionJSON, err := json.Marshal(map[string]string{
+		"SessionId":  aws.ToString(startSessionResp.SessionId),
+		"StreamUrl":  aws.ToString(startSessionResp.StreamUrl),
+		"TokenValue": aws.ToString(startSessionResp.TokenValue),
+	})
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	startSessionInputJSON, err := json.Marshal(map[string]interface{}{
+		"Target":       instanceID,
+		"DocumentName": portForwardingSessionDocumentName,
+		"Parameters":   startSessionInput.Parameters,
+	})
+
+	if err != nil {
+		returnedError = err
+		return
+	}
+
+	session.pluginCmd = exec.CommandContext(
+		pluginCtx,
+		pluginPath,
+		string(sessionJSON),
+		i.ssmOptions.Region,
+		"StartSession",
+		"",
+		string(startSessionInputJSON),
+		SSMEndpoint,
+	)
+
+	if err := session.pluginCmd.Start(); err != nil {
+		returnedError = err
+		return
+	}
+
+	returnedError = waitForLocalPortListening(ctx, session.localAddr)
+
+	if returnedError != nil {
+		return
+	}
+
+	returnedSession = session
+	return
+}
+
+// close stops the Session Manager plugin
+// and terminates the SSM session.
+func (p *portForwardingSession) close() {
+	p.cancelPlugin()
+
+	if p.pluginCmd != nil && p.pluginCmd.Process != nil {
+		_ = p.pluginCmd.Wait()
+	}
+
+	cleanupCtx, cancelCleanup := newCleanupContext()
+	defer cancelCleanup()
+
+	_, _ = p.ssmClient.TerminateSession(cleanupCtx, &ssm.TerminateSessionInput{
+		SessionId: aws.String(p.sessionID),
+	})
+}
+
+// checkInstanceConnectedToSSM returns ErrInstanceNotConnectedToSSM
+// until the SSM agent of the instance is connected to SSM.
+func (i InstanceSSMClient) checkInstanceConnectedToSSM(
+	ctx context.Context,
+	instanceID string,
+) error {
+
+	describeInstanceInformationResp, err := i.ssmClient.DescribeInstanceInformation(
+		ctx,
+		&ssm.DescribeInstanceInformationInput{
+			Filters: []types.InstanceInformationStringFilter{{
+				Key:    aws.String("InstanceIds"),
+				Values: []string{instanceID},
+			}},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	for _, instanceInformation := range describeInstanceInformationResp.InstanceInformationList {
+		if instanceInformation.PingStatus == types.PingStatusOnline {
+			return nil
+		}
+	}
+
+	return ErrInstanceNotConnectedToSSM
+}
+
+func freeLocalPort() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		return "", err
+	}
+
+	defer listener.Close()
+
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port), nil
+}
+
+func waitForLocalPortListening(ctx context.Context, localAddr string) error {
+	pollTimeoutChan := time.After(30 * time.Second)
+	pollSleepDuration := 250 * time.Millisecond
+
+	for {
+		conn, err := net.DialTimeout("tcp", localAddr, instanceSSHConnTimeout)
+
+		if err == nil {
+			return conn.Close()
+		}
+
+		select {
+		case <-pollTimeoutChan:
+			return err
+		default:
+		}
+
+		if err := sleepWithContext(ctx, pollSleepDuration); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package infrastructure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+func TestResolveSSMEndpoint(t *testing.T) {
+	testCases := []struct {
+		test             string
+		SDKConfig        aws.Config
+		expectedEndpoint string
+	}{
+		{
+			test:             "commercial region",
+			SDKConfig:        aws.Config{Region: "eu-west-3"},
+			expectedEndpoint: "https://ssm.eu-west-3.amazonaws.com",
+		},
+
+		{
+			test:             "China region",
+			SDKConfig:        aws.Config{Region: "cn-north-1"},
+			expectedEndpoint: "https://ssm.cn-north-1.amazonaws.com.cn",
+		},
+
+		{
+			test: "custom endpoint",
+			SDKConfig: aws.Config{
+				Region:       "eu-west-3",
+				BaseEndpoint: aws.String("https://ssm.example.com"),
+			},
+			expectedEndpoint: "https://ssm.example.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			SSMClient := ssm.NewFromConfig(tc.SDKConfig)
+			instanceSSMClient := NewInstanceSSMClient(SSMClient, SSMClient.Options())
+
+			endpoint, err := instanceSSMClient.resolveSSMEndpoint(context.Background())
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if endpoint != tc.expectedEndpoint {
+				t.Fatalf("expected endpoint to equal '%s', got '%s'", tc.expectedEndpoint, endpoint)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// DataKey represents a data key generated by KMS.
+// The plaintext key must never be persisted.
+type DataKey struct {
+	Plaintext      []byte
+	CiphertextBlob []byte
+}
+
+// GenerateDataKeyWithKMS generates a 256-bit data key
+// encrypted under the passed KMS key (ID, ARN or alias).
+func GenerateDataKeyWithKMS(
+	ctx context.Context,
+	kmsClient KMSAPI,
+	kmsKeyID string,
+) (*DataKey, error) {
+
+	generateDataKeyResp, err := kmsClient.GenerateDataKey(
+		ctx,
+		&kms.GenerateDataKeyInput{
+			KeyId:   aws.String(kmsKeyID),
+			KeySpec: types.DataKeySpecAes256,
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataKey{
+		Plaintext:      generateDataKeyResp.Plaintext,
+		CiphertextBlob: generateDataKeyResp.CiphertextBlob,
+	}, nil
+}
+
+// DecryptDataKeyWithKMS decrypts a data key generated by
+// GenerateDataKeyWithKMS. The KMS key is found in the ciphertext.
+func DecryptDataKeyWithKMS(
+	ctx context.Context,
+	kmsClient KMSAPI,
+	ciphertextBlob []byte,
+) ([]byte, error) {
+
+	decryptResp, err := kmsClient.Decrypt(
+		ctx,
+		&kms.DecryptInput{
+			CiphertextBlob: ciphertextBlob,
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptResp.Plaintext, nil
+}
@@ -0,0 +1,85 @@
+package infrastructure
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// LookupAvailabilityZones returns the names of the available
+// availability zones of the region (sorted).
+// Local and Wavelength zones are excluded.
+func LookupAvailabilityZones(
+	ctx context.Context,
+	ec2Client EC2API,
+) ([]string, error) {
+
+	describeAvailabilityZonesResp, err := ec2Client.DescribeAvailabilityZones(
+		ctx,
+		&ec2.DescribeAvailabilityZonesInput{
+			Filters: []types.Filter{{
+				Name:   aws.String("state"),
+				Values: []string{"available"},
+			}, {
+				Name:   aws.String("zone-type"),
+				Values: []string{"availability-zone"},
+			}},
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	availabilityZones := []string{}
+
+	for _, availabilityZone := range describeAvailabilityZonesResp.AvailabilityZones {
+		availabilityZones = append(availabilityZones, aws.ToString(availabilityZone.ZoneName))
+	}
+
+	sort.Strings(availabilityZones)
+
+	return availabilityZones, nil
+}
+
+// LookupInstanceTypeAvailabilityZones returns the names of the
+// availability zones where the passed instance type is offered (sorted).
+// An empty list is returned for unknown instance types.
+func LookupInstanceTypeAvailabilityZones(
+	ctx context.Context,
+	ec2Client EC2API,
+	instanceType string,
+) ([]string, error) {
+
+	paginator := ec2.NewDescribeInstanceTypeOfferingsPaginator(
+		ec2Client,
+		&ec2.DescribeInstanceTypeOfferingsInput{
+			LocationType: types.LocationTypeAvailabilityZone,
+			Filters: []types.Filter{{
+				Name:   aws.String("instance-type"),
+				Values: []string{instanceType},
+			}},
+		},
+	)
+
+	availabilityZones := []string{}
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, offering := range page.InstanceTypeOfferings {
+			availabilityZones = append(availabilityZones, aws.ToString(offering.Location))
+		}
+	}
+
+	sort.Strings(availabilityZones)
+
+	return availabilityZones, nil
+}
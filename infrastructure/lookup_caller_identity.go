@@ -0,0 +1,40 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// CallerIdentity represents the
+// identity of the credentials used.
+type CallerIdentity struct {
+	AccountID string `json:"account_id"`
+	ARN       string `json:"arn"`
+	UserID    string `json:"user_id"`
+}
+
+// LookupCallerIdentity returns the identity of the credentials used
+// by the passed client. Given that GetCallerIdentity doesn't require
+// any permission, an error means that the credentials are not valid.
+func LookupCallerIdentity(
+	ctx context.Context,
+	stsClient STSAPI,
+) (*CallerIdentity, error) {
+
+	getCallerIdentityResp, err := stsClient.GetCallerIdentity(
+		ctx,
+		&sts.GetCallerIdentityInput{},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &CallerIdentity{
+		AccountID: aws.ToString(getCallerIdentityResp.Account),
+		ARN:       aws.ToString(getCallerIdentityResp.Arn),
+		UserID:    aws.ToString(getCallerIdentityResp.UserId),
+	}, nil
+}
@@ -0,0 +1,77 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCallerPublicIPAddress = errors.New("ErrInvalidCallerPublicIPAddress")
+)
+
+// The endpoint used by default to look up the public
+// IP address of the caller (returned as plain text).
+const callerPublicIPEndpoint = "https://checkip.amazonaws.com"
+
+// CallerPublicIPClient looks up the public IP address
+// used by the caller to reach internet.
+type CallerPublicIPClient struct {
+	httpClient *http.Client
+	endpoint   string
+}
+
+// NewCallerPublicIPClient constructs the CallerPublicIPClient struct.
+func NewCallerPublicIPClient() CallerPublicIPClient {
+	return CallerPublicIPClient{
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		endpoint: callerPublicIPEndpoint,
+	}
+}
+
+// LookupCallerPublicIPAddress returns the public IP address of the
+// caller. ErrInvalidCallerPublicIPAddress is returned if the
+// response is not an IP address.
+func (c CallerPublicIPClient) LookupCallerPublicIPAddress(
+	ctx context.Context,
+) (string, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.httpClient.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", ErrInvalidCallerPublicIPAddress
+	}
+
+	// An IP address is way smaller than that
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+
+	if err != nil {
+		return "", err
+	}
+
+	IPAddress := net.ParseIP(strings.TrimSpace(string(body)))
+
+	if IPAddress == nil {
+		return "", ErrInvalidCallerPublicIPAddress
+	}
+
+	return IPAddress.String(), nil
+}
@@ -0,0 +1,122 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+)
+
+// ErrIAMPolicySimulationUnavailable represents the error returned
+// when the policies of a principal could not be simulated
+// (eg: "iam:SimulatePrincipalPolicy" not allowed or unknown principal).
+var ErrIAMPolicySimulationUnavailable = errors.New("ErrIAMPolicySimulationUnavailable")
+
+// IAMActionsSimulation represents a set of
+// actions simulated on the same resources.
+type IAMActionsSimulation struct {
+	Actions []string
+
+	// ResourceARNs default to "*" (all resources) if not set
+	ResourceARNs []string
+
+	// Context represents the values of the condition
+	// keys (eg: "ec2:ResourceTag/Name") used during simulation
+	Context map[string]string
+}
+
+// LookupDeniedIAMActions simulates the policies attached to the passed
+// principal (IAM user or role ARN) and returns the actions that
+// are not allowed on all the resources of the simulation (sorted).
+func LookupDeniedIAMActions(
+	ctx context.Context,
+	IAMClient IAMAPI,
+	principalARN string,
+	simulation IAMActionsSimulation,
+) ([]string, error) {
+
+	contextEntries := []types.ContextEntry{}
+
+	for _, key := range sortedContextKeys(simulation.Context) {
+		contextEntries = append(contextEntries, types.ContextEntry{
+			ContextKeyName:   aws.String(key),
+			ContextKeyType:   types.ContextKeyTypeEnumString,
+			ContextKeyValues: []string{simulation.Context[key]},
+		})
+	}
+
+	paginator := iam.NewSimulatePrincipalPolicyPaginator(
+		IAMClient,
+		&iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(principalARN),
+			ActionNames:     simulation.Actions,
+			ResourceArns:    simulation.ResourceARNs,
+			ContextEntries:  contextEntries,
+		},
+	)
+
+	deniedActions := map[string]bool{}
+
+	for paginator.HasMorePages() {
+		simulatePolicyResp, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			var APIErr smithy.APIError
+
+			if errors.As(err, &APIErr) &&
+				(APIErr.ErrorCode() == "AccessDenied" ||
+					APIErr.ErrorCode() == "NoSuchEntity") {
+
+				return nil, ErrIAMPolicySimulationUnavailable
+			}
+
+			return nil, err
+		}
+
+		for _, result := range simulatePolicyResp.EvaluationResults {
+			if !isIAMActionAllowed(result) {
+				deniedActions[aws.ToString(result.EvalActionName)] = true
+			}
+		}
+	}
+
+	denied := []string{}
+
+	for action := range deniedActions {
+		denied = append(denied, action)
+	}
+
+	sort.Strings(denied)
+
+	return denied, nil
+}
+
+func isIAMActionAllowed(result types.EvaluationResult) bool {
+	if result.EvalDecision != types.PolicyEvaluationDecisionTypeAllowed {
+		return false
+	}
+
+	for _, resourceResult := range result.ResourceSpecificResults {
+		if resourceResult.EvalResourceDecision != types.PolicyEvaluationDecisionTypeAllowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortedContextKeys(context map[string]string) []string {
+	keys := make([]string, 0, len(context))
+
+	for key := range context {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
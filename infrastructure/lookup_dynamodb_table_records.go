@@ -3,6 +3,8 @@ package infrastructure
 import (
 	"context"
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -10,54 +12,495 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+const (
+	// DynamoDBRecodeConfigRootRecordID represents the ID of the record
+	// holding the config (without its clusters) and the IDs of the
+	// records holding its clusters and dev envs (see DynamoDBRecodeConfigShardRecord).
+	DynamoDBRecodeConfigRootRecordID = "config#root"
+
+	// The number of times the config is read again when a shard
+	// was removed by a concurrent update while it was read.
+	maxRecodeConfigLookupAttempts = 3
+
+	// The maximum number of keys that
+	// could be passed to BatchGetItem.
+	maxBatchGetItemKeys = 100
+
+	// The number of BatchGetItem calls made for the same
+	// keys when some of them are returned as unprocessed.
+	maxBatchGetItemAttempts = 5
+)
+
 var (
-	ErrNoRecodeConfigFound       = errors.New("ErrNoRecodeConfigFound")
 	ErrMultipleRecodeConfigFound = errors.New("ErrMultipleRecodeConfigFound")
+	// Returned when the shards of the config were removed by concurrent
+	// updates during each of the maxRecodeConfigLookupAttempts lookups.
+	ErrRecodeConfigUpdatedDuringLookup = errors.New("ErrRecodeConfigUpdatedDuringLookup")
+	// Returned when some shards were still unprocessed
+	// after maxBatchGetItemAttempts BatchGetItem calls.
+	ErrRecodeConfigShardsUnprocessed = errors.New("ErrRecodeConfigShardsUnprocessed")
+
+	errRecodeConfigRecordNotFound   = errors.New("errRecodeConfigRecordNotFound")
+	errRecodeConfigSnapshotNotFound = errors.New("errRecodeConfigSnapshotNotFound")
 )
 
+// DynamoDBRecodeConfigTableRecord represents the root record of the config
+// or a snapshot of a previous root record (see recodeConfigVersionRecordID).
+//
+// Before sharding, the whole config was stored in ConfigJSON in a
+// record whose ID was the config ID (see StoredRecodeConfig.LegacyRecordID).
 type DynamoDBRecodeConfigTableRecord struct {
 	ID         string
 	ConfigJSON string
+	// Incremented on each write. Used to detect
+	// concurrent updates (see UpdateRecodeConfigInDynamoDBTable).
+	Version         int64
+	ClusterShardIDs []string `dynamodbav:",omitempty"`
+
+	// Set when the sensitive fields
+	// of the config are encrypted
+	DataKeyProviderID string `dynamodbav:",omitempty"`
+	EncryptedDataKey  []byte `dynamodbav:",omitempty"`
+
+	// When and by whom this version was written (unix ms)
+	SavedAt           int64  `dynamodbav:",omitempty"`
+	WriterID          string `dynamodbav:",omitempty"`
+	WriterDescription string `dynamodbav:",omitempty"`
+
+	// Root record only. The versions kept in history (oldest first).
+	History []StoredRecodeConfigVersion `dynamodbav:",omitempty"`
+
+	// Snapshots only. The shards referenced by the
+	// previous version that are not referenced by this one.
+	UnreferencedShardIDs []string `dynamodbav:",omitempty"`
+}
+
+// DynamoDBRecodeConfigShardRecord represents a record holding
+// a cluster (without its dev envs) or a dev env.
+//
+// Shard IDs are derived from their content so that concurrent
+// updates never overwrite a shard referenced by another root record.
+type DynamoDBRecodeConfigShardRecord struct {
+	ID             string
+	ClusterJSON    string   `dynamodbav:",omitempty"`
+	DevEnvShardIDs []string `dynamodbav:",omitempty"`
+	DevEnvJSON     string   `dynamodbav:",omitempty"`
+	// The version of the root record that
+	// referenced this shard when it was written
+	ConfigVersion int64
 }
 
 func LookupRecodeConfigInDynamoDBTable(
-	dynamoDBClient *dynamodb.Client,
-) (returnedConfigJSON string, returnedError error) {
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+) (returnedConfig *StoredRecodeConfig, returnedError error) {
+
+	for attempt := 0; attempt < maxRecodeConfigLookupAttempts; attempt++ {
+		returnedConfig, returnedError = lookupShardedRecodeConfig(
+			ctx,
+			dynamoDBClient,
+			DynamoDBRecodeConfigRootRecordID,
+		)
+
+		// The shards referenced by the root record were removed
+		// by a concurrent update (that has also updated the root record)
+		if errors.Is(returnedError, errRecodeConfigRecordNotFound) {
+			continue
+		}
+
+		if errors.Is(returnedError, errRecodeConfigSnapshotNotFound) {
+			return lookupLegacyRecodeConfig(ctx, dynamoDBClient)
+		}
+
+		return
+	}
+
+	return nil, ErrRecodeConfigUpdatedDuringLookup
+}
+
+// LookupRecodeConfigHistoryInDynamoDBTable returns the
+// versions kept in the history of the config (oldest first).
+func LookupRecodeConfigHistoryInDynamoDBTable(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+) ([]StoredRecodeConfigVersion, error) {
+
+	var rootRecord *DynamoDBRecodeConfigTableRecord
+	err := getRecodeConfigRecord(
+		ctx,
+		dynamoDBClient,
+		DynamoDBRecodeConfigRootRecordID,
+		&rootRecord,
+	)
+
+	if err != nil {
+
+		if errors.Is(err, errRecodeConfigRecordNotFound) {
+			return nil, ErrNoRecodeConfigFound
+		}
+
+		return nil, err
+	}
+
+	return recodeConfigHistory(rootRecord), nil
+}
+
+// LookupRecodeConfigVersionInDynamoDBTable returns the passed version of
+// the config. Only the versions kept in history could be returned.
+func LookupRecodeConfigVersionInDynamoDBTable(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	version int64,
+) (*StoredRecodeConfig, error) {
+
+	config, err := lookupShardedRecodeConfig(
+		ctx,
+		dynamoDBClient,
+		recodeConfigVersionRecordID(version),
+	)
+
+	if err != nil {
+
+		if errors.Is(err, errRecodeConfigSnapshotNotFound) ||
+			errors.Is(err, errRecodeConfigRecordNotFound) { // Pruned concurrently
+
+			return nil, ErrRecodeConfigVersionNotFound
+		}
+
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// lookupShardedRecodeConfig looks up the config from the root
+// record or a snapshot (passed record ID) and its shards.
+func lookupShardedRecodeConfig(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	recordID string,
+) (*StoredRecodeConfig, error) {
+
+	var rootRecord *DynamoDBRecodeConfigTableRecord
+	err := getRecodeConfigRecord(
+		ctx,
+		dynamoDBClient,
+		recordID,
+		&rootRecord,
+	)
+
+	if err != nil {
+
+		if errors.Is(err, errRecodeConfigRecordNotFound) {
+			return nil, errRecodeConfigSnapshotNotFound
+		}
+
+		return nil, err
+	}
+
+	config := &StoredRecodeConfig{
+		Version:           rootRecord.Version,
+		ConfigJSON:        rootRecord.ConfigJSON,
+		DataKeyProviderID: rootRecord.DataKeyProviderID,
+		EncryptedDataKey:  rootRecord.EncryptedDataKey,
+	}
+
+	clusterShards := map[string]*DynamoDBRecodeConfigShardRecord{}
+	err = batchGetRecodeConfigRecords(
+		ctx,
+		dynamoDBClient,
+		rootRecord.ClusterShardIDs,
+		clusterShards,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The dev envs of all the clusters are read together
+	devEnvShardIDs := []string{}
+
+	for _, clusterShardID := range rootRecord.ClusterShardIDs {
+		devEnvShardIDs = append(
+			devEnvShardIDs,
+			clusterShards[clusterShardID].DevEnvShardIDs...,
+		)
+	}
+
+	devEnvShards := map[string]*DynamoDBRecodeConfigShardRecord{}
+	err = batchGetRecodeConfigRecords(
+		ctx,
+		dynamoDBClient,
+		devEnvShardIDs,
+		devEnvShards,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, clusterShardID := range rootRecord.ClusterShardIDs {
+		clusterShard := clusterShards[clusterShardID]
+
+		cluster := StoredRecodeConfigCluster{
+			ClusterJSON: clusterShard.ClusterJSON,
+			DevEnvJSONs: []string{},
+		}
+
+		for _, devEnvShardID := range clusterShard.DevEnvShardIDs {
+			cluster.DevEnvJSONs = append(
+				cluster.DevEnvJSONs,
+				devEnvShards[devEnvShardID].DevEnvJSON,
+			)
+		}
+
+		config.Clusters = append(config.Clusters, cluster)
+	}
+
+	return config, nil
+}
+
+// lookupLegacyRecodeConfig looks up the config stored in one record
+// (before sharding). The table is scanned given that the ID of
+// the legacy record is the config ID.
+func lookupLegacyRecodeConfig(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+) (*StoredRecodeConfig, error) {
 
-	scanResp, err := dynamoDBClient.Scan(context.TODO(), &dynamodb.ScanInput{
+	scanInput := &dynamodb.ScanInput{
 		TableName: aws.String(DynamoDBRecodeConfigTableName),
+		// The table also stores leases, shards and snapshots
+		FilterExpression: aws.String(
+			"attribute_exists(#configJSON) AND attribute_not_exists(#savedAt) AND #id <> :rootRecordID",
+		),
+		ExpressionAttributeNames: map[string]string{
+			"#configJSON": "ConfigJSON",
+			"#savedAt":    "SavedAt",
+			"#id":         "ID",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":rootRecordID": &types.AttributeValueMemberS{
+				Value: DynamoDBRecodeConfigRootRecordID,
+			},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	var records []DynamoDBRecodeConfigTableRecord
+	paginator := dynamodb.NewScanPaginator(dynamoDBClient, scanInput)
+
+	for paginator.HasMorePages() {
+		scanResp, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			var resourceNotFoundErr *types.ResourceNotFoundException
+
+			if errors.As(err, &resourceNotFoundErr) { // Table not found
+				return nil, ErrNoRecodeConfigFound
+			}
+
+			return nil, err
+		}
+
+		var pageRecords []DynamoDBRecodeConfigTableRecord
+		err = attributevalue.UnmarshalListOfMaps(scanResp.Items, &pageRecords)
+
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, pageRecords...)
+	}
+
+	if len(records) == 0 { // Empty table
+		return nil, ErrNoRecodeConfigFound
+	}
+
+	if len(records) > 1 { // Multiple rows
+		return nil, ErrMultipleRecodeConfigFound
+	}
+
+	return &StoredRecodeConfig{
+		Version:        records[0].Version,
+		ConfigJSON:     records[0].ConfigJSON,
+		LegacyRecordID: records[0].ID,
+	}, nil
+}
+
+// getRecodeConfigRecord returns errRecodeConfigRecordNotFound
+// if the record doesn't exist.
+func getRecodeConfigRecord(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	recordID string,
+	record interface{},
+) error {
+
+	getItemResp, err := dynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(DynamoDBRecodeConfigTableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: recordID},
+		},
+		ConsistentRead: aws.Bool(true),
 	})
 
 	if err != nil {
 		var resourceNotFoundErr *types.ResourceNotFoundException
 
 		if errors.As(err, &resourceNotFoundErr) { // Table not found
-			returnedError = ErrNoRecodeConfigFound
-			return
+			return ErrNoRecodeConfigFound
 		}
 
-		returnedError = err
-		return
+		return err
 	}
 
-	if scanResp.Count == 0 { // Empty table
-		returnedError = ErrNoRecodeConfigFound
-		return
+	if getItemResp.Item == nil {
+		return errRecodeConfigRecordNotFound
 	}
 
-	if scanResp.Count > 1 { // Multiple rows
-		returnedError = ErrMultipleRecodeConfigFound
-		return
+	return attributevalue.UnmarshalMap(getItemResp.Item, record)
+}
+
+// batchGetRecodeConfigRecords reads the shards with the passed IDs
+// (in batches of maxBatchGetItemKeys) and stores them by ID in
+// records. Returns errRecodeConfigRecordNotFound if one
+// of the shards doesn't exist.
+func batchGetRecodeConfigRecords(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	recordIDs []string,
+	records map[string]*DynamoDBRecodeConfigShardRecord,
+) error {
+
+	// BatchGetItem rejects duplicate keys
+	uniqueRecordIDs := []string{}
+	seenRecordIDs := map[string]bool{}
+
+	for _, recordID := range recordIDs {
+		if seenRecordIDs[recordID] {
+			continue
+		}
+
+		seenRecordIDs[recordID] = true
+		uniqueRecordIDs = append(uniqueRecordIDs, recordID)
 	}
 
-	var records []DynamoDBRecodeConfigTableRecord
-	err = attributevalue.UnmarshalListOfMaps(scanResp.Items, &records)
+	for start := 0; start < len(uniqueRecordIDs); start += maxBatchGetItemKeys {
+		end := start + maxBatchGetItemKeys
 
-	if err != nil {
-		returnedError = err
-		return
+		if end > len(uniqueRecordIDs) {
+			end = len(uniqueRecordIDs)
+		}
+
+		keys := []map[string]types.AttributeValue{}
+
+		for _, recordID := range uniqueRecordIDs[start:end] {
+			keys = append(keys, map[string]types.AttributeValue{
+				"ID": &types.AttributeValueMemberS{Value: recordID},
+			})
+		}
+
+		err := batchGetRecodeConfigRecordsWithRetries(ctx, dynamoDBClient, keys, records)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, recordID := range uniqueRecordIDs {
+		if _, ok := records[recordID]; !ok {
+			return errRecodeConfigRecordNotFound
+		}
+	}
+
+	return nil
+}
+
+// batchGetRecodeConfigRecordsWithRetries calls BatchGetItem until
+// all the passed keys are processed, waiting (with an exponential
+// backoff) between each call as recommended by AWS.
+func batchGetRecodeConfigRecordsWithRetries(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	keys []map[string]types.AttributeValue,
+	records map[string]*DynamoDBRecodeConfigShardRecord,
+) error {
+
+	retryDelay := 50 * time.Millisecond
+
+	for attempt := 0; attempt < maxBatchGetItemAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryDelay):
+			}
+
+			retryDelay *= 2
+		}
+
+		batchGetItemResp, err := dynamoDBClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				DynamoDBRecodeConfigTableName: {
+					Keys:           keys,
+					ConsistentRead: aws.Bool(true),
+				},
+			},
+		})
+
+		if err != nil {
+			var resourceNotFoundErr *types.ResourceNotFoundException
+
+			if errors.As(err, &resourceNotFoundErr) { // Table not found
+				return ErrNoRecodeConfigFound
+			}
+
+			return err
+		}
+
+		var batchRecords []*DynamoDBRecodeConfigShardRecord
+		err = attributevalue.UnmarshalListOfMaps(
+			batchGetItemResp.Responses[DynamoDBRecodeConfigTableName],
+			&batchRecords,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		for _, record := range batchRecords {
+			records[record.ID] = record
+		}
+
+		keys = batchGetItemResp.UnprocessedKeys[DynamoDBRecodeConfigTableName].Keys
+
+		if len(keys) == 0 {
+			return nil
+		}
 	}
 
-	returnedConfigJSON = records[0].ConfigJSON
-	return
+	return ErrRecodeConfigShardsUnprocessed
+}
+
+// recodeConfigHistory returns the versions kept in the history
+// of the passed root record. Root records written before history
+// was introduced only reference their own version.
+func recodeConfigHistory(
+	rootRecord *DynamoDBRecodeConfigTableRecord,
+) []StoredRecodeConfigVersion {
+
+	if len(rootRecord.History) > 0 {
+		return rootRecord.History
+	}
+
+	return []StoredRecodeConfigVersion{
+		{
+			Version: rootRecord.Version,
+		},
+	}
+}
+
+func recodeConfigVersionRecordID(version int64) string {
+	return "config#version#" + strconv.FormatInt(version, 10)
 }
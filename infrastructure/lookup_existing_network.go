@@ -0,0 +1,167 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	ErrVPCNotFound    = errors.New("ErrVPCNotFound")
+	ErrSubnetNotFound = errors.New("ErrSubnetNotFound")
+)
+
+// DefaultRouteTarget represents the kind of gateway
+// targeted by the default route ("0.0.0.0/0") of a subnet.
+type DefaultRouteTarget string
+
+const (
+	DefaultRouteTargetNone            DefaultRouteTarget = ""
+	DefaultRouteTargetInternetGateway DefaultRouteTarget = "internet-gateway"
+	DefaultRouteTargetNATGateway      DefaultRouteTarget = "nat-gateway"
+)
+
+// ExistingNetwork represents a VPC and a subnet
+// that were not created by Recode.
+type ExistingNetwork struct {
+	VPCCIDRBlock        string
+	SubnetCIDRBlock     string
+	SubnetVPCID         string
+	AvailabilityZone    string
+	MapPublicIPOnLaunch bool
+
+	// DefaultRouteTarget is looked up in the route table associated
+	// with the subnet (or in the main route table of the VPC if none)
+	DefaultRouteTarget DefaultRouteTarget
+}
+
+// LookupExistingNetwork returns the passed VPC and subnet.
+// ErrVPCNotFound or ErrSubnetNotFound is returned if they don't exist.
+func LookupExistingNetwork(
+	ctx context.Context,
+	ec2Client EC2API,
+	VPCID string,
+	subnetID string,
+) (*ExistingNetwork, error) {
+
+	describeVPCsResp, err := ec2Client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{
+		VpcIds: []string{VPCID},
+	})
+
+	if err != nil {
+		return nil, notFoundError(err, "InvalidVpcID.NotFound", ErrVPCNotFound)
+	}
+
+	if len(describeVPCsResp.Vpcs) == 0 {
+		return nil, ErrVPCNotFound
+	}
+
+	describeSubnetsResp, err := ec2Client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{
+		SubnetIds: []string{subnetID},
+	})
+
+	if err != nil {
+		return nil, notFoundError(err, "InvalidSubnetID.NotFound", ErrSubnetNotFound)
+	}
+
+	if len(describeSubnetsResp.Subnets) == 0 {
+		return nil, ErrSubnetNotFound
+	}
+
+	subnet := describeSubnetsResp.Subnets[0]
+
+	defaultRouteTarget, err := lookupDefaultRouteTarget(
+		ctx,
+		ec2Client,
+		aws.ToString(subnet.VpcId),
+		subnetID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExistingNetwork{
+		VPCCIDRBlock:        aws.ToString(describeVPCsResp.Vpcs[0].CidrBlock),
+		SubnetCIDRBlock:     aws.ToString(subnet.CidrBlock),
+		SubnetVPCID:         aws.ToString(subnet.VpcId),
+		AvailabilityZone:    aws.ToString(subnet.AvailabilityZone),
+		MapPublicIPOnLaunch: aws.ToBool(subnet.MapPublicIpOnLaunch),
+		DefaultRouteTarget:  defaultRouteTarget,
+	}, nil
+}
+
+func lookupDefaultRouteTarget(
+	ctx context.Context,
+	ec2Client EC2API,
+	VPCID string,
+	subnetID string,
+) (DefaultRouteTarget, error) {
+
+	// Subnets without explicit association use the main route table
+	filtersList := [][]types.Filter{
+		{{
+			Name:   aws.String("association.subnet-id"),
+			Values: []string{subnetID},
+		}},
+		{{
+			Name:   aws.String("vpc-id"),
+			Values: []string{VPCID},
+		}, {
+			Name:   aws.String("association.main"),
+			Values: []string{"true"},
+		}},
+	}
+
+	for _, filters := range filtersList {
+		describeRouteTablesResp, err := ec2Client.DescribeRouteTables(
+			ctx,
+			&ec2.DescribeRouteTablesInput{
+				Filters: filters,
+			},
+		)
+
+		if err != nil {
+			return DefaultRouteTargetNone, err
+		}
+
+		if len(describeRouteTablesResp.RouteTables) == 0 {
+			continue
+		}
+
+		for _, route := range describeRouteTablesResp.RouteTables[0].Routes {
+			if aws.ToString(route.DestinationCidrBlock) != "0.0.0.0/0" ||
+				route.State == types.RouteStateBlackhole {
+
+				continue
+			}
+
+			if len(aws.ToString(route.NatGatewayId)) > 0 {
+				return DefaultRouteTargetNATGateway, nil
+			}
+
+			if strings.HasPrefix(aws.ToString(route.GatewayId), "igw-") {
+				return DefaultRouteTargetInternetGateway, nil
+			}
+		}
+
+		return DefaultRouteTargetNone, nil
+	}
+
+	return DefaultRouteTargetNone, nil
+}
+
+func notFoundError(err error, notFoundCode string, notFoundErr error) error {
+	var APIErr smithy.APIError
+
+	if errors.As(err, &APIErr) && APIErr.ErrorCode() == notFoundCode {
+		return notFoundErr
+	}
+
+	return err
+}
@@ -0,0 +1,31 @@
+package infrastructure
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+)
+
+// LookupHostedZoneName returns the domain name of the
+// Route 53 hosted zone (without the trailing dot).
+func LookupHostedZoneName(
+	ctx context.Context,
+	route53Client Route53API,
+	hostedZoneID string,
+) (string, error) {
+
+	getHostedZoneResp, err := route53Client.GetHostedZone(
+		ctx,
+		&route53.GetHostedZoneInput{
+			Id: aws.String(hostedZoneID),
+		},
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(aws.ToString(getHostedZoneResp.HostedZone.Name), "."), nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
@@ -13,12 +14,13 @@ var (
 )
 
 func lookupInstance(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	instanceID string,
 ) (*types.Instance, error) {
 
 	describeInstancesResp, err := ec2Client.DescribeInstances(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeInstancesInput{
 			InstanceIds: []string{instanceID},
 		},
@@ -37,3 +39,20 @@ func lookupInstance(
 	instance := describeInstancesResp.Reservations[0].Instances[0]
 	return &instance, nil
 }
+
+// instanceIPv6Address returns the IPv6 address of the instance
+// (empty in IPv4-only subnets). The address assigned to the
+// network interface is used when no primary one is set.
+func instanceIPv6Address(instance *types.Instance) string {
+	if len(aws.ToString(instance.Ipv6Address)) > 0 {
+		return aws.ToString(instance.Ipv6Address)
+	}
+
+	for _, networkInterface := range instance.NetworkInterfaces {
+		for _, IPv6Address := range networkInterface.Ipv6Addresses {
+			return aws.ToString(IPv6Address.Ipv6Address)
+		}
+	}
+
+	return ""
+}
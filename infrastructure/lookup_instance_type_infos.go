@@ -18,8 +18,9 @@ const (
 )
 
 var (
-	ErrInvalidInstanceType     = errors.New("ErrInvalidInstanceType")
-	ErrInvalidInstanceTypeArch = errors.New("ErrInvalidInstanceTypeArch")
+	ErrInvalidInstanceType         = errors.New("ErrInvalidInstanceType")
+	ErrInvalidInstanceTypeArch     = errors.New("ErrInvalidInstanceTypeArch")
+	ErrInstanceTypeSpotUnsupported = errors.New("ErrInstanceTypeSpotUnsupported")
 
 	SupportedInstanceTypeArchs = []string{
 		string(InstanceTypeArchArm64),
@@ -32,13 +33,18 @@ type InstanceTypeInfos struct {
 	Arch InstanceTypeArch `json:"arch"`
 }
 
+// LookupInstanceTypeInfos looks up the architecture of the passed
+// instance type. When spot is set, ErrInstanceTypeSpotUnsupported
+// is returned if the instance type could not be launched as spot.
 func LookupInstanceTypeInfos(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	instanceType string,
+	spot bool,
 ) (returnedInstanceTypeInfos *InstanceTypeInfos, returnedError error) {
 
 	describeInstanceTypesResp, err := ec2Client.DescribeInstanceTypes(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeInstanceTypesInput{
 			InstanceTypes: []types.InstanceType{
 				types.InstanceType(instanceType),
@@ -78,6 +84,11 @@ func LookupInstanceTypeInfos(
 		return
 	}
 
+	if spot && !supportsUsageClass(instanceTypes[0], types.UsageClassTypeSpot) {
+		returnedError = ErrInstanceTypeSpotUnsupported
+		return
+	}
+
 	supportedArchs := instanceTypes[0].ProcessorInfo.SupportedArchitectures
 
 	returnedInstanceTypeInfos = &InstanceTypeInfos{
@@ -94,3 +105,17 @@ func LookupInstanceTypeInfos(
 	returnedInstanceTypeInfos.Arch = InstanceTypeArchX8664
 	return
 }
+
+func supportsUsageClass(
+	instanceType types.InstanceTypeInfo,
+	usageClass types.UsageClassType,
+) bool {
+
+	for _, supportedUsageClass := range instanceType.SupportedUsageClasses {
+		if supportedUsageClass == usageClass {
+			return true
+		}
+	}
+
+	return false
+}
@@ -22,7 +22,8 @@ type AMI struct {
 }
 
 func LookupUbuntuAMIForArch(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	arch InstanceTypeArch,
 ) (returnedAMI *AMI, returnedError error) {
 
@@ -33,7 +34,7 @@ func LookupUbuntuAMIForArch(
 	}
 
 	describeImagesResp, err := ec2Client.DescribeImages(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeImagesInput{
 			Filters: []types.Filter{{
 				Name: aws.String("name"),
@@ -0,0 +1,552 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	recodeConfigRootObjectKey = "config.json"
+)
+
+var (
+	errRecodeConfigObjectNotFound        = errors.New("errRecodeConfigObjectNotFound")
+	errRecodeConfigObjectConditionFailed = errors.New("errRecodeConfigObjectConditionFailed")
+)
+
+// recodeConfigObjectStore represents the interface used by
+// ObjectRecodeConfigStorage to store objects in an S3 bucket
+// or in a local directory.
+//
+// Objects are identified by a slash-separated key and versioned
+// by an ETag that changes each time their content changes.
+type recodeConfigObjectStore interface {
+	create(ctx context.Context) error
+	remove(ctx context.Context) error
+
+	// getObject returns errRecodeConfigObjectNotFound
+	// if the object doesn't exist.
+	getObject(ctx context.Context, key string) (content []byte, ETag string, err error)
+
+	// putObject and deleteObject return
+	// errRecodeConfigObjectConditionFailed
+	// if the passed condition is not met.
+	putObject(ctx context.Context, key string, content []byte, condition recodeConfigObjectCondition) error
+	deleteObject(ctx context.Context, key string, condition recodeConfigObjectCondition) error
+
+	// listObjectKeys returns the keys
+	// that start with the passed prefix.
+	listObjectKeys(ctx context.Context, keyPrefix string) ([]string, error)
+}
+
+// recodeConfigObjectCondition represents the condition
+// of a write. The zero value means no condition.
+type recodeConfigObjectCondition struct {
+	// The write succeeds only if the
+	// current ETag of the object equals IfMatch
+	IfMatch string
+
+	// The write succeeds only if the object doesn't exist
+	IfNotExists bool
+}
+
+// recodeConfigObject represents the root object of the config
+// or a snapshot of a previous root object (see recodeConfigVersionObjectKey).
+//
+// Contrary to DynamoDB items, objects are not size-limited
+// so the config is not sharded.
+type recodeConfigObject struct {
+	Version    int64
+	ConfigJSON string
+	Clusters   []StoredRecodeConfigCluster
+
+	DataKeyProviderID string `json:",omitempty"`
+	EncryptedDataKey  []byte `json:",omitempty"`
+
+	SavedAt           int64
+	WriterID          string `json:",omitempty"`
+	WriterDescription string `json:",omitempty"`
+
+	// Root object only. The versions kept in history (oldest first).
+	History []StoredRecodeConfigVersion `json:",omitempty"`
+}
+
+// ObjectRecodeConfigStorage stores the config and the leases
+// as JSON objects in an S3 bucket or in a local directory
+// (see NewS3RecodeConfigStorage and NewFileRecodeConfigStorage).
+//
+// Concurrent updates are detected with conditional writes
+// based on the ETag of the objects.
+type ObjectRecodeConfigStorage struct {
+	objectStore recodeConfigObjectStore
+}
+
+func (o ObjectRecodeConfigStorage) Create(ctx context.Context) error {
+	return o.objectStore.create(ctx)
+}
+
+func (o ObjectRecodeConfigStorage) Remove(ctx context.Context) error {
+	return o.objectStore.remove(ctx)
+}
+
+func (o ObjectRecodeConfigStorage) LookupConfig(
+	ctx context.Context,
+) (*StoredRecodeConfig, error) {
+
+	rootObject, _, err := o.getRootObject(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rootObject.storedConfig(), nil
+}
+
+func (o ObjectRecodeConfigStorage) LookupConfigHistory(
+	ctx context.Context,
+) ([]StoredRecodeConfigVersion, error) {
+
+	rootObject, _, err := o.getRootObject(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rootObject.History, nil
+}
+
+// LookupConfigVersion returns the passed version of the config.
+// Only the versions kept in history could be returned.
+func (o ObjectRecodeConfigStorage) LookupConfigVersion(
+	ctx context.Context,
+	version int64,
+) (*StoredRecodeConfig, error) {
+
+	rootObject, _, err := o.getRootObject(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rootObject.Version == version {
+		return rootObject.storedConfig(), nil
+	}
+
+	versionInHistory := false
+
+	for _, historyVersion := range rootObject.History {
+		if historyVersion.Version == version {
+			versionInHistory = true
+			break
+		}
+	}
+
+	if !versionInHistory {
+		return nil, ErrRecodeConfigVersionNotFound
+	}
+
+	var snapshotObject *recodeConfigObject
+	_, err = o.getJSONObject(ctx, recodeConfigVersionObjectKey(version), &snapshotObject)
+
+	if err != nil {
+
+		if errors.Is(err, errRecodeConfigObjectNotFound) { // Pruned concurrently
+			return nil, ErrRecodeConfigVersionNotFound
+		}
+
+		return nil, err
+	}
+
+	return snapshotObject.storedConfig(), nil
+}
+
+// UpdateConfig writes the config only if the version of the
+// root object equals expectedVersion (0 means that the config
+// was never written).
+//
+// Before being replaced, the root object is copied to a snapshot
+// so that it could be restored. Snapshots are immutable: all the
+// concurrent writers would copy the same root object.
+func (o ObjectRecodeConfigStorage) UpdateConfig(
+	ctx context.Context,
+	config *StoredRecodeConfig,
+	expectedVersion int64,
+	historyOpts RecodeConfigHistoryOpts,
+) error {
+
+	previousRootObject, previousRootObjectETag, err := o.getRootObject(ctx)
+
+	if err != nil && !errors.Is(err, ErrNoRecodeConfigFound) {
+		return err
+	}
+
+	if (previousRootObject == nil && expectedVersion != 0) ||
+		(previousRootObject != nil && previousRootObject.Version != expectedVersion) {
+
+		return ErrRecodeConfigVersionMismatch
+	}
+
+	previousHistory := []StoredRecodeConfigVersion{}
+	rootObjectCondition := recodeConfigObjectCondition{
+		IfNotExists: true,
+	}
+
+	if previousRootObject != nil {
+		previousHistory = previousRootObject.History
+		rootObjectCondition = recodeConfigObjectCondition{
+			IfMatch: previousRootObjectETag,
+		}
+
+		snapshotObject := *previousRootObject
+		snapshotObject.History = nil
+
+		err := o.putJSONObject(
+			ctx,
+			recodeConfigVersionObjectKey(snapshotObject.Version),
+			snapshotObject,
+			recodeConfigObjectCondition{},
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	savedVersion := StoredRecodeConfigVersion{
+		Version:           expectedVersion + 1,
+		SavedAt:           time.Now().UnixMilli(),
+		WriterID:          historyOpts.WriterID,
+		WriterDescription: historyOpts.WriterDescription,
+	}
+
+	history, prunedVersions := appendRecodeConfigHistory(
+		previousHistory,
+		savedVersion,
+		historyOpts,
+	)
+
+	err = o.putJSONObject(
+		ctx,
+		recodeConfigRootObjectKey,
+		recodeConfigObject{
+			Version:           savedVersion.Version,
+			ConfigJSON:        config.ConfigJSON,
+			Clusters:          config.Clusters,
+			DataKeyProviderID: config.DataKeyProviderID,
+			EncryptedDataKey:  config.EncryptedDataKey,
+			SavedAt:           savedVersion.SavedAt,
+			WriterID:          savedVersion.WriterID,
+			WriterDescription: savedVersion.WriterDescription,
+			History:           history,
+		},
+		rootObjectCondition,
+	)
+
+	if err != nil {
+
+		if errors.Is(err, errRecodeConfigObjectConditionFailed) {
+			return ErrRecodeConfigVersionMismatch
+		}
+
+		return err
+	}
+
+	// The config was written. Pruning the history
+	// is best effort: leftovers are harmless.
+	for _, prunedVersion := range prunedVersions {
+		_ = o.objectStore.deleteObject(
+			ctx,
+			recodeConfigVersionObjectKey(prunedVersion.Version),
+			recodeConfigObjectCondition{},
+		)
+	}
+
+	return nil
+}
+
+// RemoveLegacyConfig is a no-op. Legacy
+// configs are only found in DynamoDB.
+func (o ObjectRecodeConfigStorage) RemoveLegacyConfig(
+	ctx context.Context,
+	legacyRecordID string,
+) error {
+
+	return nil
+}
+
+// AcquireLease creates or renews the lease with the passed ID.
+// It succeeds if the lease doesn't exist, has expired or is
+// already held by ownerID. Otherwise, ErrLeaseAlreadyHeld is returned.
+func (o ObjectRecodeConfigStorage) AcquireLease(
+	ctx context.Context,
+	leaseID string,
+	ownerID string,
+	ownerDescription string,
+	expiresAt time.Time,
+) error {
+
+	heldLease, heldLeaseETag, err := o.getLease(ctx, leaseID)
+
+	if err != nil {
+		return err
+	}
+
+	condition := recodeConfigObjectCondition{
+		IfNotExists: true,
+	}
+
+	if heldLease != nil {
+		if heldLease.OwnerID != ownerID &&
+			heldLease.ExpiresAt >= time.Now().UnixMilli() {
+
+			return ErrLeaseAlreadyHeld
+		}
+
+		condition = recodeConfigObjectCondition{
+			IfMatch: heldLeaseETag,
+		}
+	}
+
+	err = o.putJSONObject(
+		ctx,
+		leaseObjectKey(leaseID),
+		LeaseRecord{
+			ID:               leaseID,
+			OwnerID:          ownerID,
+			OwnerDescription: ownerDescription,
+			ExpiresAt:        expiresAt.UnixMilli(),
+		},
+		condition,
+	)
+
+	if errors.Is(err, errRecodeConfigObjectConditionFailed) {
+		return ErrLeaseAlreadyHeld
+	}
+
+	return err
+}
+
+// RenewLease extends the lease with the passed ID. Contrary to
+// AcquireLease, an expired lease is not reclaimed: ErrLeaseNotHeld
+// is returned if the lease is not held by ownerID anymore.
+func (o ObjectRecodeConfigStorage) RenewLease(
+	ctx context.Context,
+	leaseID string,
+	ownerID string,
+	ownerDescription string,
+	expiresAt time.Time,
+) error {
+
+	heldLease, heldLeaseETag, err := o.getLease(ctx, leaseID)
+
+	if err != nil {
+		return err
+	}
+
+	if heldLease == nil || heldLease.OwnerID != ownerID {
+		return ErrLeaseNotHeld
+	}
+
+	err = o.putJSONObject(
+		ctx,
+		leaseObjectKey(leaseID),
+		LeaseRecord{
+			ID:               leaseID,
+			OwnerID:          ownerID,
+			OwnerDescription: ownerDescription,
+			ExpiresAt:        expiresAt.UnixMilli(),
+		},
+		recodeConfigObjectCondition{
+			IfMatch: heldLeaseETag,
+		},
+	)
+
+	if errors.Is(err, errRecodeConfigObjectConditionFailed) {
+		return ErrLeaseNotHeld
+	}
+
+	return err
+}
+
+// ReleaseLease removes the lease with the passed ID if it is still
+// held by ownerID. Releasing a lease that was reclaimed by
+// someone else is a no-op.
+func (o ObjectRecodeConfigStorage) ReleaseLease(
+	ctx context.Context,
+	leaseID string,
+	ownerID string,
+) error {
+
+	heldLease, heldLeaseETag, err := o.getLease(ctx, leaseID)
+
+	if err != nil {
+		return err
+	}
+
+	if heldLease == nil || heldLease.OwnerID != ownerID {
+		return nil
+	}
+
+	err = o.objectStore.deleteObject(
+		ctx,
+		leaseObjectKey(leaseID),
+		recodeConfigObjectCondition{
+			IfMatch: heldLeaseETag,
+		},
+	)
+
+	if err != nil &&
+		!errors.Is(err, errRecodeConfigObjectConditionFailed) &&
+		!errors.Is(err, errRecodeConfigObjectNotFound) {
+
+		return err
+	}
+
+	return nil
+}
+
+// LookupLease returns the lease with the
+// passed ID or nil if the lease doesn't exist.
+func (o ObjectRecodeConfigStorage) LookupLease(
+	ctx context.Context,
+	leaseID string,
+) (*LeaseRecord, error) {
+
+	lease, _, err := o.getLease(ctx, leaseID)
+
+	return lease, err
+}
+
+// ListLeases returns the leases whose ID starts with
+// the passed prefix (including the expired ones).
+func (o ObjectRecodeConfigStorage) ListLeases(
+	ctx context.Context,
+	leaseIDPrefix string,
+) ([]*LeaseRecord, error) {
+
+	keys, err := o.objectStore.listObjectKeys(ctx, leaseObjectKeyPrefix+leaseIDPrefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	leases := []*LeaseRecord{}
+
+	for _, key := range keys {
+		var lease *LeaseRecord
+		_, err := o.getJSONObject(ctx, key, &lease)
+
+		// Released in the meantime
+		if errors.Is(err, errRecodeConfigObjectNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		leases = append(leases, lease)
+	}
+
+	return leases, nil
+}
+
+// getRootObject returns ErrNoRecodeConfigFound
+// if the root object doesn't exist.
+func (o ObjectRecodeConfigStorage) getRootObject(
+	ctx context.Context,
+) (*recodeConfigObject, string, error) {
+
+	var rootObject *recodeConfigObject
+	ETag, err := o.getJSONObject(ctx, recodeConfigRootObjectKey, &rootObject)
+
+	if err != nil {
+
+		if errors.Is(err, errRecodeConfigObjectNotFound) {
+			return nil, "", ErrNoRecodeConfigFound
+		}
+
+		return nil, "", err
+	}
+
+	return rootObject, ETag, nil
+}
+
+// getLease returns a nil lease if the lease doesn't exist.
+func (o ObjectRecodeConfigStorage) getLease(
+	ctx context.Context,
+	leaseID string,
+) (*LeaseRecord, string, error) {
+
+	var lease *LeaseRecord
+	ETag, err := o.getJSONObject(ctx, leaseObjectKey(leaseID), &lease)
+
+	if err != nil {
+
+		if errors.Is(err, errRecodeConfigObjectNotFound) {
+			return nil, "", nil
+		}
+
+		return nil, "", err
+	}
+
+	return lease, ETag, nil
+}
+
+func (o ObjectRecodeConfigStorage) getJSONObject(
+	ctx context.Context,
+	key string,
+	object interface{},
+) (string, error) {
+
+	content, ETag, err := o.objectStore.getObject(ctx, key)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := json.Unmarshal(content, object); err != nil {
+		return "", err
+	}
+
+	return ETag, nil
+}
+
+func (o ObjectRecodeConfigStorage) putJSONObject(
+	ctx context.Context,
+	key string,
+	object interface{},
+	condition recodeConfigObjectCondition,
+) error {
+
+	content, err := json.Marshal(object)
+
+	if err != nil {
+		return err
+	}
+
+	return o.objectStore.putObject(ctx, key, content, condition)
+}
+
+func (r recodeConfigObject) storedConfig() *StoredRecodeConfig {
+	return &StoredRecodeConfig{
+		Version:           r.Version,
+		ConfigJSON:        r.ConfigJSON,
+		Clusters:          r.Clusters,
+		DataKeyProviderID: r.DataKeyProviderID,
+		EncryptedDataKey:  r.EncryptedDataKey,
+	}
+}
+
+func recodeConfigVersionObjectKey(version int64) string {
+	return "versions/" + strconv.FormatInt(version, 10) + ".json"
+}
+
+const leaseObjectKeyPrefix = "leases/"
+
+func leaseObjectKey(leaseID string) string {
+	return leaseObjectKeyPrefix + leaseID + ".json"
+}
@@ -0,0 +1,158 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	// OwnerAccountIDTagKey represents the key of the tag set to
+	// the account ID of the credentials that created the resource.
+	OwnerAccountIDTagKey = "RecodeOwnerAccountID"
+
+	// OwnerARNTagKey represents the key of the tag set to
+	// the ARN of the credentials that created the resource.
+	OwnerARNTagKey = "RecodeOwnerARN"
+)
+
+// ownerTaggedEC2Client adds the owner tags to the
+// tag specifications of the EC2 resources created
+// through the embedded client.
+type ownerTaggedEC2Client struct {
+	EC2API
+
+	lookupOwner func() *CallerIdentity
+}
+
+// NewOwnerTaggedEC2Client wraps the passed client to tag the
+// created resources with the identity returned by lookupOwner.
+// The resources are not tagged while lookupOwner returns nil
+// (eg: if the credentials were not verified).
+func NewOwnerTaggedEC2Client(
+	ec2Client EC2API,
+	lookupOwner func() *CallerIdentity,
+) EC2API {
+
+	return ownerTaggedEC2Client{
+		EC2API:      ec2Client,
+		lookupOwner: lookupOwner,
+	}
+}
+
+// withOwnerTags returns a copy of the passed tag specifications with
+// the owner tags appended (the input is not updated given that
+// it could be retried, see runInstancesWhenProfilePropagated).
+func (c ownerTaggedEC2Client) withOwnerTags(
+	tagSpecifications []types.TagSpecification,
+) []types.TagSpecification {
+
+	owner := c.lookupOwner()
+
+	if owner == nil {
+		return tagSpecifications
+	}
+
+	ownerTags := []types.Tag{
+		{
+			Key:   aws.String(OwnerAccountIDTagKey),
+			Value: aws.String(owner.AccountID),
+		},
+		{
+			Key:   aws.String(OwnerARNTagKey),
+			Value: aws.String(owner.ARN),
+		},
+	}
+
+	taggedSpecifications := make([]types.TagSpecification, len(tagSpecifications))
+
+	for i, tagSpecification := range tagSpecifications {
+		tags := make([]types.Tag, 0, len(tagSpecification.Tags)+len(ownerTags))
+		tags = append(tags, tagSpecification.Tags...)
+		tags = append(tags, ownerTags...)
+
+		tagSpecification.Tags = tags
+		taggedSpecifications[i] = tagSpecification
+	}
+
+	return taggedSpecifications
+}
+
+func (c ownerTaggedEC2Client) CreateVpc(ctx context.Context, params *ec2.CreateVpcInput, optFns ...func(*ec2.Options)) (*ec2.CreateVpcOutput, error) {
+	input := *params
+	input.TagSpecifications = c.withOwnerTags(params.TagSpecifications)
+
+	return c.EC2API.CreateVpc(ctx, &input, optFns...)
+}
+
+func (c ownerTaggedEC2Client) CreateSubnet(ctx context.Context, params *ec2.CreateSubnetInput, optFns ...func(*ec2.Options)) (*ec2.CreateSubnetOutput, error) {
+	input := *params
+	input.TagSpecifications = c.withOwnerTags(params.TagSpecifications)
+
+	return c.EC2API.CreateSubnet(ctx, &input, optFns...)
+}
+
+func (c ownerTaggedEC2Client) CreateVpcEndpoint(ctx context.Context, params *ec2.CreateVpcEndpointInput, optFns ...func(*ec2.Options)) (*ec2.CreateVpcEndpointOutput, error) {
+	input := *params
+	input.TagSpecifications = c.withOwnerTags(params.TagSpecifications)
+
+	return c.EC2API.CreateVpcEndpoint(ctx, &input, optFns...)
+}
+
+func (c ownerTaggedEC2Client) CreateInternetGateway(ctx context.Context, params *ec2.CreateInternetGatewayInput, optFns ...func(*ec2.Options)) (*ec2.CreateInternetGatewayOutput, error) {
+	input := *params
+	input.TagSpecifications = c.withOwnerTags(params.TagSpecifications)
+
+	return c.EC2API.CreateInternetGateway(ctx, &input, optFns...)
+}
+
+func (c ownerTaggedEC2Client) CreateRouteTable(ctx context.Context, params *ec2.CreateRouteTableInput, optFns ...func(*ec2.Options)) (*ec2.CreateRouteTableOutput, error) {
+	input := *params
+	input.TagSpecifications = c.withOwnerTags(params.TagSpecifications)
+
+	return c.EC2API.CreateRouteTable(ctx, &input, optFns...)
+}
+
+func (c ownerTaggedEC2Client) CreateSecurityGroup(ctx context.Context, params *ec2.CreateSecurityGroupInput, optFns ...func(*ec2.Options)) (*ec2.CreateSecurityGroupOutput, error) {
+	input := *params
+	input.TagSpecifications = c.withOwnerTags(params.TagSpecifications)
+
+	return c.EC2API.CreateSecurityGroup(ctx, &input, optFns...)
+}
+
+func (c ownerTaggedEC2Client) CreateNetworkInterface(ctx context.Context, params *ec2.CreateNetworkInterfaceInput, optFns ...func(*ec2.Options)) (*ec2.CreateNetworkInterfaceOutput, error) {
+	input := *params
+	input.TagSpecifications = c.withOwnerTags(params.TagSpecifications)
+
+	return c.EC2API.CreateNetworkInterface(ctx, &input, optFns...)
+}
+
+func (c ownerTaggedEC2Client) AllocateAddress(ctx context.Context, params *ec2.AllocateAddressInput, optFns ...func(*ec2.Options)) (*ec2.AllocateAddressOutput, error) {
+	input := *params
+	input.TagSpecifications = c.withOwnerTags(params.TagSpecifications)
+
+	return c.EC2API.AllocateAddress(ctx, &input, optFns...)
+}
+
+func (c ownerTaggedEC2Client) RunInstances(ctx context.Context, params *ec2.RunInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	input := *params
+	input.TagSpecifications = c.withOwnerTags(params.TagSpecifications)
+
+	return c.EC2API.RunInstances(ctx, &input, optFns...)
+}
+
+func (c ownerTaggedEC2Client) CreateVolume(ctx context.Context, params *ec2.CreateVolumeInput, optFns ...func(*ec2.Options)) (*ec2.CreateVolumeOutput, error) {
+	input := *params
+	input.TagSpecifications = c.withOwnerTags(params.TagSpecifications)
+
+	return c.EC2API.CreateVolume(ctx, &input, optFns...)
+}
+
+func (c ownerTaggedEC2Client) CreateSnapshot(ctx context.Context, params *ec2.CreateSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.CreateSnapshotOutput, error) {
+	input := *params
+	input.TagSpecifications = c.withOwnerTags(params.TagSpecifications)
+
+	return c.EC2API.CreateSnapshot(ctx, &input, optFns...)
+}
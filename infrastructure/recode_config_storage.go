@@ -0,0 +1,107 @@
+package infrastructure
+
+import (
+	"errors"
+)
+
+// The errors returned by all the config storages
+// (DynamoDB table, S3 bucket and local directory).
+var (
+	ErrNoRecodeConfigFound         = errors.New("ErrNoRecodeConfigFound")
+	ErrRecodeConfigVersionNotFound = errors.New("ErrRecodeConfigVersionNotFound")
+	ErrRecodeConfigVersionMismatch = errors.New("ErrRecodeConfigVersionMismatch")
+	ErrLeaseAlreadyHeld            = errors.New("ErrLeaseAlreadyHeld")
+	ErrLeaseNotHeld                = errors.New("ErrLeaseNotHeld")
+)
+
+// StoredRecodeConfig represents the config
+// split into its root, clusters and dev envs.
+type StoredRecodeConfig struct {
+	Version int64
+	// The config without its clusters
+	ConfigJSON string
+	Clusters   []StoredRecodeConfigCluster
+
+	// The data key used to encrypt the sensitive fields of the
+	// config (encrypted by the data key provider). Empty if the
+	// config is not encrypted.
+	DataKeyProviderID string
+	EncryptedDataKey  []byte
+
+	// Set when the config was found in a legacy (unsharded)
+	// DynamoDB record. ConfigJSON contains the whole config
+	// in this case and Clusters is empty.
+	LegacyRecordID string
+}
+
+// StoredRecodeConfigCluster represents
+// a cluster and its dev envs.
+type StoredRecodeConfigCluster struct {
+	// The cluster without its dev envs
+	ClusterJSON string
+	DevEnvJSONs []string
+}
+
+// StoredRecodeConfigVersion represents
+// a version kept in the history of the config.
+type StoredRecodeConfigVersion struct {
+	Version           int64
+	SavedAt           int64 // unix ms
+	WriterID          string
+	WriterDescription string
+}
+
+// RecodeConfigHistoryOpts represents the options
+// used to keep the history of the config.
+type RecodeConfigHistoryOpts struct {
+	// Size specifies the number of versions kept
+	// (including the current one). Minimum 1.
+	Size int
+
+	// WriterID and WriterDescription identify
+	// the process writing the config.
+	WriterID          string
+	WriterDescription string
+}
+
+// LeaseRecord represents a lease stored
+// alongside the config.
+//
+// In DynamoDB, lease records don't have a ConfigJSON
+// attribute so they are ignored when the config is looked up.
+type LeaseRecord struct {
+	ID               string
+	OwnerID          string
+	OwnerDescription string
+	// Unix timestamp in milliseconds
+	ExpiresAt int64
+}
+
+// appendRecodeConfigHistory appends savedVersion to the passed history
+// and returns the versions that exceed the history size (oldest first).
+func appendRecodeConfigHistory(
+	history []StoredRecodeConfigVersion,
+	savedVersion StoredRecodeConfigVersion,
+	historyOpts RecodeConfigHistoryOpts,
+) (newHistory []StoredRecodeConfigVersion, prunedVersions []StoredRecodeConfigVersion) {
+
+	historySize := historyOpts.Size
+
+	if historySize < 1 {
+		historySize = 1
+	}
+
+	newHistory = append(
+		append([]StoredRecodeConfigVersion{}, history...),
+		savedVersion,
+	)
+
+	prunedVersions = []StoredRecodeConfigVersion{}
+
+	if len(newHistory) > historySize {
+		prunedVersions = newHistory[:len(newHistory)-historySize]
+		newHistory = newHistory[len(newHistory)-historySize:]
+	}
+
+	return newHistory, prunedVersions
+}
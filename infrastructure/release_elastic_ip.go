@@ -0,0 +1,42 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// ReleaseElasticIP disassociates the Elastic IP (if associated)
+// then releases it. The association may already be gone if the
+// network interface was removed first.
+func ReleaseElasticIP(
+	ctx context.Context,
+	ec2Client EC2API,
+	elasticIP *ElasticIP,
+) error {
+
+	if len(elasticIP.AssociationID) > 0 {
+		_, err := ec2Client.DisassociateAddress(
+			ctx,
+			&ec2.DisassociateAddressInput{
+				AssociationId: aws.String(elasticIP.AssociationID),
+			},
+		)
+
+		if err != nil && !isEC2APIError(err, "InvalidAssociationID.NotFound") {
+			return err
+		}
+
+		elasticIP.AssociationID = ""
+	}
+
+	_, err := ec2Client.ReleaseAddress(
+		ctx,
+		&ec2.ReleaseAddressInput{
+			AllocationId: aws.String(elasticIP.AllocationID),
+		},
+	)
+
+	return err
+}
@@ -0,0 +1,67 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/smithy-go"
+)
+
+// RemoveDNSRecord deletes the A and AAAA records. The records
+// that don't exist anymore (eg: removed in the console) are skipped.
+func RemoveDNSRecord(
+	ctx context.Context,
+	route53Client Route53API,
+	record *DNSRecord,
+) error {
+
+	for _, address := range []struct {
+		recordType types.RRType
+		address    *string
+	}{
+		{types.RRTypeA, &record.IPAddress},
+		{types.RRTypeAaaa, &record.IPv6Address},
+	} {
+		if len(*address.address) == 0 {
+			continue
+		}
+
+		// One record at a time given that a whole
+		// batch fails if one record doesn't exist
+		_, err := route53Client.ChangeResourceRecordSets(
+			ctx,
+			&route53.ChangeResourceRecordSetsInput{
+				HostedZoneId: aws.String(record.HostedZoneID),
+				ChangeBatch: &types.ChangeBatch{
+					Changes: []types.Change{
+						record.change(
+							types.ChangeActionDelete,
+							address.recordType,
+							*address.address,
+						),
+					},
+				},
+			},
+		)
+
+		if err != nil && !isDNSRecordNotFoundError(err) {
+			return err
+		}
+
+		*address.address = ""
+	}
+
+	return nil
+}
+
+func isDNSRecordNotFoundError(err error) bool {
+	var APIErr smithy.APIError
+
+	return errors.As(err, &APIErr) &&
+		APIErr.ErrorCode() == "InvalidChangeBatch" &&
+		strings.Contains(APIErr.ErrorMessage(), "not found")
+}
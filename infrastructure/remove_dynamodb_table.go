@@ -9,10 +9,11 @@ import (
 )
 
 func RemoveDynamoDBTableForRecodeConfig(
-	dynamoDBClient *dynamodb.Client,
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
 ) error {
 
-	_, err := dynamoDBClient.DeleteTable(context.TODO(), &dynamodb.DeleteTableInput{
+	_, err := dynamoDBClient.DeleteTable(ctx, &dynamodb.DeleteTableInput{
 		TableName: aws.String(DynamoDBRecodeConfigTableName),
 	})
 
@@ -23,7 +24,7 @@ func RemoveDynamoDBTableForRecodeConfig(
 	waiter := dynamodb.NewTableNotExistsWaiter(dynamoDBClient)
 	maxWaitTime := 5 * time.Minute
 
-	return waiter.Wait(context.TODO(), &dynamodb.DescribeTableInput{
+	return waiter.Wait(ctx, &dynamodb.DescribeTableInput{
 		TableName: aws.String(DynamoDBRecodeConfigTableName),
 	}, maxWaitTime)
 }
@@ -8,11 +8,12 @@ import (
 )
 
 func TerminateInstance(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	instanceID string,
 ) error {
 
-	_, err := ec2Client.TerminateInstances(context.TODO(), &ec2.TerminateInstancesInput{
+	_, err := ec2Client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
 		InstanceIds: []string{instanceID},
 	})
 
@@ -24,7 +25,7 @@ func TerminateInstance(
 	maxWaitTime := 5 * time.Minute
 
 	return terminatedWaiter.Wait(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeInstancesInput{
 			InstanceIds: []string{
 				instanceID,
@@ -0,0 +1,63 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/smithy-go"
+)
+
+// RemoveInstanceProfile removes the instance profile and its role.
+// The entities already removed are skipped so that a partially
+// removed instance profile could be removed again.
+func RemoveInstanceProfile(
+	ctx context.Context,
+	iamClient IAMAPI,
+	instanceProfile *InstanceProfile,
+) error {
+
+	_, err := iamClient.RemoveRoleFromInstanceProfile(
+		ctx,
+		&iam.RemoveRoleFromInstanceProfileInput{
+			InstanceProfileName: &instanceProfile.Name,
+			RoleName:            &instanceProfile.RoleName,
+		},
+	)
+
+	if err != nil && !isIAMNoSuchEntityError(err) {
+		return err
+	}
+
+	_, err = iamClient.DeleteInstanceProfile(ctx, &iam.DeleteInstanceProfileInput{
+		InstanceProfileName: &instanceProfile.Name,
+	})
+
+	if err != nil && !isIAMNoSuchEntityError(err) {
+		return err
+	}
+
+	_, err = iamClient.DetachRolePolicy(ctx, &iam.DetachRolePolicyInput{
+		RoleName:  &instanceProfile.RoleName,
+		PolicyArn: &instanceProfile.PolicyARN,
+	})
+
+	if err != nil && !isIAMNoSuchEntityError(err) {
+		return err
+	}
+
+	_, err = iamClient.DeleteRole(ctx, &iam.DeleteRoleInput{
+		RoleName: &instanceProfile.RoleName,
+	})
+
+	if err != nil && !isIAMNoSuchEntityError(err) {
+		return err
+	}
+
+	return nil
+}
+
+func isIAMNoSuchEntityError(err error) bool {
+	var APIErr smithy.APIError
+	return errors.As(err, &APIErr) && APIErr.ErrorCode() == "NoSuchEntity"
+}
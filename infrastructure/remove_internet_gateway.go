@@ -7,12 +7,13 @@ import (
 )
 
 func RemoveInternetGateway(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	internetGatewayId string,
 ) error {
 
 	_, err := ec2Client.DeleteInternetGateway(
-		context.TODO(),
+		ctx,
 		&ec2.DeleteInternetGatewayInput{
 			InternetGatewayId: &internetGatewayId,
 		},
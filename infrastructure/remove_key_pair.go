@@ -7,12 +7,13 @@ import (
 )
 
 func RemoveKeyPair(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	keyPairID string,
 ) error {
 
 	_, err := ec2Client.DeleteKeyPair(
-		context.TODO(),
+		ctx,
 		&ec2.DeleteKeyPairInput{
 			KeyPairId: &keyPairID,
 		},
@@ -7,12 +7,13 @@ import (
 )
 
 func RemoveNetworkInterface(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	networkInterfaceID string,
 ) error {
 
 	_, err := ec2Client.DeleteNetworkInterface(
-		context.TODO(),
+		ctx,
 		&ec2.DeleteNetworkInterfaceInput{
 			NetworkInterfaceId: &networkInterfaceID,
 		},
@@ -7,12 +7,13 @@ import (
 )
 
 func RemoveRouteTable(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	routeTableID string,
 ) error {
 
 	_, err := ec2Client.DeleteRouteTable(
-		context.TODO(),
+		ctx,
 		&ec2.DeleteRouteTableInput{
 			RouteTableId: &routeTableID,
 		},
@@ -7,12 +7,13 @@ import (
 )
 
 func RemoveSecurityGroup(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	securityGroupID string,
 ) error {
 
 	_, err := ec2Client.DeleteSecurityGroup(
-		context.TODO(),
+		ctx,
 		&ec2.DeleteSecurityGroupInput{
 			GroupId: &securityGroupID,
 		},
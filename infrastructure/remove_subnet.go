@@ -7,12 +7,13 @@ import (
 )
 
 func RemoveSubnet(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	subnetID string,
 ) error {
 
 	_, err := ec2Client.DeleteSubnet(
-		context.TODO(),
+		ctx,
 		&ec2.DeleteSubnetInput{
 			SubnetId: &subnetID,
 		},
@@ -7,12 +7,13 @@ import (
 )
 
 func RemoveVPC(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	VPCID string,
 ) error {
 
 	_, err := ec2Client.DeleteVpc(
-		context.TODO(),
+		ctx,
 		&ec2.DeleteVpcInput{
 			VpcId: &VPCID,
 		},
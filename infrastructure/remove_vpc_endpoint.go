@@ -0,0 +1,57 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var ErrVPCEndpointNotFound = errors.New("ErrVPCEndpointNotFound")
+
+// RemoveVPCEndpoint removes the VPC endpoint and waits for its
+// removal given that its network interfaces (or its routes for
+// the gateway endpoints) prevent the removal of the subnets, of
+// the security groups and of the route tables.
+func RemoveVPCEndpoint(
+	ctx context.Context,
+	ec2Client EC2API,
+	VPCEndpointID string,
+) error {
+
+	deleteVPCEndpointsResp, err := ec2Client.DeleteVpcEndpoints(
+		ctx,
+		&ec2.DeleteVpcEndpointsInput{
+			VpcEndpointIds: []string{VPCEndpointID},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Errors are returned per endpoint
+	for _, unsuccessfulItem := range deleteVPCEndpointsResp.Unsuccessful {
+		if unsuccessfulItem.Error != nil &&
+			aws.ToString(unsuccessfulItem.Error.Code) != "InvalidVpcEndpointId.NotFound" {
+
+			return fmt.Errorf(
+				"%s: %s",
+				aws.ToString(unsuccessfulItem.Error.Code),
+				aws.ToString(unsuccessfulItem.Error.Message),
+			)
+		}
+	}
+
+	return waitForVPCEndpointState(
+		ctx,
+		ec2Client,
+		VPCEndpointID,
+		types.StateDeleted,
+		5*time.Minute,
+	)
+}
@@ -0,0 +1,263 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// S3RecodeConfigKeyPrefix represents the prefix of the keys of the
+// objects used to store the config so that the bucket could be shared.
+const S3RecodeConfigKeyPrefix = "recode/"
+
+// NewS3RecodeConfigStorage constructs an ObjectRecodeConfigStorage
+// that stores the config in the passed S3 bucket.
+//
+// Concurrent updates are detected with conditional writes
+// ("If-Match" and "If-None-Match"). The leases are released with
+// conditional deletes ("If-Match" on DeleteObject). S3-compatible
+// stores that ignore this condition may remove a lease reclaimed
+// by someone else if it expired while it was released.
+func NewS3RecodeConfigStorage(
+	s3Client S3API,
+	bucket string,
+	region string,
+) ObjectRecodeConfigStorage {
+
+	return ObjectRecodeConfigStorage{
+		objectStore: s3RecodeConfigObjectStore{
+			s3Client: s3Client,
+			bucket:   bucket,
+			region:   region,
+		},
+	}
+}
+
+type s3RecodeConfigObjectStore struct {
+	s3Client S3API
+	bucket   string
+	region   string
+}
+
+// create creates the bucket if it doesn't exist. An existing
+// bucket is reused (eg: created by an administrator).
+func (s s3RecodeConfigObjectStore) create(ctx context.Context) error {
+	_, err := s.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	})
+
+	if err == nil {
+		return nil
+	}
+
+	var notFoundErr *types.NotFound
+
+	if !errors.As(err, &notFoundErr) {
+		return err
+	}
+
+	createBucketInput := &s3.CreateBucketInput{
+		Bucket: aws.String(s.bucket),
+	}
+
+	// Buckets are created in "us-east-1" if
+	// no location constraint is passed
+	if s.region != "us-east-1" {
+		createBucketInput.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(s.region),
+		}
+	}
+
+	_, err = s.s3Client.CreateBucket(ctx, createBucketInput)
+
+	if err != nil {
+		var bucketAlreadyOwnedErr *types.BucketAlreadyOwnedByYou
+
+		if !errors.As(err, &bucketAlreadyOwnedErr) {
+			return err
+		}
+	}
+
+	existsWaiter := s3.NewBucketExistsWaiter(s.s3Client)
+	maxWaitTime := 5 * time.Minute
+
+	return existsWaiter.Wait(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	}, maxWaitTime)
+}
+
+// remove removes the objects used to store the config.
+// The bucket is kept given that it could be shared.
+func (s s3RecodeConfigObjectStore) remove(ctx context.Context) error {
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(S3RecodeConfigKeyPrefix),
+	})
+
+	for paginator.HasMorePages() {
+		listObjectsResp, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			var noSuchBucketErr *types.NoSuchBucket
+
+			if errors.As(err, &noSuchBucketErr) {
+				return nil
+			}
+
+			return err
+		}
+
+		for _, object := range listObjectsResp.Contents {
+			_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    object.Key,
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s s3RecodeConfigObjectStore) listObjectKeys(
+	ctx context.Context,
+	keyPrefix string,
+) ([]string, error) {
+
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(S3RecodeConfigKeyPrefix + keyPrefix),
+	})
+
+	keys := []string{}
+
+	for paginator.HasMorePages() {
+		listObjectsResp, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			var noSuchBucketErr *types.NoSuchBucket
+
+			if errors.As(err, &noSuchBucketErr) {
+				return keys, nil
+			}
+
+			return nil, err
+		}
+
+		for _, object := range listObjectsResp.Contents {
+			keys = append(keys, strings.TrimPrefix(aws.ToString(object.Key), S3RecodeConfigKeyPrefix))
+		}
+	}
+
+	return keys, nil
+}
+
+func (s s3RecodeConfigObjectStore) getObject(
+	ctx context.Context,
+	key string,
+) ([]byte, string, error) {
+
+	getObjectResp, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(S3RecodeConfigKeyPrefix + key),
+	})
+
+	if err != nil {
+		var noSuchKeyErr *types.NoSuchKey
+		var noSuchBucketErr *types.NoSuchBucket
+
+		if errors.As(err, &noSuchKeyErr) || errors.As(err, &noSuchBucketErr) {
+			return nil, "", errRecodeConfigObjectNotFound
+		}
+
+		return nil, "", err
+	}
+
+	defer getObjectResp.Body.Close()
+
+	content, err := io.ReadAll(getObjectResp.Body)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return content, aws.ToString(getObjectResp.ETag), nil
+}
+
+func (s s3RecodeConfigObjectStore) putObject(
+	ctx context.Context,
+	key string,
+	content []byte,
+	condition recodeConfigObjectCondition,
+) error {
+
+	putObjectInput := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(S3RecodeConfigKeyPrefix + key),
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String("application/json"),
+	}
+
+	if len(condition.IfMatch) > 0 {
+		putObjectInput.IfMatch = aws.String(condition.IfMatch)
+	} else if condition.IfNotExists {
+		putObjectInput.IfNoneMatch = aws.String("*")
+	}
+
+	_, err := s.s3Client.PutObject(ctx, putObjectInput)
+
+	return s3ConditionalWriteError(err)
+}
+
+func (s s3RecodeConfigObjectStore) deleteObject(
+	ctx context.Context,
+	key string,
+	condition recodeConfigObjectCondition,
+) error {
+
+	deleteObjectInput := &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(S3RecodeConfigKeyPrefix + key),
+	}
+
+	// "If-None-Match" is not supported by DeleteObject
+	if len(condition.IfMatch) > 0 {
+		deleteObjectInput.IfMatch = aws.String(condition.IfMatch)
+	}
+
+	_, err := s.s3Client.DeleteObject(ctx, deleteObjectInput)
+
+	return s3ConditionalWriteError(err)
+}
+
+func s3ConditionalWriteError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var APIErr smithy.APIError
+
+	// "ConditionalRequestConflict" is returned when a concurrent
+	// write to the same object is in progress and "NoSuchKey" when
+	// the object passed with "If-Match" doesn't exist anymore
+	if errors.As(err, &APIErr) &&
+		(APIErr.ErrorCode() == "PreconditionFailed" ||
+			APIErr.ErrorCode() == "ConditionalRequestConflict" ||
+			APIErr.ErrorCode() == "NoSuchKey") {
+
+		return errRecodeConfigObjectConditionFailed
+	}
+
+	return err
+}
@@ -0,0 +1,105 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// SecurityGroupIngressRule represents a rule that accepts the
+// traffic sent to a port from an IPv4 or IPv6 CIDR block.
+type SecurityGroupIngressRule struct {
+	Protocol  string `json:"protocol"`
+	Port      int32  `json:"port"`
+	CIDRBlock string `json:"cidr_block"`
+}
+
+// AuthorizeSecurityGroupIngressRules authorizes the passed rules
+// in the security group. The rules that already exist are skipped.
+func AuthorizeSecurityGroupIngressRules(
+	ctx context.Context,
+	ec2Client EC2API,
+	securityGroupID string,
+	ingressRules []SecurityGroupIngressRule,
+) error {
+
+	// One rule at a time given that a whole
+	// request fails if one rule already exists
+	for _, ingressRule := range ingressRules {
+		_, err := ec2Client.AuthorizeSecurityGroupIngress(
+			ctx,
+			&ec2.AuthorizeSecurityGroupIngressInput{
+				GroupId:       aws.String(securityGroupID),
+				IpPermissions: []types.IpPermission{ingressRule.ipPermission()},
+			},
+		)
+
+		if err != nil && !isEC2APIError(err, "InvalidPermission.Duplicate") {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RevokeSecurityGroupIngressRules revokes the passed rules from the
+// security group. The rules that don't exist anymore are skipped.
+func RevokeSecurityGroupIngressRules(
+	ctx context.Context,
+	ec2Client EC2API,
+	securityGroupID string,
+	ingressRules []SecurityGroupIngressRule,
+) error {
+
+	for _, ingressRule := range ingressRules {
+		_, err := ec2Client.RevokeSecurityGroupIngress(
+			ctx,
+			&ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       aws.String(securityGroupID),
+				IpPermissions: []types.IpPermission{ingressRule.ipPermission()},
+			},
+		)
+
+		if err != nil && !isEC2APIError(err, "InvalidPermission.NotFound") {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ipPermission converts the rule to the format expected by
+// the EC2 API (the CIDR blocks are assumed to be valid).
+func (s SecurityGroupIngressRule) ipPermission() types.IpPermission {
+	IPPermission := types.IpPermission{
+		IpProtocol: aws.String(s.Protocol),
+		FromPort:   aws.Int32(s.Port),
+		ToPort:     aws.Int32(s.Port),
+	}
+
+	ip, _, err := net.ParseCIDR(s.CIDRBlock)
+
+	if err == nil && ip.To4() == nil {
+		IPPermission.Ipv6Ranges = []types.Ipv6Range{{
+			CidrIpv6: aws.String(s.CIDRBlock),
+		}}
+
+		return IPPermission
+	}
+
+	IPPermission.IpRanges = []types.IpRange{{
+		CidrIp: aws.String(s.CIDRBlock),
+	}}
+
+	return IPPermission
+}
+
+func isEC2APIError(err error, code string) bool {
+	var APIErr smithy.APIError
+	return errors.As(err, &APIErr) && APIErr.ErrorCode() == code
+}
@@ -0,0 +1,104 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	ErrSpotCapacityUnavailable = errors.New("ErrSpotCapacityUnavailable")
+	ErrSpotInstanceInterrupted = errors.New("ErrSpotInstanceInterrupted")
+)
+
+// The error codes returned by RunInstances and StartInstances
+// when a spot instance could not be launched (or restarted).
+var spotCapacityErrorCodes = map[string]bool{
+	"InsufficientInstanceCapacity": true,
+	"MaxSpotInstanceCountExceeded": true,
+	"SpotMaxPriceTooLow":           true,
+}
+
+// The state reasons of the spot instances
+// stopped or terminated by an interruption.
+var spotInterruptionStateReasonCodes = map[string]bool{
+	"Server.SpotInstanceShutdown":    true,
+	"Server.SpotInstanceTermination": true,
+}
+
+// InstanceSpotOpts represents the options of the spot
+// instances (see CreateInstance). The instances are launched
+// with a persistent request and are stopped on interruption
+// so that their root volume is kept.
+type InstanceSpotOpts struct {
+	// MaxPrice is the maximum hourly price in USD
+	// (eg: "0.05"). Default to the on-demand price.
+	MaxPrice string
+}
+
+// CancelSpotInstanceRequest cancels the persistent spot request of
+// an instance. It must be called before terminating the instance
+// given that the request would launch a new one otherwise.
+func CancelSpotInstanceRequest(
+	ctx context.Context,
+	ec2Client EC2API,
+	spotInstanceRequestID string,
+) error {
+
+	_, err := ec2Client.CancelSpotInstanceRequests(
+		ctx,
+		&ec2.CancelSpotInstanceRequestsInput{
+			SpotInstanceRequestIds: []string{spotInstanceRequestID},
+		},
+	)
+
+	var APIErr smithy.APIError
+
+	if errors.As(err, &APIErr) &&
+		APIErr.ErrorCode() == "InvalidSpotInstanceRequestID.NotFound" {
+
+		return nil
+	}
+
+	return err
+}
+
+// spotCapacityError returns ErrSpotCapacityUnavailable
+// if the passed error was returned because there is no
+// spot capacity (or if the max price is too low).
+func spotCapacityError(err error) error {
+	var APIErr smithy.APIError
+
+	if errors.As(err, &APIErr) && spotCapacityErrorCodes[APIErr.ErrorCode()] {
+		return ErrSpotCapacityUnavailable
+	}
+
+	return err
+}
+
+// spotInterruptionError returns ErrSpotInstanceInterrupted if
+// the passed error was returned while waiting for an instance
+// that was interrupted (the waiters fail once the instance is
+// stopping or terminated).
+func spotInterruptionError(
+	ctx context.Context,
+	ec2Client EC2API,
+	instanceID string,
+	err error,
+) error {
+
+	instance, lookupErr := lookupInstance(ctx, ec2Client, instanceID)
+
+	if lookupErr != nil || instance.StateReason == nil {
+		return err
+	}
+
+	if spotInterruptionStateReasonCodes[aws.ToString(instance.StateReason.Code)] {
+		return ErrSpotInstanceInterrupted
+	}
+
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
@@ -13,16 +14,27 @@ type StartInstanceResp struct {
 	Instance types.Instance
 }
 
+// StartInstance starts the instance and waits for it to be running.
+// ErrSpotCapacityUnavailable is returned for the spot instances that
+// could not be started and ErrSpotInstanceInterrupted for the ones
+// interrupted while starting.
 func StartInstance(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	instance *Instance,
 ) error {
 
-	_, err := ec2Client.StartInstances(context.TODO(), &ec2.StartInstancesInput{
+	isSpot := len(instance.SpotInstanceRequestID) > 0
+
+	_, err := ec2Client.StartInstances(ctx, &ec2.StartInstancesInput{
 		InstanceIds: []string{instance.ID},
 	})
 
 	if err != nil {
+		if isSpot {
+			return spotCapacityError(err)
+		}
+
 		return err
 	}
 
@@ -30,7 +42,7 @@ func StartInstance(
 	maxWaitTime := 5 * time.Minute
 
 	err = runningWaiter.Wait(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeInstancesInput{
 			InstanceIds: []string{
 				instance.ID,
@@ -40,17 +52,23 @@ func StartInstance(
 	)
 
 	if err != nil {
+		if isSpot {
+			return spotInterruptionError(ctx, ec2Client, instance.ID, err)
+		}
+
 		return err
 	}
 
-	startedInstance, err := lookupInstance(ec2Client, instance.ID)
+	startedInstance, err := lookupInstance(ctx, ec2Client, instance.ID)
 
 	if err != nil {
 		return err
 	}
 
-	instance.PublicIPAddress = *startedInstance.PublicIpAddress
-	instance.PublicHostname = *startedInstance.PublicDnsName
+	// No public IP in subnets routed to a NAT gateway
+	instance.PublicIPAddress = aws.ToString(startedInstance.PublicIpAddress)
+	instance.PublicHostname = aws.ToString(startedInstance.PublicDnsName)
+	instance.IPv6Address = instanceIPv6Address(startedInstance)
 
 	return nil
 }
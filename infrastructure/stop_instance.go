@@ -8,11 +8,12 @@ import (
 )
 
 func StopInstance(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	instance *Instance,
 ) error {
 
-	_, err := ec2Client.StopInstances(context.TODO(), &ec2.StopInstancesInput{
+	_, err := ec2Client.StopInstances(ctx, &ec2.StopInstancesInput{
 		InstanceIds: []string{instance.ID},
 	})
 
@@ -24,7 +25,7 @@ func StopInstance(
 	maxWaitTime := 5 * time.Minute
 
 	return stoppedWaiter.Wait(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeInstancesInput{
 			InstanceIds: []string{
 				instance.ID,
@@ -2,33 +2,417 @@ package infrastructure
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// UpdateRecodeConfigInDynamoDBTable writes the config only if the version
+// stored in the table equals expectedVersion (0 means that the config
+// was never written or is still stored in a legacy record).
+//
+// The config is written as one root record plus one record per cluster
+// and per dev env. The shards are written before the root record so that
+// readers never see a root record referencing missing shards.
+//
+// A snapshot of the root record is written alongside it so that the
+// previous versions could be restored. The shards are removed once all
+// the versions referencing them have left the history.
+//
+// The root record has its version set to expectedVersion + 1
+// (config.Version and config.LegacyRecordID are ignored).
 func UpdateRecodeConfigInDynamoDBTable(
-	dynamoDBClient *dynamodb.Client,
-	configID string,
-	configJSON string,
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	config *StoredRecodeConfig,
+	expectedVersion int64,
+	historyOpts RecodeConfigHistoryOpts,
 ) error {
 
-	configRecord := DynamoDBRecodeConfigTableRecord{
-		ID:         configID,
-		ConfigJSON: configJSON,
+	var previousRootRecord *DynamoDBRecodeConfigTableRecord
+	err := getRecodeConfigRecord(
+		ctx,
+		dynamoDBClient,
+		DynamoDBRecodeConfigRootRecordID,
+		&previousRootRecord,
+	)
+
+	if err != nil && !errors.Is(err, errRecodeConfigRecordNotFound) {
+		return err
+	}
+
+	previousClusterShardIDs := []string{}
+	previousHistory := []StoredRecodeConfigVersion{}
+
+	if previousRootRecord != nil {
+		previousClusterShardIDs = previousRootRecord.ClusterShardIDs
+		previousHistory = recodeConfigHistory(previousRootRecord)
+	}
+
+	// Fail early. The conditional write of the
+	// root record remains the source of truth.
+	if (previousRootRecord == nil && expectedVersion != 0) ||
+		(previousRootRecord != nil && previousRootRecord.Version != expectedVersion) {
+
+		return ErrRecodeConfigVersionMismatch
+	}
+
+	newVersion := expectedVersion + 1
+	referencedShardIDs := map[string]bool{}
+	clusterShardIDs := []string{}
+
+	for _, cluster := range config.Clusters {
+		devEnvShards := []DynamoDBRecodeConfigShardRecord{}
+		devEnvShardIDs := []string{}
+
+		for _, devEnvJSON := range cluster.DevEnvJSONs {
+			devEnvShard := DynamoDBRecodeConfigShardRecord{
+				ID:            recodeConfigShardID("dev-env", devEnvJSON),
+				DevEnvJSON:    devEnvJSON,
+				ConfigVersion: newVersion,
+			}
+
+			devEnvShards = append(devEnvShards, devEnvShard)
+			devEnvShardIDs = append(devEnvShardIDs, devEnvShard.ID)
+		}
+
+		clusterShard := DynamoDBRecodeConfigShardRecord{
+			ID: recodeConfigShardID(
+				"cluster",
+				cluster.ClusterJSON+"\n"+strings.Join(devEnvShardIDs, "\n"),
+			),
+			ClusterJSON:    cluster.ClusterJSON,
+			DevEnvShardIDs: devEnvShardIDs,
+			ConfigVersion:  newVersion,
+		}
+
+		clusterShardIDs = append(clusterShardIDs, clusterShard.ID)
+
+		// Shards are content-addressed so an unchanged cluster
+		// (and therefore its dev envs) doesn't need to be written again
+		clusterUnchanged := containsRecodeConfigShardID(
+			previousClusterShardIDs,
+			clusterShard.ID,
+		)
+
+		for _, shard := range append(devEnvShards, clusterShard) {
+			if !clusterUnchanged && !referencedShardIDs[shard.ID] {
+				err := putRecodeConfigShard(ctx, dynamoDBClient, shard)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			referencedShardIDs[shard.ID] = true
+		}
+	}
+
+	unreferencedShardIDs, err := lookupUnreferencedRecodeConfigShards(
+		ctx,
+		dynamoDBClient,
+		previousClusterShardIDs,
+		referencedShardIDs,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	savedVersion := StoredRecodeConfigVersion{
+		Version:           newVersion,
+		SavedAt:           time.Now().UnixMilli(),
+		WriterID:          historyOpts.WriterID,
+		WriterDescription: historyOpts.WriterDescription,
+	}
+
+	history, prunedVersions := appendRecodeConfigHistory(
+		previousHistory,
+		savedVersion,
+		historyOpts,
+	)
+
+	rootRecord := DynamoDBRecodeConfigTableRecord{
+		ID:                DynamoDBRecodeConfigRootRecordID,
+		ConfigJSON:        config.ConfigJSON,
+		Version:           newVersion,
+		ClusterShardIDs:   clusterShardIDs,
+		DataKeyProviderID: config.DataKeyProviderID,
+		EncryptedDataKey:  config.EncryptedDataKey,
+		SavedAt:           savedVersion.SavedAt,
+		WriterID:          savedVersion.WriterID,
+		WriterDescription: savedVersion.WriterDescription,
+		History:           history,
+	}
+
+	snapshotRecord := rootRecord
+	snapshotRecord.ID = recodeConfigVersionRecordID(newVersion)
+	snapshotRecord.History = nil
+	snapshotRecord.UnreferencedShardIDs = unreferencedShardIDs
+
+	marshaledRootRecord, err := attributevalue.MarshalMap(rootRecord)
+
+	if err != nil {
+		return err
+	}
+
+	marshaledSnapshotRecord, err := attributevalue.MarshalMap(snapshotRecord)
+
+	if err != nil {
+		return err
+	}
+
+	rootRecordPut := &types.Put{
+		TableName: aws.String(DynamoDBRecodeConfigTableName),
+		Item:      marshaledRootRecord,
+		ExpressionAttributeNames: map[string]string{
+			"#version": "Version",
+		},
+	}
+
+	if expectedVersion == 0 {
+		rootRecordPut.ConditionExpression = aws.String("attribute_not_exists(#version)")
+	} else {
+		rootRecordPut.ConditionExpression = aws.String("#version = :expectedVersion")
+		rootRecordPut.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":expectedVersion": &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(expectedVersion, 10),
+			},
+		}
+	}
+
+	// The root record and its snapshot are written atomically
+	_, err = dynamoDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: rootRecordPut,
+			},
+
+			{
+				Put: &types.Put{
+					TableName:           aws.String(DynamoDBRecodeConfigTableName),
+					Item:                marshaledSnapshotRecord,
+					ConditionExpression: aws.String("attribute_not_exists(#id)"),
+					ExpressionAttributeNames: map[string]string{
+						"#id": "ID",
+					},
+				},
+			},
+		},
+	})
+
+	if err != nil {
+		var transactionCanceledErr *types.TransactionCanceledException
+
+		// The shards written above may be orphaned
+		// in this case. They are small and harmless.
+		if errors.As(err, &transactionCanceledErr) &&
+			conditionalCheckFailedInTransaction(transactionCanceledErr) {
+
+			return ErrRecodeConfigVersionMismatch
+		}
+
+		return err
+	}
+
+	// The config was written. Pruning the history
+	// is best effort: leftovers are harmless.
+	for _, prunedVersion := range prunedVersions {
+		var nextUnreferencedShardIDs []string
+
+		if prunedVersion.Version+1 == newVersion {
+			nextUnreferencedShardIDs = unreferencedShardIDs
+		} else {
+			var nextSnapshotRecord *DynamoDBRecodeConfigTableRecord
+			err := getRecodeConfigRecord(
+				ctx,
+				dynamoDBClient,
+				recodeConfigVersionRecordID(prunedVersion.Version+1),
+				&nextSnapshotRecord,
+			)
+
+			if err != nil {
+				continue
+			}
+
+			nextUnreferencedShardIDs = nextSnapshotRecord.UnreferencedShardIDs
+		}
+
+		_ = pruneRecodeConfigVersion(
+			ctx,
+			dynamoDBClient,
+			prunedVersion.Version,
+			nextUnreferencedShardIDs,
+		)
 	}
 
-	marshaledConfigRecord, err := attributevalue.MarshalMap(configRecord)
+	return nil
+}
+
+// RemoveLegacyRecodeConfigFromDynamoDBTable removes the record that was
+// used to store the whole config before it was sharded.
+func RemoveLegacyRecodeConfigFromDynamoDBTable(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	legacyRecordID string,
+) error {
+
+	_, err := dynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(DynamoDBRecodeConfigTableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: legacyRecordID},
+		},
+	})
+
+	return err
+}
+
+// putRecodeConfigShard writes the passed shard. Overwriting an existing
+// (identical) shard updates its ConfigVersion, which prevents
+// a concurrent pruning from removing it (see pruneRecodeConfigVersion).
+func putRecodeConfigShard(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	shard DynamoDBRecodeConfigShardRecord,
+) error {
+
+	marshaledShard, err := attributevalue.MarshalMap(shard)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = dynamoDBClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
+	_, err = dynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(DynamoDBRecodeConfigTableName),
+		Item:      marshaledShard,
+	})
+
+	return err
+}
+
+// lookupUnreferencedRecodeConfigShards returns the shards referenced by
+// the previous root record that are not referenced by the new one.
+func lookupUnreferencedRecodeConfigShards(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	previousClusterShardIDs []string,
+	referencedShardIDs map[string]bool,
+) ([]string, error) {
+
+	unreferencedShardIDs := []string{}
+
+	for _, clusterShardID := range previousClusterShardIDs {
+		if referencedShardIDs[clusterShardID] {
+			continue
+		}
+
+		var clusterShard *DynamoDBRecodeConfigShardRecord
+		err := getRecodeConfigRecord(ctx, dynamoDBClient, clusterShardID, &clusterShard)
+
+		if err != nil && !errors.Is(err, errRecodeConfigRecordNotFound) {
+			return nil, err
+		}
+
+		if clusterShard != nil {
+			for _, devEnvShardID := range clusterShard.DevEnvShardIDs {
+				if !referencedShardIDs[devEnvShardID] {
+					unreferencedShardIDs = append(unreferencedShardIDs, devEnvShardID)
+				}
+			}
+		}
+
+		unreferencedShardIDs = append(unreferencedShardIDs, clusterShardID)
+	}
+
+	return unreferencedShardIDs, nil
+}
+
+// pruneRecodeConfigVersion removes the snapshot of the passed version
+// and the shards that were only referenced by this version and the
+// ones before it (ie: the shards unreferenced by the next version).
+//
+// Shards rewritten since the pruned version (ie: referenced
+// again by a newer version) are kept.
+func pruneRecodeConfigVersion(
+	ctx context.Context,
+	dynamoDBClient DynamoDBAPI,
+	prunedVersion int64,
+	nextUnreferencedShardIDs []string,
+) error {
+
+	for _, shardID := range nextUnreferencedShardIDs {
+		_, err := dynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(DynamoDBRecodeConfigTableName),
+			Key: map[string]types.AttributeValue{
+				"ID": &types.AttributeValueMemberS{Value: shardID},
+			},
+			ConditionExpression: aws.String("#configVersion <= :prunedVersion"),
+			ExpressionAttributeNames: map[string]string{
+				"#configVersion": "ConfigVersion",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":prunedVersion": &types.AttributeValueMemberN{
+					Value: strconv.FormatInt(prunedVersion, 10),
+				},
+			},
+		})
+
+		if err != nil {
+			var conditionalCheckFailedErr *types.ConditionalCheckFailedException
+
+			if errors.As(err, &conditionalCheckFailedErr) {
+				continue
+			}
+
+			return err
+		}
+	}
+
+	_, err := dynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
 		TableName: aws.String(DynamoDBRecodeConfigTableName),
-		Item:      marshaledConfigRecord,
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{
+				Value: recodeConfigVersionRecordID(prunedVersion),
+			},
+		},
 	})
 
 	return err
 }
+
+func conditionalCheckFailedInTransaction(
+	transactionCanceledErr *types.TransactionCanceledException,
+) bool {
+
+	for _, reason := range transactionCanceledErr.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func recodeConfigShardID(shardKind, shardContent string) string {
+	hash := sha256.Sum256([]byte(shardKind + "\n" + shardContent))
+
+	return "config#" + shardKind + "#" + hex.EncodeToString(hash[:])
+}
+
+func containsRecodeConfigShardID(shardIDs []string, shardID string) bool {
+	for _, s := range shardIDs {
+		if s == shardID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,108 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// DNSRecord represents the A and AAAA records that point
+// a name of a Route 53 hosted zone to an instance. The
+// addresses are empty when the matching record doesn't exist.
+type DNSRecord struct {
+	HostedZoneID string `json:"hosted_zone_id"`
+	Name         string `json:"name"`
+	TTL          int64  `json:"ttl"`
+
+	IPAddress   string `json:"ip_address"`
+	IPv6Address string `json:"ipv6_address"`
+
+	// The ID of the last change submitted to Route 53
+	ChangeID string `json:"change_id"`
+}
+
+// UpsertDNSRecord points the record to the passed addresses. The A
+// (or AAAA) record is deleted if its address is empty. The record is
+// updated once the change is accepted by Route 53.
+func UpsertDNSRecord(
+	ctx context.Context,
+	route53Client Route53API,
+	record *DNSRecord,
+	IPAddress string,
+	IPv6Address string,
+) error {
+
+	changes := []types.Change{}
+
+	for _, address := range []struct {
+		recordType      types.RRType
+		currentAddress  string
+		upsertedAddress string
+	}{
+		{types.RRTypeA, record.IPAddress, IPAddress},
+		{types.RRTypeAaaa, record.IPv6Address, IPv6Address},
+	} {
+		if len(address.upsertedAddress) > 0 {
+			changes = append(changes, record.change(
+				types.ChangeActionUpsert,
+				address.recordType,
+				address.upsertedAddress,
+			))
+
+			continue
+		}
+
+		if len(address.currentAddress) > 0 {
+			changes = append(changes, record.change(
+				types.ChangeActionDelete,
+				address.recordType,
+				address.currentAddress,
+			))
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	changeResourceRecordSetsResp, err := route53Client.ChangeResourceRecordSets(
+		ctx,
+		&route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(record.HostedZoneID),
+			ChangeBatch: &types.ChangeBatch{
+				Changes: changes,
+			},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	record.IPAddress = IPAddress
+	record.IPv6Address = IPv6Address
+	record.ChangeID = aws.ToString(changeResourceRecordSetsResp.ChangeInfo.Id)
+
+	return nil
+}
+
+func (d DNSRecord) change(
+	action types.ChangeAction,
+	recordType types.RRType,
+	address string,
+) types.Change {
+
+	return types.Change{
+		Action: action,
+		ResourceRecordSet: &types.ResourceRecordSet{
+			Name: aws.String(d.Name),
+			Type: recordType,
+			TTL:  aws.Int64(d.TTL),
+			ResourceRecords: []types.ResourceRecord{{
+				Value: aws.String(address),
+			}},
+		},
+	}
+}
@@ -15,14 +15,15 @@ type CreateVolumeFromSnapshotResp struct {
 }
 
 func CreateVolumeFromSnapshot(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	name string,
 	availabilityZone string,
 	snapshotID string,
 ) (resp CreateVolumeFromSnapshotResp) {
 
 	createVolumeResp, err := ec2Client.CreateVolume(
-		context.TODO(),
+		ctx,
 		&ec2.CreateVolumeInput{
 			AvailabilityZone: &availabilityZone,
 			SnapshotId:       &snapshotID,
@@ -45,7 +46,7 @@ func CreateVolumeFromSnapshot(
 	availableWaiter := ec2.NewVolumeAvailableWaiter(ec2Client)
 	maxWaitTime := 5 * time.Minute
 
-	err = availableWaiter.Wait(context.TODO(), &ec2.DescribeVolumesInput{
+	err = availableWaiter.Wait(ctx, &ec2.DescribeVolumesInput{
 		VolumeIds: []string{
 			*createVolumeResp.VolumeId,
 		},
@@ -65,12 +66,13 @@ type RemoveVolumeResp struct {
 }
 
 func RemoveVolume(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	volumeID string,
 ) (resp RemoveVolumeResp) {
 
 	_, err := ec2Client.DeleteVolume(
-		context.TODO(),
+		ctx,
 		&ec2.DeleteVolumeInput{
 			VolumeId: &volumeID,
 		},
@@ -85,7 +87,7 @@ func RemoveVolume(
 	maxWaitTime := 5 * time.Minute
 
 	resp.Err = deletedWaiter.Wait(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeVolumesInput{
 			VolumeIds: []string{
 				volumeID,
@@ -102,14 +104,15 @@ type DetachVolumeResp struct {
 }
 
 func DetachVolume(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	instanceID string,
 	volumeID string,
 	deviceName string,
 ) (resp DetachVolumeResp) {
 
 	_, err := ec2Client.DetachVolume(
-		context.TODO(),
+		ctx,
 		&ec2.DetachVolumeInput{
 			InstanceId: &instanceID,
 			VolumeId:   &volumeID,
@@ -126,7 +129,7 @@ func DetachVolume(
 	maxWaitTime := 5 * time.Minute
 
 	resp.Err = availableWaiter.Wait(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeVolumesInput{
 			VolumeIds: []string{
 				volumeID,
@@ -143,14 +146,15 @@ type AttachVolumeResp struct {
 }
 
 func AttachVolume(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	instanceID string,
 	volumeID string,
 	deviceName string,
 ) (resp AttachVolumeResp) {
 
 	_, err := ec2Client.AttachVolume(
-		context.TODO(),
+		ctx,
 		&ec2.AttachVolumeInput{
 			InstanceId: &instanceID,
 			VolumeId:   &volumeID,
@@ -167,7 +171,7 @@ func AttachVolume(
 	maxWaitTime := 5 * time.Minute
 
 	resp.Err = inUseWaiter.Wait(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeVolumesInput{
 			VolumeIds: []string{
 				volumeID,
@@ -185,13 +189,14 @@ type CreateSnapshotForVolumeResp struct {
 }
 
 func CreateSnapshotForVolume(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	name string,
 	volumeID string,
 ) (resp CreateSnapshotForVolumeResp) {
 
 	createSnapshotResp, err := ec2Client.CreateSnapshot(
-		context.TODO(),
+		ctx,
 		&ec2.CreateSnapshotInput{
 			VolumeId: &volumeID,
 			TagSpecifications: []types.TagSpecification{{
@@ -215,7 +220,7 @@ func CreateSnapshotForVolume(
 	maxWaitTime := 24 * time.Hour
 
 	err = completedWaiter.Wait(
-		context.TODO(),
+		ctx,
 		&ec2.DescribeSnapshotsInput{
 			SnapshotIds: []string{
 				snapshotID,
@@ -238,12 +243,13 @@ type RemoveVolumeSnapshotResp struct {
 }
 
 func RemoveVolumeSnapshot(
-	ec2Client *ec2.Client,
+	ctx context.Context,
+	ec2Client EC2API,
 	snapshotID string,
 ) (resp RemoveVolumeSnapshotResp) {
 
 	_, err := ec2Client.DeleteSnapshot(
-		context.TODO(),
+		ctx,
 		&ec2.DeleteSnapshotInput{
 			SnapshotId: &snapshotID,
 		},
@@ -1,10 +1,10 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/recode-sh/aws-cloud-provider/infrastructure"
 	"github.com/recode-sh/recode/stepper"
 )
@@ -27,16 +27,30 @@ func (ErrInvalidInstanceTypeArch) Error() string {
 	return "ErrInvalidInstanceTypeArch"
 }
 
+// ErrInstanceTypeSpotUnsupported represents the error returned
+// when spot instances are enabled for an instance type that
+// could only be launched on demand.
+type ErrInstanceTypeSpotUnsupported struct {
+	InstanceType string
+}
+
+func (ErrInstanceTypeSpotUnsupported) Error() string {
+	return "ErrInstanceTypeSpotUnsupported"
+}
+
 func (a *AWS) CheckInstanceTypeValidity(
+	ctx context.Context,
 	stepper stepper.Stepper,
 	instanceType string,
 ) error {
 
-	ec2Client := ec2.NewFromConfig(a.sdkConfig)
+	ec2Client := a.clients.EC2
 
 	_, err := infrastructure.LookupInstanceTypeInfos(
+		ctx,
 		ec2Client,
 		instanceType,
+		a.devEnvOpts.Spot,
 	)
 
 	if err != nil {
@@ -55,6 +69,12 @@ func (a *AWS) CheckInstanceTypeValidity(
 			}
 		}
 
+		if errors.Is(err, infrastructure.ErrInstanceTypeSpotUnsupported) {
+			return ErrInstanceTypeSpotUnsupported{
+				InstanceType: instanceType,
+			}
+		}
+
 		return err
 	}
 
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/recode/stepper"
+)
+
+// The value of the "Name" tag used to simulate the
+// actions restricted to the resources created by Recode.
+const permissionsPreflightResourceName = "recode-permissions-preflight"
+
+// ErrMissingPermissions represents the error returned when
+// the policies attached to the credentials don't allow
+// some of the actions used by a method.
+type ErrMissingPermissions struct {
+	Method       string
+	PrincipalARN string
+	Actions      []string
+}
+
+func (ErrMissingPermissions) Error() string {
+	return "ErrMissingPermissions"
+}
+
+// ErrPermissionsPreflightUnavailable represents the error returned
+// when the permissions could not be checked (eg: root user,
+// federated user or "iam:SimulatePrincipalPolicy" not allowed).
+type ErrPermissionsPreflightUnavailable struct {
+	PrincipalARN string
+}
+
+func (ErrPermissionsPreflightUnavailable) Error() string {
+	return "ErrPermissionsPreflightUnavailable"
+}
+
+// CheckPermissions uses IAM policy simulation to check that
+// the credentials are allowed to call the passed method
+// (see IAMPermissionsCatalog). ErrMissingPermissions is returned
+// with the denied actions otherwise.
+//
+// The credentials are verified first if they weren't already
+// (see VerifyCredentials).
+func (a *AWS) CheckPermissions(ctx context.Context, method string) error {
+	permissions, err := LookupIAMPermissions(method)
+
+	if err != nil {
+		return err
+	}
+
+	callerIdentity := a.CallerIdentity()
+
+	if callerIdentity == nil {
+		if err := a.VerifyCredentials(ctx); err != nil {
+			return err
+		}
+
+		callerIdentity = a.CallerIdentity()
+	}
+
+	principalARN, ok := simulablePrincipalARN(callerIdentity.ARN)
+
+	if !ok {
+		return ErrPermissionsPreflightUnavailable{
+			PrincipalARN: callerIdentity.ARN,
+		}
+	}
+
+	deniedActions := []string{}
+
+	for _, simulation := range a.permissionsSimulations(permissions, callerIdentity.AccountID) {
+		denied, err := infrastructure.LookupDeniedIAMActions(
+			ctx,
+			a.clients.IAM,
+			principalARN,
+			simulation,
+		)
+
+		if err != nil {
+			if errors.Is(err, infrastructure.ErrIAMPolicySimulationUnavailable) {
+				return ErrPermissionsPreflightUnavailable{
+					PrincipalARN: principalARN,
+				}
+			}
+
+			return err
+		}
+
+		deniedActions = append(deniedActions, denied...)
+	}
+
+	if len(deniedActions) > 0 {
+		return ErrMissingPermissions{
+			Method:       method,
+			PrincipalARN: principalARN,
+			Actions:      uniqueSortedActions(deniedActions),
+		}
+	}
+
+	return nil
+}
+
+// checkPermissionsBeforeCreate runs the permissions preflight for
+// the passed methods if enabled. The creation is not blocked when
+// the permissions could not be checked.
+func (a *AWS) checkPermissionsBeforeCreate(
+	ctx context.Context,
+	stepper stepper.Stepper,
+	methods ...string,
+) error {
+
+	if !a.permissionsPreflight {
+		return nil
+	}
+
+	stepper.StartTemporaryStep("Checking the permissions of your credentials")
+
+	for _, method := range methods {
+		err := a.CheckPermissions(ctx, method)
+
+		if errors.As(err, &ErrPermissionsPreflightUnavailable{}) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// permissionsSimulations groups the actions of the passed
+// permissions by the resources they reach so that they
+// could be simulated against the generated policies.
+func (a *AWS) permissionsSimulations(
+	permissions IAMPermissions,
+	accountID string,
+) []infrastructure.IAMActionsSimulation {
+
+	actions := permissions.Actions(
+		a.configStorageOpts.Backend,
+		len(a.configEncryptionOpts.KMSKeyID) > 0,
+	)
+
+	actionsByResource := map[string][]string{}
+
+	for _, action := range actions {
+		resource := "*"
+
+		switch {
+		case strings.HasPrefix(action, "dynamodb:"):
+			resource = recodeConfigTableARN(a.sdkConfig.Region, accountID)
+		case s3BucketActions[action]:
+			resource = recodeConfigBucketARN(a.configStorageOpts.S3Bucket)
+		case strings.HasPrefix(action, "s3:"):
+			resource = recodeConfigObjectARN(a.configStorageOpts.S3Bucket, "config")
+		case iamInstanceProfileActions[action]:
+			resource = recodeRoleARN(accountID, permissionsPreflightResourceName)
+		case strings.HasPrefix(action, "route53:"):
+			resource = hostedZoneARN(a.devEnvOpts.DNS.HostedZoneID)
+		}
+
+		actionsByResource[resource] = append(actionsByResource[resource], action)
+	}
+
+	resources := []string{}
+
+	for resource := range actionsByResource {
+		resources = append(resources, resource)
+	}
+
+	sort.Strings(resources)
+
+	simulations := []infrastructure.IAMActionsSimulation{}
+
+	for _, resource := range resources {
+		simulations = append(simulations, infrastructure.IAMActionsSimulation{
+			Actions:      actionsByResource[resource],
+			ResourceARNs: []string{resource},
+			Context: map[string]string{
+				"ec2:ResourceTag/Name": permissionsPreflightResourceName,
+				"aws:ResourceTag/Name": permissionsPreflightResourceName,
+			},
+		})
+	}
+
+	return simulations
+}
+
+// simulablePrincipalARN returns the ARN of the IAM user or role
+// matching the passed caller ARN. Assumed roles are simulated
+// using their role (roles with a path are not supported given that
+// the path is not part of the assumed role ARN).
+func simulablePrincipalARN(callerARN string) (string, bool) {
+	// eg: "arn:aws:sts::123456789012:assumed-role/role-name/session-name"
+	ARNParts := strings.SplitN(callerARN, ":", 6)
+
+	if len(ARNParts) != 6 {
+		return "", false
+	}
+
+	partition := ARNParts[1]
+	service := ARNParts[2]
+	accountID := ARNParts[4]
+	resource := ARNParts[5]
+
+	if service == "iam" && strings.HasPrefix(resource, "user/") {
+		return callerARN, true
+	}
+
+	if service == "sts" && strings.HasPrefix(resource, "assumed-role/") {
+		roleName := strings.SplitN(strings.TrimPrefix(resource, "assumed-role/"), "/", 2)[0]
+		return "arn:" + partition + ":iam::" + accountID + ":role/" + roleName, true
+	}
+
+	return "", false
+}
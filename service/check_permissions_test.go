@@ -0,0 +1,133 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	testCases := []struct {
+		test          string
+		deniedActions []string
+		IAMError      error
+		expectedError error
+	}{
+		{
+			test: "all actions allowed",
+		},
+
+		{
+			test:          "denied actions",
+			deniedActions: []string{"ec2:CreateVpc", "dynamodb:PutItem", "ec2:AttachInternetGateway"},
+			expectedError: service.ErrMissingPermissions{
+				Method:       "CreateCluster",
+				PrincipalARN: "arn:aws:iam::123456789012:user/recode",
+				Actions:      []string{"dynamodb:PutItem", "ec2:AttachInternetGateway", "ec2:CreateVpc"},
+			},
+		},
+
+		{
+			test: "simulation not allowed",
+			IAMError: &smithy.GenericAPIError{
+				Code:    "AccessDenied",
+				Message: "User is not authorized to perform: iam:SimulatePrincipalPolicy",
+			},
+			expectedError: service.ErrPermissionsPreflightUnavailable{
+				PrincipalARN: "arn:aws:iam::123456789012:user/recode",
+			},
+		},
+
+		{
+			test:          "unknown error",
+			IAMError:      errors.New("UnknownError"),
+			expectedError: errors.New("UnknownError"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			cloud := newFakeCloud(t)
+			cloud.IAM.DenyActions(tc.deniedActions...)
+
+			if tc.IAMError != nil {
+				cloud.IAM.FailNext("SimulatePrincipalPolicy", tc.IAMError)
+			}
+
+			err := cloud.AWSService().CheckPermissions(context.Background(), "CreateCluster")
+
+			if !reflect.DeepEqual(err, tc.expectedError) {
+				t.Fatalf("expected error to equal '%+v', got '%+v'", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestCheckPermissionsWithUnknownMethod(t *testing.T) {
+	cloud := newFakeCloud(t)
+	err := cloud.AWSService().CheckPermissions(context.Background(), "UnknownMethod")
+
+	if !errors.As(err, &service.ErrUnknownAWSMethod{}) {
+		t.Fatalf("expected unknown method error, got '%+v'", err)
+	}
+}
+
+func TestCreateClusterWithPermissionsPreflight(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cloud.IAM.DenyActions("ec2:AssociateRouteTable")
+
+	err := cloud.AWSServiceWithOpts(service.AWSOpts{
+		PermissionsPreflight: true,
+	}).CreateCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		&entities.Cluster{Name: entities.DefaultClusterName},
+	)
+
+	var missingPermissionsErr service.ErrMissingPermissions
+
+	if !errors.As(err, &missingPermissionsErr) ||
+		!reflect.DeepEqual(missingPermissionsErr.Actions, []string{"ec2:AssociateRouteTable"}) {
+
+		t.Fatalf("expected missing permissions error, got '%+v'", err)
+	}
+
+	// Nothing was created (not even the lease)
+	if cloud.DynamoDB.Calls("PutItem") != 0 {
+		t.Errorf("expected no lease, got %d calls to PutItem", cloud.DynamoDB.Calls("PutItem"))
+	}
+
+	assertNoResourceLeft(t, cloud.EC2)
+}
+
+func TestCreateDevEnvWithUnavailablePermissionsPreflight(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+
+	cloud.IAM.FailNext("SimulatePrincipalPolicy", &smithy.GenericAPIError{
+		Code:    "AccessDenied",
+		Message: "User is not authorized to perform: iam:SimulatePrincipalPolicy",
+	})
+
+	// The creation is not blocked
+	err := cloud.AWSServiceWithOpts(service.AWSOpts{
+		PermissionsPreflight: true,
+	}).CreateDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		&entities.DevEnv{Name: "recode-sh-api", InstanceType: "t2.medium"},
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+}
@@ -0,0 +1,427 @@
+package service
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+
+	"github.com/recode-sh/recode/entities"
+)
+
+const (
+	// DefaultClusterVPCCIDRBlock represents the CIDR block
+	// of the VPC of the clusters if not set in ClusterOpts.
+	DefaultClusterVPCCIDRBlock = "10.0.0.0/16"
+
+	// DefaultClusterSubnetCIDRBlock represents the CIDR block
+	// of the subnet of the clusters if not set in ClusterOpts
+	// (and if the default VPC CIDR block is used).
+	DefaultClusterSubnetCIDRBlock = "10.0.0.0/24"
+
+	// ClusterCIDRBlockMinPrefixSize and ClusterCIDRBlockMaxPrefixSize
+	// represent the sizes of the CIDR blocks allowed by AWS
+	// for VPCs and subnets (from /16 to /28).
+	ClusterCIDRBlockMinPrefixSize = 16
+	ClusterCIDRBlockMaxPrefixSize = 28
+
+	// The prefix size of the default subnet
+	// when only the VPC CIDR block is set.
+	defaultClusterSubnetPrefixSize = 24
+
+	// The prefix size of the IPv6 blocks of the
+	// subnets (the only one allowed by AWS).
+	clusterSubnetIPv6PrefixSize = 64
+)
+
+// The private IPv4 address ranges (RFC1918).
+var privateIPv4CIDRBlocks = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+}
+
+// ErrInvalidCIDRBlock represents the error returned when a
+// CIDR block is not a valid IPv4 CIDR block (eg: "10.0.0.0/33")
+// or when bits are set after the prefix (eg: "10.0.0.1/16").
+type ErrInvalidCIDRBlock struct {
+	CIDRBlock string
+}
+
+func (ErrInvalidCIDRBlock) Error() string {
+	return "ErrInvalidCIDRBlock"
+}
+
+// ErrCIDRBlockNotPrivate represents the error returned when a CIDR
+// block is not contained in a private address range (RFC1918).
+type ErrCIDRBlockNotPrivate struct {
+	CIDRBlock string
+}
+
+func (ErrCIDRBlockNotPrivate) Error() string {
+	return "ErrCIDRBlockNotPrivate"
+}
+
+// ErrInvalidCIDRBlockPrefixSize represents the error returned
+// when the size of a CIDR block is not allowed by AWS.
+type ErrInvalidCIDRBlockPrefixSize struct {
+	CIDRBlock     string
+	MinPrefixSize int
+	MaxPrefixSize int
+}
+
+func (ErrInvalidCIDRBlockPrefixSize) Error() string {
+	return "ErrInvalidCIDRBlockPrefixSize"
+}
+
+// ErrSubnetCIDRBlockNotInVPC represents the error returned when
+// the subnet CIDR block is not contained in the VPC CIDR block.
+type ErrSubnetCIDRBlockNotInVPC struct {
+	SubnetCIDRBlock string
+	VPCCIDRBlock    string
+}
+
+func (ErrSubnetCIDRBlockNotInVPC) Error() string {
+	return "ErrSubnetCIDRBlockNotInVPC"
+}
+
+// ErrClusterCIDRBlockOverlap represents the error returned when the
+// VPC CIDR block overlaps the one of another cluster in the region.
+type ErrClusterCIDRBlockOverlap struct {
+	CIDRBlock           string
+	OverlappedCluster   string
+	OverlappedCIDRBlock string
+}
+
+func (ErrClusterCIDRBlockOverlap) Error() string {
+	return "ErrClusterCIDRBlockOverlap"
+}
+
+// ClusterOpts represents the options
+// used to configure the created clusters.
+type ClusterOpts struct {
+	// VPCCIDRBlock specifies the CIDR block of the VPC. It must be
+	// a private range (RFC1918) that doesn't overlap the VPC of the
+	// other clusters in the region (checked using the config).
+	// Default to DefaultClusterVPCCIDRBlock if not set.
+	VPCCIDRBlock string
+
+	// SubnetCIDRBlock specifies the CIDR block of the first subnet.
+	// The subnets of the other availability zones use the following
+	// blocks of the same size (the zones that don't fit in the VPC
+	// are skipped). Default to the first /24 of the VPC CIDR block
+	// (or to the whole block if smaller) if not set.
+	SubnetCIDRBlock string
+
+	// VPCID and SubnetID specify an existing VPC and subnet
+	// to create the clusters in (must be set together).
+	// Nothing is created in this mode (nor removed with the
+	// cluster) and the CIDR blocks above are ignored.
+	VPCID    string
+	SubnetID string
+
+	// IPv6 enables the dual-stack networking: the VPC gets an
+	// Amazon-provided IPv6 block, each subnet a /64 of this block and
+	// the dev envs an IPv6 address reachable on the SSH server port.
+	// Only applies to the VPCs created after it was set
+	// (ignored in an existing network).
+	IPv6 bool
+
+	// Private enables the private mode: the security groups of the
+	// dev envs don't accept any ingress and the dev envs are reached
+	// through SSM Session Manager (via interface endpoints created in
+	// the VPC and an instance profile created for each dev env). The
+	// instances still need to reach internet so VPCID and SubnetID must
+	// be set to a subnet routed to a NAT gateway (or to an internet
+	// gateway mapping public IPs on launch). Otherwise, CreateCluster
+	// returns ErrPrivateClusterWithoutExistingNetwork. Only applies
+	// to the clusters created after it was set.
+	Private bool
+
+	// GatewayEndpoints enables the creation of gateway VPC endpoints
+	// for S3 and DynamoDB attached to the route table of the clusters
+	// so that the traffic of the dev envs to these services doesn't go
+	// through the internet gateway (ignored in an existing network).
+	GatewayEndpoints bool
+}
+
+// resolveClusterCIDRBlocks records the CIDR blocks of the cluster
+// in its infrastructure. The CIDR blocks recorded during a
+// previous (partial) creation are kept.
+func (a *AWS) resolveClusterCIDRBlocks(
+	config *entities.Config,
+	cluster *entities.Cluster,
+	clusterInfra *ClusterInfrastructure,
+) error {
+
+	if len(clusterInfra.VPCCIDRBlock) > 0 {
+		return nil
+	}
+
+	// VPC created before the CIDR blocks were recorded
+	if clusterInfra.VPC != nil {
+		clusterInfra.VPCCIDRBlock = DefaultClusterVPCCIDRBlock
+		clusterInfra.SubnetCIDRBlock = DefaultClusterSubnetCIDRBlock
+
+		return nil
+	}
+
+	VPCCIDRBlock := a.clusterOpts.VPCCIDRBlock
+
+	if len(VPCCIDRBlock) == 0 {
+		VPCCIDRBlock = DefaultClusterVPCCIDRBlock
+	}
+
+	VPCNet, err := parseClusterCIDRBlock(VPCCIDRBlock)
+
+	if err != nil {
+		return err
+	}
+
+	subnetCIDRBlock := a.clusterOpts.SubnetCIDRBlock
+
+	if len(subnetCIDRBlock) == 0 {
+		subnetCIDRBlock = defaultClusterSubnetCIDRBlock(VPCNet)
+	}
+
+	subnetNet, err := parseClusterCIDRBlock(subnetCIDRBlock)
+
+	if err != nil {
+		return err
+	}
+
+	if !cidrBlockContains(VPCNet, subnetNet) {
+		return ErrSubnetCIDRBlockNotInVPC{
+			SubnetCIDRBlock: subnetCIDRBlock,
+			VPCCIDRBlock:    VPCCIDRBlock,
+		}
+	}
+
+	err = checkClusterCIDRBlockOverlaps(
+		config,
+		cluster,
+		VPCNet,
+		len(a.clusterOpts.VPCCIDRBlock) == 0,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	clusterInfra.VPCCIDRBlock = VPCCIDRBlock
+	clusterInfra.SubnetCIDRBlock = subnetCIDRBlock
+
+	return nil
+}
+
+// parseClusterCIDRBlock parses the passed CIDR block and
+// checks that it could be used for a VPC or a subnet.
+func parseClusterCIDRBlock(CIDRBlock string) (*net.IPNet, error) {
+	IP, IPNet, err := net.ParseCIDR(CIDRBlock)
+
+	if err != nil || IP.To4() == nil || !IP.Equal(IPNet.IP) {
+		return nil, ErrInvalidCIDRBlock{
+			CIDRBlock: CIDRBlock,
+		}
+	}
+
+	prefixSize, _ := IPNet.Mask.Size()
+
+	if prefixSize < ClusterCIDRBlockMinPrefixSize ||
+		prefixSize > ClusterCIDRBlockMaxPrefixSize {
+
+		return nil, ErrInvalidCIDRBlockPrefixSize{
+			CIDRBlock:     CIDRBlock,
+			MinPrefixSize: ClusterCIDRBlockMinPrefixSize,
+			MaxPrefixSize: ClusterCIDRBlockMaxPrefixSize,
+		}
+	}
+
+	for _, privateCIDRBlock := range privateIPv4CIDRBlocks {
+		_, privateNet, _ := net.ParseCIDR(privateCIDRBlock)
+
+		if cidrBlockContains(privateNet, IPNet) {
+			return IPNet, nil
+		}
+	}
+
+	return nil, ErrCIDRBlockNotPrivate{
+		CIDRBlock: CIDRBlock,
+	}
+}
+
+// checkClusterCIDRBlockOverlaps checks that the passed VPC
+// CIDR block doesn't overlap the ones of the other clusters.
+//
+// usesDefaultVPCCIDRBlock is set when the VPC CIDR block was not
+// set in ClusterOpts. In this case, the clusters that also use
+// DefaultClusterVPCCIDRBlock are not considered overlapping: they
+// share it, like before the blocks were configurable. Their VPCs
+// are not peered so the shared block is harmless.
+func checkClusterCIDRBlockOverlaps(
+	config *entities.Config,
+	cluster *entities.Cluster,
+	VPCNet *net.IPNet,
+	usesDefaultVPCCIDRBlock bool,
+) error {
+
+	if config == nil {
+		return nil
+	}
+
+	for _, otherCluster := range config.Clusters {
+		if otherCluster.GetNameSlug() == cluster.GetNameSlug() ||
+			len(otherCluster.InfrastructureJSON) == 0 {
+
+			continue
+		}
+
+		var otherClusterInfra *ClusterInfrastructure
+		err := json.Unmarshal([]byte(otherCluster.InfrastructureJSON), &otherClusterInfra)
+
+		if err != nil {
+			return err
+		}
+
+		otherVPCCIDRBlock := otherClusterInfra.VPCCIDRBlock
+
+		// VPC created before the CIDR blocks were recorded
+		if len(otherVPCCIDRBlock) == 0 && otherClusterInfra.VPC != nil {
+			otherVPCCIDRBlock = DefaultClusterVPCCIDRBlock
+		}
+
+		// Default vs default (see above)
+		if usesDefaultVPCCIDRBlock &&
+			otherVPCCIDRBlock == DefaultClusterVPCCIDRBlock {
+
+			continue
+		}
+
+		_, otherVPCNet, err := net.ParseCIDR(otherVPCCIDRBlock)
+
+		if err != nil {
+			continue
+		}
+
+		if otherVPCNet.Contains(VPCNet.IP) || VPCNet.Contains(otherVPCNet.IP) {
+			return ErrClusterCIDRBlockOverlap{
+				CIDRBlock:           VPCNet.String(),
+				OverlappedCluster:   otherCluster.Name,
+				OverlappedCIDRBlock: otherVPCCIDRBlock,
+			}
+		}
+	}
+
+	return nil
+}
+
+// nextClusterSubnetCIDRBlock returns the first block, starting at
+// the subnet CIDR block and with the same size, that is contained in
+// the VPC CIDR block and not used by the subnets of the cluster.
+// An empty string is returned if there is no room left in the VPC.
+func nextClusterSubnetCIDRBlock(clusterInfra *ClusterInfrastructure) (string, error) {
+	_, VPCNet, err := net.ParseCIDR(clusterInfra.VPCCIDRBlock)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, subnetNet, err := net.ParseCIDR(clusterInfra.SubnetCIDRBlock)
+
+	if err != nil {
+		return "", err
+	}
+
+	usedCIDRBlocks := map[string]bool{}
+
+	for _, subnet := range clusterInfra.Subnets {
+		usedCIDRBlocks[subnet.CIDRBlock] = true
+	}
+
+	subnetPrefixSize, _ := subnetNet.Mask.Size()
+	subnetSize := uint32(1) << (32 - subnetPrefixSize)
+	subnetIP := binary.BigEndian.Uint32(subnetNet.IP.To4())
+
+	for {
+		candidateNet := &net.IPNet{
+			IP:   make(net.IP, net.IPv4len),
+			Mask: subnetNet.Mask,
+		}
+
+		binary.BigEndian.PutUint32(candidateNet.IP, subnetIP)
+
+		if !cidrBlockContains(VPCNet, candidateNet) {
+			return "", nil
+		}
+
+		if !usedCIDRBlocks[candidateNet.String()] {
+			return candidateNet.String(), nil
+		}
+
+		subnetIP += subnetSize
+	}
+}
+
+// nextClusterSubnetIPv6CIDRBlock returns the first /64 of
+// the IPv6 block of the VPC not used by the subnets of the cluster.
+// An empty string is returned for IPv4-only VPCs or
+// if there is no room left in the VPC.
+func nextClusterSubnetIPv6CIDRBlock(clusterInfra *ClusterInfrastructure) (string, error) {
+	if clusterInfra.VPC == nil || len(clusterInfra.VPC.IPv6CIDRBlock) == 0 {
+		return "", nil
+	}
+
+	_, VPCNet, err := net.ParseCIDR(clusterInfra.VPC.IPv6CIDRBlock)
+
+	if err != nil {
+		return "", err
+	}
+
+	usedCIDRBlocks := map[string]bool{}
+
+	for _, subnet := range clusterInfra.Subnets {
+		usedCIDRBlocks[subnet.IPv6CIDRBlock] = true
+	}
+
+	// The VPC block is a /56 so the subnet
+	// ID is the 8th byte of the address
+	for subnetID := 0; subnetID < 256; subnetID++ {
+		candidateNet := &net.IPNet{
+			IP:   append(net.IP{}, VPCNet.IP...),
+			Mask: net.CIDRMask(clusterSubnetIPv6PrefixSize, 128),
+		}
+
+		candidateNet.IP[7] |= byte(subnetID)
+
+		if !cidrBlockContains(VPCNet, candidateNet) {
+			return "", nil
+		}
+
+		if !usedCIDRBlocks[candidateNet.String()] {
+			return candidateNet.String(), nil
+		}
+	}
+
+	return "", nil
+}
+
+func defaultClusterSubnetCIDRBlock(VPCNet *net.IPNet) string {
+	VPCPrefixSize, _ := VPCNet.Mask.Size()
+
+	if VPCPrefixSize >= defaultClusterSubnetPrefixSize {
+		return VPCNet.String()
+	}
+
+	subnetNet := net.IPNet{
+		IP:   VPCNet.IP,
+		Mask: net.CIDRMask(defaultClusterSubnetPrefixSize, 32),
+	}
+
+	return subnetNet.String()
+}
+
+func cidrBlockContains(outer *net.IPNet, inner *net.IPNet) bool {
+	outerPrefixSize, _ := outer.Mask.Size()
+	innerPrefixSize, _ := inner.Mask.Size()
+
+	return outer.Contains(inner.IP) && innerPrefixSize >= outerPrefixSize
+}
@@ -0,0 +1,284 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+func TestCreateClusterWithCIDRBlocks(t *testing.T) {
+	otherCluster := &entities.Cluster{
+		Name:               "other",
+		InfrastructureJSON: `{"vpc_cidr_block":"172.16.0.0/16","vpc":{"id":"vpc-other"}}`,
+	}
+
+	legacyCluster := &entities.Cluster{
+		Name:               "legacy",
+		InfrastructureJSON: `{"vpc":{"id":"vpc-legacy"}}`,
+	}
+
+	customCluster := &entities.Cluster{
+		Name:               "custom",
+		InfrastructureJSON: `{"vpc_cidr_block":"10.0.0.0/20","vpc":{"id":"vpc-custom"}}`,
+	}
+
+	testCases := []struct {
+		test                    string
+		clusterOpts             service.ClusterOpts
+		otherClusters           []*entities.Cluster
+		expectedError           error
+		expectedVPCCIDRBlock    string
+		expectedSubnetCIDRBlock string
+		// One per availability zone that fits in the VPC
+		expectedSubnetCIDRBlocks []string
+	}{
+		{
+			test:                     "default CIDR blocks",
+			otherClusters:            []*entities.Cluster{legacyCluster},
+			expectedVPCCIDRBlock:     service.DefaultClusterVPCCIDRBlock,
+			expectedSubnetCIDRBlock:  service.DefaultClusterSubnetCIDRBlock,
+			expectedSubnetCIDRBlocks: []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24"},
+		},
+
+		{
+			test:          "default CIDR blocks overlapping custom ones",
+			otherClusters: []*entities.Cluster{legacyCluster, customCluster},
+			expectedError: service.ErrClusterCIDRBlockOverlap{
+				CIDRBlock:           service.DefaultClusterVPCCIDRBlock,
+				OverlappedCluster:   "custom",
+				OverlappedCIDRBlock: "10.0.0.0/20",
+			},
+		},
+
+		{
+			test: "VPC and subnet CIDR blocks",
+			clusterOpts: service.ClusterOpts{
+				VPCCIDRBlock:    "192.168.0.0/20",
+				SubnetCIDRBlock: "192.168.8.0/22",
+			},
+			otherClusters:            []*entities.Cluster{otherCluster, legacyCluster},
+			expectedVPCCIDRBlock:     "192.168.0.0/20",
+			expectedSubnetCIDRBlock:  "192.168.8.0/22",
+			expectedSubnetCIDRBlocks: []string{"192.168.8.0/22", "192.168.12.0/22"},
+		},
+
+		{
+			test: "VPC CIDR block only",
+			clusterOpts: service.ClusterOpts{
+				VPCCIDRBlock: "10.42.0.0/16",
+			},
+			expectedVPCCIDRBlock:     "10.42.0.0/16",
+			expectedSubnetCIDRBlock:  "10.42.0.0/24",
+			expectedSubnetCIDRBlocks: []string{"10.42.0.0/24", "10.42.1.0/24", "10.42.2.0/24"},
+		},
+
+		{
+			test: "small VPC CIDR block only",
+			clusterOpts: service.ClusterOpts{
+				VPCCIDRBlock: "10.42.0.0/26",
+			},
+			expectedVPCCIDRBlock:     "10.42.0.0/26",
+			expectedSubnetCIDRBlock:  "10.42.0.0/26",
+			expectedSubnetCIDRBlocks: []string{"10.42.0.0/26"},
+		},
+
+		{
+			test: "invalid CIDR block",
+			clusterOpts: service.ClusterOpts{
+				VPCCIDRBlock: "10.0.0.1/16",
+			},
+			expectedError: service.ErrInvalidCIDRBlock{
+				CIDRBlock: "10.0.0.1/16",
+			},
+		},
+
+		{
+			test: "public CIDR block",
+			clusterOpts: service.ClusterOpts{
+				VPCCIDRBlock: "8.8.0.0/16",
+			},
+			expectedError: service.ErrCIDRBlockNotPrivate{
+				CIDRBlock: "8.8.0.0/16",
+			},
+		},
+
+		{
+			test: "too large CIDR block",
+			clusterOpts: service.ClusterOpts{
+				VPCCIDRBlock: "10.0.0.0/8",
+			},
+			expectedError: service.ErrInvalidCIDRBlockPrefixSize{
+				CIDRBlock:     "10.0.0.0/8",
+				MinPrefixSize: service.ClusterCIDRBlockMinPrefixSize,
+				MaxPrefixSize: service.ClusterCIDRBlockMaxPrefixSize,
+			},
+		},
+
+		{
+			test: "subnet outside VPC",
+			clusterOpts: service.ClusterOpts{
+				VPCCIDRBlock:    "10.1.0.0/16",
+				SubnetCIDRBlock: "10.2.0.0/24",
+			},
+			expectedError: service.ErrSubnetCIDRBlockNotInVPC{
+				SubnetCIDRBlock: "10.2.0.0/24",
+				VPCCIDRBlock:    "10.1.0.0/16",
+			},
+		},
+
+		{
+			test: "overlap with other cluster",
+			clusterOpts: service.ClusterOpts{
+				VPCCIDRBlock: "172.16.128.0/17",
+			},
+			otherClusters: []*entities.Cluster{otherCluster},
+			expectedError: service.ErrClusterCIDRBlockOverlap{
+				CIDRBlock:           "172.16.128.0/17",
+				OverlappedCluster:   "other",
+				OverlappedCIDRBlock: "172.16.0.0/16",
+			},
+		},
+
+		{
+			test: "overlap with cluster created before CIDR blocks were recorded",
+			clusterOpts: service.ClusterOpts{
+				VPCCIDRBlock: "10.0.0.0/16",
+			},
+			otherClusters: []*entities.Cluster{legacyCluster},
+			expectedError: service.ErrClusterCIDRBlockOverlap{
+				CIDRBlock:           "10.0.0.0/16",
+				OverlappedCluster:   "legacy",
+				OverlappedCIDRBlock: service.DefaultClusterVPCCIDRBlock,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			cloud := newFakeCloud(t)
+			cluster := &entities.Cluster{
+				Name: entities.DefaultClusterName,
+			}
+
+			err := cloud.AWSServiceWithOpts(service.AWSOpts{
+				Cluster: tc.clusterOpts,
+			}).CreateCluster(
+				context.Background(),
+				&fakes.Stepper{},
+				&entities.Config{
+					Clusters: append(tc.otherClusters, cluster),
+				},
+				cluster,
+			)
+
+			if tc.expectedError != nil {
+				if !reflect.DeepEqual(err, tc.expectedError) {
+					t.Fatalf("expected error to equal '%+v', got '%+v'", tc.expectedError, err)
+				}
+
+				assertNoResourceLeft(t, cloud.EC2)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			var clusterInfra *service.ClusterInfrastructure
+			err = json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if clusterInfra.VPCCIDRBlock != tc.expectedVPCCIDRBlock ||
+				clusterInfra.SubnetCIDRBlock != tc.expectedSubnetCIDRBlock {
+
+				t.Fatalf(
+					"expected CIDR blocks '%s' and '%s' to be recorded, got '%s' and '%s'",
+					tc.expectedVPCCIDRBlock,
+					tc.expectedSubnetCIDRBlock,
+					clusterInfra.VPCCIDRBlock,
+					clusterInfra.SubnetCIDRBlock,
+				)
+			}
+
+			subnetCIDRBlocks := []string{}
+
+			for _, subnet := range clusterInfra.Subnets {
+				subnetCIDRBlocks = append(subnetCIDRBlocks, subnet.CIDRBlock)
+			}
+
+			if !reflect.DeepEqual(subnetCIDRBlocks, tc.expectedSubnetCIDRBlocks) {
+				t.Fatalf(
+					"expected subnet CIDR blocks to equal '%+v', got '%+v'",
+					tc.expectedSubnetCIDRBlocks,
+					subnetCIDRBlocks,
+				)
+			}
+
+			describeVPCsResp, err := cloud.EC2.DescribeVpcs(context.Background(), &ec2.DescribeVpcsInput{
+				VpcIds: []string{clusterInfra.VPC.ID},
+			})
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if aws.ToString(describeVPCsResp.Vpcs[0].CidrBlock) != tc.expectedVPCCIDRBlock {
+				t.Fatalf(
+					"expected VPC CIDR block to equal '%s', got '%s'",
+					tc.expectedVPCCIDRBlock,
+					aws.ToString(describeVPCsResp.Vpcs[0].CidrBlock),
+				)
+			}
+		})
+	}
+}
+
+func TestCreateClusterKeepsRecordedCIDRBlocks(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	cloud.EC2.FailNext("CreateSubnet", context.DeadlineExceeded)
+
+	err := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: service.ClusterOpts{VPCCIDRBlock: "10.42.0.0/16"},
+	}).CreateCluster(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if err == nil {
+		t.Fatalf("expected error, got nothing")
+	}
+
+	// Resumed without options
+	err = cloud.AWSService().CreateCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	var clusterInfra *service.ClusterInfrastructure
+	err = json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if clusterInfra.SubnetCIDRBlock != "10.42.0.0/24" {
+		t.Fatalf("expected recorded subnet CIDR block to be used, got '%s'", clusterInfra.SubnetCIDRBlock)
+	}
+}
@@ -0,0 +1,426 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/recode/entities"
+)
+
+const (
+	// ConfigEncryptionLocalKeySize represents the size
+	// (in bytes) of the local keys (AES-256).
+	ConfigEncryptionLocalKeySize = 32
+
+	// The prefix of the encrypted fields. Fields without
+	// this prefix were written before encryption was enabled.
+	encryptedConfigFieldPrefix = "recode-encrypted:v1:"
+
+	kmsDataKeyProviderIDPrefix   = "kms:"
+	localDataKeyProviderIDPrefix = "local:"
+)
+
+var (
+	ErrConfigEncryptionNotConfigured = errors.New("ErrConfigEncryptionNotConfigured")
+	ErrInvalidConfigEncryptionKey    = errors.New("ErrInvalidConfigEncryptionKey")
+	ErrConfigDecryptionFailed        = errors.New("ErrConfigDecryptionFailed")
+)
+
+// ErrConfigDataKeyUnavailable represents the error returned
+// when the config was encrypted with a key that is not configured
+// (eg: local key missing, KMS key removed or access denied).
+type ErrConfigDataKeyUnavailable struct {
+	ProviderID string
+	Err        error
+}
+
+func (ErrConfigDataKeyUnavailable) Error() string {
+	return "ErrConfigDataKeyUnavailable"
+}
+
+// ConfigEncryptionOpts represents the options used to configure
+// the encryption of the sensitive fields of the config (SSH private keys).
+//
+// Fields are encrypted with a data key which is itself encrypted
+// with a KMS key or, for offline use, a local key (envelope encryption).
+// The config is stored unencrypted if neither is set.
+type ConfigEncryptionOpts struct {
+	// KMSKeyID specifies the KMS key (ID, ARN or alias)
+	// used to encrypt the data keys.
+	KMSKeyID string
+
+	// LocalKey specifies the key used to encrypt the data keys
+	// when KMSKeyID is not set. Must be ConfigEncryptionLocalKeySize bytes.
+	LocalKey []byte
+
+	// PreviousLocalKeys specifies the local keys that could still be
+	// used to decrypt the data keys (eg: before a rotation or
+	// before moving to KMS).
+	PreviousLocalKeys [][]byte
+}
+
+func (o ConfigEncryptionOpts) enabled() bool {
+	return len(o.KMSKeyID) > 0 || len(o.LocalKey) > 0
+}
+
+// configDataKey represents the decrypted data key of a config.
+type configDataKey struct {
+	plaintext []byte
+
+	providerID string
+	ciphertext []byte
+
+	// The fields are encrypted with random nonces. The last value
+	// read or written with this key is kept for each field so that
+	// a field whose plaintext is unchanged keeps its ciphertext and
+	// unchanged dev envs are not written again
+	// (see infrastructure.UpdateRecodeConfigInDynamoDBTable).
+	encryptedFieldsMu sync.Mutex
+	encryptedFields   map[string]encryptedConfigField
+}
+
+type encryptedConfigField struct {
+	plaintext  string
+	ciphertext string
+}
+
+// lookupFieldCiphertext returns the last ciphertext of the passed
+// field if it was encrypted from the passed plaintext.
+func (k *configDataKey) lookupFieldCiphertext(fieldPath, plaintext string) (string, bool) {
+	k.encryptedFieldsMu.Lock()
+	defer k.encryptedFieldsMu.Unlock()
+
+	field, ok := k.encryptedFields[fieldPath]
+
+	if !ok || field.plaintext != plaintext {
+		return "", false
+	}
+
+	return field.ciphertext, true
+}
+
+func (k *configDataKey) setFieldCiphertext(fieldPath, plaintext, ciphertext string) {
+	k.encryptedFieldsMu.Lock()
+	defer k.encryptedFieldsMu.Unlock()
+
+	if k.encryptedFields == nil {
+		k.encryptedFields = map[string]encryptedConfigField{}
+	}
+
+	k.encryptedFields[fieldPath] = encryptedConfigField{
+		plaintext:  plaintext,
+		ciphertext: ciphertext,
+	}
+}
+
+// generateConfigDataKey generates a data key encrypted with the KMS key
+// or the local key (in that order of preference).
+func (a *AWS) generateConfigDataKey(ctx context.Context) (*configDataKey, error) {
+	encryptionOpts := a.configEncryptionOpts
+
+	if len(encryptionOpts.KMSKeyID) > 0 {
+		dataKey, err := infrastructure.GenerateDataKeyWithKMS(
+			ctx,
+			a.clients.KMS,
+			encryptionOpts.KMSKeyID,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &configDataKey{
+			plaintext:  dataKey.Plaintext,
+			providerID: kmsDataKeyProviderIDPrefix + encryptionOpts.KMSKeyID,
+			ciphertext: dataKey.CiphertextBlob,
+		}, nil
+	}
+
+	if len(encryptionOpts.LocalKey) == 0 {
+		return nil, ErrConfigEncryptionNotConfigured
+	}
+
+	plaintext := make([]byte, ConfigEncryptionLocalKeySize)
+
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := sealWithAESGCM(encryptionOpts.LocalKey, plaintext)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &configDataKey{
+		plaintext:  plaintext,
+		providerID: localDataKeyProviderIDPrefix + localKeyFingerprint(encryptionOpts.LocalKey),
+		ciphertext: ciphertext,
+	}, nil
+}
+
+// decryptConfigDataKey decrypts the data key
+// stored alongside the config.
+func (a *AWS) decryptConfigDataKey(
+	ctx context.Context,
+	providerID string,
+	ciphertext []byte,
+) (*configDataKey, error) {
+
+	dataKey := &configDataKey{
+		providerID: providerID,
+		ciphertext: ciphertext,
+	}
+
+	if strings.HasPrefix(providerID, kmsDataKeyProviderIDPrefix) {
+		// The KMS key is found in the ciphertext
+		plaintext, err := infrastructure.DecryptDataKeyWithKMS(
+			ctx,
+			a.clients.KMS,
+			ciphertext,
+		)
+
+		if err != nil {
+			return nil, ErrConfigDataKeyUnavailable{
+				ProviderID: providerID,
+				Err:        err,
+			}
+		}
+
+		dataKey.plaintext = plaintext
+		return dataKey, nil
+	}
+
+	localKeys := append(
+		[][]byte{a.configEncryptionOpts.LocalKey},
+		a.configEncryptionOpts.PreviousLocalKeys...,
+	)
+
+	for _, localKey := range localKeys {
+		if len(localKey) == 0 ||
+			localDataKeyProviderIDPrefix+localKeyFingerprint(localKey) != providerID {
+			continue
+		}
+
+		plaintext, err := openWithAESGCM(localKey, ciphertext)
+
+		if err != nil {
+			return nil, err
+		}
+
+		dataKey.plaintext = plaintext
+		return dataKey, nil
+	}
+
+	return nil, ErrConfigDataKeyUnavailable{
+		ProviderID: providerID,
+	}
+}
+
+// encryptRecodeConfig returns a copy of the passed config
+// with its sensitive fields encrypted with the data key.
+func encryptRecodeConfig(
+	config *entities.Config,
+	dataKey *configDataKey,
+) (*entities.Config, error) {
+
+	return transformRecodeConfigSensitiveFields(config, func(fieldPath, value string) (string, error) {
+		if len(value) == 0 || strings.HasPrefix(value, encryptedConfigFieldPrefix) {
+			return value, nil
+		}
+
+		// Unchanged field
+		if encryptedValue, ok := dataKey.lookupFieldCiphertext(fieldPath, value); ok {
+			return encryptedValue, nil
+		}
+
+		ciphertext, err := sealWithAESGCM(dataKey.plaintext, []byte(value))
+
+		if err != nil {
+			return "", err
+		}
+
+		encryptedValue := encryptedConfigFieldPrefix + base64.StdEncoding.EncodeToString(ciphertext)
+		dataKey.setFieldCiphertext(fieldPath, value, encryptedValue)
+
+		return encryptedValue, nil
+	})
+}
+
+// decryptRecodeConfig returns a copy of the passed config with its
+// sensitive fields decrypted. dataKey could be nil if the config is not encrypted.
+func decryptRecodeConfig(
+	config *entities.Config,
+	dataKey *configDataKey,
+) (*entities.Config, error) {
+
+	return transformRecodeConfigSensitiveFields(config, func(fieldPath, value string) (string, error) {
+		if !strings.HasPrefix(value, encryptedConfigFieldPrefix) {
+			return value, nil
+		}
+
+		if dataKey == nil {
+			return "", ErrConfigDecryptionFailed
+		}
+
+		ciphertext, err := base64.StdEncoding.DecodeString(
+			strings.TrimPrefix(value, encryptedConfigFieldPrefix),
+		)
+
+		if err != nil {
+			return "", ErrConfigDecryptionFailed
+		}
+
+		plaintext, err := openWithAESGCM(dataKey.plaintext, ciphertext)
+
+		if err != nil {
+			return "", err
+		}
+
+		dataKey.setFieldCiphertext(fieldPath, string(plaintext), value)
+
+		return string(plaintext), nil
+	})
+}
+
+// transformRecodeConfigSensitiveFields returns a copy of the passed
+// config with transform applied to the SSH private keys of the dev envs.
+// Each field is identified by a path unique in the config
+// (eg: "default/dev-env/KeyPair.PEMContent").
+func transformRecodeConfigSensitiveFields(
+	config *entities.Config,
+	transform func(fieldPath, value string) (string, error),
+) (*entities.Config, error) {
+
+	configCopy := *config
+	configCopy.Clusters = []*entities.Cluster{}
+
+	for _, cluster := range config.Clusters {
+		clusterCopy := *cluster
+		clusterCopy.DevEnvs = []*entities.DevEnv{}
+
+		for _, devEnv := range cluster.DevEnvs {
+			devEnvCopy := *devEnv
+			devEnvPath := cluster.Name + "/" + devEnv.Name + "/"
+
+			SSHKeyPairPEMContent, err := transform(
+				devEnvPath+"SSHKeyPairPEMContent",
+				devEnv.SSHKeyPairPEMContent,
+			)
+
+			if err != nil {
+				return nil, err
+			}
+
+			devEnvCopy.SSHKeyPairPEMContent = SSHKeyPairPEMContent
+
+			if len(devEnv.InfrastructureJSON) > 0 {
+				var devEnvInfra *DevEnvInfrastructure
+				err := json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+
+				if err != nil {
+					return nil, err
+				}
+
+				if devEnvInfra.KeyPair != nil {
+					keyPairCopy := *devEnvInfra.KeyPair
+
+					keyPairCopy.PEMContent, err = transform(
+						devEnvPath+"KeyPair.PEMContent",
+						keyPairCopy.PEMContent,
+					)
+
+					if err != nil {
+						return nil, err
+					}
+
+					devEnvInfra.KeyPair = &keyPairCopy
+
+					if err := devEnvCopy.SetInfrastructureJSON(devEnvInfra); err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			clusterCopy.DevEnvs = append(clusterCopy.DevEnvs, &devEnvCopy)
+		}
+
+		configCopy.Clusters = append(configCopy.Clusters, &clusterCopy)
+	}
+
+	return &configCopy, nil
+}
+
+// localKeyFingerprint identifies a local key
+// without revealing it.
+func localKeyFingerprint(localKey []byte) string {
+	hash := sha256.Sum256(localKey)
+	return hex.EncodeToString(hash[:8])
+}
+
+// sealWithAESGCM encrypts plaintext with a random nonce.
+// The nonce is prepended to the returned ciphertext.
+func sealWithAESGCM(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newAESGCM(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openWithAESGCM(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newAESGCM(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrConfigDecryptionFailed
+	}
+
+	plaintext, err := gcm.Open(
+		nil,
+		ciphertext[:gcm.NonceSize()],
+		ciphertext[gcm.NonceSize():],
+		nil,
+	)
+
+	if err != nil {
+		return nil, ErrConfigDecryptionFailed
+	}
+
+	return plaintext, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != ConfigEncryptionLocalKeySize {
+		return nil, ErrInvalidConfigEncryptionKey
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/aws-cloud-provider/userconfig"
+)
+
+// ConfigStorage represents the interface used to store the config
+// and the leases (see infrastructure.DynamoDBRecodeConfigStorage and
+// infrastructure.ObjectRecodeConfigStorage).
+type ConfigStorage interface {
+	Create(ctx context.Context) error
+	Remove(ctx context.Context) error
+
+	LookupConfig(ctx context.Context) (*infrastructure.StoredRecodeConfig, error)
+	LookupConfigHistory(ctx context.Context) ([]infrastructure.StoredRecodeConfigVersion, error)
+	LookupConfigVersion(ctx context.Context, version int64) (*infrastructure.StoredRecodeConfig, error)
+
+	UpdateConfig(
+		ctx context.Context,
+		config *infrastructure.StoredRecodeConfig,
+		expectedVersion int64,
+		historyOpts infrastructure.RecodeConfigHistoryOpts,
+	) error
+
+	RemoveLegacyConfig(ctx context.Context, legacyRecordID string) error
+
+	AcquireLease(
+		ctx context.Context,
+		leaseID string,
+		ownerID string,
+		ownerDescription string,
+		expiresAt time.Time,
+	) error
+
+	RenewLease(
+		ctx context.Context,
+		leaseID string,
+		ownerID string,
+		ownerDescription string,
+		expiresAt time.Time,
+	) error
+
+	ReleaseLease(ctx context.Context, leaseID string, ownerID string) error
+	LookupLease(ctx context.Context, leaseID string) (*infrastructure.LeaseRecord, error)
+	ListLeases(ctx context.Context, leaseIDPrefix string) ([]*infrastructure.LeaseRecord, error)
+}
+
+var (
+	_ ConfigStorage = infrastructure.DynamoDBRecodeConfigStorage{}
+	_ ConfigStorage = infrastructure.ObjectRecodeConfigStorage{}
+)
+
+// newConfigStorage constructs the config storage
+// matching the backend set in user config.
+func newConfigStorage(
+	SDKConfig aws.Config,
+	configStorage userconfig.ConfigStorage,
+) ConfigStorage {
+
+	switch configStorage.Backend {
+	case userconfig.ConfigStorageBackendS3:
+		return infrastructure.NewS3RecodeConfigStorage(
+			s3.NewFromConfig(SDKConfig),
+			configStorage.S3Bucket,
+			SDKConfig.Region,
+		)
+	case userconfig.ConfigStorageBackendFile:
+		return infrastructure.NewFileRecodeConfigStorage(
+			configStorage.FileDirPath,
+		)
+	}
+
+	return infrastructure.NewDynamoDBRecodeConfigStorage(
+		dynamodb.NewFromConfig(SDKConfig),
+	)
+}
@@ -0,0 +1,166 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+func TestConfigStorageBackends(t *testing.T) {
+	testCases := []struct {
+		test          string
+		configStorage func(t *testing.T, cloud *fakeCloud) service.ConfigStorage
+	}{
+		{
+			test: "DynamoDB table",
+			configStorage: func(t *testing.T, cloud *fakeCloud) service.ConfigStorage {
+				return infrastructure.NewDynamoDBRecodeConfigStorage(cloud.DynamoDB)
+			},
+		},
+
+		{
+			test: "S3 bucket",
+			configStorage: func(t *testing.T, cloud *fakeCloud) service.ConfigStorage {
+				return infrastructure.NewS3RecodeConfigStorage(
+					cloud.S3,
+					"recode-config-bucket",
+					cloud.EC2.Region(),
+				)
+			},
+		},
+
+		{
+			test: "local directory",
+			configStorage: func(t *testing.T, cloud *fakeCloud) service.ConfigStorage {
+				return infrastructure.NewFileRecodeConfigStorage(
+					filepath.Join(t.TempDir(), "recode"),
+				)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			cloud := newFakeCloud(t)
+			cloud.ConfigStorage = tc.configStorage(t, cloud)
+
+			recodeCLI := cloud.AWSService()
+
+			err := recodeCLI.CreateRecodeConfigStorage(context.Background(), &fakes.Stepper{})
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			_, err = recodeCLI.LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+			if !errors.Is(err, entities.ErrRecodeNotInstalled) {
+				t.Fatalf("expected Recode not installed error, got '%+v'", err)
+			}
+
+			saveRecodeConfigVersions(t, recodeCLI, "first")
+
+			// Concurrent update
+			staleRecodeCLI := cloud.AWSService()
+			staleConfig, err := staleRecodeCLI.LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			_, err = recodeCLI.UpdateRecodeConfig(
+				context.Background(),
+				&fakes.Stepper{},
+				func(config *entities.Config) error {
+					config.Clusters[0].DevEnvs[0].InstanceType = "m6g.large"
+					return nil
+				},
+			)
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			err = staleRecodeCLI.SaveRecodeConfig(context.Background(), &fakes.Stepper{}, staleConfig)
+
+			if !errors.As(err, &service.ErrConfigConflict{}) {
+				t.Fatalf("expected config conflict error, got '%+v'", err)
+			}
+
+			config, err := cloud.AWSService().LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if len(config.Clusters) != 1 ||
+				config.Clusters[0].DevEnvs[0].InstanceType != "m6g.large" {
+
+				t.Errorf("expected updated config to be returned, got '%+v'", config.Clusters)
+			}
+
+			versions, err := recodeCLI.ListRecodeConfigVersions(context.Background(), &fakes.Stepper{})
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if len(versions) != 3 {
+				t.Errorf("expected 3 versions in history, got '%+v'", versions)
+			}
+
+			changes, err := recodeCLI.DiffRecodeConfigVersions(context.Background(), &fakes.Stepper{}, 1, 2)
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if len(changes) == 0 {
+				t.Errorf("expected version 1 and 2 to differ")
+			}
+
+			// Leases
+			err = cloud.ConfigStorage.AcquireLease(
+				context.Background(),
+				clusterLeaseID,
+				"another-owner",
+				"jane@laptop (pid 42)",
+				time.Now().Add(time.Hour),
+			)
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			err = recodeCLI.CreateCluster(
+				context.Background(),
+				&fakes.Stepper{},
+				config,
+				&entities.Cluster{Name: entities.DefaultClusterName},
+			)
+
+			if !errors.As(err, &service.ErrLeaseHeld{}) {
+				t.Fatalf("expected lease held error, got '%+v'", err)
+			}
+
+			err = recodeCLI.RemoveRecodeConfigStorage(context.Background(), &fakes.Stepper{})
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			_, err = recodeCLI.LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+			if !errors.Is(err, entities.ErrRecodeNotInstalled) {
+				t.Fatalf("expected Recode not installed error, got '%+v'", err)
+			}
+		})
+	}
+}
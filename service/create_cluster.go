@@ -1,9 +1,9 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/recode-sh/aws-cloud-provider/infrastructure"
 	"github.com/recode-sh/recode/entities"
 	"github.com/recode-sh/recode/queues"
@@ -11,18 +11,128 @@ import (
 )
 
 type ClusterInfrastructure struct {
+	// The CIDR blocks chosen when the cluster was created
+	// (see ClusterOpts). Recorded before creating the VPC.
+	VPCCIDRBlock    string `json:"vpc_cidr_block"`
+	SubnetCIDRBlock string `json:"subnet_cidr_block"`
+
 	VPC             *infrastructure.VPC             `json:"vpc"`
 	InternetGateway *infrastructure.InternetGateway `json:"internet_gateway"`
-	Subnet          *infrastructure.Subnet          `json:"subnet"`
 	RouteTable      *infrastructure.RouteTable      `json:"route_table"`
 	Route           *infrastructure.Route           `json:"route"`
+
+	// The default IPv6 route of the
+	// dual-stack clusters (see ClusterOpts)
+	IPv6Route *infrastructure.Route `json:"ipv6_route"`
+
+	// One subnet per availability zone
+	// (only one for the adopted subnets)
+	Subnets []*infrastructure.Subnet `json:"subnets"`
+
+	// IsPrivate is set for the clusters created in private mode
+	// (see ClusterOpts). Their dev envs are reached through SSM
+	// via the interface endpoints below (one per SSM service)
+	// that accept HTTPS from the VPC via their security group.
+	IsPrivate              bool                          `json:"is_private"`
+	EndpointsSecurityGroup *infrastructure.SecurityGroup `json:"endpoints_security_group"`
+	VPCEndpoints           []*infrastructure.VPCEndpoint `json:"vpc_endpoints"`
+
+	// The gateway endpoints for S3 and DynamoDB attached
+	// to the route table (see ClusterOpts)
+	GatewayVPCEndpoints []*infrastructure.VPCEndpoint `json:"gateway_vpc_endpoints"`
+}
+
+// UnmarshalJSON migrates the single subnet of the clusters
+// created before one subnet was created per availability zone.
+func (c *ClusterInfrastructure) UnmarshalJSON(data []byte) error {
+	type clusterInfrastructure ClusterInfrastructure
+
+	if err := json.Unmarshal(data, (*clusterInfrastructure)(c)); err != nil {
+		return err
+	}
+
+	var legacyClusterInfra struct {
+		Subnet     *infrastructure.Subnet `json:"subnet"`
+		RouteTable *struct {
+			IsAssociatedToSubnet bool `json:"is_associated_to_subnet"`
+		} `json:"route_table"`
+	}
+
+	if err := json.Unmarshal(data, &legacyClusterInfra); err != nil {
+		return err
+	}
+
+	if legacyClusterInfra.Subnet == nil || len(c.Subnets) > 0 {
+		return nil
+	}
+
+	subnet := legacyClusterInfra.Subnet
+
+	if len(subnet.CIDRBlock) == 0 {
+		subnet.CIDRBlock = c.SubnetCIDRBlock
+
+		// Created before the CIDR blocks were recorded
+		if len(subnet.CIDRBlock) == 0 {
+			subnet.CIDRBlock = DefaultClusterSubnetCIDRBlock
+		}
+	}
+
+	subnet.IsAssociatedToRouteTable = legacyClusterInfra.RouteTable != nil &&
+		legacyClusterInfra.RouteTable.IsAssociatedToSubnet
+
+	c.Subnets = []*infrastructure.Subnet{subnet}
+
+	return nil
+}
+
+// availabilityZones returns the availability
+// zones of the subnets of the cluster.
+func (c *ClusterInfrastructure) availabilityZones() []string {
+	availabilityZones := []string{}
+
+	for _, subnet := range c.Subnets {
+		availabilityZones = append(availabilityZones, subnet.AvailabilityZone)
+	}
+
+	return availabilityZones
+}
+
+// subnetInAvailabilityZone returns the subnet of the cluster
+// in the passed availability zone (nil if none).
+func (c *ClusterInfrastructure) subnetInAvailabilityZone(
+	availabilityZone string,
+) *infrastructure.Subnet {
+
+	for _, subnet := range c.Subnets {
+		if subnet.AvailabilityZone == availabilityZone {
+			return subnet
+		}
+	}
+
+	return nil
 }
 
 func (a *AWS) CreateCluster(
+	ctx context.Context,
 	stepper stepper.Stepper,
 	config *entities.Config,
 	cluster *entities.Cluster,
-) error {
+) (returnedError error) {
+
+	permissionsMethods := a.createClusterPermissionsMethods(cluster)
+
+	if err := a.checkPermissionsBeforeCreate(ctx, stepper, permissionsMethods...); err != nil {
+		return err
+	}
+
+	lease, err := a.acquireClusterLease(ctx, cluster.GetNameSlug())
+
+	if err != nil {
+		return err
+	}
+
+	ctx = lease.ctx
+	defer func() { returnedError = a.releaseLease(lease, returnedError) }()
 
 	clusterInfra := &ClusterInfrastructure{}
 	if len(cluster.InfrastructureJSON) > 0 {
@@ -33,8 +143,46 @@ func (a *AWS) CreateCluster(
 		}
 	}
 
+	// The modes of a (partially) created cluster are kept
+	if clusterInfra.VPC == nil {
+		clusterInfra.IsPrivate = a.clusterOpts.Private
+	}
+
+	if clusterInfra.VPC == nil && a.clusterOpts.usesExistingNetwork() {
+		err := a.adoptExistingNetwork(ctx, stepper, clusterInfra)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// No internet gateway nor NAT gateway is created for the
+	// private clusters: their instances would not reach internet
+	if clusterInfra.IsPrivate && !clusterInfra.isInExistingNetwork() {
+		return ErrPrivateClusterWithoutExistingNetwork{}
+	}
+
 	prefixResource := prefixClusterResource(cluster.GetNameSlug())
-	ec2Client := ec2.NewFromConfig(a.sdkConfig)
+	ec2Client := a.clients.EC2
+
+	// Only the SSM endpoints of the
+	// private clusters in an existing network
+	if clusterInfra.isInExistingNetwork() {
+		clusterInfraQueue := queues.InfrastructureQueue[*ClusterInfrastructure](
+			a.createSSMEndpointsSteps(ctx, stepper, clusterInfra, prefixResource),
+		)
+
+		err := clusterInfraQueue.Run(clusterInfra)
+
+		cluster.SetInfrastructureJSON(clusterInfra)
+		return err
+	}
+
+	err = a.resolveClusterCIDRBlocks(config, cluster, clusterInfra)
+
+	if err != nil {
+		return err
+	}
 
 	clusterInfraQueue := queues.InfrastructureQueue[*ClusterInfrastructure]{}
 
@@ -44,9 +192,11 @@ func (a *AWS) CreateCluster(
 		}
 
 		vpc, err := infrastructure.CreateVPC(
+			ctx,
 			ec2Client,
 			prefixResource("vpc"),
-			"10.0.0.0/16",
+			infra.VPCCIDRBlock,
+			a.clusterOpts.IPv6,
 		)
 
 		if err != nil {
@@ -63,6 +213,7 @@ func (a *AWS) CreateCluster(
 		}
 
 		internetGateway, err := infrastructure.CreateInternetGateway(
+			ctx,
 			ec2Client,
 			prefixResource("internet-gateway"),
 		)
@@ -75,6 +226,26 @@ func (a *AWS) CreateCluster(
 		return nil
 	}
 
+	var availabilityZones []string
+
+	lookupAvailabilityZones := func(infra *ClusterInfrastructure) error {
+		if availabilityZones != nil {
+			return nil
+		}
+
+		zones, err := infrastructure.LookupAvailabilityZones(
+			ctx,
+			ec2Client,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		availabilityZones = zones
+		return nil
+	}
+
 	clusterInfraQueue = append(
 		clusterInfraQueue,
 		queues.InfrastructureQueueSteps[*ClusterInfrastructure]{
@@ -84,6 +255,7 @@ func (a *AWS) CreateCluster(
 			},
 			createVPC,
 			createInternetGateway,
+			lookupAvailabilityZones,
 		},
 	)
 
@@ -93,6 +265,7 @@ func (a *AWS) CreateCluster(
 		}
 
 		err := infrastructure.AttachInternetGatewayToVPC(
+			ctx,
 			ec2Client,
 			infra.InternetGateway.ID,
 			infra.VPC.ID,
@@ -106,23 +279,48 @@ func (a *AWS) CreateCluster(
 		return nil
 	}
 
-	createSubnet := func(infra *ClusterInfrastructure) error {
-		if infra.Subnet != nil {
-			return nil
-		}
+	createSubnets := func(infra *ClusterInfrastructure) error {
+		for _, availabilityZone := range availabilityZones {
+			if infra.subnetInAvailabilityZone(availabilityZone) != nil {
+				continue
+			}
 
-		subnet, err := infrastructure.CreateSubnet(
-			ec2Client,
-			prefixResource("public-subnet"),
-			"10.0.0.0/24",
-			infra.VPC.ID,
-		)
+			CIDRBlock, err := nextClusterSubnetCIDRBlock(infra)
 
-		if err != nil {
-			return err
+			if err != nil {
+				return err
+			}
+
+			// No room left in the VPC
+			// for the remaining zones
+			if len(CIDRBlock) == 0 {
+				return nil
+			}
+
+			// Empty for the IPv4-only VPCs
+			IPv6CIDRBlock, err := nextClusterSubnetIPv6CIDRBlock(infra)
+
+			if err != nil {
+				return err
+			}
+
+			subnet, err := infrastructure.CreateSubnet(
+				ctx,
+				ec2Client,
+				prefixResource("public-subnet-"+availabilityZone),
+				CIDRBlock,
+				IPv6CIDRBlock,
+				infra.VPC.ID,
+				availabilityZone,
+			)
+
+			if err != nil {
+				return err
+			}
+
+			infra.Subnets = append(infra.Subnets, subnet)
 		}
 
-		infra.Subnet = subnet
 		return nil
 	}
 
@@ -132,6 +330,7 @@ func (a *AWS) CreateCluster(
 		}
 
 		routeTable, err := infrastructure.CreateRouteTable(
+			ctx,
 			ec2Client,
 			prefixResource("route-table"),
 			infra.VPC.ID,
@@ -149,11 +348,11 @@ func (a *AWS) CreateCluster(
 		clusterInfraQueue,
 		queues.InfrastructureQueueSteps[*ClusterInfrastructure]{
 			func(*ClusterInfrastructure) error {
-				stepper.StartTemporaryStep("Creating a subnet and a route table")
+				stepper.StartTemporaryStep("Creating the subnets and a route table")
 				return nil
 			},
 			attachInternetGatewayToVPC,
-			createSubnet,
+			createSubnets,
 			createRouteTable,
 		},
 	)
@@ -164,6 +363,7 @@ func (a *AWS) CreateCluster(
 		}
 
 		route, err := infrastructure.CreateRoute(
+			ctx,
 			ec2Client,
 			infra.InternetGateway.ID,
 			infra.RouteTable.ID,
@@ -177,14 +377,15 @@ func (a *AWS) CreateCluster(
 		return nil
 	}
 
-	associateRouteTable := func(infra *ClusterInfrastructure) error {
-		if infra.RouteTable.IsAssociatedToSubnet {
+	createIPv6Route := func(infra *ClusterInfrastructure) error {
+		if infra.IPv6Route != nil || len(infra.VPC.IPv6CIDRBlock) == 0 {
 			return nil
 		}
 
-		err := infrastructure.AssociateRouteTable(
+		IPv6Route, err := infrastructure.CreateIPv6Route(
+			ctx,
 			ec2Client,
-			infra.Subnet.ID,
+			infra.InternetGateway.ID,
 			infra.RouteTable.ID,
 		)
 
@@ -192,7 +393,30 @@ func (a *AWS) CreateCluster(
 			return err
 		}
 
-		infra.RouteTable.IsAssociatedToSubnet = true
+		infra.IPv6Route = IPv6Route
+		return nil
+	}
+
+	associateRouteTable := func(infra *ClusterInfrastructure) error {
+		for _, subnet := range infra.Subnets {
+			if subnet.IsAssociatedToRouteTable {
+				continue
+			}
+
+			err := infrastructure.AssociateRouteTable(
+				ctx,
+				ec2Client,
+				subnet.ID,
+				infra.RouteTable.ID,
+			)
+
+			if err != nil {
+				return err
+			}
+
+			subnet.IsAssociatedToRouteTable = true
+		}
+
 		return nil
 	}
 
@@ -204,11 +428,17 @@ func (a *AWS) CreateCluster(
 				return nil
 			},
 			createRoute,
+			createIPv6Route,
 			associateRouteTable,
 		},
 	)
 
-	err := clusterInfraQueue.Run(
+	clusterInfraQueue = append(
+		clusterInfraQueue,
+		a.createGatewayEndpointsSteps(ctx, stepper, prefixResource)...,
+	)
+
+	err = clusterInfraQueue.Run(
 		clusterInfra,
 	)
 
@@ -0,0 +1,364 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+type fakeCloud struct {
+	EC2         *fakes.EC2
+	DynamoDB    *fakes.DynamoDB
+	KMS         *fakes.KMS
+	S3          *fakes.S3
+	STS         *fakes.STS
+	IAM         *fakes.IAM
+	Route53     *fakes.Route53
+	InstanceSSH *fakes.InstanceSSH
+	InstanceSSM *fakes.InstanceSSM
+
+	CallerPublicIP *fakes.CallerPublicIP
+
+	// Default to the Recode config table if nil
+	ConfigStorage service.ConfigStorage
+}
+
+// newFakeCloud returns a fake cloud with the
+// Recode config table already created.
+func newFakeCloud(t *testing.T) *fakeCloud {
+	t.Helper()
+
+	fakeEC2 := fakes.NewEC2("eu-west-3")
+	fakeDynamoDB := fakes.NewDynamoDB()
+
+	err := infrastructure.CreateDynamoDBTableForRecodeConfig(
+		context.Background(),
+		fakeDynamoDB,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	fakeIAM := fakes.NewIAM()
+
+	return &fakeCloud{
+		EC2:         fakeEC2,
+		DynamoDB:    fakeDynamoDB,
+		KMS:         fakes.NewKMS(fakeEC2.Region()),
+		S3:          fakes.NewS3(),
+		STS:         fakes.NewSTS(),
+		IAM:         fakeIAM,
+		Route53:     fakes.NewRoute53(),
+		InstanceSSH: fakes.NewInstanceSSH(fakeEC2),
+		InstanceSSM: fakes.NewInstanceSSM(fakeEC2, fakeIAM),
+
+		CallerPublicIP: fakes.NewCallerPublicIP("203.0.113.10"),
+	}
+}
+
+func (f *fakeCloud) AWSService() *service.AWS {
+	return f.AWSServiceWithOpts(service.AWSOpts{})
+}
+
+func (f *fakeCloud) AWSServiceWithOpts(opts service.AWSOpts) *service.AWS {
+	return service.NewAWSWithClients(
+		aws.Config{Region: f.EC2.Region()},
+		service.AWSClients{
+			EC2:         f.EC2,
+			DynamoDB:    f.DynamoDB,
+			KMS:         f.KMS,
+			STS:         f.STS,
+			IAM:         f.IAM,
+			Route53:     f.Route53,
+			InstanceSSH: f.InstanceSSH,
+			InstanceSSM: f.InstanceSSM,
+
+			CallerPublicIP: f.CallerPublicIP,
+			ConfigStorage:  f.ConfigStorage,
+		},
+		opts,
+	)
+}
+
+func assertNoResourceLeft(t *testing.T, fakeEC2 *fakes.EC2) {
+	t.Helper()
+
+	for resourceKind, count := range fakeEC2.ResourceCounts() {
+		if count != 0 {
+			t.Errorf("expected no %s left, got %d", resourceKind, count)
+		}
+	}
+}
+
+func TestCreateCluster(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	err := cloud.AWSService().CreateCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	var clusterInfra *service.ClusterInfrastructure
+	err = json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if clusterInfra.Route == nil || !clusterInfra.InternetGateway.IsAttachedToVPC {
+		t.Fatalf("expected complete cluster infrastructure, got '%s'", cluster.InfrastructureJSON)
+	}
+
+	// One subnet per availability zone
+	if len(clusterInfra.Subnets) != len(cloud.EC2.AvailabilityZones()) {
+		t.Fatalf("expected %d subnets, got '%s'", len(cloud.EC2.AvailabilityZones()), cluster.InfrastructureJSON)
+	}
+
+	for i, subnet := range clusterInfra.Subnets {
+		expectedCIDRBlock := fmt.Sprintf("10.0.%d.0/24", i)
+
+		if subnet.AvailabilityZone != cloud.EC2.AvailabilityZones()[i] ||
+			subnet.CIDRBlock != expectedCIDRBlock || !subnet.IsAssociatedToRouteTable {
+
+			t.Errorf(
+				"expected subnet in '%s' with CIDR block '%s' associated to the route table, got '%+v'",
+				cloud.EC2.AvailabilityZones()[i],
+				expectedCIDRBlock,
+				*subnet,
+			)
+		}
+	}
+
+	routeTable := cloud.EC2.RouteTable(clusterInfra.RouteTable.ID)
+
+	if routeTable == nil || len(routeTable.Routes) != 2 {
+		t.Fatalf("expected a local route and a route to the internet gateway, got '%+v'", routeTable)
+	}
+
+	if gatewayID := aws.ToString(routeTable.Routes[1].GatewayId); gatewayID != clusterInfra.InternetGateway.ID {
+		t.Errorf("expected route to target '%s', got '%s'", clusterInfra.InternetGateway.ID, gatewayID)
+	}
+
+	// IPv4-only if not enabled in ClusterOpts
+	if len(clusterInfra.VPC.IPv6CIDRBlock) > 0 || clusterInfra.IPv6Route != nil {
+		t.Errorf("expected IPv4-only cluster, got '%s'", cluster.InfrastructureJSON)
+	}
+}
+
+func TestCreateClusterResumesAfterPartialFailure(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	injectedErr := errors.New("injected error")
+	cloud.EC2.FailNext("CreateRoute", injectedErr)
+
+	err := cloud.AWSService().CreateCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+	)
+
+	if !errors.Is(err, injectedErr) {
+		t.Fatalf("expected '%+v', got '%+v'", injectedErr, err)
+	}
+
+	var partialClusterInfra *service.ClusterInfrastructure
+	err = json.Unmarshal([]byte(cluster.InfrastructureJSON), &partialClusterInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if partialClusterInfra.VPC == nil || len(partialClusterInfra.Subnets) == 0 ||
+		partialClusterInfra.Route != nil {
+
+		t.Fatalf("expected partial cluster infrastructure, got '%s'", cluster.InfrastructureJSON)
+	}
+
+	err = cloud.AWSService().CreateCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if calls := cloud.EC2.Calls("CreateVpc"); calls != 1 {
+		t.Errorf("expected the VPC to be created once, got %d calls", calls)
+	}
+
+	if calls := cloud.EC2.Calls("CreateSubnet"); calls != len(cloud.EC2.AvailabilityZones()) {
+		t.Errorf("expected the subnets to be created once, got %d calls", calls)
+	}
+
+	if count := cloud.EC2.ResourceCounts()["vpc"]; count != 1 {
+		t.Errorf("expected one VPC, got %d", count)
+	}
+}
+
+func TestClusterInfrastructureWithLegacySubnet(t *testing.T) {
+	legacyClusterInfraJSON := `{
+		"vpc": {"id": "vpc-legacy"},
+		"subnet": {"id": "subnet-legacy", "availability_zone": "eu-west-3c"},
+		"route_table": {"id": "rtb-legacy", "is_associated_to_subnet": true}
+	}`
+
+	var clusterInfra *service.ClusterInfrastructure
+	err := json.Unmarshal([]byte(legacyClusterInfraJSON), &clusterInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	expectedSubnets := []*infrastructure.Subnet{{
+		ID:                       "subnet-legacy",
+		AvailabilityZone:         "eu-west-3c",
+		CIDRBlock:                service.DefaultClusterSubnetCIDRBlock,
+		IsAssociatedToRouteTable: true,
+	}}
+
+	if !reflect.DeepEqual(clusterInfra.Subnets, expectedSubnets) {
+		t.Fatalf("expected subnets to equal '%+v', got '%+v'", *expectedSubnets[0], clusterInfra.Subnets)
+	}
+}
+
+func TestCreateDualStackClusterAndDevEnv(t *testing.T) {
+	cloud := newFakeCloud(t)
+
+	// Caller reaching internet over IPv6
+	cloud.CallerPublicIP.SetIPAddress("2001:db8::10")
+
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: service.ClusterOpts{
+			IPv6: true,
+		},
+	})
+
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	err := recodeCLI.CreateCluster(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	var clusterInfra *service.ClusterInfrastructure
+	err = json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	_, VPCIPv6Net, err := net.ParseCIDR(clusterInfra.VPC.IPv6CIDRBlock)
+
+	if err != nil {
+		t.Fatalf("expected VPC IPv6 CIDR block, got '%s'", cluster.InfrastructureJSON)
+	}
+
+	usedIPv6CIDRBlocks := map[string]bool{}
+
+	for _, subnet := range clusterInfra.Subnets {
+		subnetIP, subnetIPv6Net, err := net.ParseCIDR(subnet.IPv6CIDRBlock)
+
+		if err != nil || !VPCIPv6Net.Contains(subnetIP) ||
+			usedIPv6CIDRBlocks[subnet.IPv6CIDRBlock] {
+
+			t.Fatalf("expected distinct IPv6 /64 in VPC block, got '%+v'", *subnet)
+		}
+
+		if prefixSize, _ := subnetIPv6Net.Mask.Size(); prefixSize != 64 {
+			t.Fatalf("expected IPv6 /64, got '%s'", subnet.IPv6CIDRBlock)
+		}
+
+		usedIPv6CIDRBlocks[subnet.IPv6CIDRBlock] = true
+	}
+
+	routeTable := cloud.EC2.RouteTable(clusterInfra.RouteTable.ID)
+	hasIPv6Route := false
+
+	for _, route := range routeTable.Routes {
+		hasIPv6Route = hasIPv6Route ||
+			(aws.ToString(route.DestinationIpv6CidrBlock) == "::/0" &&
+				aws.ToString(route.GatewayId) == clusterInfra.InternetGateway.ID)
+	}
+
+	if clusterInfra.IPv6Route == nil || !hasIPv6Route {
+		t.Fatalf("expected IPv6 route to the internet gateway, got '%+v'", routeTable.Routes)
+	}
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	err = recodeCLI.CreateDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	var devEnvInfra *service.DevEnvInfrastructure
+	err = json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	instanceIP := net.ParseIP(devEnvInfra.Instance.IPv6Address)
+
+	if instanceIP == nil || !VPCIPv6Net.Contains(instanceIP) {
+		t.Errorf("expected instance IPv6 address in VPC block, got '%s'", devEnvInfra.Instance.IPv6Address)
+	}
+
+	if len(devEnvInfra.Instance.PublicIPAddress) == 0 {
+		t.Errorf("expected instance public IP address to be kept")
+	}
+
+	describeSecurityGroupsResp, err := cloud.EC2.DescribeSecurityGroups(
+		context.Background(),
+		&ec2.DescribeSecurityGroupsInput{
+			GroupIds: []string{devEnvInfra.SecurityGroup.ID},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	ingress := describeSecurityGroupsResp.SecurityGroups[0].IpPermissions
+
+	if len(ingress) != 1 || len(ingress[0].Ipv6Ranges) != 1 ||
+		aws.ToString(ingress[0].Ipv6Ranges[0].CidrIpv6) != "2001:db8::10/128" {
+
+		t.Errorf("expected SSH server port open to the caller over IPv6, got '%+v'", ingress)
+	}
+}
@@ -1,12 +1,10 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
-	"strconv"
+	"errors"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/recode-sh/agent/constants"
 	"github.com/recode-sh/aws-cloud-provider/infrastructure"
 	"github.com/recode-sh/recode/entities"
@@ -14,21 +12,68 @@ import (
 	"github.com/recode-sh/recode/stepper"
 )
 
+// ErrInstanceTypeNotOfferedInCluster represents the error returned
+// when the instance type of a dev env is not offered in any of the
+// availability zones of the subnets of the cluster.
+type ErrInstanceTypeNotOfferedInCluster struct {
+	InstanceType      string
+	AvailabilityZones []string
+}
+
+func (ErrInstanceTypeNotOfferedInCluster) Error() string {
+	return "ErrInstanceTypeNotOfferedInCluster"
+}
+
+// ErrElasticIPInPrivateCluster represents the error returned
+// when an Elastic IP is requested for a dev env of a private
+// cluster (that must not be reachable from internet).
+type ErrElasticIPInPrivateCluster struct {
+	ClusterName string
+}
+
+func (ErrElasticIPInPrivateCluster) Error() string {
+	return "ErrElasticIPInPrivateCluster"
+}
+
 type DevEnvInfrastructure struct {
+	// The availability zone where the instance type is
+	// offered, chosen before creating the network interface.
+	// Empty for the dev envs created before it was recorded
+	// (in the single subnet of their cluster).
+	AvailabilityZone string `json:"availability_zone"`
+
 	SecurityGroup     *infrastructure.SecurityGroup     `json:"security_group"`
 	KeyPair           *infrastructure.KeyPair           `json:"key_pair"`
 	NetworkInterface  *infrastructure.NetworkInterface  `json:"network_interface"`
 	InstanceTypeInfos *infrastructure.InstanceTypeInfos `json:"instance_type_infos"`
 	InstanceAMI       *infrastructure.AMI               `json:"instance_ami"`
 	Instance          *infrastructure.Instance          `json:"instance"`
+
+	// The instance profile that lets the SSM agent of the
+	// instance connect to SSM (only for the private clusters).
+	// The dev env is reached through SSM when set.
+	InstanceProfile *infrastructure.InstanceProfile `json:"instance_profile"`
+
+	// The Elastic IP associated with the network interface
+	// (only if enabled when the dev env was created).
+	ElasticIP *infrastructure.ElasticIP `json:"elastic_ip"`
+
+	// The Route 53 record pointed to the public addresses of the
+	// instance (only if a hosted zone was set when it was created).
+	DNSRecord *infrastructure.DNSRecord `json:"dns_record"`
+
+	// The fallback of the spot instance to an on-demand
+	// one, only set while it is in progress (see StartDevEnv).
+	SpotInstanceFallback *SpotInstanceFallback `json:"spot_instance_fallback"`
 }
 
 func (a *AWS) CreateDevEnv(
+	ctx context.Context,
 	stepper stepper.Stepper,
 	config *entities.Config,
 	cluster *entities.Cluster,
 	devEnv *entities.DevEnv,
-) error {
+) (returnedError error) {
 
 	var clusterInfra *ClusterInfrastructure
 	err := json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
@@ -37,6 +82,43 @@ func (a *AWS) CreateDevEnv(
 		return err
 	}
 
+	permissionsMethods := []string{"CreateDevEnv"}
+
+	if clusterInfra.IsPrivate {
+		permissionsMethods = append(permissionsMethods, "CreateDevEnvPrivateMode")
+	}
+
+	if a.devEnvOpts.ElasticIP {
+		if clusterInfra.IsPrivate {
+			return ErrElasticIPInPrivateCluster{
+				ClusterName: cluster.Name,
+			}
+		}
+
+		permissionsMethods = append(permissionsMethods, "CreateDevEnvElasticIP")
+	}
+
+	if len(a.devEnvOpts.DNS.HostedZoneID) > 0 {
+		permissionsMethods = append(permissionsMethods, "CreateDevEnvDNSRecord")
+	}
+
+	if a.devEnvOpts.Spot {
+		permissionsMethods = append(permissionsMethods, "CreateDevEnvSpot")
+	}
+
+	if err := a.checkPermissionsBeforeCreate(ctx, stepper, permissionsMethods...); err != nil {
+		return err
+	}
+
+	lease, err := a.acquireDevEnvLease(ctx, cluster.GetNameSlug(), devEnv.GetNameSlug())
+
+	if err != nil {
+		return err
+	}
+
+	ctx = lease.ctx
+	defer func() { returnedError = a.releaseLease(lease, returnedError) }()
+
 	devEnvInfra := &DevEnvInfrastructure{}
 	if len(devEnv.InfrastructureJSON) > 0 {
 		err := json.Unmarshal([]byte(devEnv.InfrastructureJSON), devEnvInfra)
@@ -47,7 +129,7 @@ func (a *AWS) CreateDevEnv(
 	}
 
 	prefixResource := prefixDevEnvResource(cluster.GetNameSlug(), devEnv.GetNameSlug())
-	ec2Client := ec2.NewFromConfig(a.sdkConfig)
+	ec2Client := a.clients.EC2
 
 	devEnvInfraQueue := queues.InfrastructureQueue[*DevEnvInfrastructure]{}
 
@@ -56,33 +138,20 @@ func (a *AWS) CreateDevEnv(
 			return nil
 		}
 
-		recodeSSHServerListenPort, err := strconv.ParseInt(
-			constants.SSHServerListenPort,
-			10,
-			64,
-		)
+		// No SSH ingress in private clusters (dev env reached through SSM)
+		ingressRules, err := a.devEnvIngressRules(ctx, clusterInfra.IsPrivate)
 
 		if err != nil {
 			return err
 		}
 
 		securityGroup, err := infrastructure.CreateSecurityGroup(
+			ctx,
 			ec2Client,
 			prefixResource("security-group"),
 			"The security group attached to your development environment",
 			clusterInfra.VPC.ID,
-			[]types.IpPermission{
-				{
-					IpProtocol: aws.String("tcp"),
-					FromPort:   aws.Int32(int32(recodeSSHServerListenPort)),
-					ToPort:     aws.Int32(int32(recodeSSHServerListenPort)),
-					IpRanges: []types.IpRange{
-						{
-							CidrIp: aws.String("0.0.0.0/0"),
-						},
-					},
-				},
-			},
+			ingressRules,
 		)
 
 		if err != nil {
@@ -99,6 +168,7 @@ func (a *AWS) CreateDevEnv(
 		}
 
 		keyPair, err := infrastructure.CreateKeyPair(
+			ctx,
 			ec2Client,
 			prefixResource("key-pair"),
 		)
@@ -111,6 +181,48 @@ func (a *AWS) CreateDevEnv(
 		return nil
 	}
 
+	createInstanceProfile := func(infra *DevEnvInfrastructure) error {
+		if infra.InstanceProfile != nil || !clusterInfra.IsPrivate {
+			return nil
+		}
+
+		// The IAM names are global to the account
+		instanceProfile, err := infrastructure.CreateInstanceProfile(
+			ctx,
+			a.clients.IAM,
+			prefixResource(a.sdkConfig.Region+"-instance-profile"),
+			a.devEnvInstanceProfilePolicyARN(),
+		)
+
+		if err != nil {
+			return err
+		}
+
+		infra.InstanceProfile = instanceProfile
+		return nil
+	}
+
+	// The dev envs created before the Elastic IP was
+	// enabled keep the public IP assigned on each start
+	allocateElasticIP := func(infra *DevEnvInfrastructure) error {
+		if !a.devEnvOpts.ElasticIP || infra.ElasticIP != nil || infra.NetworkInterface != nil {
+			return nil
+		}
+
+		elasticIP, err := infrastructure.AllocateElasticIP(
+			ctx,
+			ec2Client,
+			prefixResource("elastic-ip"),
+		)
+
+		if err != nil {
+			return err
+		}
+
+		infra.ElasticIP = elasticIP
+		return nil
+	}
+
 	devEnvInfraQueue = append(
 		devEnvInfraQueue,
 		queues.InfrastructureQueueSteps[*DevEnvInfrastructure]{
@@ -120,6 +232,86 @@ func (a *AWS) CreateDevEnv(
 			},
 			createSecurityGroup,
 			createKeyPair,
+			createInstanceProfile,
+			allocateElasticIP,
+		},
+	)
+
+	lookupInstanceTypeInfos := func(infra *DevEnvInfrastructure) error {
+		if infra.InstanceTypeInfos != nil {
+			return nil
+		}
+
+		instanceTypeInfos, err := infrastructure.LookupInstanceTypeInfos(
+			ctx,
+			ec2Client,
+			devEnv.InstanceType,
+			a.devEnvOpts.Spot,
+		)
+
+		if errors.Is(err, infrastructure.ErrInstanceTypeSpotUnsupported) {
+			return ErrInstanceTypeSpotUnsupported{
+				InstanceType: devEnv.InstanceType,
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		infra.InstanceTypeInfos = instanceTypeInfos
+		return nil
+	}
+
+	devEnvInfraQueue = append(
+		devEnvInfraQueue,
+		queues.InfrastructureQueueSteps[*DevEnvInfrastructure]{
+			func(*DevEnvInfrastructure) error {
+				stepper.StartTemporaryStep("Looking up instance type informations")
+				return nil
+			},
+			lookupInstanceTypeInfos,
+		},
+	)
+
+	chooseAvailabilityZone := func(infra *DevEnvInfrastructure) error {
+		// The network interface could have been created
+		// before the availability zone was recorded
+		if len(infra.AvailabilityZone) > 0 || infra.NetworkInterface != nil {
+			return nil
+		}
+
+		offeredAvailabilityZones, err := infrastructure.LookupInstanceTypeAvailabilityZones(
+			ctx,
+			ec2Client,
+			infra.InstanceTypeInfos.Type,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		for _, availabilityZone := range offeredAvailabilityZones {
+			if clusterInfra.subnetInAvailabilityZone(availabilityZone) != nil {
+				infra.AvailabilityZone = availabilityZone
+				return nil
+			}
+		}
+
+		return ErrInstanceTypeNotOfferedInCluster{
+			InstanceType:      infra.InstanceTypeInfos.Type,
+			AvailabilityZones: clusterInfra.availabilityZones(),
+		}
+	}
+
+	devEnvInfraQueue = append(
+		devEnvInfraQueue,
+		queues.InfrastructureQueueSteps[*DevEnvInfrastructure]{
+			func(*DevEnvInfrastructure) error {
+				stepper.StartTemporaryStep("Choosing an availability zone")
+				return nil
+			},
+			chooseAvailabilityZone,
 		},
 	)
 
@@ -129,10 +321,11 @@ func (a *AWS) CreateDevEnv(
 		}
 
 		networkInterface, err := infrastructure.CreateNetworkInterface(
+			ctx,
 			ec2Client,
 			prefixResource("network-interface"),
 			"The network interface attached to your development environment",
-			clusterInfra.Subnet.ID,
+			clusterInfra.subnetInAvailabilityZone(infra.AvailabilityZone).ID,
 			[]string{infra.SecurityGroup.ID},
 		)
 
@@ -155,32 +348,29 @@ func (a *AWS) CreateDevEnv(
 		},
 	)
 
-	lookupInstanceTypeInfos := func(infra *DevEnvInfrastructure) error {
-		if infra.InstanceTypeInfos != nil {
+	// Before the instance is launched so that
+	// it gets the Elastic IP as public IP
+	associateElasticIP := func(infra *DevEnvInfrastructure) error {
+		if infra.ElasticIP == nil || len(infra.ElasticIP.AssociationID) > 0 {
 			return nil
 		}
 
-		instanceTypeInfos, err := infrastructure.LookupInstanceTypeInfos(
+		return infrastructure.AssociateElasticIP(
+			ctx,
 			ec2Client,
-			devEnv.InstanceType,
+			infra.ElasticIP,
+			infra.NetworkInterface.ID,
 		)
-
-		if err != nil {
-			return err
-		}
-
-		infra.InstanceTypeInfos = instanceTypeInfos
-		return nil
 	}
 
 	devEnvInfraQueue = append(
 		devEnvInfraQueue,
 		queues.InfrastructureQueueSteps[*DevEnvInfrastructure]{
 			func(*DevEnvInfrastructure) error {
-				stepper.StartTemporaryStep("Looking up instance type informations")
+				stepper.StartTemporaryStep("Associating the Elastic IP with the network interface")
 				return nil
 			},
-			lookupInstanceTypeInfos,
+			associateElasticIP,
 		},
 	)
 
@@ -190,6 +380,7 @@ func (a *AWS) CreateDevEnv(
 		}
 
 		instanceAMI, err := infrastructure.LookupUbuntuAMIForArch(
+			ctx,
 			ec2Client,
 			infra.InstanceTypeInfos.Arch,
 		)
@@ -218,7 +409,14 @@ func (a *AWS) CreateDevEnv(
 			return nil
 		}
 
+		instanceProfileName := ""
+
+		if infra.InstanceProfile != nil {
+			instanceProfileName = infra.InstanceProfile.Name
+		}
+
 		instance, err := infrastructure.CreateInstance(
+			ctx,
 			ec2Client,
 			prefixResource("instance"),
 			infra.InstanceAMI.ID,
@@ -226,10 +424,14 @@ func (a *AWS) CreateDevEnv(
 			infra.InstanceTypeInfos.Type,
 			infra.NetworkInterface.ID,
 			infra.KeyPair.Name,
+			instanceProfileName,
+			a.instanceSpotOpts(),
 		)
 
+		// The instances interrupted while launching are terminated
+		// so there is nothing to start again (contrary to StartDevEnv)
 		if err != nil {
-			return err
+			return spotCapacityError(err, infra.InstanceTypeInfos.Type)
 		}
 
 		infra.Instance = instance
@@ -247,14 +449,40 @@ func (a *AWS) CreateDevEnv(
 		},
 	)
 
+	upsertDNSRecord := func(infra *DevEnvInfrastructure) error {
+		return a.upsertDevEnvDNSRecord(
+			ctx,
+			infra,
+			cluster.GetNameSlug(),
+			devEnv.GetNameSlug(),
+		)
+	}
+
+	devEnvInfraQueue = append(
+		devEnvInfraQueue,
+		queues.InfrastructureQueueSteps[*DevEnvInfrastructure]{
+			func(*DevEnvInfrastructure) error {
+				stepper.StartTemporaryStep("Creating the DNS record")
+				return nil
+			},
+			upsertDNSRecord,
+		},
+	)
+
 	lookupInstanceInitScriptResults := func(infra *DevEnvInfrastructure) error {
 		if infra.Instance.InitScriptResults != nil {
 			return nil
 		}
 
-		initScriptResults, err := infrastructure.LookupInitInstanceScriptResults(
-			ec2Client,
-			devEnvInfra.Instance.PublicIPAddress,
+		instanceClient, instanceAddress, err := a.instanceTransport(infra)
+
+		if err != nil {
+			return err
+		}
+
+		initScriptResults, err := instanceClient.LookupInitInstanceScriptResults(
+			ctx,
+			instanceAddress,
 			constants.SSHServerListenPort,
 			entities.DevEnvRootUser,
 			devEnvInfra.KeyPair.PEMContent,
@@ -290,7 +518,7 @@ func (a *AWS) CreateDevEnv(
 	}
 
 	devEnv.InstancePublicIPAddress = devEnvInfra.Instance.PublicIPAddress
-	devEnv.InstancePublicHostname = devEnvInfra.Instance.PublicHostname
+	devEnv.InstancePublicHostname = devEnvPublicHostname(devEnvInfra)
 
 	devEnv.SSHHostKeys = devEnvInfra.Instance.InitScriptResults.SSHHostKeys
 	devEnv.SSHKeyPairPEMContent = devEnvInfra.KeyPair.PEMContent
@@ -0,0 +1,282 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+func createClusterInFakeCloud(t *testing.T, cloud *fakeCloud) *entities.Cluster {
+	t.Helper()
+
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	err := cloud.AWSService().CreateCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	return cluster
+}
+
+func TestCreateDevEnv(t *testing.T) {
+	testCases := []struct {
+		test         string
+		instanceType string
+		expectedArch infrastructure.InstanceTypeArch
+		// The first zone where the instance type is offered
+		expectedAvailabilityZoneSuffix string
+	}{
+		{
+			test:                           "with x86_64 instance type",
+			instanceType:                   "t2.medium",
+			expectedArch:                   infrastructure.InstanceTypeArchX8664,
+			expectedAvailabilityZoneSuffix: "a",
+		},
+
+		{
+			test:                           "with arm64 instance type",
+			instanceType:                   "m6g.large",
+			expectedArch:                   infrastructure.InstanceTypeArchArm64,
+			expectedAvailabilityZoneSuffix: "b",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			cloud := newFakeCloud(t)
+			cluster := createClusterInFakeCloud(t, cloud)
+
+			devEnv := &entities.DevEnv{
+				Name:         "recode-sh-api",
+				InstanceType: tc.instanceType,
+			}
+
+			err := cloud.AWSService().CreateDevEnv(
+				context.Background(),
+				&fakes.Stepper{},
+				&entities.Config{},
+				cluster,
+				devEnv,
+			)
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			var devEnvInfra *service.DevEnvInfrastructure
+			err = json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if devEnvInfra.InstanceTypeInfos.Arch != tc.expectedArch {
+				t.Errorf(
+					"expected arch to equal '%s', got '%s'",
+					tc.expectedArch,
+					devEnvInfra.InstanceTypeInfos.Arch,
+				)
+			}
+
+			expectedAvailabilityZone := cloud.EC2.Region() + tc.expectedAvailabilityZoneSuffix
+
+			if devEnvInfra.AvailabilityZone != expectedAvailabilityZone {
+				t.Errorf(
+					"expected availability zone to equal '%s', got '%s'",
+					expectedAvailabilityZone,
+					devEnvInfra.AvailabilityZone,
+				)
+			}
+
+			if len(devEnv.InstancePublicIPAddress) == 0 ||
+				devEnv.InstancePublicIPAddress != devEnvInfra.Instance.PublicIPAddress {
+
+				t.Errorf("expected instance public IP address to be set, got '%s'", devEnv.InstancePublicIPAddress)
+			}
+
+			if devEnv.SSHKeyPairPEMContent != devEnvInfra.KeyPair.PEMContent {
+				t.Errorf("expected SSH key pair PEM content to be set")
+			}
+
+			if len(devEnvInfra.Instance.Volumes) != 1 || !devEnvInfra.Instance.Volumes[0].IsRootVolume {
+				t.Errorf("expected one root volume, got '%+v'", devEnvInfra.Instance.Volumes)
+			}
+		})
+	}
+}
+
+func TestCreateDevEnvWithInvalidInstanceType(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+
+	err := cloud.AWSService().CreateDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		&entities.DevEnv{
+			Name:         "recode-sh-api",
+			InstanceType: "unknown.large",
+		},
+	)
+
+	if !errors.Is(err, infrastructure.ErrInvalidInstanceType) {
+		t.Fatalf("expected '%+v', got '%+v'", infrastructure.ErrInvalidInstanceType, err)
+	}
+}
+
+func TestCreateDevEnvWithInstanceTypeNotOfferedInCluster(t *testing.T) {
+	cloud := newFakeCloud(t)
+
+	// Single subnet in the first availability zone
+	VPCID, subnetID := createExistingNetwork(t, cloud.EC2, existingNetworkOpts{
+		defaultRoute:        "internet-gateway",
+		mapPublicIPOnLaunch: true,
+	})
+
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: service.ClusterOpts{
+			VPCID:    VPCID,
+			SubnetID: subnetID,
+		},
+	})
+
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	err := recodeCLI.CreateCluster(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = recodeCLI.CreateDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		&entities.DevEnv{
+			Name:         "recode-sh-api",
+			InstanceType: "m6g.large",
+		},
+	)
+
+	expectedErr := service.ErrInstanceTypeNotOfferedInCluster{
+		InstanceType:      "m6g.large",
+		AvailabilityZones: []string{cloud.EC2.Region() + "a"},
+	}
+
+	if !reflect.DeepEqual(err, expectedErr) {
+		t.Fatalf("expected error to equal '%+v', got '%+v'", expectedErr, err)
+	}
+
+	if calls := cloud.EC2.Calls("CreateNetworkInterface"); calls != 0 {
+		t.Errorf("expected no network interface, got %d calls to CreateNetworkInterface", calls)
+	}
+}
+
+func TestCreateDevEnvResumesAfterPartialFailure(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	injectedErr := errors.New("injected error")
+	cloud.InstanceSSH.FailNext("LookupInitInstanceScriptResults", injectedErr)
+
+	err := cloud.AWSService().CreateDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		devEnv,
+	)
+
+	if !errors.Is(err, injectedErr) {
+		t.Fatalf("expected '%+v', got '%+v'", injectedErr, err)
+	}
+
+	err = cloud.AWSService().CreateDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		devEnv,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if calls := cloud.EC2.Calls("RunInstances"); calls != 1 {
+		t.Errorf("expected the instance to be created once, got %d calls", calls)
+	}
+
+	if count := cloud.EC2.ResourceCounts()["instance"]; count != 1 {
+		t.Errorf("expected one instance, got %d", count)
+	}
+}
+
+func TestCreateDevEnvWithCanceledContext(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cloud.EC2.BeforeCall("CreateNetworkInterface", cancel)
+
+	err := cloud.AWSService().CreateDevEnv(
+		ctx,
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		devEnv,
+	)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected '%+v', got '%+v'", context.Canceled, err)
+	}
+
+	var partialDevEnvInfra *service.DevEnvInfrastructure
+	err = json.Unmarshal([]byte(devEnv.InfrastructureJSON), &partialDevEnvInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if partialDevEnvInfra.SecurityGroup == nil || partialDevEnvInfra.KeyPair == nil ||
+		partialDevEnvInfra.NetworkInterface != nil {
+
+		t.Fatalf("expected partial dev env infrastructure, got '%s'", devEnv.InfrastructureJSON)
+	}
+
+	if calls := cloud.EC2.Calls("RunInstances"); calls != 0 {
+		t.Errorf("expected no instance to be created, got %d calls", calls)
+	}
+}
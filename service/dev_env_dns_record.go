@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// DefaultDNSRecordTTL represents the TTL (in seconds) of the
+// DNS records of the dev envs if DevEnvDNSOpts.TTL is not set.
+const DefaultDNSRecordTTL int64 = 60
+
+// DevEnvDNSOpts represents the options used to point
+// a predictable name to the dev envs (eg:
+// "<dev env>.<cluster>.dev.example.com").
+type DevEnvDNSOpts struct {
+	// HostedZoneID specifies the Route 53 hosted zone where
+	// the A (and AAAA) records of the dev envs are upserted
+	// on each create and start. Only applies to the dev envs
+	// created after it was set.
+	HostedZoneID string
+
+	// TTL specifies the TTL of the records (in seconds).
+	// Default to DefaultDNSRecordTTL if not set.
+	TTL int64
+}
+
+// devEnvDNSRecordName returns the name of the record of the
+// dev env in the passed zone (the slugs are valid DNS labels).
+func devEnvDNSRecordName(
+	clusterNameSlug string,
+	devEnvNameSlug string,
+	zoneName string,
+) string {
+
+	return strings.Join([]string{devEnvNameSlug, clusterNameSlug, zoneName}, ".")
+}
+
+// upsertDevEnvDNSRecord points the record of the dev env to the
+// current public addresses of its instance. The record is created
+// on first call if a hosted zone is set (and if the instance has a
+// public address: the dev envs of the private clusters don't).
+func (a *AWS) upsertDevEnvDNSRecord(
+	ctx context.Context,
+	devEnvInfra *DevEnvInfrastructure,
+	clusterNameSlug string,
+	devEnvNameSlug string,
+) error {
+
+	instance := devEnvInfra.Instance
+	hasPublicAddress := len(instance.PublicIPAddress) > 0 || len(instance.IPv6Address) > 0
+
+	if devEnvInfra.DNSRecord == nil {
+		DNSOpts := a.devEnvOpts.DNS
+
+		if len(DNSOpts.HostedZoneID) == 0 || !hasPublicAddress {
+			return nil
+		}
+
+		zoneName, err := infrastructure.LookupHostedZoneName(
+			ctx,
+			a.clients.Route53,
+			DNSOpts.HostedZoneID,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		TTL := DNSOpts.TTL
+
+		if TTL == 0 {
+			TTL = DefaultDNSRecordTTL
+		}
+
+		devEnvInfra.DNSRecord = &infrastructure.DNSRecord{
+			HostedZoneID: DNSOpts.HostedZoneID,
+			Name:         devEnvDNSRecordName(clusterNameSlug, devEnvNameSlug, zoneName),
+			TTL:          TTL,
+		}
+	}
+
+	return infrastructure.UpsertDNSRecord(
+		ctx,
+		a.clients.Route53,
+		devEnvInfra.DNSRecord,
+		instance.PublicIPAddress,
+		instance.IPv6Address,
+	)
+}
+
+// devEnvPublicHostname returns the name of the DNS
+// record of the dev env or the EC2 public hostname.
+func devEnvPublicHostname(devEnvInfra *DevEnvInfrastructure) string {
+	if devEnvInfra.DNSRecord != nil {
+		return devEnvInfra.DNSRecord.Name
+	}
+
+	return devEnvInfra.Instance.PublicHostname
+}
@@ -0,0 +1,153 @@
+package service_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+func TestDevEnvDNSRecordLifecycle(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	hostedZoneID := cloud.Route53.CreateHostedZone("dev.example.com")
+
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			DNS: service.DevEnvDNSOpts{
+				HostedZoneID: hostedZoneID,
+			},
+		},
+	})
+
+	devEnv, devEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+	recordName := "recode-sh-api." + cluster.GetNameSlug() + ".dev.example.com"
+
+	if devEnvInfra.DNSRecord == nil || len(devEnvInfra.DNSRecord.ChangeID) == 0 {
+		t.Fatalf("expected DNS record to be recorded, got '%s'", devEnv.InfrastructureJSON)
+	}
+
+	if devEnvInfra.DNSRecord.Name != recordName || devEnv.InstancePublicHostname != recordName {
+		t.Fatalf("expected record name '%s' as public hostname, got '%s'", recordName, devEnv.InstancePublicHostname)
+	}
+
+	values, _ := cloud.Route53.RecordValues(hostedZoneID, recordName, types.RRTypeA)
+	expectedValues := []string{devEnvInfra.Instance.PublicIPAddress}
+
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Fatalf("expected A record '%+v', got '%+v'", expectedValues, values)
+	}
+
+	err := recodeCLI.StopDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if count := cloud.Route53.RecordCount(); count != 0 {
+		t.Fatalf("expected DNS record to be removed on stop, got %d left", count)
+	}
+
+	err = recodeCLI.StartDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	devEnvInfra = unmarshalDevEnvInfra(t, devEnv)
+
+	values, _ = cloud.Route53.RecordValues(hostedZoneID, recordName, types.RRTypeA)
+	expectedValues = []string{devEnvInfra.Instance.PublicIPAddress}
+
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Fatalf("expected A record to be updated to '%+v', got '%+v'", expectedValues, values)
+	}
+
+	if devEnv.InstancePublicHostname != recordName {
+		t.Fatalf("expected record name to be kept as public hostname, got '%s'", devEnv.InstancePublicHostname)
+	}
+
+	err = recodeCLI.RemoveDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if count := cloud.Route53.RecordCount(); count != 0 {
+		t.Fatalf("expected DNS record to be removed, got %d left", count)
+	}
+}
+
+func TestStopDevEnvWithElasticIPKeepsDNSRecord(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	hostedZoneID := cloud.Route53.CreateHostedZone("dev.example.com")
+
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			ElasticIP: true,
+			DNS: service.DevEnvDNSOpts{
+				HostedZoneID: hostedZoneID,
+			},
+		},
+	})
+
+	devEnv, devEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+
+	err := recodeCLI.StopDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	values, _ := cloud.Route53.RecordValues(hostedZoneID, devEnvInfra.DNSRecord.Name, types.RRTypeA)
+	expectedValues := []string{devEnvInfra.ElasticIP.PublicIPAddress}
+
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Fatalf("expected A record '%+v' to be kept, got '%+v'", expectedValues, values)
+	}
+}
+
+func TestCreateDevEnvDNSRecordInDualStackCluster(t *testing.T) {
+	cloud := newFakeCloud(t)
+	hostedZoneID := cloud.Route53.CreateHostedZone("dev.example.com")
+
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: service.ClusterOpts{
+			IPv6: true,
+		},
+		DevEnv: service.DevEnvOpts{
+			DNS: service.DevEnvDNSOpts{
+				HostedZoneID: hostedZoneID,
+			},
+		},
+	})
+
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	err := recodeCLI.CreateCluster(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	_, devEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+	recordName := devEnvInfra.DNSRecord.Name
+
+	values, _ := cloud.Route53.RecordValues(hostedZoneID, recordName, types.RRTypeAaaa)
+	expectedValues := []string{devEnvInfra.DNSRecord.IPv6Address}
+
+	if len(devEnvInfra.DNSRecord.IPv6Address) == 0 || !reflect.DeepEqual(values, expectedValues) {
+		t.Fatalf("expected AAAA record '%+v', got '%+v'", expectedValues, values)
+	}
+
+	if _, ok := cloud.Route53.RecordValues(hostedZoneID, recordName, types.RRTypeA); !ok {
+		t.Fatalf("expected A record next to the AAAA record")
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/recode/entities"
+	"github.com/recode-sh/recode/stepper"
+)
+
+// ErrInvalidDevEnvIngressPort represents the error returned when an
+// extra ingress port of the dev envs is not valid (unknown protocol,
+// port out of range, no CIDR blocks or invalid CIDR block).
+type ErrInvalidDevEnvIngressPort struct {
+	Protocol  string
+	Port      int32
+	CIDRBlock string
+}
+
+func (ErrInvalidDevEnvIngressPort) Error() string {
+	return "ErrInvalidDevEnvIngressPort"
+}
+
+// DevEnvIngressPort represents an extra port accepted by the
+// dev envs from the passed IPv4 or IPv6 CIDR blocks.
+type DevEnvIngressPort struct {
+	// Protocol is either "tcp" or "udp"
+	Protocol   string
+	Port       int32
+	CIDRBlocks []string
+}
+
+// ingressRules validates the port and returns
+// the rules that let the CIDR blocks reach it.
+func (d DevEnvIngressPort) ingressRules() ([]infrastructure.SecurityGroupIngressRule, error) {
+	invalidPortErr := ErrInvalidDevEnvIngressPort{
+		Protocol: d.Protocol,
+		Port:     d.Port,
+	}
+
+	if d.Protocol != "tcp" && d.Protocol != "udp" {
+		return nil, invalidPortErr
+	}
+
+	if d.Port < 1 || d.Port > 65535 || len(d.CIDRBlocks) == 0 {
+		return nil, invalidPortErr
+	}
+
+	ingressRules := []infrastructure.SecurityGroupIngressRule{}
+
+	for _, CIDRBlock := range d.CIDRBlocks {
+		if !isCanonicalCIDRBlock(CIDRBlock) {
+			invalidPortErr.CIDRBlock = CIDRBlock
+			return nil, invalidPortErr
+		}
+
+		ingressRules = append(ingressRules, infrastructure.SecurityGroupIngressRule{
+			Protocol:  d.Protocol,
+			Port:      d.Port,
+			CIDRBlock: CIDRBlock,
+		})
+	}
+
+	return ingressRules, nil
+}
+
+// devEnvIngressRules returns the rules expected in the security group
+// of the dev envs: the SSH allowlist (except for the dev envs reached
+// through SSM) and the extra ingress ports set in DevEnvOpts.
+func (a *AWS) devEnvIngressRules(
+	ctx context.Context,
+	isPrivate bool,
+) ([]infrastructure.SecurityGroupIngressRule, error) {
+
+	ingressRules := []infrastructure.SecurityGroupIngressRule{}
+
+	if !isPrivate {
+		allowedCIDRBlocks, err := a.sshAllowedCIDRBlocks(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		SSHIngressRules, err := sshIngressRules(allowedCIDRBlocks)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ingressRules = append(ingressRules, SSHIngressRules...)
+	}
+
+	for _, ingressPort := range a.devEnvOpts.IngressPorts {
+		portIngressRules, err := ingressPort.ingressRules()
+
+		if err != nil {
+			return nil, err
+		}
+
+		ingressRules = append(ingressRules, portIngressRules...)
+	}
+
+	// An extra port may overlap the SSH allowlist
+	return diffIngressRules(ingressRules, nil), nil
+}
+
+// UpdateDevEnvIngress updates the ingress of the security group of the
+// dev env to match the SSH allowlist and the extra ingress ports set in
+// DevEnvOpts (without restarting the dev env). Only the rules recorded
+// by Recode are revoked (the ones added in the console are kept).
+func (a *AWS) UpdateDevEnvIngress(
+	ctx context.Context,
+	stepper stepper.Stepper,
+	config *entities.Config,
+	cluster *entities.Cluster,
+	devEnv *entities.DevEnv,
+) (returnedError error) {
+
+	lease, err := a.acquireDevEnvLease(ctx, cluster.GetNameSlug(), devEnv.GetNameSlug())
+
+	if err != nil {
+		return err
+	}
+
+	ctx = lease.ctx
+	defer func() { returnedError = a.releaseLease(lease, returnedError) }()
+
+	var devEnvInfra *DevEnvInfrastructure
+	err = json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+
+	if err != nil {
+		return err
+	}
+
+	stepper.StartTemporaryStep("Updating the ingress of the security group")
+
+	// The recorded ingress rules are
+	// updated even if the refresh fails
+	err = a.refreshIngress(ctx, devEnvInfra)
+	devEnv.SetInfrastructureJSON(devEnvInfra)
+
+	return err
+}
+
+// refreshIngress authorizes the expected rules in the security group
+// of the dev env then revokes the recorded rules that are not expected
+// anymore (so that the dev env stays reachable during the refresh).
+// The recorded rules are updated as the refresh goes (even in case of error).
+func (a *AWS) refreshIngress(
+	ctx context.Context,
+	devEnvInfra *DevEnvInfrastructure,
+) error {
+
+	// Dev env reached through SSM
+	isPrivate := devEnvInfra.InstanceProfile != nil
+	securityGroup := devEnvInfra.SecurityGroup
+
+	if securityGroup.IngressRules == nil {
+		legacyIngressRules := []infrastructure.SecurityGroupIngressRule{}
+
+		if !isPrivate {
+			SSHIngressRules, err := sshIngressRules(legacySSHAllowedCIDRBlocks)
+
+			if err != nil {
+				return err
+			}
+
+			legacyIngressRules = SSHIngressRules
+		}
+
+		securityGroup.IngressRules = legacyIngressRules
+	}
+
+	expectedIngressRules, err := a.devEnvIngressRules(ctx, isPrivate)
+
+	if err != nil {
+		return err
+	}
+
+	ingressRulesToAuthorize := diffIngressRules(expectedIngressRules, securityGroup.IngressRules)
+
+	err = infrastructure.AuthorizeSecurityGroupIngressRules(
+		ctx,
+		a.clients.EC2,
+		securityGroup.ID,
+		ingressRulesToAuthorize,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	securityGroup.IngressRules = append(securityGroup.IngressRules, ingressRulesToAuthorize...)
+
+	ingressRulesToRevoke := diffIngressRules(securityGroup.IngressRules, expectedIngressRules)
+
+	err = infrastructure.RevokeSecurityGroupIngressRules(
+		ctx,
+		a.clients.EC2,
+		securityGroup.ID,
+		ingressRulesToRevoke,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	securityGroup.IngressRules = diffIngressRules(securityGroup.IngressRules, ingressRulesToRevoke)
+
+	return nil
+}
+
+// diffIngressRules returns the (deduplicated) rules of a that are not in b.
+func diffIngressRules(
+	a []infrastructure.SecurityGroupIngressRule,
+	b []infrastructure.SecurityGroupIngressRule,
+) []infrastructure.SecurityGroupIngressRule {
+
+	skip := map[infrastructure.SecurityGroupIngressRule]bool{}
+
+	for _, ingressRule := range b {
+		skip[ingressRule] = true
+	}
+
+	diff := []infrastructure.SecurityGroupIngressRule{}
+
+	for _, ingressRule := range a {
+		if !skip[ingressRule] {
+			diff = append(diff, ingressRule)
+			skip[ingressRule] = true
+		}
+	}
+
+	return diff
+}
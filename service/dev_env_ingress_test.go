@@ -0,0 +1,218 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+// securityGroupIngress returns the (sorted) rules of the passed
+// security group formatted as "protocol/port/CIDR block".
+func securityGroupIngress(
+	t *testing.T,
+	fakeEC2 *fakes.EC2,
+	securityGroupID string,
+) []string {
+
+	t.Helper()
+
+	describeSecurityGroupsResp, err := fakeEC2.DescribeSecurityGroups(
+		context.Background(),
+		&ec2.DescribeSecurityGroupsInput{
+			GroupIds: []string{securityGroupID},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	ingress := []string{}
+
+	for _, IPPermission := range describeSecurityGroupsResp.SecurityGroups[0].IpPermissions {
+		CIDRBlocks := []string{}
+
+		for _, IPRange := range IPPermission.IpRanges {
+			CIDRBlocks = append(CIDRBlocks, aws.ToString(IPRange.CidrIp))
+		}
+
+		for _, IPv6Range := range IPPermission.Ipv6Ranges {
+			CIDRBlocks = append(CIDRBlocks, aws.ToString(IPv6Range.CidrIpv6))
+		}
+
+		for _, CIDRBlock := range CIDRBlocks {
+			ingress = append(ingress, fmt.Sprintf(
+				"%s/%d/%s",
+				aws.ToString(IPPermission.IpProtocol),
+				aws.ToInt32(IPPermission.FromPort),
+				CIDRBlock,
+			))
+		}
+	}
+
+	sort.Strings(ingress)
+
+	return ingress
+}
+
+func TestUpdateDevEnvIngress(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			IngressPorts: []service.DevEnvIngressPort{
+				{Protocol: "tcp", Port: 3000, CIDRBlocks: []string{"192.0.2.0/24"}},
+				{Protocol: "udp", Port: 4000, CIDRBlocks: []string{"2001:db8::/32"}},
+			},
+		},
+	})
+
+	devEnv, devEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+
+	ingress := securityGroupIngress(t, cloud.EC2, devEnvInfra.SecurityGroup.ID)
+	expectedIngress := []string{
+		"tcp/2200/203.0.113.10/32",
+		"tcp/3000/192.0.2.0/24",
+		"udp/4000/2001:db8::/32",
+	}
+
+	if !reflect.DeepEqual(ingress, expectedIngress) {
+		t.Fatalf("expected ingress '%+v', got '%+v'", expectedIngress, ingress)
+	}
+
+	// Rule added outside of Recode (must be kept)
+	_, err := cloud.EC2.AuthorizeSecurityGroupIngress(
+		context.Background(),
+		&ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId: aws.String(devEnvInfra.SecurityGroup.ID),
+			IpPermissions: []types.IpPermission{{
+				IpProtocol: aws.String("tcp"),
+				FromPort:   aws.Int32(8080),
+				ToPort:     aws.Int32(8080),
+				IpRanges:   []types.IpRange{{CidrIp: aws.String("198.51.100.0/24")}},
+			}},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	recodeCLI = cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			IngressPorts: []service.DevEnvIngressPort{
+				{Protocol: "tcp", Port: 3000, CIDRBlocks: []string{"192.0.2.0/24", "198.51.100.0/24"}},
+			},
+		},
+	})
+
+	err = recodeCLI.UpdateDevEnvIngress(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		devEnv,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	ingress = securityGroupIngress(t, cloud.EC2, devEnvInfra.SecurityGroup.ID)
+	expectedIngress = []string{
+		"tcp/2200/203.0.113.10/32",
+		"tcp/3000/192.0.2.0/24",
+		"tcp/3000/198.51.100.0/24",
+		"tcp/8080/198.51.100.0/24",
+	}
+
+	if !reflect.DeepEqual(ingress, expectedIngress) {
+		t.Fatalf("expected ingress '%+v', got '%+v'", expectedIngress, ingress)
+	}
+
+	devEnvInfra = restartDevEnvInFakeCloud(t, cloud.AWSService(), cluster, devEnv)
+
+	ingress = securityGroupIngress(t, cloud.EC2, devEnvInfra.SecurityGroup.ID)
+	expectedIngress = []string{
+		"tcp/2200/203.0.113.10/32",
+		"tcp/8080/198.51.100.0/24",
+	}
+
+	if !reflect.DeepEqual(ingress, expectedIngress) {
+		t.Fatalf("expected extra ports to be revoked on start, got '%+v'", ingress)
+	}
+
+	if len(devEnvInfra.SecurityGroup.IngressRules) != 1 {
+		t.Fatalf("expected only the SSH rule to be recorded, got '%+v'", devEnvInfra.SecurityGroup.IngressRules)
+	}
+}
+
+func TestCreateDevEnvWithInvalidIngressPort(t *testing.T) {
+	testCases := []struct {
+		test        string
+		ingressPort service.DevEnvIngressPort
+		expectedErr error
+	}{
+		{
+			test:        "with unknown protocol",
+			ingressPort: service.DevEnvIngressPort{Protocol: "icmp", Port: 3000, CIDRBlocks: []string{"192.0.2.0/24"}},
+			expectedErr: service.ErrInvalidDevEnvIngressPort{Protocol: "icmp", Port: 3000},
+		},
+
+		{
+			test:        "with port out of range",
+			ingressPort: service.DevEnvIngressPort{Protocol: "tcp", Port: 70000, CIDRBlocks: []string{"192.0.2.0/24"}},
+			expectedErr: service.ErrInvalidDevEnvIngressPort{Protocol: "tcp", Port: 70000},
+		},
+
+		{
+			test:        "without CIDR blocks",
+			ingressPort: service.DevEnvIngressPort{Protocol: "udp", Port: 3000},
+			expectedErr: service.ErrInvalidDevEnvIngressPort{Protocol: "udp", Port: 3000},
+		},
+
+		{
+			test:        "with invalid CIDR block",
+			ingressPort: service.DevEnvIngressPort{Protocol: "tcp", Port: 3000, CIDRBlocks: []string{"192.0.2.1/24"}},
+			expectedErr: service.ErrInvalidDevEnvIngressPort{Protocol: "tcp", Port: 3000, CIDRBlock: "192.0.2.1/24"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			cloud := newFakeCloud(t)
+			cluster := createClusterInFakeCloud(t, cloud)
+			recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+				DevEnv: service.DevEnvOpts{
+					IngressPorts: []service.DevEnvIngressPort{tc.ingressPort},
+				},
+			})
+
+			err := recodeCLI.CreateDevEnv(
+				context.Background(),
+				&fakes.Stepper{},
+				&entities.Config{},
+				cluster,
+				&entities.DevEnv{
+					Name:         "recode-sh-api",
+					InstanceType: "t2.medium",
+				},
+			)
+
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected error '%+v', got '%+v'", tc.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+// DevEnvOpts represents the options
+// used to configure the dev envs.
+type DevEnvOpts struct {
+	// SSHAllowedCIDRBlocks specifies the IPv4 or IPv6 CIDR blocks
+	// allowed to reach the SSH server of the dev envs. The rules are
+	// refreshed each time a dev env is started. Default to the public
+	// IP address of the caller (looked up on each create and start).
+	SSHAllowedCIDRBlocks []string
+
+	// IngressPorts specifies the extra TCP or UDP ports
+	// accepted by the dev envs (eg: to share a web server
+	// with a teammate). Applied on creation and updated on
+	// each start (see AWS.UpdateDevEnvIngress).
+	IngressPorts []DevEnvIngressPort
+
+	// ElasticIP enables the allocation of an Elastic IP per dev env
+	// (associated with its network interface) so that the public IP
+	// address stays the same across restarts. Only applies to the dev
+	// envs created after it was set (not supported in private clusters).
+	ElasticIP bool
+
+	// DNS specifies the Route 53 hosted zone where
+	// the dev envs get a record (disabled if not set).
+	DNS DevEnvDNSOpts
+
+	// Spot enables the launch of the dev envs as spot instances
+	// (persistent request stopped on interruption). A dev env that
+	// could not be started for lack of spot capacity is moved to an
+	// on-demand instance (keeping its root volume). Only applies to
+	// the dev envs created after it was set.
+	Spot bool
+
+	// SpotMaxPrice specifies the maximum hourly price in USD
+	// of the spot instances (eg: "0.05"). Default to the
+	// on-demand price of the instance type.
+	SpotMaxPrice string
+}
@@ -0,0 +1,103 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+func TestDevEnvWithElasticIPLifecycle(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			ElasticIP: true,
+		},
+	})
+
+	devEnv, devEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+	elasticIP := devEnvInfra.ElasticIP
+
+	if elasticIP == nil || len(elasticIP.AssociationID) == 0 {
+		t.Fatalf("expected associated Elastic IP to be recorded, got '%s'", devEnv.InfrastructureJSON)
+	}
+
+	associatedIPAddress, ok := cloud.EC2.ElasticIPAssociatedWith(devEnvInfra.NetworkInterface.ID)
+
+	if !ok || associatedIPAddress != elasticIP.PublicIPAddress {
+		t.Fatalf("expected Elastic IP to be associated with the network interface, got '%s'", associatedIPAddress)
+	}
+
+	if devEnv.InstancePublicIPAddress != elasticIP.PublicIPAddress {
+		t.Fatalf("expected Elastic IP as public IP, got '%s'", devEnv.InstancePublicIPAddress)
+	}
+
+	devEnvInfra = restartDevEnvInFakeCloud(t, recodeCLI, cluster, devEnv)
+
+	if devEnvInfra.Instance.PublicIPAddress != elasticIP.PublicIPAddress ||
+		devEnv.InstancePublicIPAddress != elasticIP.PublicIPAddress {
+
+		t.Fatalf("expected public IP to be kept across restarts, got '%s'", devEnvInfra.Instance.PublicIPAddress)
+	}
+
+	err := recodeCLI.RemoveDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if count := cloud.EC2.ResourceCounts()["elastic-ip"]; count != 0 {
+		t.Fatalf("expected Elastic IP to be released, got %d left", count)
+	}
+
+	err = recodeCLI.RemoveCluster(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	assertNoResourceLeft(t, cloud.EC2)
+}
+
+func TestCreateDevEnvWithElasticIPInPrivateCluster(t *testing.T) {
+	cloud := newFakeCloud(t)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: privateClusterOpts(t, cloud.EC2),
+		DevEnv: service.DevEnvOpts{
+			ElasticIP: true,
+		},
+	})
+
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	err := recodeCLI.CreateCluster(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = recodeCLI.CreateDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		&entities.DevEnv{
+			Name:         "recode-sh-api",
+			InstanceType: "t2.medium",
+		},
+	)
+
+	if !errors.As(err, &service.ErrElasticIPInPrivateCluster{}) {
+		t.Fatalf("expected ErrElasticIPInPrivateCluster, got '%+v'", err)
+	}
+
+	if count := cloud.EC2.ResourceCounts()["elastic-ip"]; count != 0 {
+		t.Fatalf("expected no Elastic IP to be allocated, got %d", count)
+	}
+}
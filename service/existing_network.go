@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/recode/entities"
+	"github.com/recode-sh/recode/stepper"
+)
+
+// ErrIncompleteExistingNetwork represents the error returned
+// when only one of ClusterOpts.VPCID and ClusterOpts.SubnetID is set.
+type ErrIncompleteExistingNetwork struct {
+	VPCID    string
+	SubnetID string
+}
+
+func (ErrIncompleteExistingNetwork) Error() string {
+	return "ErrIncompleteExistingNetwork"
+}
+
+// ErrExistingVPCNotFound represents the error returned
+// when the VPC set in ClusterOpts doesn't exist.
+type ErrExistingVPCNotFound struct {
+	VPCID string
+}
+
+func (ErrExistingVPCNotFound) Error() string {
+	return "ErrExistingVPCNotFound"
+}
+
+// ErrExistingSubnetNotFound represents the error returned
+// when the subnet set in ClusterOpts doesn't exist.
+type ErrExistingSubnetNotFound struct {
+	SubnetID string
+}
+
+func (ErrExistingSubnetNotFound) Error() string {
+	return "ErrExistingSubnetNotFound"
+}
+
+// ErrExistingSubnetNotInVPC represents the error returned when
+// the subnet set in ClusterOpts doesn't belong to the VPC.
+type ErrExistingSubnetNotInVPC struct {
+	SubnetID string
+	VPCID    string
+}
+
+func (ErrExistingSubnetNotInVPC) Error() string {
+	return "ErrExistingSubnetNotInVPC"
+}
+
+// ErrExistingSubnetNotRoutable represents the error returned when
+// the route table of the subnet set in ClusterOpts doesn't have
+// any default route to an internet gateway or to a NAT gateway.
+type ErrExistingSubnetNotRoutable struct {
+	SubnetID string
+}
+
+func (ErrExistingSubnetNotRoutable) Error() string {
+	return "ErrExistingSubnetNotRoutable"
+}
+
+// ErrExistingSubnetWithoutPublicIPs represents the error returned
+// when the subnet set in ClusterOpts can't give a public IP to the
+// dev envs that need one: it is routed to a NAT gateway outside of
+// private mode (the dev envs would not be reachable) or it is routed
+// to an internet gateway but doesn't map public IPs on launch
+// (the dev envs could not reach internet, even in private mode).
+type ErrExistingSubnetWithoutPublicIPs struct {
+	SubnetID string
+}
+
+func (ErrExistingSubnetWithoutPublicIPs) Error() string {
+	return "ErrExistingSubnetWithoutPublicIPs"
+}
+
+// ErrPrivateClusterWithoutExistingNetwork represents the error
+// returned when ClusterOpts.Private is set without ClusterOpts.VPCID
+// and ClusterOpts.SubnetID. The instances of the private clusters
+// don't have any public IP so they could only reach internet (to
+// run their init script) through the NAT gateway of an existing subnet.
+type ErrPrivateClusterWithoutExistingNetwork struct{}
+
+func (ErrPrivateClusterWithoutExistingNetwork) Error() string {
+	return "ErrPrivateClusterWithoutExistingNetwork"
+}
+
+// usesExistingNetwork returns true if the clusters
+// are created in an existing VPC and subnet.
+func (c ClusterOpts) usesExistingNetwork() bool {
+	return len(c.VPCID) > 0 || len(c.SubnetID) > 0
+}
+
+// isInExistingNetwork returns true if the cluster
+// was created in an existing VPC and subnet.
+func (c *ClusterInfrastructure) isInExistingNetwork() bool {
+	return c.VPC != nil && c.VPC.IsAdopted
+}
+
+// createClusterPermissionsMethods returns the entries of the IAM
+// permissions catalog matching the way the cluster is created.
+func (a *AWS) createClusterPermissionsMethods(cluster *entities.Cluster) []string {
+	clusterInfra := &ClusterInfrastructure{}
+
+	if len(cluster.InfrastructureJSON) > 0 {
+		_ = json.Unmarshal([]byte(cluster.InfrastructureJSON), clusterInfra)
+	}
+
+	methods := []string{"CreateCluster"}
+
+	if clusterInfra.isInExistingNetwork() ||
+		(clusterInfra.VPC == nil && a.clusterOpts.usesExistingNetwork()) {
+
+		methods = []string{"CreateClusterInExistingNetwork"}
+	} else if a.clusterOpts.GatewayEndpoints {
+		methods = append(methods, "CreateClusterGatewayEndpoints")
+	}
+
+	if clusterInfra.IsPrivate || (clusterInfra.VPC == nil && a.clusterOpts.Private) {
+		methods = append(methods, "CreateClusterPrivateMode")
+	}
+
+	return methods
+}
+
+// adoptExistingNetwork records the VPC and the subnet set in
+// ClusterOpts as adopted in the cluster infrastructure once
+// validated. The subnet must either be routed to an internet
+// gateway and map public IPs on launch (except in private mode)
+// or be routed to a NAT gateway.
+func (a *AWS) adoptExistingNetwork(
+	ctx context.Context,
+	stepper stepper.Stepper,
+	clusterInfra *ClusterInfrastructure,
+) error {
+
+	VPCID := a.clusterOpts.VPCID
+	subnetID := a.clusterOpts.SubnetID
+
+	if len(VPCID) == 0 || len(subnetID) == 0 {
+		return ErrIncompleteExistingNetwork{
+			VPCID:    VPCID,
+			SubnetID: subnetID,
+		}
+	}
+
+	stepper.StartTemporaryStep("Checking the existing VPC and subnet")
+
+	existingNetwork, err := infrastructure.LookupExistingNetwork(
+		ctx,
+		a.clients.EC2,
+		VPCID,
+		subnetID,
+	)
+
+	if errors.Is(err, infrastructure.ErrVPCNotFound) {
+		return ErrExistingVPCNotFound{
+			VPCID: VPCID,
+		}
+	}
+
+	if errors.Is(err, infrastructure.ErrSubnetNotFound) {
+		return ErrExistingSubnetNotFound{
+			SubnetID: subnetID,
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if existingNetwork.SubnetVPCID != VPCID {
+		return ErrExistingSubnetNotInVPC{
+			SubnetID: subnetID,
+			VPCID:    VPCID,
+		}
+	}
+
+	switch existingNetwork.DefaultRouteTarget {
+	case infrastructure.DefaultRouteTargetNATGateway:
+		// The dev envs are only reachable through SSM
+		if !clusterInfra.IsPrivate {
+			return ErrExistingSubnetWithoutPublicIPs{
+				SubnetID: subnetID,
+			}
+		}
+	case infrastructure.DefaultRouteTargetInternetGateway:
+		// The instances need a public IP to reach internet
+		// (even in private mode, where it is not used for SSH)
+		if !existingNetwork.MapPublicIPOnLaunch {
+			return ErrExistingSubnetWithoutPublicIPs{
+				SubnetID: subnetID,
+			}
+		}
+	default:
+		return ErrExistingSubnetNotRoutable{
+			SubnetID: subnetID,
+		}
+	}
+
+	clusterInfra.VPCCIDRBlock = existingNetwork.VPCCIDRBlock
+	clusterInfra.SubnetCIDRBlock = existingNetwork.SubnetCIDRBlock
+
+	clusterInfra.VPC = &infrastructure.VPC{
+		ID:        VPCID,
+		IsAdopted: true,
+	}
+
+	clusterInfra.Subnets = []*infrastructure.Subnet{{
+		ID:               subnetID,
+		AvailabilityZone: existingNetwork.AvailabilityZone,
+		CIDRBlock:        existingNetwork.SubnetCIDRBlock,
+		IsAdopted:        true,
+	}}
+
+	return nil
+}
@@ -0,0 +1,457 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/aws-cloud-provider/userconfig"
+	"github.com/recode-sh/recode/entities"
+)
+
+type existingNetworkOpts struct {
+	// "internet-gateway", "nat-gateway" or "" for no default route
+	defaultRoute        string
+	mapPublicIPOnLaunch bool
+	// Use the main route table of the VPC
+	// instead of an explicit association
+	mainRouteTable bool
+	// Required by the endpoints of the private clusters
+	enableDNSHostnames bool
+}
+
+// createExistingNetwork creates a VPC and a subnet
+// like a platform team would and returns their IDs.
+func createExistingNetwork(
+	t *testing.T,
+	fakeEC2 *fakes.EC2,
+	opts existingNetworkOpts,
+) (string, string) {
+
+	t.Helper()
+
+	ctx := context.Background()
+
+	createVPCResp, err := fakeEC2.CreateVpc(ctx, &ec2.CreateVpcInput{
+		CidrBlock: aws.String("172.31.0.0/16"),
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	VPCID := aws.ToString(createVPCResp.Vpc.VpcId)
+
+	if opts.enableDNSHostnames {
+		_, err := fakeEC2.ModifyVpcAttribute(ctx, &ec2.ModifyVpcAttributeInput{
+			VpcId:              aws.String(VPCID),
+			EnableDnsHostnames: &types.AttributeBooleanValue{Value: aws.Bool(true)},
+		})
+
+		if err != nil {
+			t.Fatalf("expected no error, got '%+v'", err)
+		}
+	}
+
+	createSubnetResp, err := fakeEC2.CreateSubnet(ctx, &ec2.CreateSubnetInput{
+		CidrBlock: aws.String("172.31.16.0/20"),
+		VpcId:     aws.String(VPCID),
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	subnetID := aws.ToString(createSubnetResp.Subnet.SubnetId)
+
+	_, err = fakeEC2.ModifySubnetAttribute(ctx, &ec2.ModifySubnetAttributeInput{
+		SubnetId:            aws.String(subnetID),
+		MapPublicIpOnLaunch: &types.AttributeBooleanValue{Value: aws.Bool(opts.mapPublicIPOnLaunch)},
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	createRouteTableResp, err := fakeEC2.CreateRouteTable(ctx, &ec2.CreateRouteTableInput{
+		VpcId: aws.String(VPCID),
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	routeTableID := aws.ToString(createRouteTableResp.RouteTable.RouteTableId)
+	createRouteInput := &ec2.CreateRouteInput{
+		DestinationCidrBlock: aws.String("0.0.0.0/0"),
+		RouteTableId:         aws.String(routeTableID),
+	}
+
+	switch opts.defaultRoute {
+	case "internet-gateway":
+		createInternetGatewayResp, err := fakeEC2.CreateInternetGateway(ctx, &ec2.CreateInternetGatewayInput{})
+
+		if err != nil {
+			t.Fatalf("expected no error, got '%+v'", err)
+		}
+
+		createRouteInput.GatewayId = createInternetGatewayResp.InternetGateway.InternetGatewayId
+
+		_, err = fakeEC2.AttachInternetGateway(ctx, &ec2.AttachInternetGatewayInput{
+			InternetGatewayId: createRouteInput.GatewayId,
+			VpcId:             aws.String(VPCID),
+		})
+
+		if err != nil {
+			t.Fatalf("expected no error, got '%+v'", err)
+		}
+	case "nat-gateway":
+		createRouteInput.NatGatewayId = aws.String("nat-0123456789abcdef0")
+	}
+
+	if len(opts.defaultRoute) > 0 {
+		if _, err := fakeEC2.CreateRoute(ctx, createRouteInput); err != nil {
+			t.Fatalf("expected no error, got '%+v'", err)
+		}
+	}
+
+	if opts.mainRouteTable {
+		err = fakeEC2.SetMainRouteTable(routeTableID)
+	} else {
+		_, err = fakeEC2.AssociateRouteTable(ctx, &ec2.AssociateRouteTableInput{
+			RouteTableId: aws.String(routeTableID),
+			SubnetId:     aws.String(subnetID),
+		})
+	}
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	return VPCID, subnetID
+}
+
+func TestCreateClusterInExistingNetwork(t *testing.T) {
+	testCases := []struct {
+		test            string
+		network         existingNetworkOpts
+		VPCID           string
+		subnetID        string
+		useOtherSubnet  bool
+		private         bool
+		expectedErrorFn func(VPCID, subnetID string) error
+	}{
+		{
+			test: "public subnet",
+			network: existingNetworkOpts{
+				defaultRoute:        "internet-gateway",
+				mapPublicIPOnLaunch: true,
+			},
+		},
+
+		{
+			test: "public subnet using the main route table",
+			network: existingNetworkOpts{
+				defaultRoute:        "internet-gateway",
+				mapPublicIPOnLaunch: true,
+				mainRouteTable:      true,
+			},
+		},
+
+		{
+			test: "private subnet with NAT gateway outside private mode",
+			network: existingNetworkOpts{
+				defaultRoute: "nat-gateway",
+			},
+			expectedErrorFn: func(VPCID, subnetID string) error {
+				return service.ErrExistingSubnetWithoutPublicIPs{SubnetID: subnetID}
+			},
+		},
+
+		{
+			test: "public subnet without public IPs",
+			network: existingNetworkOpts{
+				defaultRoute: "internet-gateway",
+			},
+			expectedErrorFn: func(VPCID, subnetID string) error {
+				return service.ErrExistingSubnetWithoutPublicIPs{SubnetID: subnetID}
+			},
+		},
+
+		{
+			test: "public subnet without public IPs in private mode",
+			network: existingNetworkOpts{
+				defaultRoute:       "internet-gateway",
+				enableDNSHostnames: true,
+			},
+			private: true,
+			expectedErrorFn: func(VPCID, subnetID string) error {
+				return service.ErrExistingSubnetWithoutPublicIPs{SubnetID: subnetID}
+			},
+		},
+
+		{
+			test: "subnet without default route",
+			network: existingNetworkOpts{
+				mapPublicIPOnLaunch: true,
+			},
+			expectedErrorFn: func(VPCID, subnetID string) error {
+				return service.ErrExistingSubnetNotRoutable{SubnetID: subnetID}
+			},
+		},
+
+		{
+			test:     "unknown VPC",
+			VPCID:    "vpc-unknown",
+			subnetID: "subnet-unknown",
+			expectedErrorFn: func(VPCID, subnetID string) error {
+				return service.ErrExistingVPCNotFound{VPCID: "vpc-unknown"}
+			},
+		},
+
+		{
+			test:     "unknown subnet",
+			subnetID: "subnet-unknown",
+			expectedErrorFn: func(VPCID, subnetID string) error {
+				return service.ErrExistingSubnetNotFound{SubnetID: "subnet-unknown"}
+			},
+		},
+
+		{
+			test: "subnet in another VPC",
+			network: existingNetworkOpts{
+				defaultRoute:        "internet-gateway",
+				mapPublicIPOnLaunch: true,
+			},
+			useOtherSubnet: true,
+			expectedErrorFn: func(VPCID, subnetID string) error {
+				return service.ErrExistingSubnetNotInVPC{SubnetID: subnetID, VPCID: VPCID}
+			},
+		},
+
+		{
+			test: "VPC without subnet",
+			network: existingNetworkOpts{
+				defaultRoute:        "internet-gateway",
+				mapPublicIPOnLaunch: true,
+			},
+			subnetID: "-",
+			expectedErrorFn: func(VPCID, subnetID string) error {
+				return service.ErrIncompleteExistingNetwork{VPCID: VPCID}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			cloud := newFakeCloud(t)
+			VPCID, subnetID := createExistingNetwork(t, cloud.EC2, tc.network)
+
+			if tc.useOtherSubnet {
+				_, subnetID = createExistingNetwork(t, cloud.EC2, tc.network)
+			}
+
+			if len(tc.VPCID) > 0 {
+				VPCID = tc.VPCID
+			}
+
+			if tc.subnetID == "-" {
+				subnetID = ""
+			} else if len(tc.subnetID) > 0 {
+				subnetID = tc.subnetID
+			}
+
+			resourceCountsBefore := cloud.EC2.ResourceCounts()
+			cluster := &entities.Cluster{
+				Name: entities.DefaultClusterName,
+			}
+
+			err := cloud.AWSServiceWithOpts(service.AWSOpts{
+				Cluster: service.ClusterOpts{
+					VPCID:    VPCID,
+					SubnetID: subnetID,
+					Private:  tc.private,
+				},
+			}).CreateCluster(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster)
+
+			// Nothing is created in an existing network
+			if resourceCounts := cloud.EC2.ResourceCounts(); !reflect.DeepEqual(resourceCounts, resourceCountsBefore) {
+				t.Fatalf("expected resources to equal '%+v', got '%+v'", resourceCountsBefore, resourceCounts)
+			}
+
+			if tc.expectedErrorFn != nil {
+				expectedError := tc.expectedErrorFn(VPCID, subnetID)
+
+				if !reflect.DeepEqual(err, expectedError) {
+					t.Fatalf("expected error to equal '%+v', got '%+v'", expectedError, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			var clusterInfra *service.ClusterInfrastructure
+			err = json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if clusterInfra.VPC == nil || clusterInfra.VPC.ID != VPCID || !clusterInfra.VPC.IsAdopted ||
+				len(clusterInfra.Subnets) != 1 || clusterInfra.Subnets[0].ID != subnetID ||
+				!clusterInfra.Subnets[0].IsAdopted {
+
+				t.Fatalf("expected VPC and subnet to be adopted, got '%s'", cluster.InfrastructureJSON)
+			}
+
+			if clusterInfra.VPCCIDRBlock != "172.31.0.0/16" ||
+				clusterInfra.SubnetCIDRBlock != "172.31.16.0/20" ||
+				len(clusterInfra.Subnets[0].AvailabilityZone) == 0 {
+
+				t.Fatalf("expected existing CIDR blocks and AZ to be recorded, got '%s'", cluster.InfrastructureJSON)
+			}
+
+			if clusterInfra.InternetGateway != nil || clusterInfra.RouteTable != nil || clusterInfra.Route != nil {
+				t.Fatalf("expected nothing else to be recorded, got '%s'", cluster.InfrastructureJSON)
+			}
+		})
+	}
+}
+
+func TestRemoveClusterKeepsExistingNetwork(t *testing.T) {
+	cloud := newFakeCloud(t)
+	VPCID, subnetID := createExistingNetwork(t, cloud.EC2, existingNetworkOpts{
+		defaultRoute:        "internet-gateway",
+		mapPublicIPOnLaunch: true,
+	})
+
+	resourceCountsBefore := cloud.EC2.ResourceCounts()
+
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: service.ClusterOpts{
+			VPCID:    VPCID,
+			SubnetID: subnetID,
+		},
+	})
+
+	ctx := context.Background()
+	stepper := &fakes.Stepper{}
+	config := &entities.Config{}
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	permissions, err := service.LookupIAMPermissions("CreateClusterInExistingNetwork")
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	catalogedActions := map[string]bool{}
+
+	for _, action := range permissions.Actions(userconfig.ConfigStorageBackendDynamoDB, false) {
+		catalogedActions[action] = true
+	}
+
+	callsBefore := calledActions(cloud)
+
+	if err := recodeCLI.CreateCluster(ctx, stepper, config, cluster); err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	for action, calls := range calledActions(cloud) {
+		if calls > callsBefore[action] && !catalogedActions[action] {
+			t.Errorf("expected %s to be listed in the permissions of CreateClusterInExistingNetwork", action)
+		}
+	}
+
+	if err := recodeCLI.CreateDevEnv(ctx, stepper, config, cluster, devEnv); err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if err := recodeCLI.RemoveDevEnv(ctx, stepper, config, cluster, devEnv); err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if err := recodeCLI.RemoveCluster(ctx, stepper, config, cluster); err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if resourceCounts := cloud.EC2.ResourceCounts(); !reflect.DeepEqual(resourceCounts, resourceCountsBefore) {
+		t.Fatalf("expected resources to equal '%+v', got '%+v'", resourceCountsBefore, resourceCounts)
+	}
+
+	for _, operation := range []string{"DeleteVpc", "DeleteSubnet", "DeleteRouteTable", "DeleteInternetGateway"} {
+		if cloud.EC2.Calls(operation) != 0 {
+			t.Errorf("expected no call to %s, got %d", operation, cloud.EC2.Calls(operation))
+		}
+	}
+}
+
+func TestCreateDevEnvWithoutPublicIP(t *testing.T) {
+	cloud := newFakeCloud(t)
+	VPCID, subnetID := createExistingNetwork(t, cloud.EC2, existingNetworkOpts{
+		defaultRoute:        "internet-gateway",
+		mapPublicIPOnLaunch: true,
+	})
+
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: service.ClusterOpts{
+			VPCID:    VPCID,
+			SubnetID: subnetID,
+		},
+	})
+
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	err := recodeCLI.CreateCluster(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	// Changed by the platform team after the cluster was created
+	_, err = cloud.EC2.ModifySubnetAttribute(context.Background(), &ec2.ModifySubnetAttributeInput{
+		SubnetId:            aws.String(subnetID),
+		MapPublicIpOnLaunch: &types.AttributeBooleanValue{Value: aws.Bool(false)},
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	err = recodeCLI.CreateDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	var devEnvWithoutPublicIPErr service.ErrDevEnvWithoutPublicIP
+
+	if !errors.As(err, &devEnvWithoutPublicIPErr) || len(devEnvWithoutPublicIPErr.InstanceID) == 0 {
+		t.Fatalf("expected dev env without public IP error, got '%+v'", err)
+	}
+
+	// Failed without waiting for SSH
+	if calls := cloud.InstanceSSH.Calls("LookupInitInstanceScriptResults"); calls != 0 {
+		t.Errorf("expected no SSH connection, got %d", calls)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/recode/queues"
+	"github.com/recode-sh/recode/stepper"
+)
+
+// The services reached via the gateway endpoints
+// of the clusters (see ClusterOpts).
+var gatewayVPCEndpointServices = []string{
+	"s3",
+	"dynamodb",
+}
+
+// createGatewayEndpointsSteps returns the steps that create the
+// S3 and DynamoDB gateway endpoints of the clusters, attached to
+// their route table (none if disabled in ClusterOpts). They
+// must be run once the route table is created.
+func (a *AWS) createGatewayEndpointsSteps(
+	ctx context.Context,
+	stepper stepper.Stepper,
+	prefixResource func(string) string,
+) []queues.InfrastructureQueueSteps[*ClusterInfrastructure] {
+
+	if !a.clusterOpts.GatewayEndpoints {
+		return nil
+	}
+
+	ec2Client := a.clients.EC2
+
+	createGatewayEndpoints := func(infra *ClusterInfrastructure) error {
+		for _, service := range gatewayVPCEndpointServices {
+			serviceName := vpcEndpointServiceName(a.sdkConfig.Region, service)
+
+			if infra.vpcEndpoint(serviceName) != nil {
+				continue
+			}
+
+			VPCEndpoint, err := infrastructure.CreateGatewayVPCEndpoint(
+				ctx,
+				ec2Client,
+				prefixResource(service+"-endpoint"),
+				infra.VPC.ID,
+				serviceName,
+				[]string{infra.RouteTable.ID},
+			)
+
+			if err != nil {
+				return err
+			}
+
+			infra.GatewayVPCEndpoints = append(infra.GatewayVPCEndpoints, VPCEndpoint)
+		}
+
+		return nil
+	}
+
+	return []queues.InfrastructureQueueSteps[*ClusterInfrastructure]{
+		{
+			func(*ClusterInfrastructure) error {
+				stepper.StartTemporaryStep("Creating the VPC endpoints for S3 and DynamoDB")
+				return nil
+			},
+			createGatewayEndpoints,
+		},
+	}
+}
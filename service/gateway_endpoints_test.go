@@ -0,0 +1,85 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+func TestClusterWithGatewayEndpointsLifecycle(t *testing.T) {
+	cloud := newFakeCloud(t)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: service.ClusterOpts{
+			GatewayEndpoints: true,
+		},
+	})
+
+	ctx := context.Background()
+	config := &entities.Config{}
+
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	err := recodeCLI.CreateCluster(ctx, &fakes.Stepper{}, config, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	var clusterInfra *service.ClusterInfrastructure
+	err = json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(clusterInfra.GatewayVPCEndpoints) != 2 {
+		t.Fatalf("expected two gateway endpoints, got '%s'", cluster.InfrastructureJSON)
+	}
+
+	for _, service := range []string{"s3", "dynamodb"} {
+		if !cloud.EC2.HasGatewayVPCEndpointRoute(clusterInfra.RouteTable.ID, service) {
+			t.Errorf("expected route table to route %s via a gateway endpoint", service)
+		}
+	}
+
+	// Dev envs keep working with the endpoints
+	devEnv, _ := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+
+	err = recodeCLI.RemoveDevEnv(ctx, &fakes.Stepper{}, config, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = recodeCLI.RemoveCluster(ctx, &fakes.Stepper{}, config, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	assertNoResourceLeft(t, cloud.EC2)
+}
+
+func TestCreateClusterWithoutGatewayEndpoints(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+
+	var clusterInfra *service.ClusterInfrastructure
+	err := json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(clusterInfra.GatewayVPCEndpoints) > 0 ||
+		cloud.EC2.HasGatewayVPCEndpointRoute(clusterInfra.RouteTable.ID, "s3") {
+
+		t.Fatalf("expected no gateway endpoint, got '%s'", cluster.InfrastructureJSON)
+	}
+}
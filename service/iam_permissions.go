@@ -0,0 +1,590 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/recode-sh/aws-cloud-provider/userconfig"
+)
+
+// ErrUnknownAWSMethod represents the error returned when
+// a method is not listed in the IAM permissions catalog.
+type ErrUnknownAWSMethod struct {
+	Method string
+}
+
+func (ErrUnknownAWSMethod) Error() string {
+	return "ErrUnknownAWSMethod"
+}
+
+// IAMPermissions represents the IAM actions
+// used by a method of the AWS service.
+//
+// The actions used to reach the config storage depend on the
+// backend (none for the "file" backend). STS GetCallerIdentity
+// is not listed given that it doesn't require any permission.
+type IAMPermissions struct {
+	Method string `json:"method"`
+
+	EC2 []string `json:"ec2,omitempty"`
+
+	// DynamoDB lists the actions used with the DynamoDB backend
+	DynamoDB []string `json:"dynamodb,omitempty"`
+
+	// S3 lists the actions used with the S3 backend
+	S3 []string `json:"s3,omitempty"`
+
+	// KMS lists the actions used when
+	// the config is encrypted with a KMS key
+	KMS []string `json:"kms,omitempty"`
+
+	IAM []string `json:"iam,omitempty"`
+
+	SSM []string `json:"ssm,omitempty"`
+
+	Route53 []string `json:"route53,omitempty"`
+}
+
+// Actions returns the actions used by the method
+// with the passed config storage backend (sorted).
+func (p IAMPermissions) Actions(
+	configStorageBackend string,
+	withKMS bool,
+) []string {
+
+	actions := append([]string{}, p.EC2...)
+	actions = append(actions, p.IAM...)
+	actions = append(actions, p.SSM...)
+	actions = append(actions, p.Route53...)
+
+	switch configStorageBackend {
+	case "", userconfig.ConfigStorageBackendDynamoDB:
+		actions = append(actions, p.DynamoDB...)
+	case userconfig.ConfigStorageBackendS3:
+		actions = append(actions, p.S3...)
+	}
+
+	if withKMS {
+		actions = append(actions, p.KMS...)
+	}
+
+	return uniqueSortedActions(actions)
+}
+
+var (
+	leaseDynamoDBActions = []string{
+		"dynamodb:DeleteItem",
+		"dynamodb:GetItem",
+		"dynamodb:PutItem",
+	}
+
+	leaseS3Actions = []string{
+		"s3:DeleteObject",
+		"s3:GetObject",
+		"s3:PutObject",
+	}
+
+	// The leases of the dev envs are listed when
+	// the lease of their cluster is acquired
+	clusterLeaseDynamoDBActions = []string{
+		"dynamodb:DeleteItem",
+		"dynamodb:GetItem",
+		"dynamodb:PutItem",
+		"dynamodb:Scan",
+	}
+
+	clusterLeaseS3Actions = []string{
+		"s3:DeleteObject",
+		"s3:GetObject",
+		"s3:ListBucket",
+		"s3:PutObject",
+	}
+
+	// The legacy config is migrated on read
+	// so reading the config could write it.
+	// The transactions are authorized through the
+	// actions of their items (only puts are used).
+	configDynamoDBActions = []string{
+		"dynamodb:BatchGetItem",
+		"dynamodb:DeleteItem",
+		"dynamodb:GetItem",
+		"dynamodb:PutItem",
+		"dynamodb:Scan",
+	}
+
+	configS3Actions = []string{
+		"s3:DeleteObject",
+		"s3:GetObject",
+		"s3:ListBucket",
+		"s3:PutObject",
+	}
+
+	configHistoryDynamoDBActions = []string{
+		"dynamodb:BatchGetItem",
+		"dynamodb:GetItem",
+		"dynamodb:Scan",
+	}
+
+	configHistoryS3Actions = []string{
+		"s3:GetObject",
+		"s3:ListBucket",
+	}
+
+	configKMSActions = []string{
+		"kms:Decrypt",
+		"kms:GenerateDataKey",
+	}
+
+	// The SSM sessions used to reach
+	// the dev envs of the private clusters
+	instanceSSMActions = []string{
+		"ssm:DescribeInstanceInformation",
+		"ssm:StartSession",
+		"ssm:TerminateSession",
+	}
+)
+
+// IAMPermissionsCatalog lists the IAM actions
+// used by each method of the AWS service.
+//
+// The EC2 "Describe*" actions include the ones used by
+// the waiters. "ec2:CreateTags" is required given that
+// the resources are tagged on creation.
+var IAMPermissionsCatalog = []IAMPermissions{
+	{
+		Method: "CheckInstanceTypeValidity",
+		EC2: []string{
+			"ec2:DescribeInstanceTypes",
+		},
+	},
+
+	{
+		Method: "CheckPermissions",
+		IAM: []string{
+			"iam:SimulatePrincipalPolicy",
+		},
+	},
+
+	{
+		Method: "CreateCluster",
+		EC2: []string{
+			"ec2:AssociateRouteTable",
+			"ec2:AttachInternetGateway",
+			"ec2:CreateInternetGateway",
+			"ec2:CreateRoute",
+			"ec2:CreateRouteTable",
+			"ec2:CreateSubnet",
+			"ec2:CreateTags",
+			"ec2:CreateVpc",
+			"ec2:DescribeAvailabilityZones",
+			"ec2:DescribeInternetGateways",
+			"ec2:DescribeSubnets",
+			"ec2:DescribeVpcs",
+			"ec2:ModifySubnetAttribute",
+			"ec2:ModifyVpcAttribute",
+		},
+		DynamoDB: clusterLeaseDynamoDBActions,
+		S3:       clusterLeaseS3Actions,
+	},
+
+	// The actions added to CreateCluster
+	// when the gateway endpoints are enabled
+	{
+		Method: "CreateClusterGatewayEndpoints",
+		EC2: []string{
+			"ec2:CreateTags",
+			"ec2:CreateVpcEndpoint",
+			"ec2:DescribeVpcEndpoints",
+		},
+	},
+
+	// CreateCluster with the existing VPC
+	// and subnet set in ClusterOpts
+	{
+		Method: "CreateClusterInExistingNetwork",
+		EC2: []string{
+			"ec2:DescribeRouteTables",
+			"ec2:DescribeSubnets",
+			"ec2:DescribeVpcs",
+		},
+		DynamoDB: clusterLeaseDynamoDBActions,
+		S3:       clusterLeaseS3Actions,
+	},
+
+	// The actions added to CreateCluster (or to
+	// CreateClusterInExistingNetwork) in private mode
+	{
+		Method: "CreateClusterPrivateMode",
+		EC2: []string{
+			"ec2:AuthorizeSecurityGroupIngress",
+			"ec2:CreateSecurityGroup",
+			"ec2:CreateTags",
+			"ec2:CreateVpcEndpoint",
+			"ec2:DescribeSecurityGroups",
+			"ec2:DescribeVpcEndpoints",
+		},
+	},
+
+	{
+		Method: "CreateDevEnv",
+		EC2: []string{
+			"ec2:AuthorizeSecurityGroupIngress",
+			"ec2:CreateKeyPair",
+			"ec2:CreateNetworkInterface",
+			"ec2:CreateSecurityGroup",
+			"ec2:CreateTags",
+			"ec2:DescribeImages",
+			"ec2:DescribeInstanceTypeOfferings",
+			"ec2:DescribeInstanceTypes",
+			"ec2:DescribeInstances",
+			"ec2:DescribeKeyPairs",
+			"ec2:DescribeNetworkInterfaces",
+			"ec2:DescribeSecurityGroups",
+			"ec2:RunInstances",
+		},
+		DynamoDB: leaseDynamoDBActions,
+		S3:       leaseS3Actions,
+	},
+
+	// The actions added to CreateDevEnv in private mode
+	// (the instance profile must be passed to the instance)
+	{
+		Method: "CreateDevEnvPrivateMode",
+		IAM: []string{
+			"iam:AddRoleToInstanceProfile",
+			"iam:AttachRolePolicy",
+			"iam:CreateInstanceProfile",
+			"iam:CreateRole",
+			"iam:GetInstanceProfile",
+			"iam:PassRole",
+		},
+		SSM: instanceSSMActions,
+	},
+
+	// The actions added to CreateDevEnv
+	// when a DNS hosted zone is set
+	{
+		Method: "CreateDevEnvDNSRecord",
+		Route53: []string{
+			"route53:ChangeResourceRecordSets",
+			"route53:GetHostedZone",
+		},
+	},
+
+	// The actions added to CreateDevEnv
+	// when the Elastic IPs are enabled
+	{
+		Method: "CreateDevEnvElasticIP",
+		EC2: []string{
+			"ec2:AllocateAddress",
+			"ec2:AssociateAddress",
+		},
+	},
+
+	// The actions added to CreateDevEnv when the spot
+	// instances are enabled (the spot request is
+	// cancelled if the instance could not be launched)
+	{
+		Method: "CreateDevEnvSpot",
+		EC2: []string{
+			"ec2:CancelSpotInstanceRequests",
+		},
+	},
+
+	{
+		Method: "CreateRecodeConfigStorage",
+		DynamoDB: []string{
+			"dynamodb:CreateTable",
+			"dynamodb:DescribeTable",
+		},
+		S3: []string{
+			"s3:CreateBucket",
+			"s3:ListBucket",
+		},
+	},
+
+	{
+		Method:   "DiffRecodeConfigVersions",
+		DynamoDB: configHistoryDynamoDBActions,
+		S3:       configHistoryS3Actions,
+		KMS:      configKMSActions,
+	},
+
+	{
+		Method:   "ListRecodeConfigVersions",
+		DynamoDB: configHistoryDynamoDBActions,
+		S3:       configHistoryS3Actions,
+	},
+
+	{
+		Method:   "LookupRecodeConfig",
+		DynamoDB: configDynamoDBActions,
+		S3:       configS3Actions,
+		KMS:      configKMSActions,
+	},
+
+	{
+		Method:   "LookupRecodeConfigVersion",
+		DynamoDB: configHistoryDynamoDBActions,
+		S3:       configHistoryS3Actions,
+		KMS:      configKMSActions,
+	},
+
+	{
+		Method: "RemoveCluster",
+		EC2: []string{
+			"ec2:DeleteInternetGateway",
+			"ec2:DeleteRouteTable",
+			"ec2:DeleteSubnet",
+			"ec2:DeleteVpc",
+			"ec2:DetachInternetGateway",
+		},
+		DynamoDB: clusterLeaseDynamoDBActions,
+		S3:       clusterLeaseS3Actions,
+	},
+
+	// The actions added to RemoveCluster
+	// when the gateway endpoints are enabled
+	{
+		Method: "RemoveClusterGatewayEndpoints",
+		EC2: []string{
+			"ec2:DeleteVpcEndpoints",
+			"ec2:DescribeVpcEndpoints",
+		},
+	},
+
+	// The actions added to RemoveCluster in private mode
+	{
+		Method: "RemoveClusterPrivateMode",
+		EC2: []string{
+			"ec2:DeleteSecurityGroup",
+			"ec2:DeleteVpcEndpoints",
+			"ec2:DescribeVpcEndpoints",
+		},
+	},
+
+	{
+		Method: "RemoveDevEnv",
+		EC2: []string{
+			"ec2:DeleteKeyPair",
+			"ec2:DeleteNetworkInterface",
+			"ec2:DeleteSecurityGroup",
+			"ec2:DescribeInstances",
+			"ec2:TerminateInstances",
+		},
+		DynamoDB: leaseDynamoDBActions,
+		S3:       leaseS3Actions,
+	},
+
+	// The actions added to RemoveDevEnv in private mode
+	{
+		Method: "RemoveDevEnvPrivateMode",
+		IAM: []string{
+			"iam:DeleteInstanceProfile",
+			"iam:DeleteRole",
+			"iam:DetachRolePolicy",
+			"iam:RemoveRoleFromInstanceProfile",
+		},
+	},
+
+	// The actions added to RemoveDevEnv
+	// when the dev env has an Elastic IP
+	{
+		Method: "RemoveDevEnvElasticIP",
+		EC2: []string{
+			"ec2:DisassociateAddress",
+			"ec2:ReleaseAddress",
+		},
+	},
+
+	// The actions added to RemoveDevEnv
+	// when the dev env has a DNS record
+	{
+		Method: "RemoveDevEnvDNSRecord",
+		Route53: []string{
+			"route53:ChangeResourceRecordSets",
+		},
+	},
+
+	// The actions added to RemoveDevEnv when the dev env
+	// runs on a spot instance (the persistent request is
+	// cancelled and the root volume detached during a
+	// fallback to on-demand is removed)
+	{
+		Method: "RemoveDevEnvSpot",
+		EC2: []string{
+			"ec2:CancelSpotInstanceRequests",
+			"ec2:DeleteVolume",
+			"ec2:DescribeVolumes",
+		},
+	},
+
+	{
+		Method: "RemoveRecodeConfigStorage",
+		DynamoDB: []string{
+			"dynamodb:DeleteTable",
+			"dynamodb:DescribeTable",
+		},
+		S3: []string{
+			"s3:DeleteObject",
+			"s3:ListBucket",
+		},
+	},
+
+	{
+		Method:   "RestoreRecodeConfigVersion",
+		DynamoDB: configDynamoDBActions,
+		S3:       configS3Actions,
+		KMS:      configKMSActions,
+	},
+
+	{
+		Method: "RestoreDevEnvData",
+		EC2: []string{
+			"ec2:AttachVolume",
+			"ec2:CreateTags",
+			"ec2:CreateVolume",
+			"ec2:DescribeVolumes",
+		},
+	},
+
+	{
+		Method:   "RotateRecodeConfigDataKey",
+		DynamoDB: configDynamoDBActions,
+		S3:       configS3Actions,
+		KMS:      configKMSActions,
+	},
+
+	{
+		Method: "SaveDevEnvData",
+		EC2: []string{
+			"ec2:CreateSnapshot",
+			"ec2:CreateTags",
+			"ec2:DeleteSnapshot",
+			"ec2:DeleteVolume",
+			"ec2:DescribeSnapshots",
+			"ec2:DescribeVolumes",
+			"ec2:DetachVolume",
+		},
+	},
+
+	{
+		Method:   "SaveRecodeConfig",
+		DynamoDB: configDynamoDBActions,
+		S3:       configS3Actions,
+		KMS:      configKMSActions,
+	},
+
+	{
+		Method: "StartDevEnv",
+		EC2: []string{
+			"ec2:AuthorizeSecurityGroupIngress",
+			"ec2:DescribeInstances",
+			"ec2:RevokeSecurityGroupIngress",
+			"ec2:StartInstances",
+		},
+		DynamoDB: leaseDynamoDBActions,
+		S3:       leaseS3Actions,
+	},
+
+	// The actions added to StartDevEnv in private mode
+	{
+		Method: "StartDevEnvPrivateMode",
+		SSM:    instanceSSMActions,
+	},
+
+	// The actions added to StartDevEnv
+	// when the dev env has a DNS record
+	{
+		Method: "StartDevEnvDNSRecord",
+		Route53: []string{
+			"route53:ChangeResourceRecordSets",
+		},
+	},
+
+	// The actions added to StartDevEnv when the dev env runs
+	// on a spot instance (moved to an on-demand instance
+	// when there is no spot capacity)
+	{
+		Method: "StartDevEnvSpot",
+		EC2: []string{
+			"ec2:AttachVolume",
+			"ec2:CancelSpotInstanceRequests",
+			"ec2:CreateTags",
+			"ec2:DeleteVolume",
+			"ec2:DescribeVolumes",
+			"ec2:DetachVolume",
+			"ec2:ModifyInstanceAttribute",
+			"ec2:RunInstances",
+			"ec2:StopInstances",
+			"ec2:TerminateInstances",
+		},
+	},
+
+	{
+		Method: "StopDevEnv",
+		EC2: []string{
+			"ec2:DescribeInstances",
+			"ec2:StopInstances",
+		},
+		DynamoDB: leaseDynamoDBActions,
+		S3:       leaseS3Actions,
+	},
+
+	// The actions added to StopDevEnv when the dev env
+	// has a DNS record but no Elastic IP
+	{
+		Method: "StopDevEnvDNSRecord",
+		Route53: []string{
+			"route53:ChangeResourceRecordSets",
+		},
+	},
+
+	{
+		Method: "UpdateDevEnvIngress",
+		EC2: []string{
+			"ec2:AuthorizeSecurityGroupIngress",
+			"ec2:RevokeSecurityGroupIngress",
+		},
+		DynamoDB: leaseDynamoDBActions,
+		S3:       leaseS3Actions,
+	},
+
+	{
+		Method:   "UpdateRecodeConfig",
+		DynamoDB: configDynamoDBActions,
+		S3:       configS3Actions,
+		KMS:      configKMSActions,
+	},
+}
+
+// LookupIAMPermissions returns the IAM permissions of the passed method.
+// ErrUnknownAWSMethod is returned if the method is not in the catalog.
+func LookupIAMPermissions(method string) (IAMPermissions, error) {
+	for _, permissions := range IAMPermissionsCatalog {
+		if permissions.Method == method {
+			return permissions, nil
+		}
+	}
+
+	return IAMPermissions{}, ErrUnknownAWSMethod{
+		Method: method,
+	}
+}
+
+func uniqueSortedActions(actions []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+
+	for _, action := range actions {
+		if seen[action] {
+			continue
+		}
+
+		seen[action] = true
+		unique = append(unique, action)
+	}
+
+	sort.Strings(unique)
+
+	return unique
+}
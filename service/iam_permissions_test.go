@@ -0,0 +1,420 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/aws-cloud-provider/userconfig"
+	"github.com/recode-sh/recode/entities"
+)
+
+type fakeClient interface {
+	Operations() []string
+	Calls(operation string) int
+}
+
+// calledActions returns the number of calls made to
+// the fake clients, indexed by IAM action.
+func calledActions(cloud *fakeCloud) map[string]int {
+	clients := map[string]fakeClient{
+		"ec2":      cloud.EC2,
+		"dynamodb": cloud.DynamoDB,
+		"kms":      cloud.KMS,
+		"s3":       cloud.S3,
+		"iam":      cloud.IAM,
+		"route53":  cloud.Route53,
+	}
+
+	// The operations that don't match an action with the same
+	// name (the transactions are authorized through the
+	// actions of their items and only puts are used)
+	operationActions := map[string]map[string]string{
+		"s3": {
+			"HeadBucket":    "ListBucket",
+			"ListObjectsV2": "ListBucket",
+		},
+		"dynamodb": {
+			"TransactWriteItems": "PutItem",
+		},
+	}
+
+	actions := map[string]int{}
+
+	for prefix, client := range clients {
+		for _, operation := range client.Operations() {
+			action := operation
+
+			if len(operationActions[prefix][operation]) > 0 {
+				action = operationActions[prefix][operation]
+			}
+
+			actions[prefix+":"+action] += client.Calls(operation)
+		}
+	}
+
+	return actions
+}
+
+func TestIAMPermissionsCatalogListsCalledActions(t *testing.T) {
+	testCases := []struct {
+		test                 string
+		configStorageBackend string
+	}{
+		{
+			test:                 "DynamoDB backend",
+			configStorageBackend: userconfig.ConfigStorageBackendDynamoDB,
+		},
+
+		{
+			test:                 "S3 backend",
+			configStorageBackend: userconfig.ConfigStorageBackendS3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			cloud := newFakeCloud(t)
+
+			if tc.configStorageBackend == userconfig.ConfigStorageBackendS3 {
+				cloud.ConfigStorage = infrastructure.NewS3RecodeConfigStorage(
+					cloud.S3,
+					"recode-config-bucket",
+					cloud.EC2.Region(),
+				)
+			}
+
+			recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+				ConfigEncryption: service.ConfigEncryptionOpts{
+					KMSKeyID: cloud.KMS.CreateKey(""),
+				},
+			})
+
+			ctx := context.Background()
+			stepper := &fakes.Stepper{}
+
+			config := &entities.Config{
+				ID: "recode-config",
+			}
+
+			cluster := &entities.Cluster{
+				Name: entities.DefaultClusterName,
+			}
+
+			devEnv := &entities.DevEnv{
+				Name:         "recode-sh-api",
+				InstanceType: "t2.medium",
+			}
+
+			methods := []struct {
+				method string
+				call   func() error
+			}{
+				{"CreateRecodeConfigStorage", func() error {
+					return recodeCLI.CreateRecodeConfigStorage(ctx, stepper)
+				}},
+				{"SaveRecodeConfig", func() error {
+					return recodeCLI.SaveRecodeConfig(ctx, stepper, config)
+				}},
+				{"LookupRecodeConfig", func() error {
+					_, err := recodeCLI.LookupRecodeConfig(ctx, stepper)
+					return err
+				}},
+				{"UpdateRecodeConfig", func() error {
+					_, err := recodeCLI.UpdateRecodeConfig(ctx, stepper, func(config *entities.Config) error {
+						config.Clusters = append(config.Clusters, &entities.Cluster{Name: "updated"})
+						return nil
+					})
+					return err
+				}},
+				{"RotateRecodeConfigDataKey", func() error {
+					return recodeCLI.RotateRecodeConfigDataKey(ctx, stepper)
+				}},
+				{"ListRecodeConfigVersions", func() error {
+					_, err := recodeCLI.ListRecodeConfigVersions(ctx, stepper)
+					return err
+				}},
+				{"LookupRecodeConfigVersion", func() error {
+					_, err := recodeCLI.LookupRecodeConfigVersion(ctx, stepper, 1)
+					return err
+				}},
+				{"DiffRecodeConfigVersions", func() error {
+					_, err := recodeCLI.DiffRecodeConfigVersions(ctx, stepper, 1, 2)
+					return err
+				}},
+				{"RestoreRecodeConfigVersion", func() error {
+					_, err := recodeCLI.RestoreRecodeConfigVersion(ctx, stepper, 1)
+					return err
+				}},
+				{"CheckInstanceTypeValidity", func() error {
+					return recodeCLI.CheckInstanceTypeValidity(ctx, stepper, devEnv.InstanceType)
+				}},
+				{"CreateCluster", func() error {
+					return recodeCLI.CreateCluster(ctx, stepper, config, cluster)
+				}},
+				{"CreateDevEnv", func() error {
+					return recodeCLI.CreateDevEnv(ctx, stepper, config, cluster, devEnv)
+				}},
+				{"StopDevEnv", func() error {
+					return recodeCLI.StopDevEnv(ctx, stepper, config, cluster, devEnv)
+				}},
+				{"StartDevEnv", func() error {
+					return recodeCLI.StartDevEnv(ctx, stepper, config, cluster, devEnv)
+				}},
+				{"UpdateDevEnvIngress", func() error {
+					return recodeCLI.UpdateDevEnvIngress(ctx, stepper, config, cluster, devEnv)
+				}},
+				{"RemoveDevEnv", func() error {
+					return recodeCLI.RemoveDevEnv(ctx, stepper, config, cluster, devEnv)
+				}},
+				{"RemoveCluster", func() error {
+					return recodeCLI.RemoveCluster(ctx, stepper, config, cluster)
+				}},
+				{"RemoveRecodeConfigStorage", func() error {
+					return recodeCLI.RemoveRecodeConfigStorage(ctx, stepper)
+				}},
+			}
+
+			for _, m := range methods {
+				permissions, err := service.LookupIAMPermissions(m.method)
+
+				if err != nil {
+					t.Fatalf("expected no error, got '%+v'", err)
+				}
+
+				catalogedActions := map[string]bool{}
+
+				for _, action := range permissions.Actions(tc.configStorageBackend, true) {
+					catalogedActions[action] = true
+				}
+
+				callsBefore := calledActions(cloud)
+
+				if err := m.call(); err != nil {
+					t.Fatalf("expected no error calling %s, got '%+v'", m.method, err)
+				}
+
+				for action, calls := range calledActions(cloud) {
+					if calls > callsBefore[action] && !catalogedActions[action] {
+						t.Errorf("expected %s to be listed in the permissions of %s", action, m.method)
+					}
+				}
+			}
+		})
+	}
+}
+
+type catalogedMethodsCall struct {
+	methods []string
+	call    func() error
+}
+
+// assertCatalogListsCalledActions asserts that the actions called by
+// each function are listed in the permissions of the passed methods.
+func assertCatalogListsCalledActions(
+	t *testing.T,
+	cloud *fakeCloud,
+	calls []catalogedMethodsCall,
+) {
+
+	t.Helper()
+
+	for _, m := range calls {
+		catalogedActions := map[string]bool{}
+
+		for _, method := range m.methods {
+			permissions, err := service.LookupIAMPermissions(method)
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			for _, action := range permissions.Actions(userconfig.ConfigStorageBackendDynamoDB, false) {
+				catalogedActions[action] = true
+			}
+		}
+
+		callsBefore := calledActions(cloud)
+
+		if err := m.call(); err != nil {
+			t.Fatalf("expected no error calling %v, got '%+v'", m.methods, err)
+		}
+
+		for action, calls := range calledActions(cloud) {
+			if calls > callsBefore[action] && !catalogedActions[action] {
+				t.Errorf("expected %s to be listed in the permissions of %v", action, m.methods)
+			}
+		}
+	}
+}
+
+func TestIAMPermissionsCatalogListsCalledActionsInPrivateMode(t *testing.T) {
+	cloud := newFakeCloud(t)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: privateClusterOpts(t, cloud.EC2),
+	})
+
+	ctx := context.Background()
+	stepper := &fakes.Stepper{}
+	config := &entities.Config{}
+
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	methods := []catalogedMethodsCall{
+		{[]string{"CreateClusterInExistingNetwork", "CreateClusterPrivateMode"}, func() error {
+			return recodeCLI.CreateCluster(ctx, stepper, config, cluster)
+		}},
+		{[]string{"CreateDevEnv", "CreateDevEnvPrivateMode"}, func() error {
+			return recodeCLI.CreateDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+		{[]string{"StopDevEnv"}, func() error {
+			return recodeCLI.StopDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+		{[]string{"StartDevEnv", "StartDevEnvPrivateMode"}, func() error {
+			return recodeCLI.StartDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+		{[]string{"RemoveDevEnv", "RemoveDevEnvPrivateMode"}, func() error {
+			return recodeCLI.RemoveDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+		{[]string{"RemoveCluster", "RemoveClusterPrivateMode"}, func() error {
+			return recodeCLI.RemoveCluster(ctx, stepper, config, cluster)
+		}},
+	}
+
+	assertCatalogListsCalledActions(t, cloud, methods)
+}
+
+func TestIAMPermissionsCatalogListsCalledActionsWithGatewayEndpoints(t *testing.T) {
+	cloud := newFakeCloud(t)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: service.ClusterOpts{
+			GatewayEndpoints: true,
+		},
+	})
+
+	ctx := context.Background()
+	stepper := &fakes.Stepper{}
+	config := &entities.Config{}
+
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	assertCatalogListsCalledActions(t, cloud, []catalogedMethodsCall{
+		{[]string{"CreateCluster", "CreateClusterGatewayEndpoints"}, func() error {
+			return recodeCLI.CreateCluster(ctx, stepper, config, cluster)
+		}},
+		{[]string{"RemoveCluster", "RemoveClusterGatewayEndpoints"}, func() error {
+			return recodeCLI.RemoveCluster(ctx, stepper, config, cluster)
+		}},
+	})
+}
+
+func TestIAMPermissionsCatalogListsCalledActionsWithDevEnvOpts(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			ElasticIP: true,
+			DNS: service.DevEnvDNSOpts{
+				HostedZoneID: cloud.Route53.CreateHostedZone("dev.example.com"),
+			},
+		},
+	})
+
+	ctx := context.Background()
+	stepper := &fakes.Stepper{}
+	config := &entities.Config{}
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	assertCatalogListsCalledActions(t, cloud, []catalogedMethodsCall{
+		{[]string{"CreateDevEnv", "CreateDevEnvElasticIP", "CreateDevEnvDNSRecord"}, func() error {
+			return recodeCLI.CreateDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+		{[]string{"StopDevEnv"}, func() error {
+			return recodeCLI.StopDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+		{[]string{"StartDevEnv", "StartDevEnvDNSRecord"}, func() error {
+			return recodeCLI.StartDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+		{[]string{"RemoveDevEnv", "RemoveDevEnvElasticIP", "RemoveDevEnvDNSRecord"}, func() error {
+			return recodeCLI.RemoveDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+	})
+}
+
+func TestIAMPermissionsCatalogListsCalledActionsWithDNSRecord(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			DNS: service.DevEnvDNSOpts{
+				HostedZoneID: cloud.Route53.CreateHostedZone("dev.example.com"),
+			},
+		},
+	})
+
+	ctx := context.Background()
+	stepper := &fakes.Stepper{}
+	config := &entities.Config{}
+
+	devEnv, _ := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+
+	assertCatalogListsCalledActions(t, cloud, []catalogedMethodsCall{
+		{[]string{"StopDevEnv", "StopDevEnvDNSRecord"}, func() error {
+			return recodeCLI.StopDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+		{[]string{"StartDevEnv", "StartDevEnvDNSRecord"}, func() error {
+			return recodeCLI.StartDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+	})
+}
+
+func TestIAMPermissionsCatalogListsCalledActionsWithSpotInstances(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			Spot: true,
+		},
+	})
+
+	ctx := context.Background()
+	stepper := &fakes.Stepper{}
+	config := &entities.Config{}
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	assertCatalogListsCalledActions(t, cloud, []catalogedMethodsCall{
+		{[]string{"CreateDevEnv", "CreateDevEnvSpot"}, func() error {
+			return recodeCLI.CreateDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+		{[]string{"StopDevEnv"}, func() error {
+			return recodeCLI.StopDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+		// Moved to an on-demand instance
+		{[]string{"StartDevEnv", "StartDevEnvSpot"}, func() error {
+			cloud.EC2.SetSpotCapacityAvailable(false)
+			return recodeCLI.StartDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+		{[]string{"RemoveDevEnv", "RemoveDevEnvSpot"}, func() error {
+			return recodeCLI.RemoveDevEnv(ctx, stepper, config, cluster, devEnv)
+		}},
+	})
+}
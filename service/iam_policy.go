@@ -0,0 +1,412 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/aws-cloud-provider/userconfig"
+)
+
+const (
+	// IAMPolicyVersion represents the version
+	// of the policy language used.
+	IAMPolicyVersion = "2012-10-17"
+
+	// RecodeResourceNamePattern matches the "Name" tag
+	// of the EC2 resources created by Recode.
+	RecodeResourceNamePattern = "recode-*"
+)
+
+// The EC2 actions that only reach resources tagged on
+// creation by Recode (key pairs and root volumes are not tagged).
+var ec2TagScopedActions = map[string]bool{
+	"ec2:AssociateRouteTable":        true,
+	"ec2:AttachInternetGateway":      true,
+	"ec2:AttachVolume":               true,
+	"ec2:CreateRoute":                true,
+	"ec2:DeleteInternetGateway":      true,
+	"ec2:DeleteNetworkInterface":     true,
+	"ec2:DeleteRouteTable":           true,
+	"ec2:DeleteSecurityGroup":        true,
+	"ec2:DeleteSnapshot":             true,
+	"ec2:DeleteSubnet":               true,
+	"ec2:DeleteVpc":                  true,
+	"ec2:DeleteVpcEndpoints":         true,
+	"ec2:DetachInternetGateway":      true,
+	"ec2:ModifyInstanceAttribute":    true,
+	"ec2:ModifySubnetAttribute":      true,
+	"ec2:ModifyVpcAttribute":         true,
+	"ec2:RevokeSecurityGroupIngress": true,
+	"ec2:StartInstances":             true,
+	"ec2:StopInstances":              true,
+	"ec2:TerminateInstances":         true,
+}
+
+// The IAM actions that reach the instance profiles (and their
+// role) created for the dev envs of the private clusters.
+var iamInstanceProfileActions = map[string]bool{
+	"iam:AddRoleToInstanceProfile":      true,
+	"iam:AttachRolePolicy":              true,
+	"iam:CreateInstanceProfile":         true,
+	"iam:CreateRole":                    true,
+	"iam:DeleteInstanceProfile":         true,
+	"iam:DeleteRole":                    true,
+	"iam:DetachRolePolicy":              true,
+	"iam:GetInstanceProfile":            true,
+	"iam:PassRole":                      true,
+	"iam:RemoveRoleFromInstanceProfile": true,
+}
+
+// The S3 actions that apply to the
+// bucket (the other ones apply to objects).
+var s3BucketActions = map[string]bool{
+	"s3:CreateBucket": true,
+	"s3:ListBucket":   true,
+}
+
+// IAMPolicy represents an IAM policy document.
+type IAMPolicy struct {
+	Version   string               `json:"Version"`
+	Statement []IAMPolicyStatement `json:"Statement"`
+}
+
+// IAMPolicyStatement represents a statement of an IAM policy.
+type IAMPolicyStatement struct {
+	Sid      string   `json:"Sid"`
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource []string `json:"Resource"`
+
+	// Condition operators then condition
+	// keys (eg: "StringLike" then "ec2:ResourceTag/Name")
+	Condition map[string]map[string][]string `json:"Condition,omitempty"`
+}
+
+// IAMPolicyOpts represents the options
+// used to generate an IAM policy.
+type IAMPolicyOpts struct {
+	// Methods lists the methods of the AWS service allowed by the
+	// policy (see IAMPermissionsCatalog). Default to all methods.
+	Methods []string
+
+	// ConfigStorage specifies where the config is stored.
+	// Default to the DynamoDB table if not set.
+	ConfigStorage userconfig.ConfigStorage
+
+	// KMSKeyARN specifies the KMS key used to encrypt the config.
+	// The KMS actions are not allowed if not set.
+	KMSKeyARN string
+
+	// ScopeByTags restricts the EC2 actions that reach existing
+	// resources (eg: "ec2:TerminateInstances") to the resources
+	// created by Recode (matched using their "Name" tag).
+	ScopeByTags bool
+
+	// DNSHostedZoneID restricts the Route 53 actions to the hosted
+	// zone where the dev envs get a record. Default to all zones.
+	DNSHostedZoneID string
+}
+
+// GenerateIAMPolicy generates the minimal IAM policy required
+// to call the passed methods of the AWS service.
+//
+// The DynamoDB and S3 actions are always restricted to the
+// table, the bucket and the objects used to store the config.
+func GenerateIAMPolicy(opts IAMPolicyOpts) (*IAMPolicy, error) {
+	methods := opts.Methods
+
+	if len(methods) == 0 {
+		for _, permissions := range IAMPermissionsCatalog {
+			methods = append(methods, permissions.Method)
+		}
+	}
+
+	actions := []string{}
+
+	for _, method := range methods {
+		permissions, err := LookupIAMPermissions(method)
+
+		if err != nil {
+			return nil, err
+		}
+
+		actions = append(actions, permissions.Actions(
+			opts.ConfigStorage.Backend,
+			len(opts.KMSKeyARN) > 0,
+		)...)
+	}
+
+	actionsByService := map[string][]string{}
+
+	for _, action := range uniqueSortedActions(actions) {
+		service := strings.SplitN(action, ":", 2)[0]
+		actionsByService[service] = append(actionsByService[service], action)
+	}
+
+	policy := &IAMPolicy{
+		Version:   IAMPolicyVersion,
+		Statement: []IAMPolicyStatement{},
+	}
+
+	policy.Statement = append(
+		policy.Statement,
+		ec2PolicyStatements(actionsByService["ec2"], opts.ScopeByTags)...,
+	)
+
+	if len(actionsByService["dynamodb"]) > 0 {
+		policy.Statement = append(policy.Statement, IAMPolicyStatement{
+			Sid:      "RecodeConfigTable",
+			Effect:   "Allow",
+			Action:   actionsByService["dynamodb"],
+			Resource: []string{recodeConfigTableARN("*", "*")},
+		})
+	}
+
+	policy.Statement = append(
+		policy.Statement,
+		s3PolicyStatements(actionsByService["s3"], opts.ConfigStorage.S3Bucket)...,
+	)
+
+	if len(actionsByService["kms"]) > 0 {
+		policy.Statement = append(policy.Statement, IAMPolicyStatement{
+			Sid:      "RecodeConfigEncryption",
+			Effect:   "Allow",
+			Action:   actionsByService["kms"],
+			Resource: []string{opts.KMSKeyARN},
+		})
+	}
+
+	policy.Statement = append(
+		policy.Statement,
+		iamPolicyStatements(actionsByService["iam"])...,
+	)
+
+	if len(actionsByService["ssm"]) > 0 {
+		policy.Statement = append(policy.Statement, IAMPolicyStatement{
+			Sid:      "RecodeSSMSessions",
+			Effect:   "Allow",
+			Action:   actionsByService["ssm"],
+			Resource: []string{"*"},
+		})
+	}
+
+	if len(actionsByService["route53"]) > 0 {
+		policy.Statement = append(policy.Statement, IAMPolicyStatement{
+			Sid:      "RecodeDNSRecords",
+			Effect:   "Allow",
+			Action:   actionsByService["route53"],
+			Resource: []string{hostedZoneARN(opts.DNSHostedZoneID)},
+		})
+	}
+
+	return policy, nil
+}
+
+// GenerateIAMPolicyJSON generates the IAM policy (see GenerateIAMPolicy)
+// and encodes it in the JSON format expected by AWS.
+func GenerateIAMPolicyJSON(opts IAMPolicyOpts) ([]byte, error) {
+	policy, err := GenerateIAMPolicy(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(policy, "", "  ")
+}
+
+func ec2PolicyStatements(
+	actions []string,
+	scopeByTags bool,
+) []IAMPolicyStatement {
+
+	if len(actions) == 0 {
+		return nil
+	}
+
+	if !scopeByTags {
+		return []IAMPolicyStatement{{
+			Sid:      "RecodeEC2",
+			Effect:   "Allow",
+			Action:   actions,
+			Resource: []string{"*"},
+		}}
+	}
+
+	unscopedActions := []string{}
+	scopedActions := []string{}
+	createActions := []string{}
+	hasCreateTags := false
+
+	for _, action := range actions {
+		if action == "ec2:CreateTags" {
+			hasCreateTags = true
+			continue
+		}
+
+		if ec2TagScopedActions[action] {
+			scopedActions = append(scopedActions, action)
+			continue
+		}
+
+		unscopedActions = append(unscopedActions, action)
+
+		// The actions used to create tagged resources
+		if strings.HasPrefix(action, "ec2:Create") || action == "ec2:RunInstances" {
+			createActions = append(createActions, strings.TrimPrefix(action, "ec2:"))
+		}
+	}
+
+	statements := []IAMPolicyStatement{}
+
+	if len(unscopedActions) > 0 {
+		statements = append(statements, IAMPolicyStatement{
+			Sid:      "RecodeEC2",
+			Effect:   "Allow",
+			Action:   unscopedActions,
+			Resource: []string{"*"},
+		})
+	}
+
+	// Tags could only be added when resources are created
+	if hasCreateTags && len(createActions) > 0 {
+		statements = append(statements, IAMPolicyStatement{
+			Sid:      "RecodeEC2TagOnCreate",
+			Effect:   "Allow",
+			Action:   []string{"ec2:CreateTags"},
+			Resource: []string{"*"},
+			Condition: map[string]map[string][]string{
+				"StringEquals": {
+					"ec2:CreateAction": createActions,
+				},
+			},
+		})
+	}
+
+	if len(scopedActions) > 0 {
+		statements = append(statements, IAMPolicyStatement{
+			Sid:      "RecodeEC2TaggedResources",
+			Effect:   "Allow",
+			Action:   scopedActions,
+			Resource: []string{"*"},
+			Condition: map[string]map[string][]string{
+				"StringLike": {
+					"ec2:ResourceTag/Name": {RecodeResourceNamePattern},
+				},
+			},
+		})
+	}
+
+	return statements
+}
+
+func s3PolicyStatements(
+	actions []string,
+	bucket string,
+) []IAMPolicyStatement {
+
+	bucketActions := []string{}
+	objectActions := []string{}
+
+	for _, action := range actions {
+		if s3BucketActions[action] {
+			bucketActions = append(bucketActions, action)
+			continue
+		}
+
+		objectActions = append(objectActions, action)
+	}
+
+	statements := []IAMPolicyStatement{}
+
+	if len(bucketActions) > 0 {
+		statements = append(statements, IAMPolicyStatement{
+			Sid:      "RecodeConfigBucket",
+			Effect:   "Allow",
+			Action:   bucketActions,
+			Resource: []string{recodeConfigBucketARN(bucket)},
+		})
+	}
+
+	if len(objectActions) > 0 {
+		statements = append(statements, IAMPolicyStatement{
+			Sid:      "RecodeConfigObjects",
+			Effect:   "Allow",
+			Action:   objectActions,
+			Resource: []string{recodeConfigObjectARN(bucket, "*")},
+		})
+	}
+
+	return statements
+}
+
+func iamPolicyStatements(actions []string) []IAMPolicyStatement {
+	instanceProfileActions := []string{}
+	otherActions := []string{}
+
+	for _, action := range actions {
+		if iamInstanceProfileActions[action] {
+			instanceProfileActions = append(instanceProfileActions, action)
+			continue
+		}
+
+		otherActions = append(otherActions, action)
+	}
+
+	statements := []IAMPolicyStatement{}
+
+	if len(otherActions) > 0 {
+		statements = append(statements, IAMPolicyStatement{
+			Sid:      "RecodePermissionsPreflight",
+			Effect:   "Allow",
+			Action:   otherActions,
+			Resource: []string{"*"},
+		})
+	}
+
+	if len(instanceProfileActions) > 0 {
+		statements = append(statements, IAMPolicyStatement{
+			Sid:    "RecodeInstanceProfiles",
+			Effect: "Allow",
+			Action: instanceProfileActions,
+			Resource: []string{
+				recodeRoleARN("*", RecodeResourceNamePattern),
+				recodeInstanceProfileARN("*", RecodeResourceNamePattern),
+			},
+		})
+	}
+
+	return statements
+}
+
+func recodeRoleARN(accountID, name string) string {
+	return "arn:aws:iam::" + accountID + ":role/" + name
+}
+
+func recodeInstanceProfileARN(accountID, name string) string {
+	return "arn:aws:iam::" + accountID + ":instance-profile/" + name
+}
+
+// hostedZoneARN returns the ARN of the passed Route 53
+// hosted zone (of all the hosted zones if empty).
+func hostedZoneARN(hostedZoneID string) string {
+	if len(hostedZoneID) == 0 {
+		hostedZoneID = "*"
+	}
+
+	return "arn:aws:route53:::hostedzone/" + hostedZoneID
+}
+
+func recodeConfigTableARN(region, accountID string) string {
+	return "arn:aws:dynamodb:" + region + ":" + accountID +
+		":table/" + infrastructure.DynamoDBRecodeConfigTableName
+}
+
+func recodeConfigBucketARN(bucket string) string {
+	return "arn:aws:s3:::" + bucket
+}
+
+func recodeConfigObjectARN(bucket, key string) string {
+	return recodeConfigBucketARN(bucket) + "/" +
+		infrastructure.S3RecodeConfigKeyPrefix + key
+}
@@ -0,0 +1,222 @@
+package service_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/aws-cloud-provider/userconfig"
+)
+
+// lookupPolicyStatement returns the statement
+// that allows the passed action (nil if none).
+func lookupPolicyStatement(
+	policy *service.IAMPolicy,
+	action string,
+) *service.IAMPolicyStatement {
+
+	for i, statement := range policy.Statement {
+		for _, statementAction := range statement.Action {
+			if statementAction == action {
+				return &policy.Statement[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestGenerateIAMPolicy(t *testing.T) {
+	testCases := []struct {
+		test               string
+		opts               service.IAMPolicyOpts
+		expectedStatements map[string]*service.IAMPolicyStatement
+	}{
+		{
+			test: "all methods",
+			opts: service.IAMPolicyOpts{},
+			expectedStatements: map[string]*service.IAMPolicyStatement{
+				"ec2:TerminateInstances": {
+					Sid:      "RecodeEC2",
+					Effect:   "Allow",
+					Resource: []string{"*"},
+				},
+				"dynamodb:PutItem": {
+					Sid:      "RecodeConfigTable",
+					Effect:   "Allow",
+					Resource: []string{"arn:aws:dynamodb:*:*:table/recode-configuration-dynamodb-table"},
+				},
+				"dynamodb:TransactWriteItems": nil,
+				"iam:SimulatePrincipalPolicy": {
+					Sid:      "RecodePermissionsPreflight",
+					Effect:   "Allow",
+					Resource: []string{"*"},
+				},
+				"s3:PutObject": nil,
+				"kms:Decrypt":  nil,
+			},
+		},
+
+		{
+			test: "scoped by tags",
+			opts: service.IAMPolicyOpts{
+				Methods:     []string{"CreateDevEnv", "RemoveDevEnv"},
+				ScopeByTags: true,
+			},
+			expectedStatements: map[string]*service.IAMPolicyStatement{
+				"ec2:RunInstances": {
+					Sid:      "RecodeEC2",
+					Effect:   "Allow",
+					Resource: []string{"*"},
+				},
+				"ec2:CreateTags": {
+					Sid:      "RecodeEC2TagOnCreate",
+					Effect:   "Allow",
+					Resource: []string{"*"},
+					Condition: map[string]map[string][]string{
+						"StringEquals": {
+							"ec2:CreateAction": {
+								"CreateKeyPair",
+								"CreateNetworkInterface",
+								"CreateSecurityGroup",
+								"RunInstances",
+							},
+						},
+					},
+				},
+				"ec2:TerminateInstances": {
+					Sid:      "RecodeEC2TaggedResources",
+					Effect:   "Allow",
+					Resource: []string{"*"},
+					Condition: map[string]map[string][]string{
+						"StringLike": {
+							"ec2:ResourceTag/Name": {"recode-*"},
+						},
+					},
+				},
+				"ec2:CreateVpc":               nil,
+				"iam:SimulatePrincipalPolicy": nil,
+			},
+		},
+
+		{
+			test: "S3 backend with KMS encryption",
+			opts: service.IAMPolicyOpts{
+				Methods: []string{"CreateRecodeConfigStorage", "SaveRecodeConfig"},
+				ConfigStorage: userconfig.ConfigStorage{
+					Backend:  userconfig.ConfigStorageBackendS3,
+					S3Bucket: "recode-config-bucket",
+				},
+				KMSKeyARN: "arn:aws:kms:eu-west-3:123456789012:key/recode",
+			},
+			expectedStatements: map[string]*service.IAMPolicyStatement{
+				"s3:CreateBucket": {
+					Sid:      "RecodeConfigBucket",
+					Effect:   "Allow",
+					Resource: []string{"arn:aws:s3:::recode-config-bucket"},
+				},
+				"s3:PutObject": {
+					Sid:      "RecodeConfigObjects",
+					Effect:   "Allow",
+					Resource: []string{"arn:aws:s3:::recode-config-bucket/recode/*"},
+				},
+				"kms:GenerateDataKey": {
+					Sid:      "RecodeConfigEncryption",
+					Effect:   "Allow",
+					Resource: []string{"arn:aws:kms:eu-west-3:123456789012:key/recode"},
+				},
+				"dynamodb:PutItem": nil,
+			},
+		},
+
+		{
+			test: "DNS records in hosted zone",
+			opts: service.IAMPolicyOpts{
+				Methods:         []string{"CreateDevEnvDNSRecord", "RemoveDevEnvDNSRecord"},
+				DNSHostedZoneID: "Z0000000001",
+			},
+			expectedStatements: map[string]*service.IAMPolicyStatement{
+				"route53:ChangeResourceRecordSets": {
+					Sid:      "RecodeDNSRecords",
+					Effect:   "Allow",
+					Resource: []string{"arn:aws:route53:::hostedzone/Z0000000001"},
+				},
+				"ec2:RunInstances": nil,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			policy, err := service.GenerateIAMPolicy(tc.opts)
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if policy.Version != service.IAMPolicyVersion {
+				t.Fatalf("expected version to equal '%s', got '%s'", service.IAMPolicyVersion, policy.Version)
+			}
+
+			for action, expectedStatement := range tc.expectedStatements {
+				statement := lookupPolicyStatement(policy, action)
+
+				if expectedStatement == nil {
+					if statement != nil {
+						t.Errorf("expected %s not to be allowed, got '%+v'", action, *statement)
+					}
+
+					continue
+				}
+
+				if statement == nil {
+					t.Errorf("expected %s to be allowed, got nothing", action)
+					continue
+				}
+
+				// Actions are not compared
+				expectedStatement.Action = statement.Action
+
+				if !reflect.DeepEqual(*statement, *expectedStatement) {
+					t.Errorf("expected statement of %s to equal '%+v', got '%+v'", action, *expectedStatement, *statement)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateIAMPolicyAllowsCatalogActions(t *testing.T) {
+	policyJSON, err := service.GenerateIAMPolicyJSON(service.IAMPolicyOpts{
+		ScopeByTags: true,
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	var policy *service.IAMPolicy
+
+	if err := json.Unmarshal(policyJSON, &policy); err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	for _, permissions := range service.IAMPermissionsCatalog {
+		for _, action := range permissions.Actions(userconfig.ConfigStorageBackendDynamoDB, false) {
+			if lookupPolicyStatement(policy, action) == nil {
+				t.Errorf("expected %s (used by %s) to be allowed", action, permissions.Method)
+			}
+		}
+	}
+}
+
+func TestGenerateIAMPolicyWithUnknownMethod(t *testing.T) {
+	_, err := service.GenerateIAMPolicy(service.IAMPolicyOpts{
+		Methods: []string{"UnknownMethod"},
+	})
+
+	if !errors.As(err, &service.ErrUnknownAWSMethod{}) {
+		t.Fatalf("expected unknown method error, got '%+v'", err)
+	}
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+const (
+	// DefaultLeaseTTL represents the duration after which a lease
+	// that was not renewed (eg: crashed process) could be reclaimed.
+	DefaultLeaseTTL = 2 * time.Minute
+)
+
+// ErrLeaseHeld represents the error returned when a cluster
+// or a dev env is locked by another Recode process.
+type ErrLeaseHeld struct {
+	LeaseID          string
+	OwnerID          string
+	OwnerDescription string
+	ExpiresAt        time.Time
+}
+
+// Error names the owner of the lease (if it was
+// still held when it was looked up) so that the
+// message could be displayed as is by the CLI.
+func (e ErrLeaseHeld) Error() string {
+	if len(e.OwnerDescription) == 0 {
+		return "ErrLeaseHeld"
+	}
+
+	return fmt.Sprintf(
+		"ErrLeaseHeld: %s is locked by %s until %s",
+		e.LeaseID,
+		e.OwnerDescription,
+		e.ExpiresAt.Format(time.RFC3339),
+	)
+}
+
+// ErrLeaseLost represents the error returned when a lease
+// could not be renewed during an operation (eg: reclaimed by
+// another process after a network outage). The operation is
+// cancelled in this case.
+type ErrLeaseLost struct {
+	LeaseID string
+}
+
+func (ErrLeaseLost) Error() string {
+	return "ErrLeaseLost"
+}
+
+// LeaseOpts represents the options
+// used to configure the leases.
+type LeaseOpts struct {
+	// TTL specifies the duration after which a lease
+	// that was not renewed could be reclaimed.
+	// Default to DefaultLeaseTTL if not set.
+	TTL time.Duration
+
+	// HeartbeatInterval specifies how often the held leases are renewed.
+	// Default to a third of the TTL if not set.
+	HeartbeatInterval time.Duration
+
+	// OwnerID identifies the process holding the leases.
+	// Default to a random ID if not set.
+	OwnerID string
+
+	// OwnerDescription is a human-readable description
+	// of the owner (returned in ErrLeaseHeld).
+	// Default to "user@hostname (pid)" if not set.
+	OwnerDescription string
+}
+
+func (o LeaseOpts) withDefaults() LeaseOpts {
+	if o.TTL == 0 {
+		o.TTL = DefaultLeaseTTL
+	}
+
+	if o.HeartbeatInterval == 0 {
+		o.HeartbeatInterval = o.TTL / 3
+	}
+
+	if len(o.OwnerID) == 0 {
+		o.OwnerID = randomLeaseOwnerID()
+	}
+
+	if len(o.OwnerDescription) == 0 {
+		o.OwnerDescription = defaultLeaseOwnerDescription()
+	}
+
+	return o
+}
+
+func clusterLeaseID(clusterNameSlug string) string {
+	return "lease#cluster#" + clusterNameSlug
+}
+
+func devEnvLeaseID(clusterNameSlug, devEnvNameSlug string) string {
+	return clusterDevEnvsLeaseIDPrefix(clusterNameSlug) + devEnvNameSlug
+}
+
+func clusterDevEnvsLeaseIDPrefix(clusterNameSlug string) string {
+	return "lease#dev-env#" + clusterNameSlug + "#"
+}
+
+// lease represents a lease held by this process.
+// It is renewed in background until released.
+type lease struct {
+	ID string
+
+	// Cancelled when the lease is lost
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	heartbeatDone chan struct{}
+
+	mu   sync.Mutex
+	lost bool
+}
+
+// acquireLease acquires the lease with the passed ID and starts
+// renewing it in background. The returned lease context must be used
+// for the operations protected by the lease and release must be called
+// once these operations are done:
+//
+//	lease, err := a.acquireLease(ctx, leaseID)
+//	// ...
+//	ctx = lease.ctx
+//	defer func() { returnedError = a.releaseLease(lease, returnedError) }()
+func (a *AWS) acquireLease(
+	ctx context.Context,
+	leaseID string,
+) (*lease, error) {
+
+	err := a.clients.ConfigStorage.AcquireLease(
+		ctx,
+		leaseID,
+		a.leaseOpts.OwnerID,
+		a.leaseOpts.OwnerDescription,
+		time.Now().Add(a.leaseOpts.TTL),
+	)
+
+	if err != nil {
+
+		if errors.Is(err, infrastructure.ErrLeaseAlreadyHeld) {
+			return nil, a.leaseHeldError(ctx, leaseID)
+		}
+
+		return nil, err
+	}
+
+	leaseCtx, cancel := context.WithCancel(ctx)
+
+	l := &lease{
+		ID:            leaseID,
+		ctx:           leaseCtx,
+		cancel:        cancel,
+		heartbeatDone: make(chan struct{}),
+	}
+
+	go a.renewLease(l)
+
+	return l, nil
+}
+
+// acquireClusterLease acquires the lease of the cluster. It fails
+// with ErrLeaseHeld if one of the dev envs of the cluster is locked
+// (eg: a dev env being created while the cluster is removed).
+//
+// The dev env leases do the opposite check (see acquireDevEnvLease)
+// so that at least one of two concurrent operations fails.
+func (a *AWS) acquireClusterLease(
+	ctx context.Context,
+	clusterNameSlug string,
+) (*lease, error) {
+
+	l, err := a.acquireLease(ctx, clusterLeaseID(clusterNameSlug))
+
+	if err != nil {
+		return nil, err
+	}
+
+	devEnvLeases, err := a.clients.ConfigStorage.ListLeases(
+		l.ctx,
+		clusterDevEnvsLeaseIDPrefix(clusterNameSlug),
+	)
+
+	if err == nil {
+		for _, devEnvLease := range devEnvLeases {
+			if a.isLeaseHeldByOther(devEnvLease) {
+				err = leaseRecordHeldError(devEnvLease)
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, a.releaseLease(l, err)
+	}
+
+	return l, nil
+}
+
+// acquireDevEnvLease acquires the lease of the dev env. It fails
+// with ErrLeaseHeld if the cluster of the dev env is locked
+// (see acquireClusterLease).
+func (a *AWS) acquireDevEnvLease(
+	ctx context.Context,
+	clusterNameSlug string,
+	devEnvNameSlug string,
+) (*lease, error) {
+
+	l, err := a.acquireLease(ctx, devEnvLeaseID(clusterNameSlug, devEnvNameSlug))
+
+	if err != nil {
+		return nil, err
+	}
+
+	clusterLease, err := a.clients.ConfigStorage.LookupLease(
+		l.ctx,
+		clusterLeaseID(clusterNameSlug),
+	)
+
+	if err == nil && clusterLease != nil && a.isLeaseHeldByOther(clusterLease) {
+		err = leaseRecordHeldError(clusterLease)
+	}
+
+	if err != nil {
+		return nil, a.releaseLease(l, err)
+	}
+
+	return l, nil
+}
+
+// isLeaseHeldByOther returns true if the passed lease
+// has not expired and is held by another process.
+func (a *AWS) isLeaseHeldByOther(l *infrastructure.LeaseRecord) bool {
+	return l.OwnerID != a.leaseOpts.OwnerID &&
+		l.ExpiresAt >= time.Now().UnixMilli()
+}
+
+func (a *AWS) renewLease(l *lease) {
+	defer close(l.heartbeatDone)
+
+	ticker := time.NewTicker(a.leaseOpts.HeartbeatInterval)
+	defer ticker.Stop()
+
+	lastRenewedAt := time.Now()
+
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := a.clients.ConfigStorage.RenewLease(
+			l.ctx,
+			l.ID,
+			a.leaseOpts.OwnerID,
+			a.leaseOpts.OwnerDescription,
+			time.Now().Add(a.leaseOpts.TTL),
+		)
+
+		if err == nil {
+			lastRenewedAt = time.Now()
+			continue
+		}
+
+		if l.ctx.Err() != nil {
+			return
+		}
+
+		// Transient errors are retried on next tick until
+		// the lease expires and could be reclaimed by someone else
+		if errors.Is(err, infrastructure.ErrLeaseNotHeld) ||
+			time.Since(lastRenewedAt) >= a.leaseOpts.TTL {
+
+			l.mu.Lock()
+			l.lost = true
+			l.mu.Unlock()
+
+			l.cancel()
+			return
+		}
+	}
+}
+
+// releaseLease stops renewing the lease and removes it.
+// It returns the error of the operation protected by the lease
+// (replaced by ErrLeaseLost if the lease was lost during the operation).
+func (a *AWS) releaseLease(l *lease, operationErr error) error {
+	l.cancel()
+	<-l.heartbeatDone
+
+	l.mu.Lock()
+	lost := l.lost
+	l.mu.Unlock()
+
+	if lost {
+		return ErrLeaseLost{
+			LeaseID: l.ID,
+		}
+	}
+
+	// The operation context may be cancelled
+	releaseCtx, cancelRelease := context.WithTimeout(
+		context.Background(),
+		30*time.Second,
+	)
+	defer cancelRelease()
+
+	// The lease will expire anyway so a
+	// release error doesn't fail the operation
+	_ = a.clients.ConfigStorage.ReleaseLease(
+		releaseCtx,
+		l.ID,
+		a.leaseOpts.OwnerID,
+	)
+
+	return operationErr
+}
+
+func (a *AWS) leaseHeldError(ctx context.Context, leaseID string) error {
+	heldLease, err := a.clients.ConfigStorage.LookupLease(ctx, leaseID)
+
+	if err != nil {
+		return err
+	}
+
+	// Lease could have been released in the meantime
+	if heldLease == nil {
+		return ErrLeaseHeld{
+			LeaseID: leaseID,
+		}
+	}
+
+	return leaseRecordHeldError(heldLease)
+}
+
+func leaseRecordHeldError(heldLease *infrastructure.LeaseRecord) ErrLeaseHeld {
+	return ErrLeaseHeld{
+		LeaseID:          heldLease.ID,
+		OwnerID:          heldLease.OwnerID,
+		OwnerDescription: heldLease.OwnerDescription,
+		ExpiresAt:        time.UnixMilli(heldLease.ExpiresAt),
+	}
+}
+
+func randomLeaseOwnerID() string {
+	randomBytes := make([]byte, 16)
+
+	if _, err := rand.Read(randomBytes); err != nil {
+		return fmt.Sprintf("pid-%d-%d", os.Getpid(), time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(randomBytes)
+}
+
+func defaultLeaseOwnerDescription() string {
+	username := "unknown"
+
+	if currentUser, err := user.Current(); err == nil {
+		username = currentUser.Username
+	}
+
+	hostname, err := os.Hostname()
+
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s@%s (pid %d)", username, hostname, os.Getpid())
+}
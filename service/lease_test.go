@@ -0,0 +1,254 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+const clusterLeaseID = "lease#cluster#default"
+
+func TestCreateClusterWithLeaseHeldByAnotherOwner(t *testing.T) {
+	cloud := newFakeCloud(t)
+
+	err := infrastructure.AcquireLeaseInDynamoDBTable(
+		context.Background(),
+		cloud.DynamoDB,
+		clusterLeaseID,
+		"another-owner",
+		"jane@laptop (pid 42)",
+		time.Now().Add(time.Hour),
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = cloud.AWSService().CreateCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		&entities.Cluster{Name: entities.DefaultClusterName},
+	)
+
+	var leaseHeldErr service.ErrLeaseHeld
+
+	if !errors.As(err, &leaseHeldErr) {
+		t.Fatalf("expected lease held error, got '%+v'", err)
+	}
+
+	if leaseHeldErr.OwnerID != "another-owner" ||
+		leaseHeldErr.OwnerDescription != "jane@laptop (pid 42)" {
+
+		t.Errorf("expected error to name the lease owner, got '%+v'", leaseHeldErr)
+	}
+
+	if calls := cloud.EC2.Calls("CreateVpc"); calls != 0 {
+		t.Errorf("expected no VPC to be created, got %d calls", calls)
+	}
+}
+
+func TestCreateClusterReclaimsExpiredLease(t *testing.T) {
+	cloud := newFakeCloud(t)
+
+	// Lease of a crashed process
+	err := infrastructure.AcquireLeaseInDynamoDBTable(
+		context.Background(),
+		cloud.DynamoDB,
+		clusterLeaseID,
+		"crashed-owner",
+		"jane@laptop (pid 42)",
+		time.Now().Add(-time.Second),
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = cloud.AWSService().CreateCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		&entities.Cluster{Name: entities.DefaultClusterName},
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	lease, err := infrastructure.LookupLeaseInDynamoDBTable(
+		context.Background(),
+		cloud.DynamoDB,
+		clusterLeaseID,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if lease != nil {
+		t.Errorf("expected lease to be released, got '%+v'", lease)
+	}
+}
+
+func TestCreateClusterWithLostLease(t *testing.T) {
+	cloud := newFakeCloud(t)
+
+	cloud.EC2.BeforeCall("CreateSubnet", func() {
+		// Simulate a lease reclaimed by someone else
+		// (eg: after a long network outage)
+		stolenLease, err := attributevalue.MarshalMap(infrastructure.LeaseRecord{
+			ID:               clusterLeaseID,
+			OwnerID:          "another-owner",
+			OwnerDescription: "jane@laptop (pid 42)",
+			ExpiresAt:        time.Now().Add(time.Hour).UnixMilli(),
+		})
+
+		if err != nil {
+			t.Errorf("expected no error, got '%+v'", err)
+			return
+		}
+
+		_, err = cloud.DynamoDB.PutItem(context.Background(), &dynamodb.PutItemInput{
+			TableName: aws.String(infrastructure.DynamoDBRecodeConfigTableName),
+			Item:      stolenLease,
+		})
+
+		if err != nil {
+			t.Errorf("expected no error, got '%+v'", err)
+		}
+
+		// Wait for the heartbeat to notice
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	AWSService := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Lease: service.LeaseOpts{
+			TTL:               time.Hour,
+			HeartbeatInterval: 10 * time.Millisecond,
+		},
+	})
+
+	err := AWSService.CreateCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		&entities.Cluster{Name: entities.DefaultClusterName},
+	)
+
+	if !errors.As(err, &service.ErrLeaseLost{}) {
+		t.Fatalf("expected lease lost error, got '%+v'", err)
+	}
+}
+
+func TestRemoveClusterWithDevEnvLeaseHeldByAnotherOwner(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+
+	expiresAt := time.Now().Add(time.Hour)
+
+	// Dev env being created by someone else
+	err := infrastructure.AcquireLeaseInDynamoDBTable(
+		context.Background(),
+		cloud.DynamoDB,
+		"lease#dev-env#default#recode-sh-api",
+		"another-owner",
+		"jane@laptop (pid 42)",
+		expiresAt,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = cloud.AWSService().RemoveCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+	)
+
+	var leaseHeldErr service.ErrLeaseHeld
+
+	if !errors.As(err, &leaseHeldErr) {
+		t.Fatalf("expected lease held error, got '%+v'", err)
+	}
+
+	if leaseHeldErr.OwnerDescription != "jane@laptop (pid 42)" ||
+		leaseHeldErr.ExpiresAt.UnixMilli() != expiresAt.UnixMilli() {
+
+		t.Errorf("expected error to describe the lease, got '%+v'", leaseHeldErr)
+	}
+
+	if !strings.Contains(err.Error(), "jane@laptop (pid 42)") {
+		t.Errorf("expected error message to name the lease owner, got '%s'", err.Error())
+	}
+
+	if calls := cloud.EC2.Calls("DeleteVpc"); calls != 0 {
+		t.Errorf("expected no VPC to be removed, got %d calls", calls)
+	}
+
+	lease, err := infrastructure.LookupLeaseInDynamoDBTable(
+		context.Background(),
+		cloud.DynamoDB,
+		clusterLeaseID,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if lease != nil {
+		t.Errorf("expected cluster lease to be released, got '%+v'", lease)
+	}
+}
+
+func TestCreateDevEnvWithClusterLeaseHeldByAnotherOwner(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+
+	// Cluster being removed by someone else
+	err := infrastructure.AcquireLeaseInDynamoDBTable(
+		context.Background(),
+		cloud.DynamoDB,
+		clusterLeaseID,
+		"another-owner",
+		"jane@laptop (pid 42)",
+		time.Now().Add(time.Hour),
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = cloud.AWSService().CreateDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		&entities.DevEnv{
+			Name:         "recode-sh-api",
+			InstanceType: "t2.medium",
+		},
+	)
+
+	var leaseHeldErr service.ErrLeaseHeld
+
+	if !errors.As(err, &leaseHeldErr) {
+		t.Fatalf("expected lease held error, got '%+v'", err)
+	}
+
+	if calls := cloud.EC2.Calls("RunInstances"); calls != 0 {
+		t.Errorf("expected no instance to be launched, got %d calls", calls)
+	}
+}
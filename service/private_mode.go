@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/recode/queues"
+	"github.com/recode-sh/recode/stepper"
+)
+
+// The services reached by the SSM agent of the instances
+// (via the interface endpoints of the private clusters).
+var ssmVPCEndpointServices = []string{
+	"ssm",
+	"ssmmessages",
+	"ec2messages",
+}
+
+// The port of the interface endpoints
+const vpcEndpointsHTTPSPort = 443
+
+// vpcEndpointServiceName returns the name of the
+// passed service (eg: "ssm") in the passed region.
+func vpcEndpointServiceName(region, service string) string {
+	return "com.amazonaws." + region + "." + service
+}
+
+// regionPartition returns the partition
+// of the passed region (eg: "aws-cn").
+func regionPartition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	}
+
+	return "aws"
+}
+
+// vpcEndpoint returns the (interface or gateway) endpoint
+// of the cluster for the passed service name (nil if none).
+func (c *ClusterInfrastructure) vpcEndpoint(serviceName string) *infrastructure.VPCEndpoint {
+	VPCEndpoints := append([]*infrastructure.VPCEndpoint{}, c.VPCEndpoints...)
+	VPCEndpoints = append(VPCEndpoints, c.GatewayVPCEndpoints...)
+
+	for _, VPCEndpoint := range VPCEndpoints {
+		if VPCEndpoint.ServiceName == serviceName {
+			return VPCEndpoint
+		}
+	}
+
+	return nil
+}
+
+// subnetIDs returns the IDs of the subnets of the cluster.
+func (c *ClusterInfrastructure) subnetIDs() []string {
+	subnetIDs := []string{}
+
+	for _, subnet := range c.Subnets {
+		subnetIDs = append(subnetIDs, subnet.ID)
+	}
+
+	return subnetIDs
+}
+
+// subnetCIDRBlocks returns the (distinct) CIDR
+// blocks of the subnets of the cluster.
+func (c *ClusterInfrastructure) subnetCIDRBlocks() []string {
+	CIDRBlocks := []string{}
+
+	for _, subnet := range c.Subnets {
+		if len(subnet.CIDRBlock) == 0 || slices.Contains(CIDRBlocks, subnet.CIDRBlock) {
+			continue
+		}
+
+		CIDRBlocks = append(CIDRBlocks, subnet.CIDRBlock)
+	}
+
+	return CIDRBlocks
+}
+
+// createSSMEndpointsSteps returns the steps that create the
+// SSM interface endpoints of the private clusters (none for
+// the other clusters). The endpoints are created in all the
+// subnets of the cluster and accept HTTPS from each of them
+// (the subnets of an existing VPC may not be in its primary
+// CIDR block).
+func (a *AWS) createSSMEndpointsSteps(
+	ctx context.Context,
+	stepper stepper.Stepper,
+	clusterInfra *ClusterInfrastructure,
+	prefixResource func(string) string,
+) []queues.InfrastructureQueueSteps[*ClusterInfrastructure] {
+
+	if !clusterInfra.IsPrivate {
+		return nil
+	}
+
+	ec2Client := a.clients.EC2
+
+	createEndpointsSecurityGroup := func(infra *ClusterInfrastructure) error {
+		if infra.EndpointsSecurityGroup != nil {
+			return nil
+		}
+
+		ingressRules := []infrastructure.SecurityGroupIngressRule{}
+
+		for _, CIDRBlock := range infra.subnetCIDRBlocks() {
+			ingressRules = append(ingressRules, infrastructure.SecurityGroupIngressRule{
+				Protocol:  "tcp",
+				Port:      vpcEndpointsHTTPSPort,
+				CIDRBlock: CIDRBlock,
+			})
+		}
+
+		securityGroup, err := infrastructure.CreateSecurityGroup(
+			ctx,
+			ec2Client,
+			prefixResource("endpoints-security-group"),
+			"The security group attached to the VPC endpoints of your instances",
+			infra.VPC.ID,
+			ingressRules,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		infra.EndpointsSecurityGroup = securityGroup
+		return nil
+	}
+
+	createSSMEndpoints := func(infra *ClusterInfrastructure) error {
+		for _, service := range ssmVPCEndpointServices {
+			serviceName := vpcEndpointServiceName(a.sdkConfig.Region, service)
+
+			if infra.vpcEndpoint(serviceName) != nil {
+				continue
+			}
+
+			VPCEndpoint, err := infrastructure.CreateInterfaceVPCEndpoint(
+				ctx,
+				ec2Client,
+				prefixResource(service+"-endpoint"),
+				infra.VPC.ID,
+				serviceName,
+				infra.subnetIDs(),
+				[]string{infra.EndpointsSecurityGroup.ID},
+			)
+
+			if err != nil {
+				return err
+			}
+
+			infra.VPCEndpoints = append(infra.VPCEndpoints, VPCEndpoint)
+		}
+
+		return nil
+	}
+
+	return []queues.InfrastructureQueueSteps[*ClusterInfrastructure]{
+		{
+			func(*ClusterInfrastructure) error {
+				stepper.StartTemporaryStep("Creating a security group for the VPC endpoints")
+				return nil
+			},
+			createEndpointsSecurityGroup,
+		},
+
+		{
+			func(*ClusterInfrastructure) error {
+				stepper.StartTemporaryStep("Creating the VPC endpoints for SSM")
+				return nil
+			},
+			createSSMEndpoints,
+		},
+	}
+}
+
+// removeVPCEndpointsSteps returns the steps that remove the VPC
+// endpoints of the cluster and their security group. They must
+// be removed before the subnets and the route table.
+func (a *AWS) removeVPCEndpointsSteps(
+	ctx context.Context,
+	stepper stepper.Stepper,
+) []queues.InfrastructureQueueSteps[*ClusterInfrastructure] {
+
+	ec2Client := a.clients.EC2
+
+	removeVPCEndpoints := func(infra *ClusterInfrastructure) error {
+		for len(infra.VPCEndpoints) > 0 {
+			err := infrastructure.RemoveVPCEndpoint(
+				ctx,
+				ec2Client,
+				infra.VPCEndpoints[0].ID,
+			)
+
+			if err != nil {
+				return err
+			}
+
+			infra.VPCEndpoints = infra.VPCEndpoints[1:]
+		}
+
+		return nil
+	}
+
+	removeGatewayVPCEndpoints := func(infra *ClusterInfrastructure) error {
+		for len(infra.GatewayVPCEndpoints) > 0 {
+			err := infrastructure.RemoveVPCEndpoint(
+				ctx,
+				ec2Client,
+				infra.GatewayVPCEndpoints[0].ID,
+			)
+
+			if err != nil {
+				return err
+			}
+
+			infra.GatewayVPCEndpoints = infra.GatewayVPCEndpoints[1:]
+		}
+
+		return nil
+	}
+
+	removeEndpointsSecurityGroup := func(infra *ClusterInfrastructure) error {
+		if infra.EndpointsSecurityGroup == nil {
+			return nil
+		}
+
+		err := infrastructure.RemoveSecurityGroup(
+			ctx,
+			ec2Client,
+			infra.EndpointsSecurityGroup.ID,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		infra.EndpointsSecurityGroup = nil
+		return nil
+	}
+
+	return []queues.InfrastructureQueueSteps[*ClusterInfrastructure]{
+		{
+			func(*ClusterInfrastructure) error {
+				stepper.StartTemporaryStep("Removing the VPC endpoints")
+				return nil
+			},
+			removeVPCEndpoints,
+			removeGatewayVPCEndpoints,
+		},
+
+		{
+			func(*ClusterInfrastructure) error {
+				stepper.StartTemporaryStep("Removing the security group of the VPC endpoints")
+				return nil
+			},
+			removeEndpointsSecurityGroup,
+		},
+	}
+}
+
+// devEnvInstanceProfilePolicyARN returns the ARN of the SSM
+// managed policy attached to the role of the private dev envs.
+func (a *AWS) devEnvInstanceProfilePolicyARN() string {
+	return "arn:" + regionPartition(a.sdkConfig.Region) +
+		":iam::aws:policy/" + infrastructure.SSMManagedInstancePolicyName
+}
+
+// ErrDevEnvWithoutPublicIP represents the error returned when
+// the instance of a dev env reached via SSH (not through SSM)
+// didn't get any public IP address (eg: its subnet
+// doesn't map public IPs on launch).
+type ErrDevEnvWithoutPublicIP struct {
+	InstanceID string
+}
+
+func (ErrDevEnvWithoutPublicIP) Error() string {
+	return "ErrDevEnvWithoutPublicIP"
+}
+
+// instanceTransport returns the client used to reach the instance
+// of the passed dev env and the address of the instance: its ID
+// for the private dev envs (reached through SSM) and its public
+// IP address otherwise.
+func (a *AWS) instanceTransport(
+	devEnvInfra *DevEnvInfrastructure,
+) (InstanceSSHClient, string, error) {
+
+	if devEnvInfra.InstanceProfile != nil {
+		return a.clients.InstanceSSM, devEnvInfra.Instance.ID, nil
+	}
+
+	// Fail fast instead of waiting
+	// for SSH on an empty address
+	if len(devEnvInfra.Instance.PublicIPAddress) == 0 {
+		return nil, "", ErrDevEnvWithoutPublicIP{
+			InstanceID: devEnvInfra.Instance.ID,
+		}
+	}
+
+	return a.clients.InstanceSSH, devEnvInfra.Instance.PublicIPAddress, nil
+}
@@ -0,0 +1,267 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+func assertSSMEndpointsAvailable(
+	t *testing.T,
+	fakeEC2 *fakes.EC2,
+	clusterInfra *service.ClusterInfrastructure,
+) {
+
+	t.Helper()
+
+	for _, SSMService := range []string{"ssm", "ssmmessages", "ec2messages"} {
+		if !fakeEC2.HasAvailableVPCEndpoint(clusterInfra.VPC.ID, SSMService) {
+			t.Errorf("expected an available %s endpoint in the VPC", SSMService)
+		}
+	}
+
+	if len(clusterInfra.VPCEndpoints) != 3 || clusterInfra.EndpointsSecurityGroup == nil {
+		t.Errorf("expected SSM endpoints to be recorded, got '%+v'", clusterInfra.VPCEndpoints)
+	}
+}
+
+// privateClusterOpts returns the options of a private cluster
+// created in an existing subnet routed to a NAT gateway.
+func privateClusterOpts(t *testing.T, fakeEC2 *fakes.EC2) service.ClusterOpts {
+	t.Helper()
+
+	VPCID, subnetID := createExistingNetwork(t, fakeEC2, existingNetworkOpts{
+		defaultRoute:       "nat-gateway",
+		enableDNSHostnames: true,
+	})
+
+	return service.ClusterOpts{
+		VPCID:    VPCID,
+		SubnetID: subnetID,
+		Private:  true,
+	}
+}
+
+func TestPrivateClusterAndDevEnvLifecycle(t *testing.T) {
+	cloud := newFakeCloud(t)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: privateClusterOpts(t, cloud.EC2),
+	})
+
+	ctx := context.Background()
+	config := &entities.Config{}
+
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	err := recodeCLI.CreateCluster(ctx, &fakes.Stepper{}, config, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	var clusterInfra *service.ClusterInfrastructure
+	err = json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if !clusterInfra.IsPrivate {
+		t.Fatalf("expected private cluster, got '%s'", cluster.InfrastructureJSON)
+	}
+
+	assertSSMEndpointsAvailable(t, cloud.EC2, clusterInfra)
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	err = recodeCLI.CreateDevEnv(ctx, &fakes.Stepper{}, config, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	var devEnvInfra *service.DevEnvInfrastructure
+	err = json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(devEnvInfra.Instance.PublicIPAddress) > 0 {
+		t.Errorf("expected no public IP address, got '%s'", devEnvInfra.Instance.PublicIPAddress)
+	}
+
+	if devEnvInfra.InstanceProfile == nil {
+		t.Fatalf("expected instance profile, got '%s'", devEnv.InfrastructureJSON)
+	}
+
+	describeSecurityGroupsResp, err := cloud.EC2.DescribeSecurityGroups(
+		ctx,
+		&ec2.DescribeSecurityGroupsInput{
+			GroupIds: []string{devEnvInfra.SecurityGroup.ID},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if ingress := describeSecurityGroupsResp.SecurityGroups[0].IpPermissions; len(ingress) > 0 {
+		t.Errorf("expected no ingress, got '%+v'", ingress)
+	}
+
+	if calls := cloud.InstanceSSM.Calls("LookupInitInstanceScriptResults"); calls != 1 {
+		t.Errorf("expected init script results to be looked up through SSM, got %d calls", calls)
+	}
+
+	err = recodeCLI.StopDevEnv(ctx, &fakes.Stepper{}, config, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = recodeCLI.StartDevEnv(ctx, &fakes.Stepper{}, config, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if calls := cloud.InstanceSSM.Calls("WaitForSSHAvailableInInstance"); calls != 1 {
+		t.Errorf("expected SSH to be waited for through SSM, got %d calls", calls)
+	}
+
+	if calls := len(cloud.InstanceSSH.Operations()); calls != 0 {
+		t.Errorf("expected the instance to never be reached directly, got '%+v'", cloud.InstanceSSH.Operations())
+	}
+
+	err = recodeCLI.RemoveDevEnv(ctx, &fakes.Stepper{}, config, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = recodeCLI.RemoveCluster(ctx, &fakes.Stepper{}, config, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	resourceCounts := cloud.EC2.ResourceCounts()
+
+	if resourceCounts["instance"] != 0 || resourceCounts["security-group"] != 0 ||
+		resourceCounts["vpc-endpoint"] != 0 || resourceCounts["vpc"] != 1 {
+
+		t.Errorf("expected only the existing network to be kept, got '%+v'", resourceCounts)
+	}
+
+	for resourceKind, count := range cloud.IAM.ResourceCounts() {
+		if count != 0 {
+			t.Errorf("expected no %s left, got %d", resourceKind, count)
+		}
+	}
+}
+
+func TestCreatePrivateClusterWithoutExistingNetwork(t *testing.T) {
+	cloud := newFakeCloud(t)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: service.ClusterOpts{
+			Private: true,
+		},
+	})
+
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	err := recodeCLI.CreateCluster(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if !errors.As(err, &service.ErrPrivateClusterWithoutExistingNetwork{}) {
+		t.Fatalf("expected ErrPrivateClusterWithoutExistingNetwork, got '%+v'", err)
+	}
+
+	assertNoResourceLeft(t, cloud.EC2)
+}
+
+func TestCreatePrivateClusterInExistingNetwork(t *testing.T) {
+	cloud := newFakeCloud(t)
+
+	// Instances reach internet via the NAT gateway
+	VPCID, subnetID := createExistingNetwork(t, cloud.EC2, existingNetworkOpts{
+		defaultRoute:       "nat-gateway",
+		enableDNSHostnames: true,
+	})
+
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Cluster: service.ClusterOpts{
+			VPCID:    VPCID,
+			SubnetID: subnetID,
+			Private:  true,
+		},
+	})
+
+	ctx := context.Background()
+	cluster := &entities.Cluster{
+		Name: entities.DefaultClusterName,
+	}
+
+	err := recodeCLI.CreateCluster(ctx, &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	var clusterInfra *service.ClusterInfrastructure
+	err = json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	assertSSMEndpointsAvailable(t, cloud.EC2, clusterInfra)
+
+	describeSecurityGroupsResp, err := cloud.EC2.DescribeSecurityGroups(
+		ctx,
+		&ec2.DescribeSecurityGroupsInput{
+			GroupIds: []string{clusterInfra.EndpointsSecurityGroup.ID},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	// HTTPS is accepted from the subnet, not the (primary) VPC block
+	ingress := describeSecurityGroupsResp.SecurityGroups[0].IpPermissions
+
+	if len(ingress) != 1 ||
+		len(ingress[0].IpRanges) != 1 ||
+		aws.ToString(ingress[0].IpRanges[0].CidrIp) != "172.31.16.0/20" ||
+		aws.ToInt32(ingress[0].FromPort) != 443 {
+
+		t.Errorf("expected HTTPS to be accepted from the subnet, got '%+v'", ingress)
+	}
+
+	err = recodeCLI.RemoveCluster(ctx, &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	resourceCounts := cloud.EC2.ResourceCounts()
+
+	if resourceCounts["vpc-endpoint"] != 0 || resourceCounts["vpc"] != 1 || resourceCounts["subnet"] != 1 {
+		t.Errorf("expected only the existing network to be kept, got '%+v'", resourceCounts)
+	}
+}
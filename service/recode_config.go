@@ -1,56 +1,286 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/recode-sh/aws-cloud-provider/infrastructure"
 	"github.com/recode-sh/recode/entities"
 	"github.com/recode-sh/recode/stepper"
 )
 
+// ErrConfigConflict represents the error returned when
+// the config was updated by someone else since it was read.
+type ErrConfigConflict struct {
+	ConfigID        string
+	ExpectedVersion int64
+}
+
+func (ErrConfigConflict) Error() string {
+	return "ErrConfigConflict"
+}
+
+// The maximum number of attempts made by UpdateRecodeConfig
+// (and by LookupRecodeConfig when the legacy config is migrated
+// concurrently) before returning ErrConfigConflict.
+const maxConfigUpdateAttempts = 5
+
 func (a *AWS) CreateRecodeConfigStorage(
+	ctx context.Context,
+	stepper stepper.Stepper,
+) error {
+
+	stepper.StartTemporaryStep("Creating the storage used to store Recode's data")
+
+	return a.clients.ConfigStorage.Create(ctx)
+}
+
+func (a *AWS) LookupRecodeConfig(
+	ctx context.Context,
+	stepper stepper.Stepper,
+) (*entities.Config, error) {
+
+	var lastErr error
+
+	for attempt := 0; attempt < maxConfigUpdateAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		storedConfig, err := a.clients.ConfigStorage.LookupConfig(ctx)
+
+		if err != nil {
+
+			if errors.Is(err, infrastructure.ErrNoRecodeConfigFound) {
+				// No storage or no config stored.
+				return nil, entities.ErrRecodeNotInstalled
+			}
+
+			return nil, err
+		}
+
+		if len(storedConfig.LegacyRecordID) == 0 {
+			recodeConfig, dataKey, err := a.decodeStoredRecodeConfig(ctx, storedConfig)
+
+			if err != nil {
+				return nil, err
+			}
+
+			a.setConfigVersion(recodeConfig.ID, storedConfig.Version)
+			a.setConfigDataKey(recodeConfig.ID, dataKey)
+
+			return recodeConfig, nil
+		}
+
+		recodeConfig, err := a.migrateLegacyRecodeConfig(ctx, stepper, storedConfig)
+
+		// Migrated concurrently by someone else
+		if errors.As(err, &ErrConfigConflict{}) {
+			lastErr = err
+			continue
+		}
+
+		return recodeConfig, err
+	}
+
+	return nil, lastErr
+}
+
+func (a *AWS) SaveRecodeConfig(
+	ctx context.Context,
 	stepper stepper.Stepper,
+	config *entities.Config,
 ) error {
 
-	dynamoDBClient := dynamodb.NewFromConfig(a.sdkConfig)
+	// The data key is generated on first save
+	// (or after a rotation) if encryption is enabled
+	dataKey := a.getConfigDataKey(config.ID)
+
+	if dataKey == nil && a.configEncryptionOpts.enabled() {
+		generatedDataKey, err := a.generateConfigDataKey(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		dataKey = generatedDataKey
+	}
+
+	configToStore := config
+
+	if dataKey != nil {
+		encryptedConfig, err := encryptRecodeConfig(config, dataKey)
 
-	stepper.StartTemporaryStep("Creating a DynamoDB table to store Recode's data")
+		if err != nil {
+			return err
+		}
+
+		configToStore = encryptedConfig
+	}
+
+	configJSON, clusters, err := splitRecodeConfig(configToStore)
+
+	if err != nil {
+		return err
+	}
+
+	storedConfig := &infrastructure.StoredRecodeConfig{
+		ConfigJSON: configJSON,
+		Clusters:   clusters,
+	}
+
+	if dataKey != nil {
+		storedConfig.DataKeyProviderID = dataKey.providerID
+		storedConfig.EncryptedDataKey = dataKey.ciphertext
+	}
+
+	expectedVersion := a.getConfigVersion(config.ID)
 
-	err := infrastructure.CreateDynamoDBTableForRecodeConfig(
-		dynamoDBClient,
+	err = a.clients.ConfigStorage.UpdateConfig(
+		ctx,
+		storedConfig,
+		expectedVersion,
+		infrastructure.RecodeConfigHistoryOpts{
+			Size:              a.configHistorySize,
+			WriterID:          a.leaseOpts.OwnerID,
+			WriterDescription: a.leaseOpts.OwnerDescription,
+		},
 	)
 
-	if err != nil && errors.Is(err, infrastructure.ErrRecodeConfigTableAlreadyExists) {
-		return nil
+	if err != nil {
+
+		if errors.Is(err, infrastructure.ErrRecodeConfigVersionMismatch) {
+			return ErrConfigConflict{
+				ConfigID:        config.ID,
+				ExpectedVersion: expectedVersion,
+			}
+		}
+
+		return err
 	}
 
-	return err
+	a.setConfigVersion(config.ID, expectedVersion+1)
+	a.setConfigDataKey(config.ID, dataKey)
+
+	return nil
 }
 
-func (a *AWS) LookupRecodeConfig(
+// UpdateRecodeConfig re-reads the config, applies update to it
+// and saves it. When the config is updated concurrently,
+// the whole process is retried with the new config.
+//
+// The update function could therefore be called multiple times
+// and must only apply its own changes to the passed config.
+func (a *AWS) UpdateRecodeConfig(
+	ctx context.Context,
 	stepper stepper.Stepper,
+	update func(config *entities.Config) error,
 ) (*entities.Config, error) {
 
-	dynamoDBClient := dynamodb.NewFromConfig(a.sdkConfig)
+	var lastErr error
+
+	for attempt := 0; attempt < maxConfigUpdateAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		config, err := a.LookupRecodeConfig(ctx, stepper)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := update(config); err != nil {
+			return nil, err
+		}
+
+		err = a.SaveRecodeConfig(ctx, stepper, config)
+
+		if err == nil {
+			return config, nil
+		}
+
+		if !errors.As(err, &ErrConfigConflict{}) {
+			return nil, err
+		}
 
-	configJSON, err := infrastructure.LookupRecodeConfigInDynamoDBTable(
-		dynamoDBClient,
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// RotateRecodeConfigDataKey re-encrypts the sensitive fields of the
+// config with a new data key, encrypted with the configured KMS key or
+// local key. It could be used to move from a local key to KMS (the
+// previous local key must be passed in ConfigEncryptionOpts.PreviousLocalKeys).
+//
+// The versions kept in history are not re-encrypted and still
+// require the previous key to be looked up or restored.
+func (a *AWS) RotateRecodeConfigDataKey(
+	ctx context.Context,
+	stepper stepper.Stepper,
+) error {
+
+	if !a.configEncryptionOpts.enabled() {
+		return ErrConfigEncryptionNotConfigured
+	}
+
+	stepper.StartTemporaryStep("Rotating the key used to encrypt Recode's data")
+
+	_, err := a.UpdateRecodeConfig(
+		ctx,
+		stepper,
+		func(config *entities.Config) error {
+			// Forces the generation of a new data key on save
+			a.setConfigDataKey(config.ID, nil)
+			return nil
+		},
 	)
 
+	return err
+}
+
+func (a *AWS) RemoveRecodeConfigStorage(
+	ctx context.Context,
+	stepper stepper.Stepper,
+) error {
+
+	stepper.StartTemporaryStep("Removing the storage used to store Recode's data")
+
+	return a.clients.ConfigStorage.Remove(ctx)
+}
+
+// migrateLegacyRecodeConfig moves a config stored in one record
+// (before sharding) to the sharded records.
+func (a *AWS) migrateLegacyRecodeConfig(
+	ctx context.Context,
+	stepper stepper.Stepper,
+	legacyConfig *infrastructure.StoredRecodeConfig,
+) (*entities.Config, error) {
+
+	var recodeConfig *entities.Config
+	err := json.Unmarshal([]byte(legacyConfig.ConfigJSON), &recodeConfig)
+
 	if err != nil {
+		return nil, err
+	}
 
-		if errors.Is(err, infrastructure.ErrNoRecodeConfigFound) {
-			// No config table or no records.
-			return nil, entities.ErrRecodeNotInstalled
-		}
+	// The sharded records don't exist yet
+	a.setConfigVersion(recodeConfig.ID, 0)
+	a.setConfigDataKey(recodeConfig.ID, nil)
 
+	err = a.SaveRecodeConfig(ctx, stepper, recodeConfig)
+
+	if err != nil {
 		return nil, err
 	}
 
-	var recodeConfig *entities.Config
-	err = json.Unmarshal([]byte(configJSON), &recodeConfig)
+	err = a.clients.ConfigStorage.RemoveLegacyConfig(
+		ctx,
+		legacyConfig.LegacyRecordID,
+	)
 
 	if err != nil {
 		return nil, err
@@ -59,35 +289,159 @@ func (a *AWS) LookupRecodeConfig(
 	return recodeConfig, nil
 }
 
-func (a *AWS) SaveRecodeConfig(
-	stepper stepper.Stepper,
+// splitRecodeConfig marshals the config without its clusters
+// and each cluster without its dev envs.
+func splitRecodeConfig(
 	config *entities.Config,
-) error {
+) (string, []infrastructure.StoredRecodeConfigCluster, error) {
+
+	configWithoutClusters := *config
+	configWithoutClusters.Clusters = nil
 
-	configJSON, err := json.Marshal(config)
+	configJSON, err := json.Marshal(configWithoutClusters)
 
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 
-	dynamoDBClient := dynamodb.NewFromConfig(a.sdkConfig)
+	clusters := []infrastructure.StoredRecodeConfigCluster{}
 
-	return infrastructure.UpdateRecodeConfigInDynamoDBTable(
-		dynamoDBClient,
-		config.ID,
-		string(configJSON),
-	)
+	for _, cluster := range config.Clusters {
+		clusterWithoutDevEnvs := *cluster
+		clusterWithoutDevEnvs.DevEnvs = nil
+
+		clusterJSON, err := json.Marshal(clusterWithoutDevEnvs)
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		storedCluster := infrastructure.StoredRecodeConfigCluster{
+			ClusterJSON: string(clusterJSON),
+			DevEnvJSONs: []string{},
+		}
+
+		for _, devEnv := range cluster.DevEnvs {
+			devEnvJSON, err := json.Marshal(devEnv)
+
+			if err != nil {
+				return "", nil, err
+			}
+
+			storedCluster.DevEnvJSONs = append(
+				storedCluster.DevEnvJSONs,
+				string(devEnvJSON),
+			)
+		}
+
+		clusters = append(clusters, storedCluster)
+	}
+
+	return string(configJSON), clusters, nil
 }
 
-func (a *AWS) RemoveRecodeConfigStorage(
-	stepper stepper.Stepper,
-) error {
+// decodeStoredRecodeConfig assembles the stored config and
+// decrypts its sensitive fields. The returned data key is nil
+// if the config is not encrypted.
+func (a *AWS) decodeStoredRecodeConfig(
+	ctx context.Context,
+	storedConfig *infrastructure.StoredRecodeConfig,
+) (*entities.Config, *configDataKey, error) {
+
+	recodeConfig, err := assembleRecodeConfig(storedConfig)
+
+	if err != nil {
+		return nil, nil, err
+	}
 
-	dynamoDBClient := dynamodb.NewFromConfig(a.sdkConfig)
+	var dataKey *configDataKey
 
-	stepper.StartTemporaryStep("Removing the DynamoDB table used to store Recode's data")
+	if len(storedConfig.EncryptedDataKey) > 0 {
+		dataKey, err = a.decryptConfigDataKey(
+			ctx,
+			storedConfig.DataKeyProviderID,
+			storedConfig.EncryptedDataKey,
+		)
 
-	return infrastructure.RemoveDynamoDBTableForRecodeConfig(
-		dynamoDBClient,
-	)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	recodeConfig, err = decryptRecodeConfig(recodeConfig, dataKey)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return recodeConfig, dataKey, nil
+}
+
+// assembleRecodeConfig is the inverse of splitRecodeConfig.
+func assembleRecodeConfig(
+	storedConfig *infrastructure.StoredRecodeConfig,
+) (*entities.Config, error) {
+
+	var recodeConfig *entities.Config
+	err := json.Unmarshal([]byte(storedConfig.ConfigJSON), &recodeConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	recodeConfig.Clusters = []*entities.Cluster{}
+
+	for _, storedCluster := range storedConfig.Clusters {
+		var cluster *entities.Cluster
+		err := json.Unmarshal([]byte(storedCluster.ClusterJSON), &cluster)
+
+		if err != nil {
+			return nil, err
+		}
+
+		cluster.DevEnvs = []*entities.DevEnv{}
+
+		for _, devEnvJSON := range storedCluster.DevEnvJSONs {
+			var devEnv *entities.DevEnv
+			err := json.Unmarshal([]byte(devEnvJSON), &devEnv)
+
+			if err != nil {
+				return nil, err
+			}
+
+			cluster.DevEnvs = append(cluster.DevEnvs, devEnv)
+		}
+
+		recodeConfig.Clusters = append(recodeConfig.Clusters, cluster)
+	}
+
+	return recodeConfig, nil
+}
+
+func (a *AWS) getConfigVersion(configID string) int64 {
+	a.configVersionsMu.Lock()
+	defer a.configVersionsMu.Unlock()
+
+	return a.configVersions[configID]
+}
+
+func (a *AWS) setConfigVersion(configID string, version int64) {
+	a.configVersionsMu.Lock()
+	defer a.configVersionsMu.Unlock()
+
+	a.configVersions[configID] = version
+}
+
+func (a *AWS) getConfigDataKey(configID string) *configDataKey {
+	a.configDataKeysMu.Lock()
+	defer a.configDataKeysMu.Unlock()
+
+	return a.configDataKeys[configID]
+}
+
+func (a *AWS) setConfigDataKey(configID string, dataKey *configDataKey) {
+	a.configDataKeysMu.Lock()
+	defer a.configDataKeysMu.Unlock()
+
+	a.configDataKeys[configID] = dataKey
 }
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/recode/entities"
+	"github.com/recode-sh/recode/stepper"
+)
+
+// DefaultConfigHistorySize represents the number of versions
+// of the config kept in history if not set in AWSOpts.
+const DefaultConfigHistorySize = 10
+
+// The value displayed in place of the sensitive
+// fields when two versions are compared.
+const redactedConfigValue = "<redacted>"
+
+// ErrConfigVersionNotFound represents the error returned
+// when a version is not (or no longer) kept in history.
+type ErrConfigVersionNotFound struct {
+	Version int64
+}
+
+func (ErrConfigVersionNotFound) Error() string {
+	return "ErrConfigVersionNotFound"
+}
+
+// RecodeConfigVersion represents a
+// version kept in the history of the config.
+type RecodeConfigVersion struct {
+	Version           int64
+	SavedAt           time.Time
+	WriterID          string
+	WriterDescription string
+}
+
+// RecodeConfigChange represents a field that
+// differs between two versions of the config.
+type RecodeConfigChange struct {
+	// Path identifies the field. Clusters and dev envs are
+	// identified by name (eg: "clusters[default].dev_envs[api].instance_type").
+	// Fields containing JSON (eg: "infrastructure_json") are compared field by field.
+	Path string
+
+	// The JSON-encoded values. From is empty if the field
+	// was added and To is empty if the field was removed.
+	// SSH private keys are redacted.
+	From string
+	To   string
+}
+
+// ListRecodeConfigVersions returns the versions
+// kept in the history of the config (most recent first).
+func (a *AWS) ListRecodeConfigVersions(
+	ctx context.Context,
+	stepper stepper.Stepper,
+) ([]RecodeConfigVersion, error) {
+
+	history, err := a.clients.ConfigStorage.LookupConfigHistory(ctx)
+
+	if err != nil {
+
+		if errors.Is(err, infrastructure.ErrNoRecodeConfigFound) {
+			return nil, entities.ErrRecodeNotInstalled
+		}
+
+		return nil, err
+	}
+
+	versions := []RecodeConfigVersion{}
+
+	for i := len(history) - 1; i >= 0; i-- {
+		versions = append(versions, RecodeConfigVersion{
+			Version:           history[i].Version,
+			SavedAt:           time.UnixMilli(history[i].SavedAt),
+			WriterID:          history[i].WriterID,
+			WriterDescription: history[i].WriterDescription,
+		})
+	}
+
+	return versions, nil
+}
+
+// LookupRecodeConfigVersion returns the passed version
+// of the config (see ListRecodeConfigVersions).
+func (a *AWS) LookupRecodeConfigVersion(
+	ctx context.Context,
+	stepper stepper.Stepper,
+	version int64,
+) (*entities.Config, error) {
+
+	storedConfig, err := a.clients.ConfigStorage.LookupConfigVersion(ctx, version)
+
+	if err != nil {
+
+		if errors.Is(err, infrastructure.ErrRecodeConfigVersionNotFound) {
+			return nil, ErrConfigVersionNotFound{
+				Version: version,
+			}
+		}
+
+		return nil, err
+	}
+
+	recodeConfig, _, err := a.decodeStoredRecodeConfig(ctx, storedConfig)
+
+	return recodeConfig, err
+}
+
+// DiffRecodeConfigVersions returns the fields that differ
+// between the passed versions of the config (sorted by path).
+func (a *AWS) DiffRecodeConfigVersions(
+	ctx context.Context,
+	stepper stepper.Stepper,
+	fromVersion int64,
+	toVersion int64,
+) ([]RecodeConfigChange, error) {
+
+	fromConfig, err := a.LookupRecodeConfigVersion(ctx, stepper, fromVersion)
+
+	if err != nil {
+		return nil, err
+	}
+
+	toConfig, err := a.LookupRecodeConfigVersion(ctx, stepper, toVersion)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return diffRecodeConfigs(fromConfig, toConfig)
+}
+
+// RestoreRecodeConfigVersion saves the passed version of the config
+// as the current one. The current version is kept in history.
+func (a *AWS) RestoreRecodeConfigVersion(
+	ctx context.Context,
+	stepper stepper.Stepper,
+	version int64,
+) (*entities.Config, error) {
+
+	stepper.StartTemporaryStep(
+		fmt.Sprintf("Restoring version %d of Recode's data", version),
+	)
+
+	restoredConfig, err := a.LookupRecodeConfigVersion(ctx, stepper, version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a.UpdateRecodeConfig(
+		ctx,
+		stepper,
+		func(config *entities.Config) error {
+			*config = *restoredConfig
+			return nil
+		},
+	)
+}
+
+func diffRecodeConfigs(
+	fromConfig *entities.Config,
+	toConfig *entities.Config,
+) ([]RecodeConfigChange, error) {
+
+	fromFields, err := flattenRecodeConfig(fromConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	toFields, err := flattenRecodeConfig(toConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+
+	for path := range fromFields {
+		paths = append(paths, path)
+	}
+
+	for path := range toFields {
+		if _, ok := fromFields[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+
+	changes := []RecodeConfigChange{}
+
+	for _, path := range paths {
+		fromValue, toValue := fromFields[path], toFields[path]
+
+		if fromValue == toValue {
+			continue
+		}
+
+		if isSensitiveConfigPath(path) {
+			fromValue = redactConfigValue(fromValue)
+			toValue = redactConfigValue(toValue)
+		}
+
+		changes = append(changes, RecodeConfigChange{
+			Path: path,
+			From: fromValue,
+			To:   toValue,
+		})
+	}
+
+	return changes, nil
+}
+
+// flattenRecodeConfig returns the JSON-encoded
+// value of each field of the config indexed by path.
+func flattenRecodeConfig(config *entities.Config) (map[string]string, error) {
+	configJSON, err := json.Marshal(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var decodedConfig interface{}
+
+	if err := json.Unmarshal(configJSON, &decodedConfig); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{}
+	err = flattenJSONValue("", decodedConfig, fields)
+
+	return fields, err
+}
+
+func flattenJSONValue(
+	path string,
+	value interface{},
+	fields map[string]string,
+) error {
+
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		if len(typedValue) == 0 {
+			fields[path] = "{}"
+			return nil
+		}
+
+		for key, fieldValue := range typedValue {
+			fieldPath := key
+
+			if len(path) > 0 {
+				fieldPath = path + "." + key
+			}
+
+			// Fields containing JSON (eg: "infrastructure_json")
+			// are compared field by field
+			if encodedJSON, ok := fieldValue.(string); ok &&
+				strings.HasSuffix(key, "_json") &&
+				strings.HasPrefix(encodedJSON, "{") {
+
+				var decodedJSON interface{}
+
+				if err := json.Unmarshal([]byte(encodedJSON), &decodedJSON); err == nil {
+					fieldValue = decodedJSON
+				}
+			}
+
+			if err := flattenJSONValue(fieldPath, fieldValue, fields); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case []interface{}:
+		if len(typedValue) == 0 {
+			fields[path] = "[]"
+			return nil
+		}
+
+		for i, element := range typedValue {
+			elementPath := path + "[" + strconv.Itoa(i) + "]"
+
+			// Clusters and dev envs are identified by name
+			if object, ok := element.(map[string]interface{}); ok {
+				if name, ok := object["name"].(string); ok && len(name) > 0 {
+					elementPath = path + "[" + name + "]"
+				}
+			}
+
+			if err := flattenJSONValue(elementPath, element, fields); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	encodedValue, err := json.Marshal(value)
+
+	if err != nil {
+		return err
+	}
+
+	fields[path] = string(encodedValue)
+
+	return nil
+}
+
+// redactConfigValue hides the passed value
+// unless it is missing or empty.
+func redactConfigValue(value string) string {
+	if len(value) == 0 || value == `""` {
+		return value
+	}
+
+	return redactedConfigValue
+}
+
+func isSensitiveConfigPath(path string) bool {
+	return strings.HasSuffix(path, ".ssh_key_pair_pem_content") ||
+		strings.HasSuffix(path, ".pem_content")
+}
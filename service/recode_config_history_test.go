@@ -0,0 +1,186 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+// saveRecodeConfigVersions installs the config and
+// adds one cluster per passed name (one version each).
+func saveRecodeConfigVersions(
+	t *testing.T,
+	recodeCLI *service.AWS,
+	clusterNames ...string,
+) {
+
+	t.Helper()
+
+	config := &entities.Config{
+		ID: "recode-config",
+	}
+
+	err := recodeCLI.SaveRecodeConfig(context.Background(), &fakes.Stepper{}, config)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	for _, clusterName := range clusterNames {
+		config.Clusters = append(config.Clusters, &entities.Cluster{
+			Name:    clusterName,
+			DevEnvs: []*entities.DevEnv{{Name: clusterName + "-dev-env", InstanceType: "t2.medium"}},
+		})
+
+		err := recodeCLI.SaveRecodeConfig(context.Background(), &fakes.Stepper{}, config)
+
+		if err != nil {
+			t.Fatalf("expected no error, got '%+v'", err)
+		}
+	}
+}
+
+func TestListRecodeConfigVersions(t *testing.T) {
+	cloud := newFakeCloud(t)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		Lease: service.LeaseOpts{
+			OwnerID:          "owner",
+			OwnerDescription: "jane@laptop (pid 42)",
+		},
+		ConfigHistorySize: 3,
+	})
+
+	saveRecodeConfigVersions(t, recodeCLI, "first", "second", "third")
+
+	versions, err := recodeCLI.ListRecodeConfigVersions(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(versions) != 3 ||
+		versions[0].Version != 4 ||
+		versions[2].Version != 2 {
+
+		t.Fatalf("expected versions 4 to 2, got '%+v'", versions)
+	}
+
+	if versions[0].WriterID != "owner" ||
+		versions[0].WriterDescription != "jane@laptop (pid 42)" ||
+		versions[0].SavedAt.IsZero() {
+
+		t.Errorf("expected writer and date to be kept, got '%+v'", versions[0])
+	}
+
+	_, err = recodeCLI.LookupRecodeConfigVersion(context.Background(), &fakes.Stepper{}, 1)
+
+	if !errors.As(err, &service.ErrConfigVersionNotFound{}) {
+		t.Fatalf("expected version not found error, got '%+v'", err)
+	}
+
+	config, err := recodeCLI.LookupRecodeConfigVersion(context.Background(), &fakes.Stepper{}, 2)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(config.Clusters) != 1 ||
+		config.Clusters[0].Name != "first" ||
+		config.Clusters[0].DevEnvs[0].Name != "first-dev-env" {
+
+		t.Errorf("expected version 2 to be returned, got '%+v'", config.Clusters)
+	}
+}
+
+func TestDiffRecodeConfigVersions(t *testing.T) {
+	cloud := newFakeCloud(t)
+	recodeCLI := cloud.AWSService()
+
+	saveRecodeConfigVersions(t, recodeCLI, "first")
+
+	_, err := recodeCLI.UpdateRecodeConfig(
+		context.Background(),
+		&fakes.Stepper{},
+		func(config *entities.Config) error {
+			config.Clusters[0].DevEnvs[0].InstanceType = "m6g.large"
+			config.Clusters[0].DevEnvs[0].SSHKeyPairPEMContent = fakeSSHPrivateKey
+			return nil
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	changes, err := recodeCLI.DiffRecodeConfigVersions(context.Background(), &fakes.Stepper{}, 2, 3)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	expectedChanges := []service.RecodeConfigChange{
+		{
+			Path: "clusters[first].dev_envs[first-dev-env].instance_type",
+			From: `"t2.medium"`,
+			To:   `"m6g.large"`,
+		},
+
+		{
+			Path: "clusters[first].dev_envs[first-dev-env].ssh_key_pair_pem_content",
+			From: `""`,
+			To:   "<redacted>",
+		},
+	}
+
+	if len(changes) != len(expectedChanges) {
+		t.Fatalf("expected changes '%+v', got '%+v'", expectedChanges, changes)
+	}
+
+	for i := range expectedChanges {
+		if changes[i] != expectedChanges[i] {
+			t.Errorf("expected change '%+v', got '%+v'", expectedChanges[i], changes[i])
+		}
+	}
+}
+
+func TestRestoreRecodeConfigVersion(t *testing.T) {
+	cloud := newFakeCloud(t)
+	recodeCLI := cloud.AWSService()
+
+	saveRecodeConfigVersions(t, recodeCLI, "first", "second")
+
+	restoredConfig, err := recodeCLI.RestoreRecodeConfigVersion(context.Background(), &fakes.Stepper{}, 2)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(restoredConfig.Clusters) != 1 || restoredConfig.Clusters[0].Name != "first" {
+		t.Fatalf("expected version 2 to be restored, got '%+v'", restoredConfig.Clusters)
+	}
+
+	config, err := cloud.AWSService().LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(config.Clusters) != 1 || config.Clusters[0].Name != "first" {
+		t.Errorf("expected version 2 to be the current one, got '%+v'", config.Clusters)
+	}
+
+	// The overwritten version is kept
+	overwrittenConfig, err := recodeCLI.LookupRecodeConfigVersion(context.Background(), &fakes.Stepper{}, 3)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(overwrittenConfig.Clusters) != 2 {
+		t.Errorf("expected version 3 to be kept, got '%+v'", overwrittenConfig.Clusters)
+	}
+}
@@ -0,0 +1,406 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+func installRecodeConfigInFakeCloud(t *testing.T, cloud *fakeCloud) *entities.Config {
+	t.Helper()
+
+	config := &entities.Config{
+		ID: "recode-config",
+	}
+
+	err := cloud.AWSService().SaveRecodeConfig(context.Background(), &fakes.Stepper{}, config)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	return config
+}
+
+func TestSaveRecodeConfigWithConcurrentUpdate(t *testing.T) {
+	cloud := newFakeCloud(t)
+	installRecodeConfigInFakeCloud(t, cloud)
+
+	firstCLI := cloud.AWSService()
+	secondCLI := cloud.AWSService()
+
+	firstConfig, err := firstCLI.LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	secondConfig, err := secondCLI.LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	firstConfig.Clusters = append(firstConfig.Clusters, &entities.Cluster{Name: "first"})
+	err = firstCLI.SaveRecodeConfig(context.Background(), &fakes.Stepper{}, firstConfig)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	secondConfig.Clusters = append(secondConfig.Clusters, &entities.Cluster{Name: "second"})
+	err = secondCLI.SaveRecodeConfig(context.Background(), &fakes.Stepper{}, secondConfig)
+
+	var conflictErr service.ErrConfigConflict
+
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("expected config conflict error, got '%+v'", err)
+	}
+
+	if conflictErr.ConfigID != secondConfig.ID || conflictErr.ExpectedVersion != 1 {
+		t.Errorf("expected conflict on version 1 of '%s', got '%+v'", secondConfig.ID, conflictErr)
+	}
+
+	storedConfig, err := cloud.AWSService().LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(storedConfig.Clusters) != 1 || storedConfig.Clusters[0].Name != "first" {
+		t.Errorf("expected first update to be kept, got '%+v'", storedConfig.Clusters)
+	}
+}
+
+func TestUpdateRecodeConfigRetriesOnConflict(t *testing.T) {
+	cloud := newFakeCloud(t)
+	installRecodeConfigInFakeCloud(t, cloud)
+
+	concurrentCLI := cloud.AWSService()
+	updateCalls := 0
+
+	config, err := cloud.AWSService().UpdateRecodeConfig(
+		context.Background(),
+		&fakes.Stepper{},
+		func(config *entities.Config) error {
+			updateCalls++
+
+			// Simulate a concurrent update
+			// between the read and the write
+			if updateCalls == 1 {
+				_, err := concurrentCLI.UpdateRecodeConfig(
+					context.Background(),
+					&fakes.Stepper{},
+					func(config *entities.Config) error {
+						config.Clusters = append(config.Clusters, &entities.Cluster{Name: "concurrent"})
+						return nil
+					},
+				)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			config.Clusters = append(config.Clusters, &entities.Cluster{Name: "mine"})
+			return nil
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if updateCalls != 2 {
+		t.Errorf("expected update to be retried once, got %d calls", updateCalls)
+	}
+
+	if len(config.Clusters) != 2 ||
+		config.Clusters[0].Name != "concurrent" ||
+		config.Clusters[1].Name != "mine" {
+
+		t.Errorf("expected both updates to be merged, got '%+v'", config.Clusters)
+	}
+}
+
+func TestSaveRecodeConfigShardsClustersAndDevEnvs(t *testing.T) {
+	cloud := newFakeCloud(t)
+	installRecodeConfigInFakeCloud(t, cloud)
+
+	// Only the current version is kept
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		ConfigHistorySize: 1,
+	})
+
+	config, err := recodeCLI.LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	config.Clusters = []*entities.Cluster{
+		{
+			Name: "first",
+			DevEnvs: []*entities.DevEnv{
+				{Name: "first-dev-env"},
+				{Name: "second-dev-env"},
+			},
+		},
+		{
+			Name: "second",
+		},
+	}
+
+	err = recodeCLI.SaveRecodeConfig(context.Background(), &fakes.Stepper{}, config)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	// One root record, its snapshot, two cluster records and two dev env records
+	if items := cloud.DynamoDB.Items(infrastructure.DynamoDBRecodeConfigTableName); len(items) != 6 {
+		t.Fatalf("expected 6 records, got %d", len(items))
+	}
+
+	storedConfig, err := cloud.AWSService().LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(storedConfig.Clusters) != 2 ||
+		storedConfig.Clusters[0].Name != "first" ||
+		storedConfig.Clusters[1].Name != "second" ||
+		len(storedConfig.Clusters[0].DevEnvs) != 2 ||
+		storedConfig.Clusters[0].DevEnvs[0].Name != "first-dev-env" ||
+		storedConfig.Clusters[0].DevEnvs[1].Name != "second-dev-env" ||
+		len(storedConfig.Clusters[1].DevEnvs) != 0 {
+
+		t.Errorf("expected config to be stored, got '%+v'", storedConfig.Clusters)
+	}
+
+	if scanCalls := cloud.DynamoDB.Calls("Scan"); scanCalls != 0 {
+		t.Errorf("expected config to be looked up without scan, got %d scans", scanCalls)
+	}
+
+	// Unreferenced records are removed
+	config.Clusters = config.Clusters[1:]
+	err = recodeCLI.SaveRecodeConfig(context.Background(), &fakes.Stepper{}, config)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if items := cloud.DynamoDB.Items(infrastructure.DynamoDBRecodeConfigTableName); len(items) != 3 {
+		t.Errorf("expected 3 records, got %d", len(items))
+	}
+}
+
+func putLegacyRecodeConfigInFakeCloud(t *testing.T, cloud *fakeCloud) {
+	t.Helper()
+
+	legacyConfigJSON, err := json.Marshal(&entities.Config{
+		ID: "recode-config",
+		Clusters: []*entities.Cluster{
+			{
+				Name:    "default",
+				DevEnvs: []*entities.DevEnv{{Name: "dev-env"}},
+			},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	legacyRecord, err := attributevalue.MarshalMap(map[string]interface{}{
+		"ID":         "recode-config",
+		"ConfigJSON": string(legacyConfigJSON),
+		"Version":    3,
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	_, err = cloud.DynamoDB.PutItem(context.Background(), &dynamodb.PutItemInput{
+		TableName: aws.String(infrastructure.DynamoDBRecodeConfigTableName),
+		Item:      legacyRecord,
+	})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+}
+
+func TestLookupRecodeConfigMigratesLegacyRecord(t *testing.T) {
+	cloud := newFakeCloud(t)
+	putLegacyRecodeConfigInFakeCloud(t, cloud)
+
+	config, err := cloud.AWSService().LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(config.Clusters) != 1 || len(config.Clusters[0].DevEnvs) != 1 {
+		t.Fatalf("expected legacy config to be returned, got '%+v'", config)
+	}
+
+	for _, item := range cloud.DynamoDB.Items(infrastructure.DynamoDBRecodeConfigTableName) {
+		if id := item["ID"].(*types.AttributeValueMemberS).Value; id == "recode-config" {
+			t.Errorf("expected legacy record to be removed")
+		}
+	}
+
+	scanCalls := cloud.DynamoDB.Calls("Scan")
+	config, err = cloud.AWSService().LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if config.ID != "recode-config" ||
+		len(config.Clusters) != 1 ||
+		config.Clusters[0].DevEnvs[0].Name != "dev-env" {
+
+		t.Errorf("expected migrated config to be returned, got '%+v'", config)
+	}
+
+	if cloud.DynamoDB.Calls("Scan") != scanCalls {
+		t.Errorf("expected migrated config to be looked up without scan")
+	}
+}
+
+func TestLookupRecodeConfigWithLegacyRecordMigratedConcurrently(t *testing.T) {
+	conditionalCheckFailedErr := &types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("ConditionalCheckFailed")},
+		},
+	}
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		cloud := newFakeCloud(t)
+		putLegacyRecodeConfigInFakeCloud(t, cloud)
+
+		for i := 0; i < 5; i++ {
+			cloud.DynamoDB.FailNext("TransactWriteItems", conditionalCheckFailedErr)
+		}
+
+		_, err := cloud.AWSService().LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+		if !errors.As(err, &service.ErrConfigConflict{}) {
+			t.Fatalf("expected config conflict error, got '%+v'", err)
+		}
+
+		if calls := cloud.DynamoDB.Calls("TransactWriteItems"); calls != 5 {
+			t.Errorf("expected 5 migration attempts, got %d", calls)
+		}
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		cloud := newFakeCloud(t)
+		putLegacyRecodeConfigInFakeCloud(t, cloud)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		cloud.DynamoDB.FailNext("TransactWriteItems", conditionalCheckFailedErr)
+		cloud.DynamoDB.BeforeCall("TransactWriteItems", cancel)
+
+		_, err := cloud.AWSService().LookupRecodeConfig(ctx, &fakes.Stepper{})
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled error, got '%+v'", err)
+		}
+
+		if calls := cloud.DynamoDB.Calls("TransactWriteItems"); calls != 1 {
+			t.Errorf("expected 1 migration attempt, got %d", calls)
+		}
+	})
+}
+
+func TestLookupRecodeConfigReadsShardsInBatches(t *testing.T) {
+	cloud := newFakeCloud(t)
+	installRecodeConfigInFakeCloud(t, cloud)
+
+	recodeCLI := cloud.AWSService()
+	config, err := recodeCLI.LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	config.Clusters = []*entities.Cluster{
+		{
+			Name: "first",
+			DevEnvs: []*entities.DevEnv{
+				{Name: "first-dev-env"},
+				{Name: "second-dev-env"},
+			},
+		},
+		{
+			Name:    "second",
+			DevEnvs: []*entities.DevEnv{{Name: "third-dev-env"}},
+		},
+	}
+
+	err = recodeCLI.SaveRecodeConfig(context.Background(), &fakes.Stepper{}, config)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	getItemCalls := cloud.DynamoDB.Calls("GetItem")
+	batchGetItemCalls := cloud.DynamoDB.Calls("BatchGetItem")
+
+	storedConfig, err := cloud.AWSService().LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(storedConfig.Clusters) != 2 ||
+		len(storedConfig.Clusters[0].DevEnvs) != 2 ||
+		storedConfig.Clusters[0].DevEnvs[1].Name != "second-dev-env" ||
+		storedConfig.Clusters[1].DevEnvs[0].Name != "third-dev-env" {
+
+		t.Fatalf("expected config to be returned, got '%+v'", storedConfig.Clusters)
+	}
+
+	// The root record, then one batch for
+	// the clusters and one for the dev envs
+	if calls := cloud.DynamoDB.Calls("GetItem") - getItemCalls; calls != 1 {
+		t.Errorf("expected 1 GetItem call, got %d", calls)
+	}
+
+	if calls := cloud.DynamoDB.Calls("BatchGetItem") - batchGetItemCalls; calls != 2 {
+		t.Errorf("expected 2 BatchGetItem calls, got %d", calls)
+	}
+
+	// Unprocessed keys are requested again
+	cloud.DynamoDB.SetMaxBatchGetItemKeysProcessed(1)
+
+	storedConfig, err = cloud.AWSService().LookupRecodeConfig(context.Background(), &fakes.Stepper{})
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if len(storedConfig.Clusters) != 2 ||
+		len(storedConfig.Clusters[0].DevEnvs) != 2 ||
+		len(storedConfig.Clusters[1].DevEnvs) != 1 {
+
+		t.Errorf("expected config to be returned, got '%+v'", storedConfig.Clusters)
+	}
+}
@@ -1,9 +1,9 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/recode-sh/aws-cloud-provider/infrastructure"
 	"github.com/recode-sh/recode/entities"
 	"github.com/recode-sh/recode/queues"
@@ -11,36 +11,53 @@ import (
 )
 
 func (a *AWS) RemoveCluster(
+	ctx context.Context,
 	stepper stepper.Stepper,
 	config *entities.Config,
 	cluster *entities.Cluster,
-) error {
+) (returnedError error) {
+
+	lease, err := a.acquireClusterLease(ctx, cluster.GetNameSlug())
+
+	if err != nil {
+		return err
+	}
+
+	ctx = lease.ctx
+	defer func() { returnedError = a.releaseLease(lease, returnedError) }()
 
 	var clusterInfra *ClusterInfrastructure
-	err := json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
+	err = json.Unmarshal([]byte(cluster.InfrastructureJSON), &clusterInfra)
 
 	if err != nil {
 		return err
 	}
 
-	ec2Client := ec2.NewFromConfig(a.sdkConfig)
-	clusterInfraQueue := queues.InfrastructureQueue[*ClusterInfrastructure]{}
+	ec2Client := a.clients.EC2
+	clusterInfraQueue := queues.InfrastructureQueue[*ClusterInfrastructure](
+		a.removeVPCEndpointsSteps(ctx, stepper),
+	)
 
-	removeSubnet := func(infra *ClusterInfrastructure) error {
-		if infra.Subnet == nil {
-			return nil
-		}
+	removeSubnets := func(infra *ClusterInfrastructure) error {
+		for len(infra.Subnets) > 0 {
+			subnet := infra.Subnets[0]
 
-		err := infrastructure.RemoveSubnet(
-			ec2Client,
-			infra.Subnet.ID,
-		)
+			// Not created by Recode
+			if !subnet.IsAdopted {
+				err := infrastructure.RemoveSubnet(
+					ctx,
+					ec2Client,
+					subnet.ID,
+				)
 
-		if err != nil {
-			return err
+				if err != nil {
+					return err
+				}
+			}
+
+			infra.Subnets = infra.Subnets[1:]
 		}
 
-		infra.Subnet = nil
 		return nil
 	}
 
@@ -48,10 +65,10 @@ func (a *AWS) RemoveCluster(
 		clusterInfraQueue,
 		queues.InfrastructureQueueSteps[*ClusterInfrastructure]{
 			func(*ClusterInfrastructure) error {
-				stepper.StartTemporaryStep("Removing the subnet")
+				stepper.StartTemporaryStep("Removing the subnets")
 				return nil
 			},
-			removeSubnet,
+			removeSubnets,
 		},
 	)
 
@@ -61,6 +78,7 @@ func (a *AWS) RemoveCluster(
 		}
 
 		err := infrastructure.RemoveRouteTable(
+			ctx,
 			ec2Client,
 			infra.RouteTable.ID,
 		)
@@ -90,6 +108,7 @@ func (a *AWS) RemoveCluster(
 		}
 
 		err := infrastructure.DetachInternetGatewayFromVPC(
+			ctx,
 			ec2Client,
 			infra.InternetGateway.ID,
 			infra.VPC.ID,
@@ -120,6 +139,7 @@ func (a *AWS) RemoveCluster(
 		}
 
 		err := infrastructure.RemoveInternetGateway(
+			ctx,
 			ec2Client,
 			infra.InternetGateway.ID,
 		)
@@ -148,7 +168,14 @@ func (a *AWS) RemoveCluster(
 			return nil
 		}
 
+		// Not created by Recode
+		if infra.VPC.IsAdopted {
+			infra.VPC = nil
+			return nil
+		}
+
 		err := infrastructure.RemoveVPC(
+			ctx,
 			ec2Client,
 			infra.VPC.ID,
 		)
@@ -1,9 +1,9 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/recode-sh/aws-cloud-provider/infrastructure"
 	"github.com/recode-sh/recode/entities"
 	"github.com/recode-sh/recode/queues"
@@ -11,20 +11,30 @@ import (
 )
 
 func (a *AWS) RemoveDevEnv(
+	ctx context.Context,
 	stepper stepper.Stepper,
 	config *entities.Config,
 	cluster *entities.Cluster,
 	devEnv *entities.DevEnv,
-) error {
+) (returnedError error) {
+
+	lease, err := a.acquireDevEnvLease(ctx, cluster.GetNameSlug(), devEnv.GetNameSlug())
+
+	if err != nil {
+		return err
+	}
+
+	ctx = lease.ctx
+	defer func() { returnedError = a.releaseLease(lease, returnedError) }()
 
 	var devEnvInfra *DevEnvInfrastructure
-	err := json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+	err = json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
 
 	if err != nil {
 		return err
 	}
 
-	ec2Client := ec2.NewFromConfig(a.sdkConfig)
+	ec2Client := a.clients.EC2
 	devEnvInfraQueue := queues.InfrastructureQueue[*DevEnvInfrastructure]{}
 
 	terminateInstance := func(infra *DevEnvInfrastructure) error {
@@ -32,7 +42,22 @@ func (a *AWS) RemoveDevEnv(
 			return nil
 		}
 
+		// The persistent spot request would
+		// launch a new instance otherwise
+		if len(infra.Instance.SpotInstanceRequestID) > 0 {
+			err := infrastructure.CancelSpotInstanceRequest(
+				ctx,
+				ec2Client,
+				infra.Instance.SpotInstanceRequestID,
+			)
+
+			if err != nil {
+				return err
+			}
+		}
+
 		err := infrastructure.TerminateInstance(
+			ctx,
 			ec2Client,
 			infra.Instance.ID,
 		)
@@ -45,6 +70,27 @@ func (a *AWS) RemoveDevEnv(
 		return nil
 	}
 
+	// The root volume detached from the spot instance
+	// during an interrupted fallback to on-demand
+	removeSpotInstanceRootVolume := func(infra *DevEnvInfrastructure) error {
+		if infra.SpotInstanceFallback == nil {
+			return nil
+		}
+
+		removeVolumeResp := infrastructure.RemoveVolume(
+			ctx,
+			ec2Client,
+			infra.SpotInstanceFallback.RootVolume.ID,
+		)
+
+		if removeVolumeResp.Err != nil {
+			return removeVolumeResp.Err
+		}
+
+		infra.SpotInstanceFallback = nil
+		return nil
+	}
+
 	devEnvInfraQueue = append(
 		devEnvInfraQueue,
 		queues.InfrastructureQueueSteps[*DevEnvInfrastructure]{
@@ -53,6 +99,57 @@ func (a *AWS) RemoveDevEnv(
 				return nil
 			},
 			terminateInstance,
+			removeSpotInstanceRootVolume,
+		},
+	)
+
+	releaseElasticIP := func(infra *DevEnvInfrastructure) error {
+		if infra.ElasticIP == nil {
+			return nil
+		}
+
+		err := infrastructure.ReleaseElasticIP(
+			ctx,
+			ec2Client,
+			infra.ElasticIP,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		infra.ElasticIP = nil
+		return nil
+	}
+
+	removeDNSRecord := func(infra *DevEnvInfrastructure) error {
+		if infra.DNSRecord == nil {
+			return nil
+		}
+
+		err := infrastructure.RemoveDNSRecord(
+			ctx,
+			a.clients.Route53,
+			infra.DNSRecord,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		infra.DNSRecord = nil
+		return nil
+	}
+
+	devEnvInfraQueue = append(
+		devEnvInfraQueue,
+		queues.InfrastructureQueueSteps[*DevEnvInfrastructure]{
+			func(*DevEnvInfrastructure) error {
+				stepper.StartTemporaryStep("Releasing the Elastic IP and removing the DNS record")
+				return nil
+			},
+			releaseElasticIP,
+			removeDNSRecord,
 		},
 	)
 
@@ -62,6 +159,7 @@ func (a *AWS) RemoveDevEnv(
 		}
 
 		err := infrastructure.RemoveKeyPair(
+			ctx,
 			ec2Client,
 			infra.KeyPair.ID,
 		)
@@ -80,6 +178,7 @@ func (a *AWS) RemoveDevEnv(
 		}
 
 		err := infrastructure.RemoveNetworkInterface(
+			ctx,
 			ec2Client,
 			infra.NetworkInterface.ID,
 		)
@@ -92,6 +191,25 @@ func (a *AWS) RemoveDevEnv(
 		return nil
 	}
 
+	removeInstanceProfile := func(infra *DevEnvInfrastructure) error {
+		if infra.InstanceProfile == nil {
+			return nil
+		}
+
+		err := infrastructure.RemoveInstanceProfile(
+			ctx,
+			a.clients.IAM,
+			infra.InstanceProfile,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		infra.InstanceProfile = nil
+		return nil
+	}
+
 	devEnvInfraQueue = append(
 		devEnvInfraQueue,
 		queues.InfrastructureQueueSteps[*DevEnvInfrastructure]{
@@ -101,6 +219,7 @@ func (a *AWS) RemoveDevEnv(
 			},
 			removeKeyPair,
 			removeNetworkInterface,
+			removeInstanceProfile,
 		},
 	)
 
@@ -110,6 +229,7 @@ func (a *AWS) RemoveDevEnv(
 		}
 
 		err := infrastructure.RemoveSecurityGroup(
+			ctx,
 			ec2Client,
 			infra.SecurityGroup.ID,
 		)
@@ -0,0 +1,105 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/recode/entities"
+)
+
+func TestRemoveDevEnvAndCluster(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	err := cloud.AWSService().CreateDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		devEnv,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = cloud.AWSService().RemoveDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		devEnv,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = cloud.AWSService().RemoveCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	assertNoResourceLeft(t, cloud.EC2)
+}
+
+func TestRemoveDevEnvAfterPartialCreation(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	cloud.EC2.FailNext("RunInstances", context.DeadlineExceeded)
+
+	err := cloud.AWSService().CreateDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		devEnv,
+	)
+
+	if err == nil {
+		t.Fatalf("expected error, got nothing")
+	}
+
+	err = cloud.AWSService().RemoveDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		devEnv,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = cloud.AWSService().RemoveCluster(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	assertNoResourceLeft(t, cloud.EC2)
+}
@@ -1,15 +1,16 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"sync"
 
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/recode-sh/aws-cloud-provider/infrastructure"
 	"github.com/recode-sh/recode/entities"
 )
 
 func (a *AWS) RestoreDevEnvData(
+	ctx context.Context,
 	config *entities.Config,
 	cluster *entities.Cluster,
 	devEnv *entities.DevEnv,
@@ -29,13 +30,22 @@ func (a *AWS) RestoreDevEnvData(
 		return nil, err
 	}
 
-	ec2Client := ec2.NewFromConfig(a.sdkConfig)
+	ec2Client := a.clients.EC2
 	prefixResource := prefixDevEnvResource(cluster.GetNameSlug(), devEnv.GetNameSlug())
 
+	availabilityZone := devEnvInfra.AvailabilityZone
+
+	// Dev envs created before the availability zone was
+	// recorded use the single subnet of their cluster
+	if len(availabilityZone) == 0 {
+		availabilityZone = clusterInfra.Subnets[0].AvailabilityZone
+	}
+
 	var attacheVolumeWG sync.WaitGroup
 	attachVolumeErrors := make([]error, len(devEnvInfra.Instance.Volumes))
 
 	devEnvInfraUpdatedVolumes := make([]infrastructure.InstanceVolume, len(devEnvInfra.Instance.Volumes))
+	copy(devEnvInfraUpdatedVolumes, devEnvInfra.Instance.Volumes)
 
 	for i, volume := range devEnvInfra.Instance.Volumes {
 		attacheVolumeWG.Add(1)
@@ -46,9 +56,10 @@ func (a *AWS) RestoreDevEnvData(
 			volumeName := "root-volume"
 
 			createVolumeResp := infrastructure.CreateVolumeFromSnapshot(
+				ctx,
 				ec2Client,
 				prefixResource(volumeName),
-				clusterInfra.Subnet.AvailabilityZone,
+				availabilityZone,
 				volume.SnapshotID,
 			)
 
@@ -57,10 +68,10 @@ func (a *AWS) RestoreDevEnvData(
 				return
 			}
 
-			devEnvInfraUpdatedVolumes[i] = volume
 			devEnvInfraUpdatedVolumes[i].ID = createVolumeResp.VolumeID
 
 			attachVolumeResp := infrastructure.AttachVolume(
+				ctx,
 				ec2Client,
 				devEnvInfra.Instance.ID,
 				createVolumeResp.VolumeID,
@@ -76,14 +87,8 @@ func (a *AWS) RestoreDevEnvData(
 
 	attacheVolumeWG.Wait()
 
-	for _, err := range attachVolumeErrors {
-		if err == nil {
-			continue
-		}
-
-		return nil, err
-	}
-
+	// Dev env infra could be updated even
+	// in case of error (partial infrastructure)
 	devEnvInfra.Instance.Volumes = devEnvInfraUpdatedVolumes
 	devEnvInfraJSON, err := json.Marshal(devEnvInfra)
 
@@ -93,5 +98,13 @@ func (a *AWS) RestoreDevEnvData(
 
 	s := string(devEnvInfraJSON)
 
+	for _, err := range attachVolumeErrors {
+		if err == nil {
+			continue
+		}
+
+		return &s, err
+	}
+
 	return &s, nil
 }
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"sync"
 
@@ -11,6 +12,7 @@ import (
 )
 
 func SaveDevEnvData(
+	ctx context.Context,
 	config *entities.Config,
 	cluster *entities.Cluster,
 	devEnv *entities.DevEnv,
@@ -30,6 +32,7 @@ func SaveDevEnvData(
 	createSnapshotErrors := make([]error, len(devEnvInfra.Instance.Volumes))
 
 	devEnvInfraUpdatedVolumes := make([]infrastructure.InstanceVolume, len(devEnvInfra.Instance.Volumes))
+	copy(devEnvInfraUpdatedVolumes, devEnvInfra.Instance.Volumes)
 
 	for i, volume := range devEnvInfra.Instance.Volumes {
 		createSnapshotWG.Add(1)
@@ -40,6 +43,7 @@ func SaveDevEnvData(
 			snapshotName := "root-volume-snapshot"
 
 			createSnapshotForVolumeResp := infrastructure.CreateSnapshotForVolume(
+				ctx,
 				ec2Client,
 				prefixResource(snapshotName),
 				volume.ID,
@@ -50,8 +54,10 @@ func SaveDevEnvData(
 				return
 			}
 
+			devEnvInfraUpdatedVolumes[i].SnapshotID = createSnapshotForVolumeResp.SnapshotID
+
 			if len(volume.SnapshotID) > 0 { // Volume has old snapshot
-				removeVolumeSnapshotResp := infrastructure.RemoveVolumeSnapshot(ec2Client, volume.SnapshotID)
+				removeVolumeSnapshotResp := infrastructure.RemoveVolumeSnapshot(ctx, ec2Client, volume.SnapshotID)
 
 				if removeVolumeSnapshotResp.Err != nil {
 					createSnapshotErrors[i] = removeVolumeSnapshotResp.Err
@@ -59,10 +65,8 @@ func SaveDevEnvData(
 				}
 			}
 
-			devEnvInfraUpdatedVolumes[i] = volume
-			devEnvInfraUpdatedVolumes[i].SnapshotID = createSnapshotForVolumeResp.SnapshotID
-
 			detachVolumeResp := infrastructure.DetachVolume(
+				ctx,
 				ec2Client,
 				devEnvInfra.Instance.ID,
 				volume.ID,
@@ -75,6 +79,7 @@ func SaveDevEnvData(
 			}
 
 			removeVolumeResp := infrastructure.RemoveVolume(
+				ctx,
 				ec2Client,
 				volume.ID,
 			)
@@ -88,14 +93,8 @@ func SaveDevEnvData(
 
 	createSnapshotWG.Wait()
 
-	for _, err := range createSnapshotErrors {
-		if err == nil {
-			continue
-		}
-
-		return nil, err
-	}
-
+	// Dev env infra could be updated even
+	// in case of error (partial infrastructure)
 	devEnvInfra.Instance.Volumes = devEnvInfraUpdatedVolumes
 	devEnvInfraJSON, err := json.Marshal(devEnvInfra)
 
@@ -105,5 +104,13 @@ func SaveDevEnvData(
 
 	s := string(devEnvInfraJSON)
 
+	for _, err := range createSnapshotErrors {
+		if err == nil {
+			continue
+		}
+
+		return &s, err
+	}
+
 	return &s, nil
 }
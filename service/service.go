@@ -1,15 +1,209 @@
 package service
 
 import (
+	"context"
+	"sync"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/aws-cloud-provider/userconfig"
 )
 
+// InstanceSSHClient represents the interface
+// used to reach the instances via SSH.
+type InstanceSSHClient interface {
+	LookupInitInstanceScriptResults(
+		ctx context.Context,
+		instancePublicIPAddress string,
+		instanceSSHPort string,
+		instanceLoginUser string,
+		sshPrivateKeyContent string,
+	) (*infrastructure.InitInstanceScriptResults, error)
+
+	WaitForSSHAvailableInInstance(
+		ctx context.Context,
+		instancePublicIPAddress string,
+		instanceSSHPort string,
+	) error
+}
+
+// AWSClients represents the clients
+// used by the AWS service to reach AWS.
+type AWSClients struct {
+	EC2         infrastructure.EC2API
+	DynamoDB    infrastructure.DynamoDBAPI
+	KMS         infrastructure.KMSAPI
+	STS         infrastructure.STSAPI
+	IAM         infrastructure.IAMAPI
+	Route53     infrastructure.Route53API
+	InstanceSSH InstanceSSHClient
+
+	// InstanceSSM reaches the instances of the private
+	// clusters through SSM (identified by their ID).
+	InstanceSSM InstanceSSHClient
+
+	// CallerPublicIP looks up the public IP address of the
+	// caller (allowed to reach the SSH server of the dev envs
+	// if DevEnvOpts.SSHAllowedCIDRBlocks is not set).
+	CallerPublicIP CallerPublicIPClient
+
+	// ConfigStorage stores the config and the leases.
+	// Default to the DynamoDB table if not set.
+	ConfigStorage ConfigStorage
+}
+
+// AWSOpts represents the options
+// used to configure the AWS service.
+type AWSOpts struct {
+	// Lease specifies how the clusters and dev envs
+	// are locked during mutating operations.
+	Lease LeaseOpts
+
+	// ConfigEncryption specifies how the sensitive
+	// fields of the config are encrypted at rest.
+	ConfigEncryption ConfigEncryptionOpts
+
+	// Cluster specifies how the clusters are created
+	// (eg: the CIDR blocks of the VPC and of the subnet).
+	Cluster ClusterOpts
+
+	// DevEnv specifies how the dev envs are created
+	// (eg: the CIDR blocks allowed to reach the SSH server).
+	DevEnv DevEnvOpts
+
+	// ConfigHistorySize specifies the number of versions of
+	// the config kept in history (including the current one).
+	// Default to DefaultConfigHistorySize if not set.
+	ConfigHistorySize int
+
+	// ConfigStorage specifies where the config and the leases
+	// are stored. Default to a DynamoDB table if not set.
+	// Only used by NewAWSWithClients to find the actions checked
+	// by the permissions preflight (see AWSClients.ConfigStorage).
+	ConfigStorage userconfig.ConfigStorage
+
+	// VerifyCredentials specifies whether the credentials
+	// are verified when the service is built (see Builder.BuildWithContext
+	// and AWS.VerifyCredentials).
+	VerifyCredentials bool
+
+	// PermissionsPreflight specifies whether CreateCluster and
+	// CreateDevEnv check the permissions before creating anything
+	// (see AWS.CheckPermissions). The check is skipped if the
+	// permissions could not be simulated.
+	PermissionsPreflight bool
+}
+
 type AWS struct {
 	sdkConfig aws.Config
+	clients   AWSClients
+	leaseOpts LeaseOpts
+
+	clusterOpts ClusterOpts
+	devEnvOpts  DevEnvOpts
+
+	// The version of the configs read or
+	// written by this service (indexed by config ID).
+	// Used to detect concurrent updates.
+	configVersionsMu sync.Mutex
+	configVersions   map[string]int64
+
+	configEncryptionOpts ConfigEncryptionOpts
+	configHistorySize    int
+	configStorageOpts    userconfig.ConfigStorage
+	permissionsPreflight bool
+
+	// The data keys of the configs read or written
+	// by this service (indexed by config ID).
+	configDataKeysMu sync.Mutex
+	configDataKeys   map[string]*configDataKey
+
+	// Set once the credentials are verified
+	callerIdentityMu sync.Mutex
+	callerIdentity   *infrastructure.CallerIdentity
 }
 
 func NewAWS(SDKConfig aws.Config) *AWS {
-	return &AWS{
-		sdkConfig: SDKConfig,
+	return NewAWSWithOpts(SDKConfig, AWSOpts{})
+}
+
+// NewAWSWithOpts constructs the AWS service
+// configured with the AWSOpts options
+// (eg: to enable the encryption of the config).
+func NewAWSWithOpts(SDKConfig aws.Config, opts AWSOpts) *AWS {
+	SSMClient := ssm.NewFromConfig(SDKConfig)
+
+	return NewAWSWithClients(
+		SDKConfig,
+		AWSClients{
+			EC2:         ec2.NewFromConfig(SDKConfig),
+			DynamoDB:    dynamodb.NewFromConfig(SDKConfig),
+			KMS:         kms.NewFromConfig(SDKConfig),
+			STS:         sts.NewFromConfig(SDKConfig),
+			IAM:         iam.NewFromConfig(SDKConfig),
+			Route53:     route53.NewFromConfig(SDKConfig),
+			InstanceSSH: infrastructure.NewInstanceSSHClient(),
+			InstanceSSM: infrastructure.NewInstanceSSMClient(
+				SSMClient,
+				SSMClient.Options(),
+			),
+			CallerPublicIP: infrastructure.NewCallerPublicIPClient(),
+
+			ConfigStorage: newConfigStorage(SDKConfig, opts.ConfigStorage),
+		},
+		opts,
+	)
+}
+
+// NewAWSWithClients constructs the AWS service
+// with the passed clients (used in tests to
+// replace AWS with an in-memory fake).
+func NewAWSWithClients(
+	SDKConfig aws.Config,
+	clients AWSClients,
+	opts AWSOpts,
+) *AWS {
+
+	if clients.ConfigStorage == nil {
+		clients.ConfigStorage = infrastructure.NewDynamoDBRecodeConfigStorage(
+			clients.DynamoDB,
+		)
+	}
+
+	if opts.ConfigHistorySize == 0 {
+		opts.ConfigHistorySize = DefaultConfigHistorySize
 	}
+
+	AWSService := &AWS{
+		sdkConfig:      SDKConfig,
+		clients:        clients,
+		leaseOpts:      opts.Lease.withDefaults(),
+		clusterOpts:    opts.Cluster,
+		devEnvOpts:     opts.DevEnv,
+		configVersions: map[string]int64{},
+
+		configEncryptionOpts: opts.ConfigEncryption,
+		configHistorySize:    opts.ConfigHistorySize,
+		configStorageOpts:    opts.ConfigStorage,
+		permissionsPreflight: opts.PermissionsPreflight,
+		configDataKeys:       map[string]*configDataKey{},
+	}
+
+	// The created resources are tagged with the
+	// identity of the credentials once verified
+	if clients.EC2 != nil {
+		AWSService.clients.EC2 = infrastructure.NewOwnerTaggedEC2Client(
+			clients.EC2,
+			AWSService.CallerIdentity,
+		)
+	}
+
+	return AWSService
 }
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"context"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/recode-sh/aws-cloud-provider/userconfig"
 	"github.com/recode-sh/recode/entities"
@@ -24,6 +26,7 @@ type Builder struct {
 	userConfigResolver  UserConfigResolver
 	userConfigValidator UserConfigValidator
 	userConfigLoader    UserConfigLoader
+	awsOpts             AWSOpts
 }
 
 func NewBuilder(
@@ -32,14 +35,41 @@ func NewBuilder(
 	userConfigLoader UserConfigLoader,
 ) Builder {
 
+	return NewBuilderWithOpts(
+		userConfigResolver,
+		userConfigValidator,
+		userConfigLoader,
+		AWSOpts{},
+	)
+}
+
+// NewBuilderWithOpts constructs a Builder that passes
+// the AWSOpts options to the built AWS service
+// (eg: to enable the encryption of the config).
+func NewBuilderWithOpts(
+	userConfigResolver UserConfigResolver,
+	userConfigValidator UserConfigValidator,
+	userConfigLoader UserConfigLoader,
+	opts AWSOpts,
+) Builder {
+
 	return Builder{
 		userConfigResolver:  userConfigResolver,
 		userConfigValidator: userConfigValidator,
 		userConfigLoader:    userConfigLoader,
+		awsOpts:             opts,
 	}
 }
 
+// Build is BuildWithContext called with a background context.
 func (b Builder) Build() (entities.CloudService, error) {
+	return b.BuildWithContext(context.Background())
+}
+
+// BuildWithContext resolves, validates and loads the user config
+// then constructs the AWS service. The passed context is used
+// to verify the credentials (see AWSOpts.VerifyCredentials).
+func (b Builder) BuildWithContext(ctx context.Context) (entities.CloudService, error) {
 	userConfig, err := b.userConfigResolver.Resolve()
 
 	if err != nil {
@@ -56,7 +86,21 @@ func (b Builder) Build() (entities.CloudService, error) {
 		return nil, err
 	}
 
-	AWSService := NewAWS(AWSSDKConfig)
+	AWSOpts := b.awsOpts
+
+	if len(userConfig.ConfigStorage.Backend) > 0 {
+		AWSOpts.ConfigStorage = userConfig.ConfigStorage
+	}
+
+	AWSService := NewAWSWithOpts(AWSSDKConfig, AWSOpts)
+
+	if AWSOpts.VerifyCredentials {
+		err := AWSService.VerifyCredentials(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return AWSService, nil
 }
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/recode/entities"
+	"github.com/recode-sh/recode/queues"
+	"github.com/recode-sh/recode/stepper"
+)
+
+// ErrSpotCapacityUnavailable represents the error returned
+// when a spot instance could not be launched because there
+// is no spot capacity for its type (or because the max
+// price is lower than the spot price).
+type ErrSpotCapacityUnavailable struct {
+	InstanceType string
+}
+
+func (ErrSpotCapacityUnavailable) Error() string {
+	return "ErrSpotCapacityUnavailable"
+}
+
+// ErrSpotInstanceInterrupted represents the error returned
+// when a spot instance was interrupted while it was
+// started (the dev env could be started again).
+type ErrSpotInstanceInterrupted struct {
+	InstanceID string
+}
+
+func (ErrSpotInstanceInterrupted) Error() string {
+	return "ErrSpotInstanceInterrupted"
+}
+
+// SpotInstanceFallback represents a fallback from a spot
+// instance to an on-demand one, recorded until the on-demand
+// instance is launched so that the fallback could be resumed.
+type SpotInstanceFallback struct {
+	// The root volume detached from the spot instance
+	RootVolume infrastructure.InstanceVolume `json:"root_volume"`
+
+	// Kept given that the init script is not run again
+	InitScriptResults *infrastructure.InitInstanceScriptResults `json:"init_script_results"`
+}
+
+// spotCapacityError maps the ErrSpotCapacityUnavailable
+// error returned by the infrastructure package to the typed one.
+func spotCapacityError(err error, instanceType string) error {
+	if errors.Is(err, infrastructure.ErrSpotCapacityUnavailable) {
+		return ErrSpotCapacityUnavailable{
+			InstanceType: instanceType,
+		}
+	}
+
+	return err
+}
+
+// spotInstanceError maps the spot errors returned by the
+// infrastructure package when an existing instance is
+// started to the typed ones.
+func spotInstanceError(err error, instanceType string, instanceID string) error {
+	if errors.Is(err, infrastructure.ErrSpotInstanceInterrupted) {
+		return ErrSpotInstanceInterrupted{
+			InstanceID: instanceID,
+		}
+	}
+
+	return spotCapacityError(err, instanceType)
+}
+
+// instanceSpotOpts returns the spot options passed to
+// CreateInstance (nil if the spot instances are disabled).
+func (a *AWS) instanceSpotOpts() *infrastructure.InstanceSpotOpts {
+	if !a.devEnvOpts.Spot {
+		return nil
+	}
+
+	return &infrastructure.InstanceSpotOpts{
+		MaxPrice: a.devEnvOpts.SpotMaxPrice,
+	}
+}
+
+// fallBackToOnDemandInstance moves the dev env from its (stopped)
+// spot instance to an on-demand one that boots on the same root
+// volume. The on-demand instance is returned stopped.
+func (a *AWS) fallBackToOnDemandInstance(
+	ctx context.Context,
+	stepper stepper.Stepper,
+	cluster *entities.Cluster,
+	devEnv *entities.DevEnv,
+	devEnvInfra *DevEnvInfrastructure,
+) error {
+
+	prefixResource := prefixDevEnvResource(cluster.GetNameSlug(), devEnv.GetNameSlug())
+	ec2Client := a.clients.EC2
+
+	devEnvInfraQueue := queues.InfrastructureQueue[*DevEnvInfrastructure]{}
+
+	detachRootVolume := func(infra *DevEnvInfrastructure) error {
+		if infra.SpotInstanceFallback != nil {
+			return nil
+		}
+
+		var rootVolume *infrastructure.InstanceVolume
+
+		for i, volume := range infra.Instance.Volumes {
+			if volume.IsRootVolume {
+				rootVolume = &infra.Instance.Volumes[i]
+				break
+			}
+		}
+
+		if rootVolume == nil {
+			return errors.New("no root volume found for the spot instance")
+		}
+
+		detachVolumeResp := infrastructure.DetachVolume(
+			ctx,
+			ec2Client,
+			infra.Instance.ID,
+			rootVolume.ID,
+			rootVolume.DeviceName,
+		)
+
+		if detachVolumeResp.Err != nil {
+			return detachVolumeResp.Err
+		}
+
+		infra.SpotInstanceFallback = &SpotInstanceFallback{
+			RootVolume:        *rootVolume,
+			InitScriptResults: infra.Instance.InitScriptResults,
+		}
+
+		return nil
+	}
+
+	devEnvInfraQueue = append(
+		devEnvInfraQueue,
+		queues.InfrastructureQueueSteps[*DevEnvInfrastructure]{
+			func(*DevEnvInfrastructure) error {
+				stepper.StartTemporaryStep("Detaching the root volume of the spot instance")
+				return nil
+			},
+			detachRootVolume,
+		},
+	)
+
+	// The detached root volume is not
+	// deleted on termination
+	terminateSpotInstance := func(infra *DevEnvInfrastructure) error {
+		if infra.Instance == nil {
+			return nil
+		}
+
+		err := infrastructure.CancelSpotInstanceRequest(
+			ctx,
+			ec2Client,
+			infra.Instance.SpotInstanceRequestID,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		err = infrastructure.TerminateInstance(
+			ctx,
+			ec2Client,
+			infra.Instance.ID,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		infra.Instance = nil
+		return nil
+	}
+
+	devEnvInfraQueue = append(
+		devEnvInfraQueue,
+		queues.InfrastructureQueueSteps[*DevEnvInfrastructure]{
+			func(*DevEnvInfrastructure) error {
+				stepper.StartTemporaryStep("Terminating the spot instance")
+				return nil
+			},
+			terminateSpotInstance,
+		},
+	)
+
+	createOnDemandInstance := func(infra *DevEnvInfrastructure) error {
+		if infra.Instance != nil {
+			return nil
+		}
+
+		instanceProfileName := ""
+
+		if infra.InstanceProfile != nil {
+			instanceProfileName = infra.InstanceProfile.Name
+		}
+
+		instance, err := infrastructure.CreateInstanceFromRootVolume(
+			ctx,
+			ec2Client,
+			prefixResource("instance"),
+			infra.InstanceAMI.ID,
+			infra.InstanceTypeInfos.Type,
+			infra.NetworkInterface.ID,
+			infra.KeyPair.Name,
+			instanceProfileName,
+			infra.SpotInstanceFallback.RootVolume,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		instance.InitScriptResults = infra.SpotInstanceFallback.InitScriptResults
+
+		infra.Instance = instance
+		infra.SpotInstanceFallback = nil
+
+		return nil
+	}
+
+	devEnvInfraQueue = append(
+		devEnvInfraQueue,
+		queues.InfrastructureQueueSteps[*DevEnvInfrastructure]{
+			func(*DevEnvInfrastructure) error {
+				stepper.StartTemporaryStep("Launching an on-demand EC2 instance")
+				return nil
+			},
+			createOnDemandInstance,
+		},
+	)
+
+	err := devEnvInfraQueue.Run(devEnvInfra)
+
+	// Dev env infra could be updated in the queue even
+	// in case of error (partial infrastructure)
+	devEnv.SetInfrastructureJSON(devEnvInfra)
+
+	return err
+}
@@ -0,0 +1,308 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+func unmarshalDevEnvInfra(t *testing.T, devEnv *entities.DevEnv) *service.DevEnvInfrastructure {
+	t.Helper()
+
+	var devEnvInfra *service.DevEnvInfrastructure
+	err := json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	return devEnvInfra
+}
+
+func TestSpotDevEnvLifecycle(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			Spot:         true,
+			SpotMaxPrice: "0.05",
+		},
+	})
+
+	devEnv, devEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+
+	if len(devEnvInfra.Instance.SpotInstanceRequestID) == 0 {
+		t.Fatalf("expected spot request to be recorded, got '%s'", devEnv.InfrastructureJSON)
+	}
+
+	instance, _ := cloud.EC2.InstanceByID(devEnvInfra.Instance.ID)
+
+	if instance == nil || instance.InstanceLifecycle != types.InstanceLifecycleTypeSpot {
+		t.Fatalf("expected running spot instance, got '%+v'", instance)
+	}
+
+	restartedDevEnvInfra := restartDevEnvInFakeCloud(t, recodeCLI, cluster, devEnv)
+
+	if restartedDevEnvInfra.Instance.ID != devEnvInfra.Instance.ID {
+		t.Fatalf("expected spot instance to be kept across restarts, got '%s'", devEnv.InfrastructureJSON)
+	}
+
+	err := recodeCLI.RemoveDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	if count := cloud.EC2.ResourceCounts()["spot-instance-request"]; count != 0 {
+		t.Fatalf("expected spot request to be cancelled, got %d left", count)
+	}
+
+	err = recodeCLI.RemoveCluster(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	assertNoResourceLeft(t, cloud.EC2)
+}
+
+func TestCreateSpotDevEnvWithoutCapacity(t *testing.T) {
+	testCases := []struct {
+		test                  string
+		spotMaxPrice          string
+		spotCapacityAvailable bool
+	}{
+		{
+			test:                  "no spot capacity",
+			spotCapacityAvailable: false,
+		},
+
+		{
+			test:                  "max price lower than spot price",
+			spotMaxPrice:          "0.001",
+			spotCapacityAvailable: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			cloud := newFakeCloud(t)
+			cluster := createClusterInFakeCloud(t, cloud)
+			recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+				DevEnv: service.DevEnvOpts{
+					Spot:         true,
+					SpotMaxPrice: tc.spotMaxPrice,
+				},
+			})
+
+			cloud.EC2.SetSpotCapacityAvailable(tc.spotCapacityAvailable)
+
+			devEnv := &entities.DevEnv{
+				Name:         "recode-sh-api",
+				InstanceType: "t2.medium",
+			}
+
+			err := recodeCLI.CreateDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+			expectedErr := service.ErrSpotCapacityUnavailable{
+				InstanceType: "t2.medium",
+			}
+
+			if !errors.Is(err, expectedErr) {
+				t.Fatalf("expected '%+v', got '%+v'", expectedErr, err)
+			}
+
+			if count := cloud.EC2.ResourceCounts()["instance"]; count != 0 {
+				t.Fatalf("expected no instance to be launched, got %d", count)
+			}
+		})
+	}
+}
+
+func TestCreateSpotDevEnvWithOnDemandOnlyInstanceType(t *testing.T) {
+	cloud := newFakeCloud(t)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			Spot: true,
+		},
+	})
+
+	err := recodeCLI.CheckInstanceTypeValidity(context.Background(), &fakes.Stepper{}, "u-6tb1.56xlarge")
+
+	expectedErr := service.ErrInstanceTypeSpotUnsupported{
+		InstanceType: "u-6tb1.56xlarge",
+	}
+
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("expected '%+v', got '%+v'", expectedErr, err)
+	}
+}
+
+func TestStartInterruptedSpotDevEnvFallsBackToOnDemand(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			Spot: true,
+		},
+	})
+
+	devEnv, spotDevEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+
+	if err := cloud.EC2.InterruptSpotInstance(spotDevEnvInfra.Instance.ID); err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	// Observed stopping then stopped
+	cloud.EC2.InstanceByID(spotDevEnvInfra.Instance.ID)
+	cloud.EC2.InstanceByID(spotDevEnvInfra.Instance.ID)
+
+	cloud.EC2.SetSpotCapacityAvailable(false)
+
+	err := recodeCLI.StartDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	devEnvInfra := unmarshalDevEnvInfra(t, devEnv)
+
+	if devEnvInfra.Instance.ID == spotDevEnvInfra.Instance.ID ||
+		len(devEnvInfra.Instance.SpotInstanceRequestID) > 0 ||
+		devEnvInfra.SpotInstanceFallback != nil {
+
+		t.Fatalf("expected spot instance to be replaced, got '%s'", devEnv.InfrastructureJSON)
+	}
+
+	instance, _ := cloud.EC2.InstanceByID(devEnvInfra.Instance.ID)
+
+	if instance == nil || instance.InstanceLifecycle == types.InstanceLifecycleTypeSpot {
+		t.Fatalf("expected running on-demand instance, got '%+v'", instance)
+	}
+
+	rootVolumeID := aws.ToString(instance.BlockDeviceMappings[0].Ebs.VolumeId)
+
+	if len(instance.BlockDeviceMappings) != 1 ||
+		rootVolumeID != spotDevEnvInfra.Instance.Volumes[0].ID {
+
+		t.Fatalf("expected root volume of the spot instance to be kept, got '%+v'", instance.BlockDeviceMappings)
+	}
+
+	if devEnvInfra.Instance.InitScriptResults == nil ||
+		devEnv.InstancePublicIPAddress != devEnvInfra.Instance.PublicIPAddress {
+
+		t.Fatalf("expected started dev env, got '%s'", devEnv.InfrastructureJSON)
+	}
+
+	if count := cloud.EC2.ResourceCounts()["spot-instance-request"]; count != 0 {
+		t.Fatalf("expected spot request to be cancelled, got %d left", count)
+	}
+
+	err = recodeCLI.RemoveDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = recodeCLI.RemoveCluster(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	assertNoResourceLeft(t, cloud.EC2)
+}
+
+func TestStartSpotDevEnvResumesInterruptedFallback(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			Spot: true,
+		},
+	})
+
+	devEnv, spotDevEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+
+	err := recodeCLI.StopDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	cloud.EC2.SetSpotCapacityAvailable(false)
+	cloud.EC2.FailNext("RunInstances", errors.New("ErrRunInstances"))
+
+	err = recodeCLI.StartDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err == nil {
+		t.Fatalf("expected error, got nothing")
+	}
+
+	devEnvInfra := unmarshalDevEnvInfra(t, devEnv)
+
+	if devEnvInfra.Instance != nil || devEnvInfra.SpotInstanceFallback == nil {
+		t.Fatalf("expected detached root volume to be recorded, got '%s'", devEnv.InfrastructureJSON)
+	}
+
+	err = recodeCLI.StartDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	devEnvInfra = unmarshalDevEnvInfra(t, devEnv)
+	instance, _ := cloud.EC2.InstanceByID(devEnvInfra.Instance.ID)
+
+	if instance == nil ||
+		aws.ToString(instance.BlockDeviceMappings[0].Ebs.VolumeId) != spotDevEnvInfra.Instance.Volumes[0].ID {
+
+		t.Fatalf("expected on-demand instance on the spot root volume, got '%+v'", instance)
+	}
+}
+
+func TestStartSpotDevEnvInterruptedWhileStarting(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+		DevEnv: service.DevEnvOpts{
+			Spot: true,
+		},
+	})
+
+	devEnv, devEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+
+	err := recodeCLI.StopDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	interrupted := false
+
+	cloud.EC2.BeforeCall("DescribeInstances", func() {
+		if interrupted || cloud.EC2.Calls("StartInstances") == 0 {
+			return
+		}
+
+		interrupted = true
+		_ = cloud.EC2.InterruptSpotInstance(devEnvInfra.Instance.ID)
+	})
+
+	err = recodeCLI.StartDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	expectedErr := service.ErrSpotInstanceInterrupted{
+		InstanceID: devEnvInfra.Instance.ID,
+	}
+
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("expected '%+v', got '%+v'", expectedErr, err)
+	}
+}
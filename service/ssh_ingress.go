@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/recode-sh/agent/constants"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// CallerPublicIPClient represents the interface used to look up
+// the public IP address of the caller (the default SSH allowlist).
+type CallerPublicIPClient interface {
+	LookupCallerPublicIPAddress(ctx context.Context) (string, error)
+}
+
+// ErrInvalidSSHAllowedCIDRBlock represents the error returned
+// when a CIDR block of the SSH allowlist is not a valid IPv4
+// or IPv6 CIDR block (or when bits are set after the prefix).
+type ErrInvalidSSHAllowedCIDRBlock struct {
+	CIDRBlock string
+}
+
+func (ErrInvalidSSHAllowedCIDRBlock) Error() string {
+	return "ErrInvalidSSHAllowedCIDRBlock"
+}
+
+// The SSH ingress of the dev envs created before
+// the ingress rules were recorded (open to the world).
+var legacySSHAllowedCIDRBlocks = []string{
+	"0.0.0.0/0",
+	"::/0",
+}
+
+// sshServerListenPort returns the port of the SSH server of the dev envs.
+func sshServerListenPort() (int32, error) {
+	port, err := strconv.ParseInt(constants.SSHServerListenPort, 10, 32)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int32(port), nil
+}
+
+// isCanonicalCIDRBlock returns whether the passed string is a valid
+// IPv4 or IPv6 CIDR block without bits set after the prefix.
+func isCanonicalCIDRBlock(CIDRBlock string) bool {
+	_, IPNet, err := net.ParseCIDR(CIDRBlock)
+	return err == nil && IPNet.String() == CIDRBlock
+}
+
+// sshAllowedCIDRBlocks returns the CIDR blocks allowed to reach
+// the SSH server of the dev envs: the ones set in DevEnvOpts or
+// the public IP address of the caller.
+func (a *AWS) sshAllowedCIDRBlocks(ctx context.Context) ([]string, error) {
+	if len(a.devEnvOpts.SSHAllowedCIDRBlocks) > 0 {
+		for _, CIDRBlock := range a.devEnvOpts.SSHAllowedCIDRBlocks {
+			if !isCanonicalCIDRBlock(CIDRBlock) {
+				return nil, ErrInvalidSSHAllowedCIDRBlock{
+					CIDRBlock: CIDRBlock,
+				}
+			}
+		}
+
+		return a.devEnvOpts.SSHAllowedCIDRBlocks, nil
+	}
+
+	callerIPAddress, err := a.clients.CallerPublicIP.LookupCallerPublicIPAddress(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if net.ParseIP(callerIPAddress).To4() == nil {
+		return []string{callerIPAddress + "/128"}, nil
+	}
+
+	return []string{callerIPAddress + "/32"}, nil
+}
+
+// sshIngressRules returns the rules that let
+// the passed CIDR blocks reach the SSH server.
+func sshIngressRules(
+	CIDRBlocks []string,
+) ([]infrastructure.SecurityGroupIngressRule, error) {
+
+	port, err := sshServerListenPort()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ingressRules := []infrastructure.SecurityGroupIngressRule{}
+
+	for _, CIDRBlock := range CIDRBlocks {
+		ingressRules = append(ingressRules, infrastructure.SecurityGroupIngressRule{
+			Protocol:  "tcp",
+			Port:      port,
+			CIDRBlock: CIDRBlock,
+		})
+	}
+
+	return ingressRules, nil
+}
@@ -0,0 +1,275 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+// sshIngressCIDRBlocks returns the (sorted) CIDR
+// blocks allowed in the passed security group.
+func sshIngressCIDRBlocks(
+	t *testing.T,
+	fakeEC2 *fakes.EC2,
+	securityGroupID string,
+) []string {
+
+	t.Helper()
+
+	describeSecurityGroupsResp, err := fakeEC2.DescribeSecurityGroups(
+		context.Background(),
+		&ec2.DescribeSecurityGroupsInput{
+			GroupIds: []string{securityGroupID},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	CIDRBlocks := []string{}
+
+	for _, IPPermission := range describeSecurityGroupsResp.SecurityGroups[0].IpPermissions {
+		for _, IPRange := range IPPermission.IpRanges {
+			CIDRBlocks = append(CIDRBlocks, aws.ToString(IPRange.CidrIp))
+		}
+
+		for _, IPv6Range := range IPPermission.Ipv6Ranges {
+			CIDRBlocks = append(CIDRBlocks, aws.ToString(IPv6Range.CidrIpv6))
+		}
+	}
+
+	sort.Strings(CIDRBlocks)
+
+	return CIDRBlocks
+}
+
+func createDevEnvInFakeCloud(
+	t *testing.T,
+	recodeCLI *service.AWS,
+	cluster *entities.Cluster,
+) (*entities.DevEnv, *service.DevEnvInfrastructure) {
+
+	t.Helper()
+
+	devEnv := &entities.DevEnv{
+		Name:         "recode-sh-api",
+		InstanceType: "t2.medium",
+	}
+
+	err := recodeCLI.CreateDevEnv(
+		context.Background(),
+		&fakes.Stepper{},
+		&entities.Config{},
+		cluster,
+		devEnv,
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	var devEnvInfra *service.DevEnvInfrastructure
+	err = json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	return devEnv, devEnvInfra
+}
+
+func restartDevEnvInFakeCloud(
+	t *testing.T,
+	recodeCLI *service.AWS,
+	cluster *entities.Cluster,
+	devEnv *entities.DevEnv,
+) *service.DevEnvInfrastructure {
+
+	t.Helper()
+
+	err := recodeCLI.StopDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = recodeCLI.StartDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, devEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	var devEnvInfra *service.DevEnvInfrastructure
+	err = json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	return devEnvInfra
+}
+
+func TestStartDevEnvRefreshesSSHIngressToCallerIP(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	recodeCLI := cloud.AWSService()
+
+	devEnv, devEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+
+	CIDRBlocks := sshIngressCIDRBlocks(t, cloud.EC2, devEnvInfra.SecurityGroup.ID)
+
+	if !reflect.DeepEqual(CIDRBlocks, []string{"203.0.113.10/32"}) {
+		t.Fatalf("expected SSH server port open to the caller only, got '%+v'", CIDRBlocks)
+	}
+
+	// The caller moved to another network
+	cloud.CallerPublicIP.SetIPAddress("198.51.100.20")
+
+	devEnvInfra = restartDevEnvInFakeCloud(t, recodeCLI, cluster, devEnv)
+
+	CIDRBlocks = sshIngressCIDRBlocks(t, cloud.EC2, devEnvInfra.SecurityGroup.ID)
+
+	if !reflect.DeepEqual(CIDRBlocks, []string{"198.51.100.20/32"}) {
+		t.Fatalf("expected stale rule to be revoked, got '%+v'", CIDRBlocks)
+	}
+
+	ingressRules := devEnvInfra.SecurityGroup.IngressRules
+
+	if len(ingressRules) != 1 || ingressRules[0].CIDRBlock != "198.51.100.20/32" {
+		t.Fatalf("expected refreshed rule to be recorded, got '%+v'", ingressRules)
+	}
+}
+
+func TestStartDevEnvRestrictsLegacySSHIngress(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	recodeCLI := cloud.AWSService()
+
+	devEnv, devEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+
+	// Dev env created when the SSH server port
+	// was open to the world (rules not recorded)
+	_, err := cloud.EC2.AuthorizeSecurityGroupIngress(
+		context.Background(),
+		&ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId: aws.String(devEnvInfra.SecurityGroup.ID),
+			IpPermissions: []types.IpPermission{{
+				IpProtocol: aws.String("tcp"),
+				FromPort:   aws.Int32(devEnvInfra.SecurityGroup.IngressRules[0].Port),
+				ToPort:     aws.Int32(devEnvInfra.SecurityGroup.IngressRules[0].Port),
+				IpRanges:   []types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+			}},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	devEnvInfra.SecurityGroup.IngressRules = nil
+	devEnv.SetInfrastructureJSON(devEnvInfra)
+
+	devEnvInfra = restartDevEnvInFakeCloud(t, recodeCLI, cluster, devEnv)
+
+	CIDRBlocks := sshIngressCIDRBlocks(t, cloud.EC2, devEnvInfra.SecurityGroup.ID)
+
+	if !reflect.DeepEqual(CIDRBlocks, []string{"203.0.113.10/32"}) {
+		t.Fatalf("expected SSH server port closed to the world, got '%+v'", CIDRBlocks)
+	}
+}
+
+func TestCreateDevEnvWithSSHAllowedCIDRBlocks(t *testing.T) {
+	testCases := []struct {
+		test               string
+		allowedCIDRBlocks  []string
+		expectedCIDRBlocks []string
+		expectedErr        error
+	}{
+		{
+			test:               "with valid CIDR blocks",
+			allowedCIDRBlocks:  []string{"192.0.2.0/24", "2001:db8::/32"},
+			expectedCIDRBlocks: []string{"192.0.2.0/24", "2001:db8::/32"},
+		},
+
+		{
+			test:              "with host bits set",
+			allowedCIDRBlocks: []string{"192.0.2.1/24"},
+			expectedErr: service.ErrInvalidSSHAllowedCIDRBlock{
+				CIDRBlock: "192.0.2.1/24",
+			},
+		},
+
+		{
+			test:              "with invalid CIDR block",
+			allowedCIDRBlocks: []string{"192.0.2.1"},
+			expectedErr: service.ErrInvalidSSHAllowedCIDRBlock{
+				CIDRBlock: "192.0.2.1",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			cloud := newFakeCloud(t)
+			cluster := createClusterInFakeCloud(t, cloud)
+			recodeCLI := cloud.AWSServiceWithOpts(service.AWSOpts{
+				DevEnv: service.DevEnvOpts{
+					SSHAllowedCIDRBlocks: tc.allowedCIDRBlocks,
+				},
+			})
+
+			devEnv := &entities.DevEnv{
+				Name:         "recode-sh-api",
+				InstanceType: "t2.medium",
+			}
+
+			err := recodeCLI.CreateDevEnv(
+				context.Background(),
+				&fakes.Stepper{},
+				&entities.Config{},
+				cluster,
+				devEnv,
+			)
+
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("expected error '%+v', got '%+v'", tc.expectedErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			var devEnvInfra *service.DevEnvInfrastructure
+			err = json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+
+			if err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			CIDRBlocks := sshIngressCIDRBlocks(t, cloud.EC2, devEnvInfra.SecurityGroup.ID)
+
+			if !reflect.DeepEqual(CIDRBlocks, tc.expectedCIDRBlocks) {
+				t.Fatalf("expected CIDR blocks '%+v', got '%+v'", tc.expectedCIDRBlocks, CIDRBlocks)
+			}
+
+			if calls := cloud.CallerPublicIP.Calls("LookupCallerPublicIPAddress"); calls != 0 {
+				t.Fatalf("expected caller public IP to not be looked up, got %d calls", calls)
+			}
+		})
+	}
+}
@@ -1,9 +1,10 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/recode-sh/agent/constants"
 	"github.com/recode-sh/aws-cloud-provider/infrastructure"
 	"github.com/recode-sh/recode/entities"
@@ -11,47 +12,121 @@ import (
 )
 
 func (a *AWS) StartDevEnv(
+	ctx context.Context,
 	stepper stepper.Stepper,
 	config *entities.Config,
 	cluster *entities.Cluster,
 	devEnv *entities.DevEnv,
-) error {
+) (returnedError error) {
+
+	lease, err := a.acquireDevEnvLease(ctx, cluster.GetNameSlug(), devEnv.GetNameSlug())
+
+	if err != nil {
+		return err
+	}
+
+	ctx = lease.ctx
+	defer func() { returnedError = a.releaseLease(lease, returnedError) }()
 
 	var devEnvInfra *DevEnvInfrastructure
-	err := json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+	err = json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
 
 	if err != nil {
 		return err
 	}
 
-	stepper.StartTemporaryStep("Starting the EC2 instance")
+	stepper.StartTemporaryStep("Updating the ingress of the security group")
 
-	ec2Client := ec2.NewFromConfig(a.sdkConfig)
-	err = infrastructure.StartInstance(
-		ec2Client,
-		devEnvInfra.Instance,
-	)
+	// The recorded ingress rules are
+	// updated even if the refresh fails
+	err = a.refreshIngress(ctx, devEnvInfra)
+	devEnv.SetInfrastructureJSON(devEnvInfra)
 
 	if err != nil {
 		return err
 	}
 
-	stepper.StartTemporaryStep("Waiting for SSH to be available in the EC2 instance")
+	// A previous fallback to on-demand was interrupted
+	if devEnvInfra.SpotInstanceFallback != nil {
+		err = a.fallBackToOnDemandInstance(ctx, stepper, cluster, devEnv, devEnvInfra)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	stepper.StartTemporaryStep("Starting the EC2 instance")
 
-	err = infrastructure.WaitForSSHAvailableInInstance(
+	ec2Client := a.clients.EC2
+	err = infrastructure.StartInstance(
+		ctx,
 		ec2Client,
-		devEnvInfra.Instance.PublicIPAddress,
-		constants.SSHServerListenPort,
+		devEnvInfra.Instance,
 	)
 
+	// The dev env is moved to an on-demand instance
+	// when there is no spot capacity to start it
+	isSpot := len(devEnvInfra.Instance.SpotInstanceRequestID) > 0
+
+	if isSpot && errors.Is(err, infrastructure.ErrSpotCapacityUnavailable) {
+		err = a.fallBackToOnDemandInstance(ctx, stepper, cluster, devEnv, devEnvInfra)
+
+		if err != nil {
+			return err
+		}
+
+		stepper.StartTemporaryStep("Starting the on-demand EC2 instance")
+
+		err = infrastructure.StartInstance(
+			ctx,
+			ec2Client,
+			devEnvInfra.Instance,
+		)
+	}
+
 	if err != nil {
-		return err
+		return spotInstanceError(
+			err,
+			devEnvInfra.Instance.Type,
+			devEnvInfra.Instance.ID,
+		)
 	}
 
+	// The public IP address changes on each start so the dev env
+	// infra is updated before waiting for SSH (that could be cancelled)
 	devEnv.SetInfrastructureJSON(devEnvInfra)
 
+	if devEnvInfra.DNSRecord != nil {
+		stepper.StartTemporaryStep("Updating the DNS record")
+
+		err = a.upsertDevEnvDNSRecord(
+			ctx,
+			devEnvInfra,
+			cluster.GetNameSlug(),
+			devEnv.GetNameSlug(),
+		)
+
+		devEnv.SetInfrastructureJSON(devEnvInfra)
+
+		if err != nil {
+			return err
+		}
+	}
+
 	devEnv.InstancePublicIPAddress = devEnvInfra.Instance.PublicIPAddress
-	devEnv.InstancePublicHostname = devEnvInfra.Instance.PublicHostname
+	devEnv.InstancePublicHostname = devEnvPublicHostname(devEnvInfra)
+
+	stepper.StartTemporaryStep("Waiting for SSH to be available in the EC2 instance")
+
+	instanceClient, instanceAddress, err := a.instanceTransport(devEnvInfra)
+
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return instanceClient.WaitForSSHAvailableInInstance(
+		ctx,
+		instanceAddress,
+		constants.SSHServerListenPort,
+	)
 }
@@ -1,33 +1,65 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/recode-sh/aws-cloud-provider/infrastructure"
 	"github.com/recode-sh/recode/entities"
 	"github.com/recode-sh/recode/stepper"
 )
 
 func (a *AWS) StopDevEnv(
+	ctx context.Context,
 	stepper stepper.Stepper,
 	config *entities.Config,
 	cluster *entities.Cluster,
 	devEnv *entities.DevEnv,
-) error {
+) (returnedError error) {
+
+	lease, err := a.acquireDevEnvLease(ctx, cluster.GetNameSlug(), devEnv.GetNameSlug())
+
+	if err != nil {
+		return err
+	}
+
+	ctx = lease.ctx
+	defer func() { returnedError = a.releaseLease(lease, returnedError) }()
 
 	var devEnvInfra *DevEnvInfrastructure
-	err := json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
+	err = json.Unmarshal([]byte(devEnv.InfrastructureJSON), &devEnvInfra)
 
 	if err != nil {
 		return err
 	}
 
-	ec2Client := ec2.NewFromConfig(a.sdkConfig)
+	ec2Client := a.clients.EC2
+
+	// The public IP address is released on stop (unless it is
+	// an Elastic IP) so the DNS record must not point to it
+	// anymore. The record is upserted again on next start.
+	if devEnvInfra.DNSRecord != nil && devEnvInfra.ElasticIP == nil {
+		stepper.StartTemporaryStep("Removing the DNS record")
+
+		err = infrastructure.RemoveDNSRecord(
+			ctx,
+			a.clients.Route53,
+			devEnvInfra.DNSRecord,
+		)
+
+		// The removed addresses are cleared
+		// even in case of error
+		devEnv.SetInfrastructureJSON(devEnvInfra)
+
+		if err != nil {
+			return err
+		}
+	}
 
 	stepper.StartTemporaryStep("Waiting for the EC2 instance to stop")
 
 	return infrastructure.StopInstance(
+		ctx,
 		ec2Client,
 		devEnvInfra.Instance,
 	)
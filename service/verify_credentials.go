@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/smithy-go"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+)
+
+// ErrInvalidCredentials represents the error returned when AWS
+// rejects the credentials (eg: unknown, revoked or wrong keys).
+type ErrInvalidCredentials struct {
+	Code    string
+	Message string
+}
+
+func (ErrInvalidCredentials) Error() string {
+	return "ErrInvalidCredentials"
+}
+
+// ErrExpiredCredentials represents the error returned when
+// the temporary credentials (or the SSO token used to
+// retrieve them) have expired.
+type ErrExpiredCredentials struct {
+	Code    string
+	Message string
+}
+
+func (ErrExpiredCredentials) Error() string {
+	return "ErrExpiredCredentials"
+}
+
+// ErrClockSkew represents the error returned when the requests
+// are rejected because the clock of the local machine is too far
+// from the AWS one (the requests are signed with the local time).
+type ErrClockSkew struct {
+	Code    string
+	Message string
+}
+
+func (ErrClockSkew) Error() string {
+	return "ErrClockSkew"
+}
+
+// VerifyCredentials checks that the credentials are accepted
+// by AWS (using STS GetCallerIdentity) and stores their
+// identity (see CallerIdentity).
+//
+// Rejected credentials return ErrInvalidCredentials,
+// ErrExpiredCredentials or ErrClockSkew.
+func (a *AWS) VerifyCredentials(ctx context.Context) error {
+	callerIdentity, err := infrastructure.LookupCallerIdentity(
+		ctx,
+		a.clients.STS,
+	)
+
+	if err != nil {
+		return credentialsError(err)
+	}
+
+	a.callerIdentityMu.Lock()
+	a.callerIdentity = callerIdentity
+	a.callerIdentityMu.Unlock()
+
+	return nil
+}
+
+// CallerIdentity returns the identity of the credentials
+// used by the service (account ID and ARN). The EC2 resources
+// created once it is set are tagged with it (see
+// infrastructure.OwnerAccountIDTagKey and infrastructure.OwnerARNTagKey).
+// Nil if the credentials were not verified (see VerifyCredentials).
+func (a *AWS) CallerIdentity() *infrastructure.CallerIdentity {
+	a.callerIdentityMu.Lock()
+	defer a.callerIdentityMu.Unlock()
+
+	return a.callerIdentity
+}
+
+func credentialsError(err error) error {
+	var invalidSSOTokenErr *ssocreds.InvalidTokenError
+
+	if errors.As(err, &invalidSSOTokenErr) {
+		return ErrExpiredCredentials{
+			Message: invalidSSOTokenErr.Error(),
+		}
+	}
+
+	var APIErr smithy.APIError
+
+	if !errors.As(err, &APIErr) {
+		return err
+	}
+
+	code := APIErr.ErrorCode()
+	message := APIErr.ErrorMessage()
+
+	// A skewed clock makes the signature look expired
+	if code == "RequestTimeTooSkewed" ||
+		code == "RequestExpired" ||
+		strings.Contains(message, "Signature expired") ||
+		strings.Contains(message, "Signature not yet current") {
+
+		return ErrClockSkew{
+			Code:    code,
+			Message: message,
+		}
+	}
+
+	switch code {
+	case "ExpiredToken", "ExpiredTokenException", "TokenRefreshRequired":
+		return ErrExpiredCredentials{
+			Code:    code,
+			Message: message,
+		}
+	case "InvalidClientTokenId", "SignatureDoesNotMatch",
+		"UnrecognizedClientException", "InvalidAccessKeyId", "AuthFailure":
+
+		return ErrInvalidCredentials{
+			Code:    code,
+			Message: message,
+		}
+	}
+
+	return err
+}
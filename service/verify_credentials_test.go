@@ -0,0 +1,179 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/recode-sh/aws-cloud-provider/fakes"
+	"github.com/recode-sh/aws-cloud-provider/infrastructure"
+	"github.com/recode-sh/aws-cloud-provider/service"
+	"github.com/recode-sh/recode/entities"
+)
+
+func TestVerifyCredentials(t *testing.T) {
+	cloud := newFakeCloud(t)
+	AWSService := cloud.AWSService()
+
+	if AWSService.CallerIdentity() != nil {
+		t.Fatalf("expected no caller identity before verification, got '%+v'", AWSService.CallerIdentity())
+	}
+
+	err := AWSService.VerifyCredentials(context.Background())
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	callerIdentity := AWSService.CallerIdentity()
+
+	if callerIdentity == nil ||
+		callerIdentity.AccountID != "123456789012" ||
+		callerIdentity.ARN != "arn:aws:iam::123456789012:user/recode" {
+
+		t.Fatalf("expected the identity of the fake user, got '%+v'", callerIdentity)
+	}
+}
+
+func TestVerifyCredentialsWithRejectedCredentials(t *testing.T) {
+	testCases := []struct {
+		test          string
+		STSError      error
+		expectedError error
+	}{
+		{
+			test: "invalid keys",
+			STSError: &smithy.GenericAPIError{
+				Code:    "InvalidClientTokenId",
+				Message: "The security token included in the request is invalid.",
+			},
+			expectedError: service.ErrInvalidCredentials{
+				Code:    "InvalidClientTokenId",
+				Message: "The security token included in the request is invalid.",
+			},
+		},
+
+		{
+			test: "wrong secret",
+			STSError: &smithy.GenericAPIError{
+				Code:    "SignatureDoesNotMatch",
+				Message: "The request signature we calculated does not match the signature you provided.",
+			},
+			expectedError: service.ErrInvalidCredentials{
+				Code:    "SignatureDoesNotMatch",
+				Message: "The request signature we calculated does not match the signature you provided.",
+			},
+		},
+
+		{
+			test: "expired token",
+			STSError: &smithy.GenericAPIError{
+				Code:    "ExpiredToken",
+				Message: "The security token included in the request is expired",
+			},
+			expectedError: service.ErrExpiredCredentials{
+				Code:    "ExpiredToken",
+				Message: "The security token included in the request is expired",
+			},
+		},
+
+		{
+			test:     "expired SSO token",
+			STSError: &ssocreds.InvalidTokenError{},
+			expectedError: service.ErrExpiredCredentials{
+				Message: (&ssocreds.InvalidTokenError{}).Error(),
+			},
+		},
+
+		{
+			test: "clock skew",
+			STSError: &smithy.GenericAPIError{
+				Code:    "SignatureDoesNotMatch",
+				Message: "Signature expired: 20220101T000000Z is now earlier than 20220101T001500Z",
+			},
+			expectedError: service.ErrClockSkew{
+				Code:    "SignatureDoesNotMatch",
+				Message: "Signature expired: 20220101T000000Z is now earlier than 20220101T001500Z",
+			},
+		},
+
+		{
+			test:          "unknown error",
+			STSError:      errors.New("UnknownError"),
+			expectedError: errors.New("UnknownError"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			cloud := newFakeCloud(t)
+			cloud.STS.FailNext("GetCallerIdentity", tc.STSError)
+
+			AWSService := cloud.AWSService()
+			err := AWSService.VerifyCredentials(context.Background())
+
+			if !reflect.DeepEqual(err, tc.expectedError) {
+				t.Fatalf("expected error to equal '%+v', got '%+v'", tc.expectedError, err)
+			}
+
+			if AWSService.CallerIdentity() != nil {
+				t.Fatalf("expected no caller identity, got '%+v'", AWSService.CallerIdentity())
+			}
+		})
+	}
+}
+
+func TestCreateDevEnvTagsResourcesWithCallerIdentity(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cluster := createClusterInFakeCloud(t, cloud)
+	recodeCLI := cloud.AWSService()
+
+	untaggedDevEnv, untaggedDevEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+	untaggedInstance, _ := cloud.EC2.InstanceByID(untaggedDevEnvInfra.Instance.ID)
+
+	if _, ok := tagValue(untaggedInstance.Tags, infrastructure.OwnerARNTagKey); ok {
+		t.Fatalf("expected no owner tag before verification, got '%+v'", untaggedInstance.Tags)
+	}
+
+	err := recodeCLI.RemoveDevEnv(context.Background(), &fakes.Stepper{}, &entities.Config{}, cluster, untaggedDevEnv)
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	err = recodeCLI.VerifyCredentials(context.Background())
+
+	if err != nil {
+		t.Fatalf("expected no error, got '%+v'", err)
+	}
+
+	_, devEnvInfra := createDevEnvInFakeCloud(t, recodeCLI, cluster)
+	instance, _ := cloud.EC2.InstanceByID(devEnvInfra.Instance.ID)
+
+	expectedTags := map[string]string{
+		"Name":                              "recode-recode-sh-api-instance",
+		infrastructure.OwnerAccountIDTagKey: "123456789012",
+		infrastructure.OwnerARNTagKey:       "arn:aws:iam::123456789012:user/recode",
+	}
+
+	for key, expectedValue := range expectedTags {
+		if value, _ := tagValue(instance.Tags, key); value != expectedValue {
+			t.Fatalf("expected tag '%s' to equal '%s', got '%+v'", key, expectedValue, instance.Tags)
+		}
+	}
+}
+
+func tagValue(tags []types.Tag, key string) (string, bool) {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key {
+			return aws.ToString(tag.Value), true
+		}
+	}
+
+	return "", false
+}
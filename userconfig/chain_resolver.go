@@ -0,0 +1,202 @@
+package userconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrMissingRegion represents the error returned
+	// when none of the chained resolvers resolves a region.
+	ErrMissingRegion = errors.New("ErrMissingRegion")
+
+	// ErrConfigOverridden represents the reason returned when
+	// the fields found by a chained resolver were already
+	// resolved by a resolver with a higher precedence.
+	ErrConfigOverridden = errors.New("ErrConfigOverridden")
+)
+
+// Resolver represents the interface
+// implemented by the user config resolvers.
+type Resolver interface {
+	Resolve() (*Config, error)
+}
+
+// PartialResolver represents the interface implemented by the resolvers
+// that could resolve a part of the config (eg: a region set in environment
+// without credentials). Used by the ChainResolver to merge configs.
+type PartialResolver interface {
+	Resolver
+
+	// ResolvePartial resolves the fields found without
+	// requiring both the credentials and the region.
+	ResolvePartial() (*Config, error)
+
+	// Source describes where the resolver looks for config
+	// (eg: "environment variables").
+	Source() string
+}
+
+// SkippedResolver represents a resolver
+// that didn't contribute to the resolved config.
+type SkippedResolver struct {
+	// Source describes the skipped resolver.
+	Source string
+
+	// Reason represents the error returned by the resolver
+	// (ErrMissingConfig if the resolver found nothing and
+	// ErrConfigOverridden if its fields were already resolved).
+	Reason error
+}
+
+// Provenance describes which resolver produced
+// each field of the config resolved by the ChainResolver.
+type Provenance struct {
+	// Credentials represents the source of the credentials
+	// (access key + secret set, AWS SSO settings, credential process
+	// and roles to assume).
+	Credentials string
+
+	// SessionToken represents the source of the
+	// session token (empty if no session token was resolved).
+	SessionToken string
+
+	// Region represents the source of the region.
+	Region string
+
+	// Skipped lists the resolvers that were skipped, in order.
+	Skipped []SkippedResolver
+}
+
+// ChainResolver resolves the AWS account
+// configuration using a list of resolvers.
+type ChainResolver struct {
+	resolvers []Resolver
+}
+
+// NewChainResolver constructs the ChainResolver struct.
+// The resolvers are ordered from the highest to the lowest precedence.
+func NewChainResolver(resolvers ...Resolver) ChainResolver {
+	return ChainResolver{
+		resolvers: resolvers,
+	}
+}
+
+// Resolve retrieves the AWS account configuration
+// using the chained resolvers (see ResolveWithProvenance).
+func (c ChainResolver) Resolve() (*Config, error) {
+	resolvedConfig, _, err := c.ResolveWithProvenance()
+	return resolvedConfig, err
+}
+
+// ResolveWithProvenance retrieves the AWS account configuration
+// using the chained resolvers and describes which resolver
+// produced each field.
+//
+// The credentials and the region are resolved independently:
+// each one is taken from the first resolver that resolves it.
+// As a result, a region set in environment could be used
+// with credentials found in config files.
+//
+// The resolvers that implement PartialResolver could contribute
+// a part of the config. The other ones contribute only if they
+// resolve a complete config. A resolver that returns an error
+// is skipped entirely. The resolvers coming after the ones that
+// resolved the config are not run.
+//
+// The provenance is returned even if an error is returned.
+func (c ChainResolver) ResolveWithProvenance() (*Config, Provenance, error) {
+	provenance := Provenance{}
+
+	var credentialsConfig *Config
+	resolvedRegion := ""
+
+	for _, resolver := range c.resolvers {
+		if credentialsConfig != nil && len(resolvedRegion) > 0 {
+			break
+		}
+
+		source := resolverSource(resolver)
+		resolvedConfig, err := resolvePartial(resolver)
+
+		if err == nil && resolvedConfig == nil {
+			err = ErrMissingConfig
+		}
+
+		if err != nil {
+			provenance.Skipped = append(provenance.Skipped, SkippedResolver{
+				Source: source,
+				Reason: err,
+			})
+
+			continue
+		}
+
+		contributed := false
+
+		if credentialsConfig == nil && resolvedConfig.Credentials.IsSet() {
+			credentialsConfig = resolvedConfig
+			contributed = true
+
+			provenance.Credentials = source
+
+			if len(resolvedConfig.Credentials.SessionToken) > 0 {
+				provenance.SessionToken = source
+			}
+		}
+
+		if len(resolvedRegion) == 0 && len(resolvedConfig.Region) > 0 {
+			resolvedRegion = resolvedConfig.Region
+			contributed = true
+
+			provenance.Region = source
+		}
+
+		if !contributed {
+			reason := ErrMissingConfig
+
+			if resolvedConfig.Credentials.IsSet() || len(resolvedConfig.Region) > 0 {
+				reason = ErrConfigOverridden
+			}
+
+			provenance.Skipped = append(provenance.Skipped, SkippedResolver{
+				Source: source,
+				Reason: reason,
+			})
+		}
+	}
+
+	if credentialsConfig == nil {
+		return nil, provenance, ErrMissingConfig
+	}
+
+	if len(resolvedRegion) == 0 {
+		return nil, provenance, ErrMissingRegion
+	}
+
+	resolvedConfig := *credentialsConfig
+	resolvedConfig.Region = resolvedRegion
+
+	return &resolvedConfig, provenance, nil
+}
+
+func resolvePartial(resolver Resolver) (*Config, error) {
+	if partialResolver, ok := resolver.(PartialResolver); ok {
+		return partialResolver.ResolvePartial()
+	}
+
+	return resolver.Resolve()
+}
+
+func resolverSource(resolver Resolver) string {
+	if partialResolver, ok := resolver.(PartialResolver); ok {
+		return partialResolver.Source()
+	}
+
+	return fmt.Sprintf("%T", resolver)
+}
+
+var (
+	_ PartialResolver = EnvVarsResolver{}
+	_ PartialResolver = FilesResolver{}
+)
@@ -0,0 +1,172 @@
+package userconfig_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/golang/mock/gomock"
+	"github.com/recode-sh/aws-cloud-provider/mocks"
+	"github.com/recode-sh/aws-cloud-provider/userconfig"
+)
+
+func TestChainResolving(t *testing.T) {
+	envSource := "environment variables"
+	filesSource := `config files (profile "default")`
+
+	testCases := []struct {
+		test               string
+		envVars            map[string]string
+		profileInFiles     config.SharedConfig
+		expectedError      error
+		expectedConfig     *userconfig.Config
+		expectedProvenance userconfig.Provenance
+	}{
+		{
+			test: "config in env",
+			envVars: map[string]string{
+				userconfig.AWSAccessKeyIDEnvVar:     "a",
+				userconfig.AWSSecretAccessKeyEnvVar: "b",
+				userconfig.AWSRegionEnvVar:          "c",
+			},
+			expectedConfig: userconfig.NewConfig("a", "b", "c"),
+			expectedProvenance: userconfig.Provenance{
+				Credentials: envSource,
+				Region:      envSource,
+			},
+		},
+
+		{
+			test: "region in env and keys in files",
+			envVars: map[string]string{
+				userconfig.AWSRegionEnvVar: "a",
+			},
+			profileInFiles: config.SharedConfig{
+				Credentials: aws.Credentials{AccessKeyID: "b", SecretAccessKey: "c", SessionToken: "d"},
+				Region:      "e",
+			},
+			expectedConfig: newConfigWithSessionToken("b", "c", "d", "a"),
+			expectedProvenance: userconfig.Provenance{
+				Credentials:  filesSource,
+				SessionToken: filesSource,
+				Region:       envSource,
+			},
+		},
+
+		{
+			test: "partial keys in env",
+			envVars: map[string]string{
+				userconfig.AWSAccessKeyIDEnvVar: "a",
+				userconfig.AWSRegionEnvVar:      "b",
+			},
+			profileInFiles: config.SharedConfig{
+				Credentials: aws.Credentials{AccessKeyID: "c", SecretAccessKey: "d"},
+				Region:      "e",
+			},
+			expectedConfig: userconfig.NewConfig("c", "d", "e"),
+			expectedProvenance: userconfig.Provenance{
+				Credentials: filesSource,
+				Region:      filesSource,
+				Skipped: []userconfig.SkippedResolver{
+					{Source: envSource, Reason: userconfig.ErrMissingSecretInEnv},
+				},
+			},
+		},
+
+		{
+			test: "keys in env and region in files",
+			envVars: map[string]string{
+				userconfig.AWSAccessKeyIDEnvVar:     "a",
+				userconfig.AWSSecretAccessKeyEnvVar: "b",
+			},
+			profileInFiles: config.SharedConfig{
+				Credentials: aws.Credentials{AccessKeyID: "c", SecretAccessKey: "d"},
+				Region:      "e",
+			},
+			expectedConfig: userconfig.NewConfig("a", "b", "e"),
+			expectedProvenance: userconfig.Provenance{
+				Credentials: envSource,
+				Region:      filesSource,
+			},
+		},
+
+		{
+			test: "missing region",
+			profileInFiles: config.SharedConfig{
+				Credentials: aws.Credentials{AccessKeyID: "a", SecretAccessKey: "b"},
+			},
+			expectedError: userconfig.ErrMissingRegion,
+			expectedProvenance: userconfig.Provenance{
+				Credentials: filesSource,
+				Skipped: []userconfig.SkippedResolver{
+					{Source: envSource, Reason: userconfig.ErrMissingConfig},
+				},
+			},
+		},
+
+		{
+			test:          "no config",
+			expectedError: userconfig.ErrMissingConfig,
+			expectedProvenance: userconfig.Provenance{
+				Skipped: []userconfig.SkippedResolver{
+					{Source: envSource, Reason: userconfig.ErrMissingConfig},
+					{Source: filesSource, Reason: userconfig.ErrMissingConfig},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.test, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			envVarsGetterMock := mocks.NewUserConfigEnvVarsGetter(mockCtrl)
+			envVarsGetterMock.EXPECT().Get(gomock.Any()).DoAndReturn(func(name string) string {
+				return tc.envVars[name]
+			}).AnyTimes()
+
+			profileLoaderMock := mocks.NewUserConfigProfileLoader(mockCtrl)
+			profileLoaderMock.
+				EXPECT().
+				Load(userconfig.AWSConfigFileDefaultProfile, "", "").
+				Return(tc.profileInFiles, nil).
+				AnyTimes()
+
+			resolver := userconfig.NewChainResolver(
+				userconfig.NewEnvVarsResolver(
+					envVarsGetterMock,
+					userconfig.EnvVarsResolverOpts{},
+				),
+				userconfig.NewFilesResolver(
+					profileLoaderMock,
+					userconfig.FilesResolverOpts{},
+				),
+			)
+
+			resolvedConfig, provenance, err := resolver.ResolveWithProvenance()
+
+			if tc.expectedError == nil && err != nil {
+				t.Fatalf("expected no error, got '%+v'", err)
+			}
+
+			if tc.expectedError != nil && !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected error to equal '%+v', got '%+v'", tc.expectedError, err)
+			}
+
+			if tc.expectedConfig != nil && !reflect.DeepEqual(*resolvedConfig, *tc.expectedConfig) {
+				t.Fatalf("expected config to equal '%+v', got '%+v'", *tc.expectedConfig, *resolvedConfig)
+			}
+
+			if tc.expectedConfig == nil && resolvedConfig != nil {
+				t.Fatalf("expected no config, got '%+v'", *resolvedConfig)
+			}
+
+			if !reflect.DeepEqual(provenance, tc.expectedProvenance) {
+				t.Fatalf("expected provenance to equal '%+v', got '%+v'", tc.expectedProvenance, provenance)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package userconfig
 
+import "time"
+
 // Credentials represents the AWS credentials resolved from user config.
 type Credentials struct {
 	// AccessKeyID represents the access key.
@@ -8,10 +10,25 @@ type Credentials struct {
 	// SecretAccessKey represents the secret associated with the access key.
 	SecretAccessKey string
 
-	// SessionToken represents an AWS session token that
-	// could replace the access key + secret set.
-	// Currently not supported.
+	// SessionToken represents the session token associated
+	// with temporary credentials (eg: issued by STS).
 	SessionToken string
+
+	// SSO represents the AWS SSO settings used to retrieve
+	// temporary credentials instead of the access key + secret set.
+	SSO SSOCredentials
+
+	// CredentialProcess represents the command run to retrieve
+	// temporary credentials instead of the access key + secret set
+	// ("credential_process" setting). The command must output
+	// the credentials in the JSON format expected by the AWS CLI.
+	CredentialProcess string
+
+	// AssumeRoles represents the roles assumed using the credentials above.
+	// The first role is assumed with the access key + secret set (or the
+	// AWS SSO / credential process credentials) and each following role is assumed with the
+	// credentials of the previous one. The last role is used by Recode.
+	AssumeRoles []AssumeRole
 }
 
 // HasKeys is an helper method used to check
@@ -20,13 +37,99 @@ func (u Credentials) HasKeys() bool {
 	return len(u.AccessKeyID) > 0 && len(u.SecretAccessKey) > 0
 }
 
+// AssumeRole represents a role assumed via STS (see Credentials.AssumeRoles).
+// It is resolved from the "role_arn" setting of a configuration profile.
+type AssumeRole struct {
+	// Profile represents the configuration
+	// profile where the role is defined.
+	Profile string
+
+	// RoleARN represents the ARN of the role to assume.
+	RoleARN string
+
+	// ExternalID represents the external ID passed when assuming the role.
+	ExternalID string
+
+	// RoleSessionName represents the name of the role session.
+	// Default to a name generated by the SDK if not set.
+	RoleSessionName string
+
+	// Duration represents the duration of the role session.
+	// Default to the one chosen by the SDK (15 minutes) if not set.
+	Duration time.Duration
+}
+
+// IsSet is an helper method used to check that the Credentials
+// struct contains a source of credentials (access key + secret set,
+// AWS SSO settings or credential process).
+func (u Credentials) IsSet() bool {
+	return u.HasKeys() || u.SSO.IsSet() || len(u.CredentialProcess) > 0
+}
+
+// SSOCredentials represents the AWS SSO settings of a configuration profile
+// ("sso_*" settings). The credentials are retrieved using the SSO token
+// cached by the AWS CLI (see "aws sso login").
+type SSOCredentials struct {
+	// StartURL represents the URL of the AWS SSO user portal.
+	StartURL string
+
+	// Region represents the region of the AWS SSO user portal.
+	Region string
+
+	// AccountID represents the AWS account assigned to the user.
+	AccountID string
+
+	// RoleName represents the role assigned to the user.
+	RoleName string
+}
+
+// IsSet is an helper method used to check
+// that all the AWS SSO settings are set.
+func (s SSOCredentials) IsSet() bool {
+	return len(s.StartURL) > 0 &&
+		len(s.Region) > 0 &&
+		len(s.AccountID) > 0 &&
+		len(s.RoleName) > 0
+}
+
+const (
+	// ConfigStorageBackendDynamoDB stores Recode's
+	// config in a DynamoDB table (default).
+	ConfigStorageBackendDynamoDB = "dynamodb"
+
+	// ConfigStorageBackendS3 stores Recode's
+	// config in an S3 bucket.
+	ConfigStorageBackendS3 = "s3"
+
+	// ConfigStorageBackendFile stores Recode's config in a local
+	// directory. Used to test Recode without cloud state.
+	ConfigStorageBackendFile = "file"
+)
+
+// ConfigStorage represents where Recode's config is stored.
+type ConfigStorage struct {
+	// Backend represents the storage backend.
+	// Default to ConfigStorageBackendDynamoDB if not set.
+	Backend string
+
+	// S3Bucket represents the bucket used by the S3 backend.
+	S3Bucket string
+
+	// FileDirPath represents the directory used by the file backend.
+	FileDirPath string
+}
+
 // Config represents the resolved user config.
 type Config struct {
-	// Credentials represents the resolved credentials (access key + secret).
+	// Credentials represents the resolved credentials
+	// (access key + secret with an optional session token or AWS SSO settings).
 	Credentials Credentials
 
 	// Region represents the resolved region.
 	Region string
+
+	// ConfigStorage represents where Recode's config is stored.
+	ConfigStorage ConfigStorage
 }
 
 // NewConfig constructs a new resolved user config.
@@ -28,6 +28,11 @@ const (
 	// that the resolver will look for when resolving the AWS secret access key.
 	AWSSecretAccessKeyEnvVar = "AWS_SECRET_ACCESS_KEY"
 
+	// AWSSessionTokenEnvVar represents the environment variable name
+	// that the resolver will look for when resolving the AWS session token
+	// (only set for temporary credentials).
+	AWSSessionTokenEnvVar = "AWS_SESSION_TOKEN"
+
 	// AWSRegionEnvVar represents the environment variable name
 	// that the resolver will look for when resolving the AWS region.
 	AWSRegionEnvVar = "AWS_REGION"
@@ -46,6 +51,10 @@ type EnvVarsResolverOpts struct {
 	// Region specifies which region will be used in the resulting config.
 	// Default to the one found in environment if not set.
 	Region string
+
+	// ConfigStorage specifies where Recode's config is stored.
+	// Default to a DynamoDB table if not set.
+	ConfigStorage ConfigStorage
 }
 
 // EnvVarsResolver retrieves the AWS account
@@ -73,29 +82,45 @@ func NewEnvVarsResolver(
 // The Region option takes precedence over the one
 // found in environment.
 //
+// The session token is optional and only
+// used with temporary credentials.
+//
 // Partial configurations return an adequate errror.
 //
 // Env vars are retrieved via the EnvVarsGetter interface
 // passed as constructor argument.
 func (e EnvVarsResolver) Resolve() (*Config, error) {
-	resolvedConfig := NewConfig(
-		e.envVars.Get(AWSAccessKeyIDEnvVar),
-		e.envVars.Get(AWSSecretAccessKeyEnvVar),
-		e.resolveRegion(e.envVars.Get(AWSRegionEnvVar)),
-	)
-
-	if resolvedConfig.Credentials.HasKeys() &&
-		len(resolvedConfig.Region) > 0 {
+	resolvedConfig, err := e.ResolvePartial()
 
-		return resolvedConfig, nil
+	if err != nil {
+		return nil, err
 	}
 
-	if resolvedConfig.Credentials.HasKeys() &&
-		len(resolvedConfig.Region) == 0 {
+	if !resolvedConfig.Credentials.HasKeys() {
+		return nil, ErrMissingConfig
+	}
 
+	if len(resolvedConfig.Region) == 0 {
 		return nil, ErrMissingRegionInEnv
 	}
 
+	return resolvedConfig, nil
+}
+
+// ResolvePartial retrieves the AWS account configuration
+// from environment variables without requiring both the
+// credentials and the region (see ChainResolver).
+//
+// A partial access key + secret set returns an adequate error.
+func (e EnvVarsResolver) ResolvePartial() (*Config, error) {
+	resolvedConfig := NewConfig(
+		e.envVars.Get(AWSAccessKeyIDEnvVar),
+		e.envVars.Get(AWSSecretAccessKeyEnvVar),
+		e.resolveRegion(e.envVars.Get(AWSRegionEnvVar)),
+	)
+
+	resolvedConfig.ConfigStorage = e.opts.ConfigStorage
+
 	if len(resolvedConfig.Credentials.AccessKeyID) == 0 &&
 		len(resolvedConfig.Credentials.SecretAccessKey) > 0 {
 
@@ -108,7 +133,17 @@ func (e EnvVarsResolver) Resolve() (*Config, error) {
 		return nil, ErrMissingSecretInEnv
 	}
 
-	return nil, ErrMissingConfig
+	if resolvedConfig.Credentials.HasKeys() {
+		resolvedConfig.Credentials.SessionToken = e.envVars.Get(AWSSessionTokenEnvVar)
+	}
+
+	return resolvedConfig, nil
+}
+
+// Source describes where the resolver
+// looks for config (see ChainResolver).
+func (EnvVarsResolver) Source() string {
+	return "environment variables"
 }
 
 func (e EnvVarsResolver) resolveRegion(regionInEnvVars string) string {
@@ -2,6 +2,7 @@ package userconfig_test
 
 import (
 	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -14,6 +15,7 @@ func TestEnvVarsResolving(t *testing.T) {
 		test                  string
 		accessKeyIDEnvVar     string
 		secretAccessKeyEnvVar string
+		sessionTokenEnvVar    string
 		regionEnvVar          string
 		regionOpts            string
 		expectedError         error
@@ -38,6 +40,24 @@ func TestEnvVarsResolving(t *testing.T) {
 			expectedError:         nil,
 		},
 
+		{
+			test:                  "valid with session token",
+			accessKeyIDEnvVar:     "a",
+			secretAccessKeyEnvVar: "b",
+			sessionTokenEnvVar:    "c",
+			regionEnvVar:          "d",
+			expectedConfig:        newConfigWithSessionToken("a", "b", "c", "d"),
+			expectedError:         nil,
+		},
+
+		{
+			test:               "session token without access key and secret",
+			sessionTokenEnvVar: "a",
+			regionEnvVar:       "b",
+			expectedError:      userconfig.ErrMissingConfig,
+			expectedConfig:     nil,
+		},
+
 		{
 			test:                  "missing region with region opts",
 			accessKeyIDEnvVar:     "a",
@@ -107,6 +127,7 @@ func TestEnvVarsResolving(t *testing.T) {
 			envVarsGetterMock := mocks.NewUserConfigEnvVarsGetter(mockCtrl)
 			envVarsGetterMock.EXPECT().Get(userconfig.AWSAccessKeyIDEnvVar).Return(tc.accessKeyIDEnvVar).AnyTimes()
 			envVarsGetterMock.EXPECT().Get(userconfig.AWSSecretAccessKeyEnvVar).Return(tc.secretAccessKeyEnvVar).AnyTimes()
+			envVarsGetterMock.EXPECT().Get(userconfig.AWSSessionTokenEnvVar).Return(tc.sessionTokenEnvVar).AnyTimes()
 			envVarsGetterMock.EXPECT().Get(userconfig.AWSRegionEnvVar).Return(tc.regionEnvVar).AnyTimes()
 
 			resolver := userconfig.NewEnvVarsResolver(
@@ -126,7 +147,7 @@ func TestEnvVarsResolving(t *testing.T) {
 				t.Fatalf("expected error to equal '%+v', got '%+v'", tc.expectedError, err)
 			}
 
-			if tc.expectedConfig != nil && *resolvedConfig != *tc.expectedConfig {
+			if tc.expectedConfig != nil && !reflect.DeepEqual(*resolvedConfig, *tc.expectedConfig) {
 				t.Fatalf("expected config to equal '%+v', got '%+v'", *tc.expectedConfig, *resolvedConfig)
 			}
 
@@ -136,3 +157,16 @@ func TestEnvVarsResolving(t *testing.T) {
 		})
 	}
 }
+
+func newConfigWithSessionToken(
+	accessKeyID string,
+	secretAccessKey string,
+	sessionToken string,
+	region string,
+) *userconfig.Config {
+
+	config := userconfig.NewConfig(accessKeyID, secretAccessKey, region)
+	config.Credentials.SessionToken = sessionToken
+
+	return config
+}
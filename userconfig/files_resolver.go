@@ -2,6 +2,7 @@ package userconfig
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 )
@@ -25,6 +26,75 @@ func (ErrProfileNotFound) Error() string {
 	return "ErrProfileNotFound"
 }
 
+// ErrMissingRoleARN represents the error returned when a profile
+// sets a source of credentials for a role (eg: "source_profile")
+// without the "role_arn" setting.
+type ErrMissingRoleARN struct {
+	Profile string
+	Setting string
+}
+
+func (ErrMissingRoleARN) Error() string {
+	return "ErrMissingRoleARN"
+}
+
+// ErrSourceProfileNotFound represents the error returned
+// when the source profile of a role was not found.
+type ErrSourceProfileNotFound struct {
+	RoleARN       string
+	SourceProfile string
+}
+
+func (ErrSourceProfileNotFound) Error() string {
+	return "ErrSourceProfileNotFound"
+}
+
+// ErrMissingCredentialsInSourceProfile represents the error returned
+// when the source profile of a role doesn't contain credentials.
+type ErrMissingCredentialsInSourceProfile struct {
+	RoleARN       string
+	SourceProfile string
+}
+
+func (ErrMissingCredentialsInSourceProfile) Error() string {
+	return "ErrMissingCredentialsInSourceProfile"
+}
+
+// ErrSourceProfileCycle represents the error returned when the
+// "source_profile" settings form a cycle. The source profile
+// is the first profile of the cycle used as source of the role.
+type ErrSourceProfileCycle struct {
+	RoleARN       string
+	SourceProfile string
+}
+
+func (ErrSourceProfileCycle) Error() string {
+	return "ErrSourceProfileCycle"
+}
+
+// ErrUnsupportedMFA represents the error returned when a role
+// requires an MFA token ("mfa_serial" setting).
+type ErrUnsupportedMFA struct {
+	Profile string
+	RoleARN string
+}
+
+func (ErrUnsupportedMFA) Error() string {
+	return "ErrUnsupportedMFA"
+}
+
+// ErrUnsupportedCredentialsSetting represents the error returned when the
+// credentials of a profile are retrieved via an unsupported setting
+// (eg: "credential_source").
+type ErrUnsupportedCredentialsSetting struct {
+	Profile string
+	Setting string
+}
+
+func (ErrUnsupportedCredentialsSetting) Error() string {
+	return "ErrUnsupportedCredentialsSetting"
+}
+
 const (
 	// AWSConfigFileDefaultProfile represents the configuration profile
 	// that will be loaded by default if the Profile option is not set.
@@ -58,6 +128,10 @@ type FilesResolverOpts struct {
 
 	// ConfigFilePath specifies the file path of the config file.
 	ConfigFilePath string
+
+	// ConfigStorage specifies where Recode's config is stored.
+	// Default to a DynamoDB table if not set.
+	ConfigStorage ConfigStorage
 }
 
 // FilesResolver retrieves the AWS account
@@ -90,9 +164,44 @@ func NewFilesResolver(
 //
 // The Region option takes precedence over the region found in config files.
 //
+// Profiles without static keys are resolved if they contain
+// the "sso_*" settings. In this case, the credentials are retrieved
+// later using the SSO token cached by the AWS CLI. The same goes
+// for the "credential_process" setting: the process is run
+// later each time the credentials need to be refreshed.
+//
+// The "source_profile" settings are followed to resolve the roles
+// to assume (see Credentials.AssumeRoles). Invalid chains return
+// an error that contains the role and the source profile at fault.
+//
 // Config files are loaded via the ProfileLoader interface
 // passed as constructor argument.
 func (f FilesResolver) Resolve() (*Config, error) {
+	resolvedConfig, err := f.ResolvePartial()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !resolvedConfig.Credentials.IsSet() {
+		// the config file is set but
+		// the credentials one is missing
+		return nil, ErrMissingConfig
+	}
+
+	if len(resolvedConfig.Region) == 0 {
+		return nil, ErrMissingRegionInFiles
+	}
+
+	return resolvedConfig, nil
+}
+
+// ResolvePartial retrieves the AWS account configuration from
+// config files without requiring both the credentials and
+// the region (see ChainResolver).
+//
+// Invalid profiles return an adequate error.
+func (f FilesResolver) ResolvePartial() (*Config, error) {
 	loadedProfile, err := f.profileLoader.Load(
 		f.resolveProfile(),
 		f.opts.CredentialsFilePath,
@@ -100,6 +209,24 @@ func (f FilesResolver) Resolve() (*Config, error) {
 	)
 
 	if err != nil {
+		// Must be checked first given that it wraps
+		// a "profile not exist" error when the
+		// source profile of a role doesn't exist
+		var assumeRoleErr config.SharedConfigAssumeRoleError
+
+		if errors.As(err, &assumeRoleErr) {
+			return nil, f.resolveAssumeRoleError(assumeRoleErr)
+		}
+
+		var requiresARNErr config.CredentialRequiresARNError
+
+		if errors.As(err, &requiresARNErr) {
+			return nil, ErrMissingRoleARN{
+				Profile: requiresARNErr.Profile,
+				Setting: requiresARNErr.Type,
+			}
+		}
+
 		if errors.As(err, &config.SharedConfigProfileNotExistError{}) {
 			if len(f.opts.Profile) > 0 {
 				return nil, ErrProfileNotFound{
@@ -115,25 +242,176 @@ func (f FilesResolver) Resolve() (*Config, error) {
 		return nil, err
 	}
 
-	if !loadedProfile.Credentials.HasKeys() {
-		// the config file is set but
-		// the credentials one is missing
-		return nil, ErrMissingConfig
+	resolvedCredentials, err := f.resolveCredentials(loadedProfile)
+
+	if err != nil {
+		return nil, err
 	}
 
-	resolvedRegion := f.resolveRegion(loadedProfile.Region)
+	return &Config{
+		Credentials:   resolvedCredentials,
+		Region:        f.resolveRegion(loadedProfile.Region),
+		ConfigStorage: f.opts.ConfigStorage,
+	}, nil
+}
 
-	if len(resolvedRegion) == 0 {
-		return nil, ErrMissingRegionInFiles
+// Source describes where the resolver
+// looks for config (see ChainResolver).
+func (f FilesResolver) Source() string {
+	return fmt.Sprintf("config files (profile \"%s\")", f.resolveProfile())
+}
+
+// resolveCredentials follows the "source_profile" chain of the
+// loaded profile until a profile with static keys or AWS SSO
+// settings is found. The roles found along the way are returned
+// in the order they need to be assumed.
+func (f FilesResolver) resolveCredentials(
+	loadedProfile config.SharedConfig,
+) (Credentials, error) {
+
+	assumeRoles := []AssumeRole{}
+	rolesProfiles := map[string]bool{}
+
+	currentProfile := &loadedProfile
+
+	// A profile could use itself as source profile to assume a role with its
+	// own keys. In this case, the source profile is returned without role.
+	for len(currentProfile.RoleARN) > 0 && currentProfile.Source != nil {
+		if rolesProfiles[currentProfile.Profile] {
+			return Credentials{}, ErrSourceProfileCycle{
+				RoleARN:       currentProfile.RoleARN,
+				SourceProfile: currentProfile.Profile,
+			}
+		}
+
+		if len(currentProfile.MFASerial) > 0 {
+			return Credentials{}, ErrUnsupportedMFA{
+				Profile: currentProfile.Profile,
+				RoleARN: currentProfile.RoleARN,
+			}
+		}
+
+		rolesProfiles[currentProfile.Profile] = true
+
+		assumeRole := AssumeRole{
+			Profile:         currentProfile.Profile,
+			RoleARN:         currentProfile.RoleARN,
+			ExternalID:      currentProfile.ExternalID,
+			RoleSessionName: currentProfile.RoleSessionName,
+		}
+
+		if currentProfile.RoleDurationSeconds != nil {
+			assumeRole.Duration = *currentProfile.RoleDurationSeconds
+		}
+
+		// The roles are assumed from the
+		// source profile to the loaded one
+		assumeRoles = append([]AssumeRole{assumeRole}, assumeRoles...)
+
+		currentProfile = currentProfile.Source
+	}
+
+	resolvedCredentials := Credentials{}
+
+	resolvedSSOCredentials := SSOCredentials{
+		StartURL:  currentProfile.SSOStartURL,
+		Region:    currentProfile.SSORegion,
+		AccountID: currentProfile.SSOAccountID,
+		RoleName:  currentProfile.SSORoleName,
+	}
+
+	// Same precedence than the SDK
+	if currentProfile.Credentials.HasKeys() {
+		resolvedCredentials.AccessKeyID = currentProfile.Credentials.AccessKeyID
+		resolvedCredentials.SecretAccessKey = currentProfile.Credentials.SecretAccessKey
+		resolvedCredentials.SessionToken = currentProfile.Credentials.SessionToken
+	} else if resolvedSSOCredentials.IsSet() {
+		resolvedCredentials.SSO = resolvedSSOCredentials
+	} else {
+		resolvedCredentials.CredentialProcess = currentProfile.CredentialProcess
+	}
+
+	if !resolvedCredentials.HasKeys() &&
+		!resolvedCredentials.SSO.IsSet() &&
+		len(resolvedCredentials.CredentialProcess) == 0 {
+
+		if unsupportedSetting := unsupportedCredentialsSetting(*currentProfile); len(unsupportedSetting) > 0 {
+			return Credentials{}, ErrUnsupportedCredentialsSetting{
+				Profile: currentProfile.Profile,
+				Setting: unsupportedSetting,
+			}
+		}
+
+		if len(assumeRoles) > 0 {
+			return Credentials{}, ErrMissingCredentialsInSourceProfile{
+				RoleARN:       assumeRoles[0].RoleARN,
+				SourceProfile: currentProfile.Profile,
+			}
+		}
+
+		return Credentials{}, nil
+	}
+
+	if len(assumeRoles) > 0 {
+		resolvedCredentials.AssumeRoles = assumeRoles
 	}
 
-	resolvedConfig := NewConfig(
-		loadedProfile.Credentials.AccessKeyID,
-		loadedProfile.Credentials.SecretAccessKey,
-		resolvedRegion,
+	return resolvedCredentials, nil
+}
+
+// resolveAssumeRoleError converts the error returned by the SDK when the
+// source profile of a role is invalid. The SDK returns the same error
+// for a source profile without credentials and for a "source_profile"
+// cycle so the source profile is loaded alone to tell them apart:
+// a source profile that is part of a cycle fails the same way.
+func (f FilesResolver) resolveAssumeRoleError(
+	assumeRoleErr config.SharedConfigAssumeRoleError,
+) error {
+
+	if errors.As(assumeRoleErr.Err, &config.SharedConfigProfileNotExistError{}) {
+		return ErrSourceProfileNotFound{
+			RoleARN:       assumeRoleErr.RoleARN,
+			SourceProfile: assumeRoleErr.Profile,
+		}
+	}
+
+	_, err := f.profileLoader.Load(
+		assumeRoleErr.Profile,
+		f.opts.CredentialsFilePath,
+		f.opts.ConfigFilePath,
 	)
 
-	return resolvedConfig, nil
+	var sourceAssumeRoleErr config.SharedConfigAssumeRoleError
+
+	if errors.As(err, &sourceAssumeRoleErr) &&
+		sourceAssumeRoleErr.Profile == assumeRoleErr.Profile &&
+		sourceAssumeRoleErr.Err == nil {
+
+		return ErrSourceProfileCycle{
+			RoleARN:       sourceAssumeRoleErr.RoleARN,
+			SourceProfile: sourceAssumeRoleErr.Profile,
+		}
+	}
+
+	return ErrMissingCredentialsInSourceProfile{
+		RoleARN:       assumeRoleErr.RoleARN,
+		SourceProfile: assumeRoleErr.Profile,
+	}
+}
+
+// unsupportedCredentialsSetting returns the name of the
+// credentials setting of the passed profile that cannot be resolved
+// (empty if none).
+func unsupportedCredentialsSetting(profile config.SharedConfig) string {
+	if len(profile.CredentialSource) > 0 {
+		return "credential_source"
+	}
+
+	if len(profile.WebIdentityTokenFile) > 0 {
+		return "web_identity_token_file"
+	}
+
+	return ""
 }
 
 func (f FilesResolver) resolveProfile() string {
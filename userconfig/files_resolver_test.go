@@ -2,8 +2,11 @@ package userconfig_test
 
 import (
 	"errors"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/golang/mock/gomock"
 	"github.com/recode-sh/aws-cloud-provider/mocks"
@@ -16,6 +19,7 @@ func TestFilesResolving(t *testing.T) {
 	testCases := []struct {
 		test                    string
 		configInFiles           *userconfig.Config
+		profileInFiles          *config.SharedConfig
 		regionOpts              string
 		profileOpts             string
 		credentialsFilePathOpts string
@@ -39,6 +43,194 @@ func TestFilesResolving(t *testing.T) {
 			expectedError:  nil,
 		},
 
+		{
+			test:           "valid with session token",
+			configInFiles:  newConfigWithSessionToken("a", "b", "c", "d"),
+			expectedConfig: newConfigWithSessionToken("a", "b", "c", "d"),
+			expectedError:  nil,
+		},
+
+		{
+			test:           "valid with SSO settings",
+			configInFiles:  newSSOConfig("https://a.awsapps.com/start", "b", "c", "d", "e"),
+			expectedConfig: newSSOConfig("https://a.awsapps.com/start", "b", "c", "d", "e"),
+			expectedError:  nil,
+		},
+
+		{
+			test:           "valid with SSO settings and region option",
+			configInFiles:  newSSOConfig("https://a.awsapps.com/start", "b", "c", "d", ""),
+			regionOpts:     "e",
+			expectedConfig: newSSOConfig("https://a.awsapps.com/start", "b", "c", "d", "e"),
+			expectedError:  nil,
+		},
+
+		{
+			test:           "SSO settings without region",
+			configInFiles:  newSSOConfig("https://a.awsapps.com/start", "b", "c", "d", ""),
+			expectedError:  userconfig.ErrMissingRegionInFiles,
+			expectedConfig: nil,
+		},
+
+		{
+			test: "valid with role",
+			profileInFiles: &config.SharedConfig{
+				Profile:             "a",
+				Region:              "b",
+				RoleARN:             "c",
+				ExternalID:          "d",
+				RoleSessionName:     "e",
+				RoleDurationSeconds: durationPtr(time.Hour),
+				SourceProfileName:   "f",
+				Source: &config.SharedConfig{
+					Profile:     "f",
+					Credentials: aws.Credentials{AccessKeyID: "g", SecretAccessKey: "h"},
+				},
+			},
+			expectedConfig: newConfigWithAssumeRoles(
+				userconfig.NewConfig("g", "h", "b"),
+				userconfig.AssumeRole{
+					Profile:         "a",
+					RoleARN:         "c",
+					ExternalID:      "d",
+					RoleSessionName: "e",
+					Duration:        time.Hour,
+				},
+			),
+			expectedError: nil,
+		},
+
+		{
+			test: "valid with role chain",
+			profileInFiles: &config.SharedConfig{
+				Profile:           "a",
+				Region:            "b",
+				RoleARN:           "c",
+				SourceProfileName: "d",
+				Source: &config.SharedConfig{
+					Profile:           "d",
+					RoleARN:           "e",
+					SourceProfileName: "f",
+					Source: &config.SharedConfig{
+						Profile:      "f",
+						SSOStartURL:  "https://g.awsapps.com/start",
+						SSORegion:    "h",
+						SSOAccountID: "i",
+						SSORoleName:  "j",
+					},
+				},
+			},
+			expectedConfig: newConfigWithAssumeRoles(
+				newSSOConfig("https://g.awsapps.com/start", "h", "i", "j", "b"),
+				userconfig.AssumeRole{Profile: "d", RoleARN: "e"},
+				userconfig.AssumeRole{Profile: "a", RoleARN: "c"},
+			),
+			expectedError: nil,
+		},
+
+		{
+			test: "valid with role using its own profile as source",
+			profileInFiles: &config.SharedConfig{
+				Profile:           "a",
+				Region:            "b",
+				RoleARN:           "c",
+				SourceProfileName: "a",
+				Source: &config.SharedConfig{
+					Profile:     "a",
+					Credentials: aws.Credentials{AccessKeyID: "d", SecretAccessKey: "e"},
+				},
+			},
+			expectedConfig: newConfigWithAssumeRoles(
+				userconfig.NewConfig("d", "e", "b"),
+				userconfig.AssumeRole{Profile: "a", RoleARN: "c"},
+			),
+			expectedError: nil,
+		},
+
+		{
+			test: "valid with credential process",
+			profileInFiles: &config.SharedConfig{
+				Profile:           "a",
+				Region:            "b",
+				CredentialProcess: "c",
+			},
+			expectedConfig: newCredentialProcessConfig("c", "b"),
+			expectedError:  nil,
+		},
+
+		{
+			test: "valid with role using credential process",
+			profileInFiles: &config.SharedConfig{
+				Profile:           "a",
+				Region:            "b",
+				RoleARN:           "c",
+				SourceProfileName: "d",
+				Source: &config.SharedConfig{
+					Profile:           "d",
+					CredentialProcess: "e",
+				},
+			},
+			expectedConfig: newConfigWithAssumeRoles(
+				newCredentialProcessConfig("e", "b"),
+				userconfig.AssumeRole{Profile: "a", RoleARN: "c"},
+			),
+			expectedError: nil,
+		},
+
+		{
+			test: "role with MFA",
+			profileInFiles: &config.SharedConfig{
+				Profile:           "a",
+				Region:            "b",
+				RoleARN:           "c",
+				MFASerial:         "d",
+				SourceProfileName: "e",
+				Source: &config.SharedConfig{
+					Profile:     "e",
+					Credentials: aws.Credentials{AccessKeyID: "f", SecretAccessKey: "g"},
+				},
+			},
+			expectedError:  userconfig.ErrUnsupportedMFA{},
+			expectedConfig: nil,
+		},
+
+		{
+			test: "role with credential source",
+			profileInFiles: &config.SharedConfig{
+				Profile:          "a",
+				Region:           "b",
+				RoleARN:          "c",
+				CredentialSource: "Ec2InstanceMetadata",
+			},
+			expectedError:  userconfig.ErrUnsupportedCredentialsSetting{},
+			expectedConfig: nil,
+		},
+
+		{
+			test:           "role with source profile cycle",
+			profileInFiles: newSourceProfileCycle(),
+			expectedError:  userconfig.ErrSourceProfileCycle{},
+			expectedConfig: nil,
+		},
+
+		{
+			test:                  "role without role ARN",
+			errorReturnedByLoader: config.CredentialRequiresARNError{Type: "source_profile", Profile: "a"},
+			expectedError:         userconfig.ErrMissingRoleARN{},
+			expectedConfig:        nil,
+		},
+
+		{
+			test: "role with missing source profile",
+			errorReturnedByLoader: config.SharedConfigAssumeRoleError{
+				RoleARN: "a",
+				Profile: "b",
+				Err:     config.SharedConfigProfileNotExistError{Profile: "b"},
+			},
+			expectedError:  userconfig.ErrSourceProfileNotFound{},
+			expectedConfig: nil,
+		},
+
 		{
 			test:           "missing region",
 			configInFiles:  userconfig.NewConfig("a", "b", ""),
@@ -95,9 +287,18 @@ func TestFilesResolving(t *testing.T) {
 			}
 
 			configAsReturnedByProfileLoader := config.SharedConfig{}
+			if tc.profileInFiles != nil {
+				configAsReturnedByProfileLoader = *tc.profileInFiles
+			}
+
 			if tc.configInFiles != nil {
 				configAsReturnedByProfileLoader.Credentials.AccessKeyID = tc.configInFiles.Credentials.AccessKeyID
 				configAsReturnedByProfileLoader.Credentials.SecretAccessKey = tc.configInFiles.Credentials.SecretAccessKey
+				configAsReturnedByProfileLoader.Credentials.SessionToken = tc.configInFiles.Credentials.SessionToken
+				configAsReturnedByProfileLoader.SSOStartURL = tc.configInFiles.Credentials.SSO.StartURL
+				configAsReturnedByProfileLoader.SSORegion = tc.configInFiles.Credentials.SSO.Region
+				configAsReturnedByProfileLoader.SSOAccountID = tc.configInFiles.Credentials.SSO.AccountID
+				configAsReturnedByProfileLoader.SSORoleName = tc.configInFiles.Credentials.SSO.RoleName
 				configAsReturnedByProfileLoader.Region = tc.configInFiles.Region
 			}
 
@@ -124,11 +325,12 @@ func TestFilesResolving(t *testing.T) {
 				t.Fatalf("expected no error, got '%+v'", err)
 			}
 
-			if tc.expectedError != nil && !errors.Is(err, tc.expectedError) && !errors.As(err, &tc.expectedError) {
+			if tc.expectedError != nil && !errors.Is(err, tc.expectedError) &&
+				reflect.TypeOf(err) != reflect.TypeOf(tc.expectedError) {
 				t.Fatalf("expected error to equal '%+v', got '%+v'", tc.expectedError, err)
 			}
 
-			if tc.expectedConfig != nil && *resolvedConfig != *tc.expectedConfig {
+			if tc.expectedConfig != nil && !reflect.DeepEqual(*resolvedConfig, *tc.expectedConfig) {
 				t.Fatalf("expected config to equal '%+v', got '%+v'", *tc.expectedConfig, *resolvedConfig)
 			}
 
@@ -138,3 +340,67 @@ func TestFilesResolving(t *testing.T) {
 		})
 	}
 }
+
+func newSSOConfig(
+	startURL string,
+	SSORegion string,
+	accountID string,
+	roleName string,
+	region string,
+) *userconfig.Config {
+
+	config := userconfig.NewConfig("", "", region)
+	config.Credentials.SSO = userconfig.SSOCredentials{
+		StartURL:  startURL,
+		Region:    SSORegion,
+		AccountID: accountID,
+		RoleName:  roleName,
+	}
+
+	return config
+}
+
+func newCredentialProcessConfig(
+	credentialProcess string,
+	region string,
+) *userconfig.Config {
+
+	config := userconfig.NewConfig("", "", region)
+	config.Credentials.CredentialProcess = credentialProcess
+
+	return config
+}
+
+func newConfigWithAssumeRoles(
+	config *userconfig.Config,
+	assumeRoles ...userconfig.AssumeRole,
+) *userconfig.Config {
+
+	config.Credentials.AssumeRoles = assumeRoles
+
+	return config
+}
+
+// newSourceProfileCycle returns a profile whose role chain loops back
+// on itself (the SDK never returns such a chain but custom loaders could).
+func newSourceProfileCycle() *config.SharedConfig {
+	profile := &config.SharedConfig{
+		Profile:           "a",
+		Region:            "b",
+		RoleARN:           "c",
+		SourceProfileName: "d",
+	}
+
+	profile.Source = &config.SharedConfig{
+		Profile:           "d",
+		RoleARN:           "e",
+		SourceProfileName: "a",
+		Source:            profile,
+	}
+
+	return profile
+}
+
+func durationPtr(duration time.Duration) *time.Duration {
+	return &duration
+}